@@ -0,0 +1,149 @@
+package lifx
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Aliases maps friendly names to device serials.
+// Unlike labels, which can be changed by anyone using the LIFX app,
+// aliases are under the control of the user, so scripts can rely on them.
+type Aliases map[string][6]byte
+
+// DefaultAliasesFile returns the path of the user's aliases file,
+// lifx/aliases in the user's configuration directory
+// (typically ~/.config/lifx/aliases).
+func DefaultAliasesFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lifx", "aliases"), nil
+}
+
+// LoadAliases reads an aliases file. See ParseAliases for the format.
+// A file that doesn't exist has no aliases, and is not an error.
+func LoadAliases(filename string) (Aliases, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Aliases{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a, err := ParseAliases(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return a, nil
+}
+
+// ParseAliases reads aliases, one per line, in the form
+//
+//	name = serial
+//
+// where serial is 12 hex digits, optionally separated by colons.
+// Names may contain spaces, and must be unique ignoring case.
+// Blank lines and lines starting with # are ignored.
+func ParseAliases(r io.Reader) (Aliases, error) {
+	a := make(Aliases)
+	folded := make(map[string]string) // lower case name => name
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, serial, ok := strings.Cut(line, "=")
+		name, serial = strings.TrimSpace(name), strings.TrimSpace(serial)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: want name = serial", n)
+		}
+		raw, err := hex.DecodeString(strings.ReplaceAll(serial, ":", ""))
+		if err != nil || len(raw) != 6 {
+			return nil, fmt.Errorf("line %d: bad serial %q", n, serial)
+		}
+		if prev, dup := folded[strings.ToLower(name)]; dup {
+			return nil, fmt.Errorf("line %d: alias %q duplicates %q", n, name, prev)
+		}
+		folded[strings.ToLower(name)] = name
+		a[name] = [6]byte(raw)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Lookup returns the serial for a name.
+// An exact match is preferred, but case is otherwise ignored.
+// ParseAliases rejects names that differ only in case, but if a map built
+// some other way has them, the first such name in sorted order wins.
+func (a Aliases) Lookup(name string) ([6]byte, bool) {
+	if serial, ok := a[name]; ok {
+		return serial, true
+	}
+	match, found := "", false
+	for n := range a {
+		if strings.EqualFold(n, name) && (!found || n < match) {
+			match, found = n, true
+		}
+	}
+	return a[match], found
+}
+
+// UnknownAliasError is returned by DeviceByAlias for names that aren't aliases.
+type UnknownAliasError struct {
+	Alias string
+}
+
+func (e *UnknownAliasError) Error() string {
+	return fmt.Sprintf("no LIFX device alias %q", e.Alias)
+}
+
+// WithAliases sets the aliases used by DeviceByAlias.
+// The default is to load them from DefaultAliasesFile when first needed.
+func WithAliases(a Aliases) Option {
+	return func(c *Client) { c.aliases = a }
+}
+
+// Aliases returns the client's aliases; see WithAliases.
+// The returned map must not be modified.
+func (c *Client) Aliases() (Aliases, error) {
+	c.aliasesOnce.Do(func() {
+		if c.aliases != nil {
+			return
+		}
+		filename, err := DefaultAliasesFile()
+		if err != nil {
+			c.aliasesErr = err
+			return
+		}
+		c.aliases, c.aliasesErr = LoadAliases(filename)
+	})
+	return c.aliases, c.aliasesErr
+}
+
+// DeviceByAlias returns the device with the serial that the name is an alias for.
+// If the name isn't an alias, the error is an *UnknownAliasError.
+//
+// Like DiscoverSerial, it waits until the device responds or the context is done.
+func (c *Client) DeviceByAlias(ctx context.Context, name string) (*Device, error) {
+	a, err := c.Aliases()
+	if err != nil {
+		return nil, fmt.Errorf("loading aliases: %w", err)
+	}
+	serial, ok := a.Lookup(name)
+	if !ok {
+		return nil, &UnknownAliasError{Alias: name}
+	}
+	return c.DiscoverSerial(ctx, serial)
+}
@@ -0,0 +1,67 @@
+package lifx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAliases(t *testing.T) {
+	const in = `
+# Downstairs
+Living room = d073d5010203
+porch=d0:73:d5:04:05:06
+`
+	a, err := ParseAliases(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseAliases: %v", err)
+	}
+	if len(a) != 2 {
+		t.Errorf("got %d aliases, want 2", len(a))
+	}
+	tests := []struct {
+		name string
+		want [6]byte
+		ok   bool
+	}{
+		{"Living room", [6]byte{0xd0, 0x73, 0xd5, 1, 2, 3}, true},
+		{"living ROOM", [6]byte{0xd0, 0x73, 0xd5, 1, 2, 3}, true},
+		{"porch", [6]byte{0xd0, 0x73, 0xd5, 4, 5, 6}, true},
+		{"garage", [6]byte{}, false},
+	}
+	for _, tc := range tests {
+		got, ok := a.Lookup(tc.name)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Lookup(%q) = %x, %v; want %x, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	for _, bad := range []string{
+		"no equals sign",
+		"= d073d5010203",
+		"short = d073d50102",
+		"notHex = d073d501020z",
+		"a = d073d5010203\na = d073d5010204",
+		"Porch = d073d5010203\nporch = d073d5010204",
+	} {
+		if _, err := ParseAliases(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseAliases(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestLookupCaseCollision(t *testing.T) {
+	a := Aliases{
+		"porch": {0xd0, 0x73, 0xd5, 0, 0, 1},
+		"Porch": {0xd0, 0x73, 0xd5, 0, 0, 2},
+		"PORCH": {0xd0, 0x73, 0xd5, 0, 0, 3},
+	}
+	// Map iteration order varies, so try a few times.
+	for i := 0; i < 20; i++ {
+		if got, ok := a.Lookup("pOrCh"); !ok || got != a["PORCH"] {
+			t.Fatalf("Lookup(%q) = %x, %v; want %x, true", "pOrCh", got, ok, a["PORCH"])
+		}
+	}
+	if got, ok := a.Lookup("Porch"); !ok || got != a["Porch"] {
+		t.Errorf("Lookup(%q) = %x, %v; want exact match %x, true", "Porch", got, ok, a["Porch"])
+	}
+}
@@ -0,0 +1,70 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// auditDiscoveryWait is how long AuditFirmware spends discovering devices.
+const auditDiscoveryWait = 2 * time.Second
+
+// FirmwareAudit is a device found by AuditFirmware.
+type FirmwareAudit struct {
+	Device   *Device
+	Firmware HostFirmware
+	Product  Product // with features as of Firmware
+}
+
+// AuditFirmware discovers devices and returns those whose firmware is older than min,
+// along with their products, sorted in discovery order.
+//
+// Devices that can't be queried, or whose product is unknown, are omitted,
+// and their errors are joined in the returned error.
+func (c *Client) AuditFirmware(ctx context.Context, min HostFirmware) ([]FirmwareAudit, error) {
+	dctx, cancel := context.WithTimeout(ctx, auditDiscoveryWait)
+	devs, err := c.Discover(dctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("Discover: %w", err)
+	}
+
+	audits := make([]*FirmwareAudit, len(devs))
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			audits[i], errs[i] = audit(ctx, d)
+		}()
+	}
+	wg.Wait()
+
+	var out []FirmwareAudit
+	for _, a := range audits {
+		if a != nil && a.Firmware.Before(min) {
+			out = append(out, *a)
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+func audit(ctx context.Context, d *Device) (*FirmwareAudit, error) {
+	hf, err := d.GetHostFirmware(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("device %x: GetHostFirmware: %w", d.Serial, err)
+	}
+	vendor, product, err := d.GetVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("device %x: GetVersion: %w", d.Serial, err)
+	}
+	p, err := DetermineProduct(CurrentProducts(), vendor, product, hf)
+	if err != nil {
+		return nil, fmt.Errorf("device %x: %w", d.Serial, err)
+	}
+	return &FirmwareAudit{Device: d, Firmware: hf, Product: p}, nil
+}
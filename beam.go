@@ -0,0 +1,104 @@
+package lifx
+
+import (
+	"fmt"
+)
+
+// ZoneRange is an inclusive range of zone indexes on a multizone device.
+type ZoneRange struct {
+	Start, End int
+}
+
+// Len returns the number of zones in the range.
+func (zr ZoneRange) Len() int { return zr.End - zr.Start + 1 }
+
+// Fill sets every zone in the range to the color.
+// zones would typically come from GetExtendedColorZones,
+// and be passed to SetExtendedColorZones afterwards.
+// It reports an error, changing nothing, if the range doesn't fit within zones.
+func (zr ZoneRange) Fill(zones []Color, c Color) error {
+	if zr.Start < 0 || zr.End < zr.Start || zr.End >= len(zones) {
+		return fmt.Errorf("zone range [%d,%d] doesn't fit in %d zones", zr.Start, zr.End, len(zones))
+	}
+	for i := zr.Start; i <= zr.End; i++ {
+		zones[i] = c
+	}
+	return nil
+}
+
+// BeamPart is a physical piece of a LIFX Beam.
+type BeamPart int
+
+const (
+	BeamSegment = BeamPart(0) // a straight beam, which has 10 zones
+	BeamCorner  = BeamPart(1) // a corner piece, which has 1 zone
+)
+
+func (bp BeamPart) zones() int {
+	if bp == BeamCorner {
+		return 1
+	}
+	return 10
+}
+
+// BeamLayout describes the parts of a LIFX Beam, in order along the chain
+// starting from the one connected to the controller.
+// The device can't report its layout, so this needs to be provided by the user.
+type BeamLayout []BeamPart
+
+// NumZones returns the total number of zones in the layout.
+func (bl BeamLayout) NumZones() int {
+	n := 0
+	for _, p := range bl {
+		n += p.zones()
+	}
+	return n
+}
+
+// Segment returns the zones of the n'th straight segment (counting from zero).
+func (bl BeamLayout) Segment(n int) (ZoneRange, error) {
+	return bl.find(BeamSegment, n)
+}
+
+// Corner returns the zone of the n'th corner (counting from zero).
+func (bl BeamLayout) Corner(n int) (ZoneRange, error) {
+	return bl.find(BeamCorner, n)
+}
+
+func (bl BeamLayout) find(want BeamPart, n int) (ZoneRange, error) {
+	off, seen := 0, 0
+	for _, p := range bl {
+		if p == want {
+			if seen == n {
+				return ZoneRange{Start: off, End: off + p.zones() - 1}, nil
+			}
+			seen++
+		}
+		off += p.zones()
+	}
+	kind := "segment"
+	if want == BeamCorner {
+		kind = "corner"
+	}
+	return ZoneRange{}, fmt.Errorf("beam layout has no %s #%d (only %d)", kind, n, seen)
+}
+
+// Parts returns the zone range for each part in the layout, in order.
+func (bl BeamLayout) Parts() []ZoneRange {
+	rs := make([]ZoneRange, len(bl))
+	off := 0
+	for i, p := range bl {
+		rs[i] = ZoneRange{Start: off, End: off + p.zones() - 1}
+		off += p.zones()
+	}
+	return rs
+}
+
+// Check reports an error if the layout doesn't match the device's zone count,
+// as reported by GetExtendedColorZones.
+func (bl BeamLayout) Check(numZones int) error {
+	if n := bl.NumZones(); n != numZones {
+		return fmt.Errorf("beam layout has %d zones, but device has %d", n, numZones)
+	}
+	return nil
+}
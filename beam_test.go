@@ -0,0 +1,65 @@
+package lifx_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestBeamLayout(t *testing.T) {
+	// Two segments joined by a corner.
+	bl := lifx.BeamLayout{lifx.BeamSegment, lifx.BeamCorner, lifx.BeamSegment}
+	if got := bl.NumZones(); got != 21 {
+		t.Errorf("NumZones = %d, want 21", got)
+	}
+	if err := bl.Check(21); err != nil {
+		t.Errorf("Check(21): %v", err)
+	}
+	if err := bl.Check(20); err == nil {
+		t.Errorf("Check(20) succeeded, want error")
+	}
+
+	want := []lifx.ZoneRange{{0, 9}, {10, 10}, {11, 20}}
+	if got := bl.Parts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parts = %v, want %v", got, want)
+	}
+	if zr, err := bl.Segment(1); err != nil || zr != want[2] {
+		t.Errorf("Segment(1) = %v, %v; want %v, nil", zr, err, want[2])
+	}
+	if zr, err := bl.Corner(0); err != nil || zr != want[1] || zr.Len() != 1 {
+		t.Errorf("Corner(0) = %v, %v; want %v, nil", zr, err, want[1])
+	}
+	if _, err := bl.Segment(2); err == nil {
+		t.Errorf("Segment(2) succeeded, want error")
+	}
+	if _, err := bl.Corner(1); err == nil {
+		t.Errorf("Corner(1) succeeded, want error")
+	}
+}
+
+func TestZoneRangeFill(t *testing.T) {
+	red := lifx.Color{Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	zones := make([]lifx.Color, 5)
+	if err := (lifx.ZoneRange{Start: 1, End: 3}).Fill(zones, red); err != nil {
+		t.Fatalf("Fill: %v", err)
+	}
+	want := []lifx.Color{{}, red, red, red, {}}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("After Fill, zones = %+v, want %+v", zones, want)
+	}
+
+	for _, zr := range []lifx.ZoneRange{
+		{Start: -1, End: 2},
+		{Start: 3, End: 5},
+		{Start: 3, End: 2},
+	} {
+		zones := make([]lifx.Color, 5)
+		if err := zr.Fill(zones, red); err == nil {
+			t.Errorf("Fill with %+v of 5 zones succeeded, want error", zr)
+		}
+		if !reflect.DeepEqual(zones, make([]lifx.Color, 5)) {
+			t.Errorf("Failed Fill with %+v changed zones", zr)
+		}
+	}
+}
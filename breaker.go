@@ -0,0 +1,148 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BreakerConfig configures a per-device circuit breaker.
+//
+// After Threshold consecutive failed operations, the device is considered
+// unreachable, and operations on it fail immediately with an *UnreachableError
+// for the Cooldown period instead of spending their full retry budget.
+// Meanwhile the device is probed in the background every Cooldown, and the
+// breaker is reset as soon as it responds.
+type BreakerConfig struct {
+	Threshold int           // if not positive, 5 is used
+	Cooldown  time.Duration // if not positive, 1s is used
+}
+
+// Defaults for BreakerConfig fields that are not positive.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 1 * time.Second
+)
+
+func (bc *BreakerConfig) threshold() int {
+	if bc.Threshold <= 0 {
+		return defaultBreakerThreshold
+	}
+	return bc.Threshold
+}
+
+func (bc *BreakerConfig) cooldown() time.Duration {
+	if bc.Cooldown <= 0 {
+		return defaultBreakerCooldown
+	}
+	return bc.Cooldown
+}
+
+// UnreachableError is returned for operations on a device
+// whose circuit breaker is open.
+type UnreachableError struct {
+	Serial   [6]byte
+	Failures int       // consecutive failures observed
+	RetryAt  time.Time // when operations will next be attempted
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("LIFX device %x unreachable after %d consecutive failures; next attempt at %v",
+		e.Serial, e.Failures, e.RetryAt.Format(time.RFC3339))
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// breakerCheck returns an error if the device's circuit breaker is open.
+func (d *Device) breakerCheck() error {
+	if d.Breaker == nil {
+		return nil
+	}
+	b := &d.brk
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < d.Breaker.threshold() || !time.Now().Before(b.openUntil) {
+		return nil
+	}
+	return &UnreachableError{
+		Serial:   d.Serial,
+		Failures: b.failures,
+		RetryAt:  b.openUntil,
+	}
+}
+
+// breakerRecord updates the circuit breaker with the outcome of an operation.
+func (d *Device) breakerRecord(err error) {
+	if d.Breaker == nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up, which says nothing about the device.
+		return
+	}
+	b := &d.brk
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !retryableErr(err) {
+		// Success, or at least the device is responding.
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures < d.Breaker.threshold() {
+		return
+	}
+	b.openUntil = time.Now().Add(d.Breaker.cooldown())
+	if !b.probing {
+		b.probing = true
+		go d.probe()
+	}
+}
+
+// probe periodically checks whether an unreachable device has recovered,
+// stopping once it has or the client is closed.
+func (d *Device) probe() {
+	d.tracef(context.Background(), "LIFX device %x unreachable; probing for recovery", d.Serial)
+	d.log(context.Background(), slog.LevelWarn, "LIFX device unreachable")
+	for {
+		d.brk.mu.Lock()
+		wait := time.Until(d.brk.openUntil)
+		d.brk.mu.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-d.client.closed:
+			t.Stop()
+			d.brk.mu.Lock()
+			d.brk.probing = false
+			d.brk.mu.Unlock()
+			return
+		case <-t.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), d.Breaker.cooldown())
+		_, err := d.rawRPC(ctx, pktGetService, pktStateService, nil, true, false)
+		cancel()
+
+		d.brk.mu.Lock()
+		if !retryableErr(err) {
+			d.brk.failures = 0
+			d.brk.openUntil = time.Time{}
+			d.brk.probing = false
+			d.brk.mu.Unlock()
+			d.tracef(context.Background(), "LIFX device %x has recovered", d.Serial)
+			d.log(context.Background(), slog.LevelInfo, "LIFX device recovered")
+			return
+		}
+		d.brk.openUntil = time.Now().Add(d.Breaker.cooldown())
+		d.brk.mu.Unlock()
+	}
+}
@@ -0,0 +1,85 @@
+package lifx_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestBreakerIgnoresCancellation(t *testing.T) {
+	// A socket that never answers.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer silent.Close()
+	client := lifxtest.NewNetwork(t).Client()
+	dev := client.NewDevice(*silent.LocalAddr().(*net.UDPAddr), testSerial)
+	dev.Breaker = &lifx.BreakerConfig{Threshold: 2, Cooldown: time.Minute}
+
+	timeout := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := dev.GetPower(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("GetPower of silent device = %v, want DeadlineExceeded", err)
+		}
+	}
+	timeout()
+
+	// A caller giving up says nothing about the device,
+	// so mustn't reset the count of consecutive failures.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dev.GetPower(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetPower with cancelled context = %v, want Canceled", err)
+	}
+
+	timeout()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var ue *lifx.UnreachableError
+	if _, err := dev.GetPower(ctx); !errors.As(err, &ue) || ue.Failures != 2 {
+		t.Errorf("GetPower after two timeouts = %v, want UnreachableError after 2 failures", err)
+	}
+}
+
+func TestClientCloseTwice(t *testing.T) {
+	client, err := lifx.NewClient(lifx.WithTransport(lifxtest.NewNetwork(t)))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.Close()
+	client.Close() // must not panic
+}
+
+func TestBreakerZeroCooldown(t *testing.T) {
+	// A socket that never answers.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer silent.Close()
+	client := lifxtest.NewNetwork(t).Client()
+	dev := client.NewDevice(*silent.LocalAddr().(*net.UDPAddr), testSerial)
+	dev.Breaker = &lifx.BreakerConfig{Threshold: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := dev.GetPower(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetPower of silent device = %v, want DeadlineExceeded", err)
+	}
+
+	// A zero Cooldown gets the default, so the breaker stays open for a while.
+	var ue *lifx.UnreachableError
+	if _, err := dev.GetPower(testContext(t)); !errors.As(err, &ue) {
+		t.Fatalf("GetPower after a timeout = %v, want UnreachableError", err)
+	}
+	if d := time.Until(ue.RetryAt); d <= 0 {
+		t.Errorf("UnreachableError.RetryAt is %v in the past, want in the future", -d)
+	}
+}
@@ -0,0 +1,42 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// BroadcastSetColor sets the color of every light on the network at once,
+// using a single broadcast message.
+//
+// Unlike SetColor, this is unacknowledged: it is quick and cheap,
+// but there is no indication of whether each device received it.
+// The context is only checked before sending.
+func (c *Client) BroadcastSetColor(ctx context.Context, color Color, duration time.Duration) error {
+	payload, err := encodeSetColor(color, duration)
+	if err != nil {
+		return err
+	}
+	return c.broadcastSet(ctx, pktSetColor, payload)
+}
+
+// BroadcastSetPower sets the power level of every device on the network at once,
+// using a single broadcast message. As with SetPower, only 0 (off) and 65535 (on)
+// are valid levels. The same caveats apply as for BroadcastSetColor.
+func (c *Client) BroadcastSetPower(ctx context.Context, level uint16) error {
+	if level != 0 && level != 0xFFFF {
+		return fmt.Errorf("bad power level %d; must be 0 or 65535", level)
+	}
+	return c.broadcastSet(ctx, pktSetPower, binary.LittleEndian.AppendUint16(nil, level))
+}
+
+func (c *Client) broadcastSet(ctx context.Context, typ msgType, payload []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.broadcast(c.conn, typ, payload); err != nil {
+		return fmt.Errorf("sending broadcast: %v", err)
+	}
+	return nil
+}
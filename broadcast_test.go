@@ -0,0 +1,31 @@
+package lifx_test
+
+import (
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestBroadcastSet(t *testing.T) {
+	light := &lifxtest.Light{}
+	var client *lifx.Client
+	_, dev, ctx := newTestDevice(t, light, func(c *lifx.Client) { client = c })
+
+	want := lifx.Color{Hue: 0x4000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	if err := client.BroadcastSetColor(ctx, want, 0); err != nil {
+		t.Fatalf("BroadcastSetColor: %v", err)
+	}
+	if err := client.BroadcastSetPower(ctx, 0xFFFF); err != nil {
+		t.Fatalf("BroadcastSetPower: %v", err)
+	}
+
+	// There's no acknowledgement, but the device handles packets in order,
+	// so these queries see the results of the broadcasts.
+	if got, err := dev.GetColor(ctx); err != nil || got != want {
+		t.Errorf("After BroadcastSetColor, GetColor = %+v, %v; want %+v, nil", got, err, want)
+	}
+	if got, err := dev.GetPower(ctx); err != nil || got != 0xFFFF {
+		t.Errorf("After BroadcastSetPower, GetPower = %d, %v; want 65535, nil", got, err)
+	}
+}
@@ -0,0 +1,140 @@
+package lifx
+
+import (
+	"sync"
+	"time"
+)
+
+// CacheConfig configures caching of query results for a device.
+//
+// Each field is how long the corresponding query results are reused for;
+// zero disables caching for that query. Any operation that changes the
+// device discards cached results except for Version and HostFirmware,
+// which can't change while a device is running.
+type CacheConfig struct {
+	Label        time.Duration // GetLabel
+	Group        time.Duration // GetGroup
+	Location     time.Duration // GetLocation
+	Version      time.Duration // GetVersion
+	HostFirmware time.Duration // GetHostFirmware
+	Power        time.Duration // GetPower and GetLightPower
+	Color        time.Duration // GetColor and GetExtendedColorZones
+}
+
+// DefaultCacheConfig is a reasonable CacheConfig for interactive applications.
+// It caches slowly-changing information for a long time,
+// and light state only very briefly.
+var DefaultCacheConfig = CacheConfig{
+	Label:        5 * time.Minute,
+	Group:        5 * time.Minute,
+	Location:     5 * time.Minute,
+	Version:      24 * time.Hour,
+	HostFirmware: time.Hour,
+	Power:        500 * time.Millisecond,
+	Color:        500 * time.Millisecond,
+}
+
+func (cc *CacheConfig) ttl(reqType msgType) time.Duration {
+	switch reqType {
+	case pktGetLabel:
+		return cc.Label
+	case pktGetGroup:
+		return cc.Group
+	case pktGetLocation:
+		return cc.Location
+	case pktGetVersion:
+		return cc.Version
+	case pktGetHostFirmware:
+		return cc.HostFirmware
+	case pktGetPower, pktGetLightPower:
+		return cc.Power
+	case pktGetColor, pktGetExtendedColorZones:
+		return cc.Color
+	}
+	return 0
+}
+
+// static reports whether results of the query never change.
+func static(reqType msgType) bool {
+	return reqType == pktGetVersion || reqType == pktGetHostFirmware
+}
+
+type cacheEntry struct {
+	payloads [][]byte // usually just one; see queryParts
+	expires  time.Time
+}
+
+type cache struct {
+	mu      sync.Mutex
+	entries map[msgType]cacheEntry
+}
+
+func (d *Device) cacheGet(reqType msgType) ([]byte, bool) {
+	payloads, ok := d.cacheGetParts(reqType)
+	if !ok {
+		return nil, false
+	}
+	return payloads[0], true
+}
+
+func (d *Device) cacheGetParts(reqType msgType) ([][]byte, bool) {
+	if d.Cache == nil {
+		return nil, false
+	}
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	e, ok := d.cache.entries[reqType]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return copyPayloads(e.payloads), true
+}
+
+func (d *Device) cachePut(reqType msgType, payload []byte) {
+	d.cachePutParts(reqType, [][]byte{payload})
+}
+
+func (d *Device) cachePutParts(reqType msgType, payloads [][]byte) {
+	if d.Cache == nil || len(payloads) == 0 {
+		return
+	}
+	ttl := d.Cache.ttl(reqType)
+	if ttl <= 0 {
+		return
+	}
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	if d.cache.entries == nil {
+		d.cache.entries = make(map[msgType]cacheEntry)
+	}
+	d.cache.entries[reqType] = cacheEntry{payloads: copyPayloads(payloads), expires: time.Now().Add(ttl)}
+}
+
+// copyPayloads returns a deep copy of payloads, so that callers can't
+// change cached results by modifying what they are given or give.
+func copyPayloads(payloads [][]byte) [][]byte {
+	c := make([][]byte, len(payloads))
+	for i, p := range payloads {
+		c[i] = append([]byte(nil), p...)
+	}
+	return c
+}
+
+func (d *Device) cacheInvalidate() {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	for rt := range d.cache.entries {
+		if !static(rt) {
+			delete(d.cache.entries, rt)
+		}
+	}
+}
+
+// InvalidateCache discards all cached query results for the device.
+// This is only needed if the device may have been changed by something else,
+// such as another program or the LIFX app, and stale results are unacceptable.
+func (d *Device) InvalidateCache() {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	d.cache.entries = nil
+}
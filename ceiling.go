@@ -0,0 +1,83 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ceilingLayout describes the matrix of a LIFX Ceiling.
+// The uplight is the final pixel; the remaining pixels form the downlight.
+type ceilingLayout struct {
+	width, height int
+}
+
+// ceilingProducts maps LIFX product IDs for Ceiling fixtures to their matrix layout.
+var ceilingProducts = map[uint32]ceilingLayout{
+	176: {8, 8},  // LIFX Ceiling US
+	177: {8, 8},  // LIFX Ceiling Intl
+	201: {16, 8}, // LIFX Ceiling 13x26" US
+	202: {16, 8}, // LIFX Ceiling 13x26" Intl
+}
+
+// IsCeiling reports whether the given vendor and product (from GetVersion)
+// identify a LIFX Ceiling with separate uplight and downlight regions.
+func IsCeiling(vendorID, productID uint32) bool {
+	_, ok := ceilingProducts[productID]
+	return ok && vendorID == 1
+}
+
+func (d *Device) ceilingLayout(ctx context.Context) (ceilingLayout, error) {
+	vendor, product, err := d.GetVersion(ctx)
+	if err != nil {
+		return ceilingLayout{}, fmt.Errorf("GetVersion: %w", err)
+	}
+	if !IsCeiling(vendor, product) {
+		return ceilingLayout{}, fmt.Errorf("device (vendor %d, product %d) is not a LIFX Ceiling", vendor, product)
+	}
+	return ceilingProducts[product], nil
+}
+
+// SetUplight sets the color of the uplight of a LIFX Ceiling,
+// leaving the downlight unchanged.
+func (d *Device) SetUplight(ctx context.Context, color Color, duration time.Duration) error {
+	cl, err := d.ceilingLayout(ctx)
+	if err != nil {
+		return err
+	}
+	rect := TileRect{X: uint8(cl.width - 1), Y: uint8(cl.height - 1), Width: 1}
+	return d.Set64(ctx, rect, duration, []Color{color})
+}
+
+// SetDownlight sets the color of the downlight of a LIFX Ceiling,
+// leaving the uplight unchanged.
+func (d *Device) SetDownlight(ctx context.Context, color Color, duration time.Duration) error {
+	cl, err := d.ceilingLayout(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set64 always writes 64 pixels, filling with black, so writing the
+	// downlight alone would blank the uplight in the last row.
+	// Write the uplight back with its current color instead.
+	up, err := d.Get64(ctx, TileRect{X: uint8(cl.width - 1), Y: uint8(cl.height - 1), Width: 1})
+	if err != nil {
+		return fmt.Errorf("Get64: %w", err)
+	}
+	pixels := make([]Color, cl.width*cl.height)
+	for i := range pixels {
+		pixels[i] = color
+	}
+	pixels[len(pixels)-1] = up[0]
+
+	// Write whole rows, as many as fit in each message.
+	rowsPer := maxSet64Colors / cl.width
+	for y := 0; y < cl.height; y += rowsPer {
+		end := min(y+rowsPer, cl.height)
+		rect := TileRect{Y: uint8(y), Width: uint8(cl.width)}
+		if err := d.Set64(ctx, rect, duration, pixels[y*cl.width:end*cl.width]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package lifx_test
+
+import (
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestCeiling(t *testing.T) {
+	for _, tc := range []struct {
+		product       uint32
+		width, height int
+	}{
+		{176, 8, 8},
+		{201, 16, 8},
+	} {
+		m := lifxtest.NewMatrix(tc.width, tc.height)
+		n := lifxtest.NewNetwork(t)
+		ed := n.AddVirtual(&lifx.VirtualDevice{Serial: testSerial, Light: m, Vendor: 1, Product: tc.product})
+		dev := n.Client().NewDevice(*ed.Addr(), ed.Serial)
+		ctx := testContext(t)
+
+		red := lifx.Color{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+		blue := lifx.Color{Hue: 0xAAAA, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+		if err := dev.SetUplight(ctx, red, 0); err != nil {
+			t.Fatalf("product %d: SetUplight: %v", tc.product, err)
+		}
+		if err := dev.SetDownlight(ctx, blue, 0); err != nil {
+			t.Fatalf("product %d: SetDownlight: %v", tc.product, err)
+		}
+		pixels := m.Pixels()
+		up := len(pixels) - 1
+		if pixels[up] != red {
+			t.Errorf("product %d: uplight is %+v after SetDownlight, want %+v", tc.product, pixels[up], red)
+		}
+		for i, c := range pixels[:up] {
+			if c != blue {
+				t.Errorf("product %d: downlight pixel (%d, %d) is %+v, want %+v", tc.product, i%tc.width, i/tc.width, c, blue)
+			}
+		}
+	}
+}
+
+func TestCeilingRejectsOtherDevices(t *testing.T) {
+	_, dev, ctx := newTestDevice(t, lifxtest.NewMatrix(8, 8))
+	if err := dev.SetDownlight(ctx, lifx.Color{Kelvin: 3500}, 0); err == nil {
+		t.Errorf("SetDownlight on a LIFX Tile succeeded, want error")
+	}
+}
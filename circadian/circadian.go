@@ -0,0 +1,256 @@
+/*
+Package circadian adjusts LIFX lights to follow the time of day.
+
+A Schedule describes the color temperature and brightness over the day:
+at their minimums before Wake and after Sleep, rising smoothly to their
+maximums midway between the two. An Adjuster periodically sets its devices
+to the Schedule's current values.
+
+If a device's color is changed by something else (for instance, someone
+using the LIFX app), the Adjuster leaves it alone until it is next turned off,
+or until Resume is called for it.
+*/
+package circadian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Schedule describes how lights change over a day.
+type Schedule struct {
+	// Wake and Sleep are the times of day, as offsets from midnight,
+	// between which the lights are raised above their minimums.
+	// Sleep may be earlier than Wake, in which case it is on the following day.
+	Wake, Sleep time.Duration
+
+	MinKelvin, MaxKelvin uint16
+
+	// MinBrightness and MaxBrightness are fractions in [0,1].
+	MinBrightness, MaxBrightness float64
+}
+
+// DefaultSchedule is a reasonable Schedule for someone awake from 7am to 11pm.
+var DefaultSchedule = Schedule{
+	Wake:          7 * time.Hour,
+	Sleep:         23 * time.Hour,
+	MinKelvin:     lifx.KelvinUltraWarm,
+	MaxKelvin:     lifx.KelvinDaylight,
+	MinBrightness: 0.3,
+	MaxBrightness: 1,
+}
+
+// Validate reports whether the schedule is usable.
+func (s Schedule) Validate() error {
+	const day = 24 * time.Hour
+	if s.Wake < 0 || s.Wake >= day || s.Sleep < 0 || s.Sleep >= day {
+		return fmt.Errorf("wake and sleep must be within a day")
+	}
+	if s.Wake == s.Sleep {
+		return fmt.Errorf("wake and sleep must differ")
+	}
+	if s.MinKelvin > s.MaxKelvin {
+		return fmt.Errorf("minimum kelvin %d exceeds maximum %d", s.MinKelvin, s.MaxKelvin)
+	}
+	if s.MinBrightness < 0 || s.MaxBrightness > 1 || s.MinBrightness > s.MaxBrightness {
+		return fmt.Errorf("brightness range [%g,%g] invalid", s.MinBrightness, s.MaxBrightness)
+	}
+	return nil
+}
+
+// level returns how far through the day's curve t is, in [0,1].
+func (s Schedule) level(t time.Time) float64 {
+	const day = 24 * time.Hour
+	y, m, d := t.Date()
+	tod := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	awake := (s.Sleep - s.Wake + day) % day
+	since := (tod - s.Wake + day) % day
+	if since >= awake {
+		return 0
+	}
+	return math.Sin(math.Pi * float64(since) / float64(awake))
+}
+
+// At returns the color the schedule calls for at t.
+// It is always white, so only Brightness and Kelvin are set.
+func (s Schedule) At(t time.Time) lifx.Color {
+	l := s.level(t)
+	k := float64(s.MinKelvin) + l*float64(s.MaxKelvin-s.MinKelvin)
+	b := s.MinBrightness + l*(s.MaxBrightness-s.MinBrightness)
+	return lifx.Color{
+		Brightness: uint16(math.Round(b * 0xFFFF)),
+		Kelvin:     uint16(math.Round(k)),
+	}
+}
+
+const (
+	// DefaultInterval is how often an Adjuster adjusts its devices by default.
+	DefaultInterval = time.Minute
+	// DefaultTransition is the default duration of each adjustment.
+	DefaultTransition = 5 * time.Second
+)
+
+// Adjuster keeps devices in line with a Schedule.
+type Adjuster struct {
+	Schedule Schedule
+	Devices  []*lifx.Device
+
+	// Interval is the time between adjustments. If zero, DefaultInterval is used.
+	Interval time.Duration
+	// Transition is the duration of each adjustment. If zero, DefaultTransition is used.
+	// It should be shorter than Interval, so changes are finished before they are checked.
+	Transition time.Duration
+
+	// Logf, if set, will be used to log activity.
+	Logf func(format string, args ...interface{})
+
+	mu         sync.Mutex
+	last       map[[6]byte]lifx.Color // what each device was last set to
+	overridden map[[6]byte]bool
+}
+
+func (a *Adjuster) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
+
+// Run adjusts the devices immediately, and then every Interval, until ctx is done.
+// Adjustment errors are logged but otherwise ignored.
+func (a *Adjuster) Run(ctx context.Context) error {
+	if err := a.Schedule.Validate(); err != nil {
+		return fmt.Errorf("bad schedule: %w", err)
+	}
+	interval := a.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Adjust(ctx, time.Now()); err != nil {
+			a.logf("Adjusting: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Adjust sets each device not overridden to the schedule's color at now.
+// Devices are processed concurrently. The returned error joins the errors
+// from each device, if any.
+func (a *Adjuster) Adjust(ctx context.Context, now time.Time) error {
+	target := a.Schedule.At(now)
+	errs := make([]error, len(a.Devices))
+	var wg sync.WaitGroup
+	for i, d := range a.Devices {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.adjust(ctx, d, target); err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (a *Adjuster) adjust(ctx context.Context, d *lifx.Device, target lifx.Color) error {
+	power, err := d.GetLightPower(ctx)
+	if err != nil {
+		return fmt.Errorf("GetLightPower: %w", err)
+	}
+	cur, err := d.GetColor(ctx)
+	if err != nil {
+		return fmt.Errorf("GetColor: %w", err)
+	}
+
+	a.mu.Lock()
+	last, ok := a.last[d.Serial]
+	switch {
+	case power == 0:
+		// Turning a light off ends any override, and it's harmless
+		// to adjust it so it comes on at the right color.
+		if a.overridden[d.Serial] {
+			a.logf("Device %x turned off; resuming adjustment", d.Serial)
+		}
+		delete(a.overridden, d.Serial)
+	case ok && !similar(cur, last):
+		if !a.overridden[d.Serial] {
+			a.logf("Device %x changed from %+v to %+v; leaving it alone", d.Serial, last, cur)
+		}
+		if a.overridden == nil {
+			a.overridden = make(map[[6]byte]bool)
+		}
+		a.overridden[d.Serial] = true
+	}
+	skip := a.overridden[d.Serial]
+	a.mu.Unlock()
+	if skip {
+		return nil
+	}
+
+	// Devices with an unknown product are used as-is.
+	if k, err := d.ClampKelvin(ctx, target.Kelvin); err == nil {
+		target.Kelvin = k
+	}
+	dur := a.Transition
+	if dur == 0 {
+		dur = DefaultTransition
+	}
+	if err := d.SetColor(ctx, target, dur); err != nil {
+		return fmt.Errorf("SetColor: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.last == nil {
+		a.last = make(map[[6]byte]lifx.Color)
+	}
+	a.last[d.Serial] = target
+	return nil
+}
+
+// Resume resumes adjustment of a device that was overridden.
+func (a *Adjuster) Resume(serial [6]byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.overridden, serial)
+	delete(a.last, serial)
+}
+
+// Overridden reports whether the device is being left alone
+// because its color was changed by something else.
+func (a *Adjuster) Overridden(serial [6]byte) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.overridden[serial]
+}
+
+// similar reports whether a device reporting cur could be one that was set to want.
+// Devices don't necessarily report exactly what they were set to,
+// and hue is irrelevant for white light.
+func similar(cur, want lifx.Color) bool {
+	const (
+		tolerance16 = 0xFFFF / 100 // 1%
+		toleranceK  = 50
+	)
+	near := func(a, b uint16, tol int) bool {
+		d := int(a) - int(b)
+		return -tol <= d && d <= tol
+	}
+	return near(cur.Saturation, want.Saturation, tolerance16) &&
+		near(cur.Brightness, want.Brightness, tolerance16) &&
+		near(cur.Kelvin, want.Kelvin, toleranceK)
+}
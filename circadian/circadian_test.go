@@ -0,0 +1,133 @@
+package circadian
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestScheduleAt(t *testing.T) {
+	s := Schedule{
+		Wake:          6 * time.Hour,
+		Sleep:         18 * time.Hour,
+		MinKelvin:     2000,
+		MaxKelvin:     6000,
+		MinBrightness: 0,
+		MaxBrightness: 1,
+	}
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		tod  time.Duration
+		want lifx.Color
+	}{
+		{3 * time.Hour, lifx.Color{Brightness: 0, Kelvin: 2000}},
+		{6 * time.Hour, lifx.Color{Brightness: 0, Kelvin: 2000}},
+		{12 * time.Hour, lifx.Color{Brightness: 0xFFFF, Kelvin: 6000}},
+		{22 * time.Hour, lifx.Color{Brightness: 0, Kelvin: 2000}},
+	}
+	for _, test := range tests {
+		if got := s.At(day.Add(test.tod)); got != test.want {
+			t.Errorf("At(%v) = %+v, want %+v", test.tod, got, test.want)
+		}
+	}
+
+	// Sleeping past midnight.
+	s.Wake, s.Sleep = 18*time.Hour, 6*time.Hour
+	if got, want := s.At(day), (lifx.Color{Brightness: 0xFFFF, Kelvin: 6000}); got != want {
+		t.Errorf("overnight At(midnight) = %+v, want %+v", got, want)
+	}
+}
+
+type testLight struct {
+	mu    sync.Mutex
+	power uint16
+	color lifx.Color
+}
+
+func (tl *testLight) Power() uint16 {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.power
+}
+
+func (tl *testLight) SetPower(level uint16, _ time.Duration) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.power = level
+}
+
+func (tl *testLight) Color() lifx.Color {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.color
+}
+
+func (tl *testLight) SetColor(c lifx.Color, _ time.Duration) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.color = c
+}
+
+func TestAdjusterOverride(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer conn.Close()
+	light := &testLight{power: 0xFFFF}
+	vd := &lifx.VirtualDevice{
+		Serial: [6]byte{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03},
+		Light:  light,
+	}
+	go vd.Serve(conn)
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	dev := client.NewDevice(*conn.LocalAddr().(*net.UDPAddr), vd.Serial)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a := &Adjuster{Schedule: DefaultSchedule, Devices: []*lifx.Device{dev}}
+	morning := time.Date(2024, 6, 1, 9, 0, 0, 0, time.Local)
+	noon := morning.Add(6 * time.Hour)
+
+	if err := a.Adjust(ctx, morning); err != nil {
+		t.Fatalf("Adjust: %v", err)
+	}
+	if got, want := light.Color(), DefaultSchedule.At(morning); got != want {
+		t.Fatalf("after Adjust, color = %+v, want %+v", got, want)
+	}
+
+	// Someone picks a color; it should be left alone.
+	red := lifx.Color{Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	light.SetColor(red, 0)
+	if err := a.Adjust(ctx, noon); err != nil {
+		t.Fatalf("Adjust: %v", err)
+	}
+	if got := light.Color(); got != red {
+		t.Errorf("after manual change and Adjust, color = %+v, want %+v", got, red)
+	}
+	if !a.Overridden(dev.Serial) {
+		t.Errorf("Overridden = false after manual change")
+	}
+
+	// Turning it off resumes adjustment.
+	light.SetPower(0, 0)
+	if err := a.Adjust(ctx, noon); err != nil {
+		t.Fatalf("Adjust: %v", err)
+	}
+	if got, want := light.Color(), DefaultSchedule.At(noon); got != want {
+		t.Errorf("after turning off and Adjust, color = %+v, want %+v", got, want)
+	}
+	if a.Overridden(dev.Serial) {
+		t.Errorf("Overridden = true after turning off")
+	}
+}
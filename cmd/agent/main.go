@@ -0,0 +1,52 @@
+// The agent command proxies the LIFX LAN protocol over TLS/WebSocket,
+// for use with the remote package.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/dsymonds/lifx/remote"
+)
+
+var (
+	listenAddr = flag.String("listen", ":8443", "`address` to serve on")
+	path       = flag.String("path", "/lifx", "URL `path` of the WebSocket endpoint")
+	certFile   = flag.String("cert", "", "TLS certificate `file`")
+	keyFile    = flag.String("key", "", "TLS private key `file`")
+	insecure   = flag.Bool("insecure", false, "serve plain HTTP without TLS; only for trusted networks")
+	anonymous  = flag.Bool("allow-anonymous", false, "accept clients without a token if LIFX_AGENT_TOKEN is unset; only for trusted networks")
+)
+
+func main() {
+	flag.Parse()
+
+	token := os.Getenv("LIFX_AGENT_TOKEN")
+	if token == "" {
+		if !*anonymous {
+			log.Fatalf("Need LIFX_AGENT_TOKEN, or -allow-anonymous")
+		}
+		log.Printf("WARNING: LIFX_AGENT_TOKEN not set; accepting all clients")
+	}
+	useTLS := *certFile != "" || *keyFile != ""
+	if !useTLS && !*insecure {
+		log.Fatalf("Need -cert and -key, or -insecure")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(*path, &remote.Agent{
+		Token: token,
+		Logf:  log.Printf,
+	})
+
+	log.Printf("Serving LIFX agent on %s%s", *listenAddr, *path)
+	var err error
+	if useTLS {
+		err = http.ListenAndServeTLS(*listenAddr, *certFile, *keyFile, mux)
+	} else {
+		err = http.ListenAndServe(*listenAddr, mux)
+	}
+	log.Fatal(err)
+}
@@ -0,0 +1,250 @@
+// The bench command exercises LIFX devices over a sustained period,
+// reporting round trip time percentiles, packet loss and retry rates.
+//
+// It is useful for evaluating access point placement, Wi-Fi changes
+// and firmware versions.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+var (
+	labels   = flag.String("labels", "", "comma-separated `labels` of devices to exercise; empty means all")
+	duration = flag.Duration("duration", 10*time.Minute, "how long to run for")
+	rate     = flag.Float64("rate", 2, "operations per second per device")
+	report   = flag.Duration("report", 30*time.Second, "interval between reports")
+	ops      = flag.String("ops", "echo,light", "comma-separated operations to alternate between: echo, light")
+)
+
+// stats accumulates measurements for one device over one reporting window.
+type stats struct {
+	echoSent int
+	rtts     []time.Duration
+
+	lightOps      int
+	lightFailures int
+	attempts      int // total attempts across light ops, including retries
+}
+
+type bench struct {
+	dev   *lifx.Device
+	label string
+
+	mu       sync.Mutex
+	window   stats
+	total    stats
+	attempts int // attempts observed during the current light op
+}
+
+func main() {
+	flag.Parse()
+	if *rate <= 0 {
+		log.Fatalf("-rate must be positive")
+	}
+	var doEcho, doLight bool
+	for _, op := range strings.Split(*ops, ",") {
+		switch strings.TrimSpace(op) {
+		case "echo":
+			doEcho = true
+		case "light":
+			doLight = true
+		default:
+			log.Fatalf("Unknown operation %q in -ops", op)
+		}
+	}
+	if !doEcho && !doLight {
+		log.Fatalf("-ops must name at least one operation")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	benches := discover(ctx, client)
+	if len(benches) == 0 {
+		log.Fatalf("No matching devices found")
+	}
+	log.Printf("Exercising %d device(s) for %v at %.1f ops/s each", len(benches), *duration, *rate)
+
+	var wg sync.WaitGroup
+	for _, b := range benches {
+		b := b
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.run(ctx, doEcho, doLight)
+		}()
+	}
+
+	ticker := time.NewTicker(*report)
+	defer ticker.Stop()
+	start := time.Now()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+			fmt.Printf("--- %v elapsed\n", time.Since(start).Round(time.Second))
+			for _, b := range benches {
+				b.mu.Lock()
+				w := b.window
+				b.window = stats{}
+				b.mu.Unlock()
+				fmt.Printf("%-20s %s\n", b.label, w)
+			}
+		}
+	}
+	wg.Wait()
+
+	fmt.Printf("=== Summary after %v\n", time.Since(start).Round(time.Second))
+	for _, b := range benches {
+		fmt.Printf("%-20s %s\n", b.label, b.total)
+	}
+}
+
+func discover(ctx context.Context, client *lifx.Client) []*bench {
+	dctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	devs, err := client.Discover(dctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Discover: %v", err)
+	}
+	want := make(map[string]bool)
+	if *labels != "" {
+		for _, l := range strings.Split(*labels, ",") {
+			want[strings.TrimSpace(l)] = true
+		}
+	}
+	var benches []*bench
+	for _, dev := range devs {
+		label, err := dev.GetLabel(ctx)
+		if err != nil {
+			log.Printf("GetLabel on %x: %v", dev.Serial, err)
+			continue
+		}
+		if len(want) > 0 && !want[label] {
+			continue
+		}
+		b := &bench{dev: dev, label: label}
+		// Count attempts made by each operation, so retries can be reported.
+		dev.Tracef = func(ctx context.Context, format string, args ...interface{}) {
+			if strings.HasPrefix(format, "LIFX op starting") {
+				b.mu.Lock()
+				b.attempts++
+				b.mu.Unlock()
+			}
+		}
+		benches = append(benches, b)
+	}
+	return benches
+}
+
+func (b *bench) run(ctx context.Context, doEcho, doLight bool) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		echo := doEcho && (!doLight || i%2 == 0)
+		if echo {
+			ps, err := b.dev.Ping(ctx, 1)
+			if ctx.Err() != nil {
+				return
+			}
+			b.mu.Lock()
+			b.record(func(s *stats) {
+				s.echoSent++
+				if err == nil && ps.Received > 0 {
+					s.rtts = append(s.rtts, ps.Avg)
+				}
+			})
+			b.mu.Unlock()
+			continue
+		}
+
+		b.mu.Lock()
+		b.attempts = 0
+		b.mu.Unlock()
+		// Bound each light op so a dead device doesn't stall the benchmark.
+		octx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		_, err := b.dev.GetColor(octx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		b.mu.Lock()
+		attempts := b.attempts
+		b.record(func(s *stats) {
+			s.lightOps++
+			s.attempts += attempts
+			if err != nil {
+				s.lightFailures++
+			}
+		})
+		b.mu.Unlock()
+	}
+}
+
+// record applies f to both the window and total stats. b.mu must be held.
+func (b *bench) record(f func(*stats)) {
+	f(&b.window)
+	f(&b.total)
+}
+
+func (s stats) String() string {
+	var parts []string
+	if s.echoSent > 0 {
+		loss := float64(s.echoSent-len(s.rtts)) / float64(s.echoSent) * 100
+		p := fmt.Sprintf("echo: %d sent, %.1f%% loss", s.echoSent, loss)
+		if len(s.rtts) > 0 {
+			sort.Slice(s.rtts, func(i, j int) bool { return s.rtts[i] < s.rtts[j] })
+			p += fmt.Sprintf(", rtt p50/p90/p99 = %v/%v/%v",
+				percentile(s.rtts, 50), percentile(s.rtts, 90), percentile(s.rtts, 99))
+		}
+		parts = append(parts, p)
+	}
+	if s.lightOps > 0 {
+		retries := s.attempts - s.lightOps
+		if retries < 0 {
+			retries = 0
+		}
+		parts = append(parts, fmt.Sprintf("light: %d ops, %d failed, %.2f retries/op",
+			s.lightOps, s.lightFailures, float64(retries)/float64(s.lightOps)))
+	}
+	if len(parts) == 0 {
+		return "no operations"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// percentile returns the pth percentile of sorted, which must be non-empty.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i].Round(100 * time.Microsecond)
+}
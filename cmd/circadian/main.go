@@ -0,0 +1,109 @@
+// The circadian command continuously adjusts the color temperature and
+// brightness of LIFX lights to follow the time of day.
+//
+// Lights whose color is changed by other means are left alone
+// until they are next turned off.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/circadian"
+)
+
+var (
+	labels     = flag.String("labels", "", "comma-separated `labels` of devices to adjust; empty means all")
+	wake       = flag.String("wake", "07:00", "`time` of day at which lights start to rise")
+	sleep      = flag.String("sleep", "23:00", "`time` of day at which lights return to their minimums")
+	minKelvin  = flag.Uint("min-kelvin", uint(circadian.DefaultSchedule.MinKelvin), "color temperature at night")
+	maxKelvin  = flag.Uint("max-kelvin", uint(circadian.DefaultSchedule.MaxKelvin), "color temperature in the middle of the day")
+	minBright  = flag.Float64("min-brightness", circadian.DefaultSchedule.MinBrightness, "brightness at night, in [0,1]")
+	maxBright  = flag.Float64("max-brightness", circadian.DefaultSchedule.MaxBrightness, "brightness in the middle of the day, in [0,1]")
+	interval   = flag.Duration("interval", circadian.DefaultInterval, "time between adjustments")
+	transition = flag.Duration("transition", circadian.DefaultTransition, "duration of each adjustment")
+)
+
+func main() {
+	flag.Parse()
+
+	sched := circadian.Schedule{
+		Wake:          parseTimeOfDay("-wake", *wake),
+		Sleep:         parseTimeOfDay("-sleep", *sleep),
+		MinKelvin:     uint16(*minKelvin),
+		MaxKelvin:     uint16(*maxKelvin),
+		MinBrightness: *minBright,
+		MaxBrightness: *maxBright,
+	}
+	if err := sched.Validate(); err != nil {
+		log.Fatalf("Bad schedule: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	devs := discover(ctx, client)
+	if len(devs) == 0 {
+		log.Fatalf("No matching devices found")
+	}
+	log.Printf("Adjusting %d device(s)", len(devs))
+
+	a := &circadian.Adjuster{
+		Schedule:   sched,
+		Devices:    devs,
+		Interval:   *interval,
+		Transition: *transition,
+		Logf:       log.Printf,
+	}
+	if err := a.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("Run: %v", err)
+	}
+}
+
+func parseTimeOfDay(name, s string) time.Duration {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		log.Fatalf("Bad %s %q: want HH:MM", name, s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+func discover(ctx context.Context, client *lifx.Client) []*lifx.Device {
+	dctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	devs, err := client.Discover(dctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Discover: %v", err)
+	}
+	if *labels == "" {
+		return devs
+	}
+	want := make(map[string]bool)
+	for _, l := range strings.Split(*labels, ",") {
+		want[strings.TrimSpace(l)] = true
+	}
+	var matched []*lifx.Device
+	for _, dev := range devs {
+		label, err := dev.GetLabel(ctx)
+		if err != nil {
+			log.Printf("GetLabel on %x: %v", dev.Serial, err)
+			continue
+		}
+		if want[label] {
+			matched = append(matched, dev)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// kind is how a payload field is encoded.
+type kind int
+
+const (
+	u8 kind = iota
+	u16
+	u32
+	u64
+	i16
+	f32
+	boolean
+	label     // 32 bytes of NUL-padded UTF-8
+	id        // 16 bytes
+	hsbk      // 8 bytes
+	colors    // up to n hsbk, with the count given by another field
+	millis    // uint32 milliseconds
+	seconds   // uint32 seconds
+	nanos     // uint64 nanoseconds
+	timestamp // uint64 nanoseconds since the Unix epoch
+	reserved  // n bytes, not shown
+	raw       // n bytes, shown in hex
+)
+
+// field is a payload field.
+type field struct {
+	name  string
+	kind  kind
+	n     int    // byte length for reserved and raw; maximum number of colors for colors
+	count string // name of the field holding the number of colors, for colors
+}
+
+func f(name string, k kind) field         { return field{name: name, kind: k} }
+func fn(name string, k kind, n int) field { return field{name: name, kind: k, n: n} }
+func fc(name string, max int, count string) field {
+	return field{name: name, kind: colors, n: max, count: count}
+}
+
+// Payload layouts, from https://lan.developer.lifx.com/docs/packet-contents.
+// Messages with empty payloads need no entry.
+var (
+	colorLayout      = []field{fn("reserved", reserved, 1), f("color", hsbk), f("duration", millis)}
+	membershipLayout = []field{f("id", id), f("label", label), f("updated_at", timestamp)}
+	waveformLayout   = []field{
+		fn("reserved", reserved, 1), f("transient", boolean), f("color", hsbk),
+		f("period", millis), f("cycles", f32), f("skew_ratio", i16), f("waveform", u8),
+	}
+	multiZoneEffectLayout = []field{
+		f("instance_id", u32), f("type", u8), fn("reserved", reserved, 2),
+		f("speed", millis), f("duration", nanos), fn("reserved", reserved, 8),
+		fn("parameters", raw, 32),
+	}
+	tileEffectLayout = []field{
+		f("instance_id", u32), f("type", u8), f("speed", millis),
+		f("duration", nanos), fn("reserved", reserved, 8), fn("parameters", raw, 32),
+		f("palette_count", u8), fc("palette", 16, "palette_count"),
+	}
+	hevConfigLayout = []field{f("indication", boolean), f("duration", seconds)}
+	relayLayout     = []field{f("relay_index", u8), f("level", u16)}
+	tileRectLayout  = []field{
+		f("tile_index", u8), f("length", u8), fn("reserved", reserved, 1),
+		f("x", u8), f("y", u8), f("width", u8),
+	}
+)
+
+var layouts = map[protocol.Type][]field{
+	protocol.StateService:      {f("service", u8), f("port", u32)},
+	protocol.StateHostFirmware: {f("build", timestamp), fn("reserved", reserved, 8), f("version_minor", u16), f("version_major", u16)},
+	protocol.StateWifiInfo:     {f("signal", f32)},
+	protocol.SetPower:          {f("level", u16)},
+	protocol.StatePower:        {f("level", u16)},
+	protocol.SetLabel:          {f("label", label)},
+	protocol.StateLabel:        {f("label", label)},
+	protocol.StateVersion:      {f("vendor", u32), f("product", u32)},
+	protocol.StateInfo:         {f("time", timestamp), f("uptime", nanos), f("downtime", nanos)},
+	protocol.SetLocation:       membershipLayout,
+	protocol.StateLocation:     membershipLayout,
+	protocol.SetGroup:          membershipLayout,
+	protocol.StateGroup:        membershipLayout,
+	protocol.EchoRequest:       {fn("echoing", raw, 64)},
+	protocol.EchoResponse:      {fn("echoing", raw, 64)},
+	protocol.SetColor:          colorLayout,
+	protocol.SetWaveform:       waveformLayout,
+	protocol.SetWaveformOptional: append(append([]field(nil), waveformLayout...),
+		f("set_hue", boolean), f("set_saturation", boolean),
+		f("set_brightness", boolean), f("set_kelvin", boolean)),
+	protocol.LightState:              {f("color", hsbk), fn("reserved", reserved, 2), f("power", u16), f("label", label), fn("reserved", reserved, 8)},
+	protocol.SetLightPower:           {f("level", u16), f("duration", millis)},
+	protocol.StateLightPower:         {f("level", u16)},
+	protocol.StateInfrared:           {f("brightness", u16)},
+	protocol.SetInfrared:             {f("brightness", u16)},
+	protocol.SetHevCycle:             {f("enable", boolean), f("duration", seconds)},
+	protocol.StateHevCycle:           {f("duration", seconds), f("remaining", seconds), f("last_power", boolean)},
+	protocol.SetHevCycleConfig:       hevConfigLayout,
+	protocol.StateHevCycleConfig:     hevConfigLayout,
+	protocol.StateLastHevCycleResult: {f("result", u8)},
+	protocol.StateUnhandled:          {f("unhandled_type", u16)},
+	protocol.SetColorZones: {
+		f("start_index", u8), f("end_index", u8), f("color", hsbk),
+		f("duration", millis), f("apply", u8),
+	},
+	protocol.GetColorZones:        {f("start_index", u8), f("end_index", u8)},
+	protocol.StateZone:            {f("count", u8), f("index", u8), f("color", hsbk)},
+	protocol.StateMultiZone:       {f("count", u8), f("index", u8), fc("colors", 8, "")},
+	protocol.SetMultiZoneEffect:   multiZoneEffectLayout,
+	protocol.StateMultiZoneEffect: multiZoneEffectLayout,
+	protocol.SetExtendedColorZones: {
+		f("duration", millis), f("apply", u8), f("index", u16),
+		f("colors_count", u8), fc("colors", 82, "colors_count"),
+	},
+	protocol.StateExtendedColorZones: {
+		f("count", u16), f("index", u16),
+		f("colors_count", u8), fc("colors", 82, "colors_count"),
+	},
+	protocol.SetUserPosition: {f("tile_index", u8), fn("reserved", reserved, 2), f("x", f32), f("y", f32)},
+	protocol.Get64:           tileRectLayout,
+	protocol.State64: {
+		f("tile_index", u8), fn("reserved", reserved, 1), f("x", u8), f("y", u8),
+		f("width", u8), fc("colors", 64, ""),
+	},
+	protocol.Set64: append(append([]field(nil), tileRectLayout...),
+		f("duration", millis), fc("colors", 64, "")),
+	protocol.GetTileEffect:   {fn("reserved", reserved, 2)},
+	protocol.SetTileEffect:   append([]field{fn("reserved", reserved, 2)}, tileEffectLayout...),
+	protocol.StateTileEffect: append([]field{fn("reserved", reserved, 1)}, tileEffectLayout...),
+	protocol.GetRPower:       {f("relay_index", u8)},
+	protocol.SetRPower:       relayLayout,
+	protocol.StateRPower:     relayLayout,
+}
+
+// size returns the encoded size of a field.
+func (fd field) size() int {
+	switch fd.kind {
+	case u8, boolean:
+		return 1
+	case u16, i16:
+		return 2
+	case u32, f32, millis, seconds:
+		return 4
+	case u64, nanos, timestamp:
+		return 8
+	case label:
+		return 32
+	case id:
+		return 16
+	case hsbk:
+		return 8
+	case colors:
+		return 8 * fd.n
+	}
+	return fd.n
+}
+
+// decodedField is a field's name and formatted value.
+type decodedField struct {
+	name, value string
+}
+
+// decodePayload decodes a payload of the given type.
+// Payloads of unknown types, and any excess bytes, are shown in hex.
+func decodePayload(typ protocol.Type, payload []byte) []decodedField {
+	layout, ok := layouts[typ]
+	if !ok {
+		if len(payload) == 0 {
+			return nil
+		}
+		return []decodedField{{"payload", hex.EncodeToString(payload)}}
+	}
+	var out []decodedField
+	ints := make(map[string]uint64) // for colors counts
+	b := payload
+	for _, fd := range layout {
+		n := fd.size()
+		if len(b) < n {
+			out = append(out, decodedField{fd.name, fmt.Sprintf("<truncated: need %d bytes, have %d>", n, len(b))})
+			return out
+		}
+		v := b[:n]
+		b = b[n:]
+		var s string
+		switch fd.kind {
+		case u8:
+			ints[fd.name] = uint64(v[0])
+			s = fmt.Sprint(v[0])
+		case u16:
+			x := binary.LittleEndian.Uint16(v)
+			ints[fd.name] = uint64(x)
+			s = fmt.Sprint(x)
+		case u32:
+			s = fmt.Sprint(binary.LittleEndian.Uint32(v))
+		case u64:
+			s = fmt.Sprint(binary.LittleEndian.Uint64(v))
+		case i16:
+			s = fmt.Sprint(int16(binary.LittleEndian.Uint16(v)))
+		case f32:
+			s = fmt.Sprint(math.Float32frombits(binary.LittleEndian.Uint32(v)))
+		case boolean:
+			s = fmt.Sprint(v[0] != 0)
+		case label:
+			s = fmt.Sprintf("%q", strings.TrimRight(string(v), "\x00"))
+		case id, raw:
+			s = hex.EncodeToString(v)
+		case hsbk:
+			s = formatHSBK(v)
+		case colors:
+			count := fd.n
+			if c, ok := ints[fd.count]; ok && int(c) < count {
+				count = int(c)
+			}
+			cs := make([]string, count)
+			for i := range cs {
+				cs[i] = formatHSBK(v[i*8 : i*8+8])
+			}
+			s = "[" + strings.Join(cs, ", ") + "]"
+		case millis:
+			s = fmt.Sprint(time.Duration(binary.LittleEndian.Uint32(v)) * time.Millisecond)
+		case seconds:
+			s = fmt.Sprint(time.Duration(binary.LittleEndian.Uint32(v)) * time.Second)
+		case nanos:
+			s = fmt.Sprint(time.Duration(binary.LittleEndian.Uint64(v)))
+		case timestamp:
+			if ns := binary.LittleEndian.Uint64(v); ns == 0 {
+				s = "0"
+			} else {
+				s = time.Unix(0, int64(ns)).UTC().Format(time.RFC3339Nano)
+			}
+		case reserved:
+			continue
+		}
+		out = append(out, decodedField{fd.name, s})
+	}
+	if len(b) > 0 {
+		out = append(out, decodedField{"excess", hex.EncodeToString(b)})
+	}
+	return out
+}
+
+// formatHSBK formats an encoded color in human units.
+func formatHSBK(b []byte) string {
+	h := binary.LittleEndian.Uint16(b[0:2])
+	s := binary.LittleEndian.Uint16(b[2:4])
+	br := binary.LittleEndian.Uint16(b[4:6])
+	k := binary.LittleEndian.Uint16(b[6:8])
+	return fmt.Sprintf("hsbk(%.0f°, %.0f%%, %.0f%%, %dK)",
+		float64(h)/0x10000*360, float64(s)/0xFFFF*100, float64(br)/0xFFFF*100, k)
+}
@@ -0,0 +1,133 @@
+// The decode command prints the LIFX packets in a packet capture,
+// with their message types named and their payloads decoded.
+// It is useful for seeing what other LIFX clients, such as the official app, send.
+//
+// Usage:
+//
+//	decode [-port 56700] [file ...]
+//
+// Each file, or standard input if there are none or the file is "-",
+// is either a pcap or pcapng capture, such as written by
+//
+//	tcpdump -w lifx.pcap udp port 56700
+//
+// or a hex dump with one packet per line. In hex dumps, whitespace and colons
+// are ignored, as are blank lines and lines starting with #.
+//
+// Packets that can't be decoded are reported, and decoding continues.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+var port = flag.Int("port", 56700, "UDP `port` of LIFX packets in captures")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: decode [-port port] [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	ok := true
+	for _, file := range files {
+		if err := decodeFile(w, file); err != nil {
+			w.Flush()
+			log.Printf("%s: %v", file, err)
+			ok = false
+		}
+	}
+	if !ok {
+		w.Flush()
+		os.Exit(1)
+	}
+}
+
+func decodeFile(w io.Writer, file string) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	br := bufio.NewReader(r)
+	fn := func(p packet) { printPacket(w, p) }
+	if isCapture(br) {
+		return readCapture(br, fn)
+	}
+	return readHex(br, fn)
+}
+
+// readHex reads a hex dump, calling fn for each packet in it.
+func readHex(r io.Reader, fn func(packet)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.Map(func(r rune) rune {
+			if r == ':' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, line)
+		data, err := hex.DecodeString(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		fn(packet{data: data})
+	}
+	return sc.Err()
+}
+
+func printPacket(w io.Writer, p packet) {
+	if !p.time.IsZero() {
+		fmt.Fprintf(w, "%s ", p.time.UTC().Format("15:04:05.000000"))
+	}
+	if p.src != nil {
+		fmt.Fprintf(w, "%v > %v ", p.src, p.dst)
+	}
+	hdr, payload, err := protocol.Decode(p.data)
+	if err != nil {
+		fmt.Fprintf(w, "bad packet: %v\n    % x\n", err, p.data)
+		return
+	}
+	fmt.Fprintf(w, "%v source=%08x", hdr.Type, hdr.Source)
+	if hdr.Tagged {
+		fmt.Fprintf(w, " tagged")
+	} else {
+		fmt.Fprintf(w, " target=%x", hdr.Target[:6])
+	}
+	fmt.Fprintf(w, " seq=%d", hdr.Sequence)
+	if hdr.AckRequired {
+		fmt.Fprintf(w, " ack")
+	}
+	if hdr.ResRequired {
+		fmt.Fprintf(w, " res")
+	}
+	fmt.Fprintln(w)
+	for _, f := range decodePayload(hdr.Type, payload) {
+		fmt.Fprintf(w, "    %s: %s\n", f.name, f.value)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// packet is a LIFX packet found in the input.
+type packet struct {
+	time     time.Time // zero if unknown
+	src, dst *net.UDPAddr
+	data     []byte
+}
+
+// Magic numbers at the start of capture files.
+const (
+	pcapMagic      = 0xa1b2c3d4
+	pcapMagicNanos = 0xa1b23c4d
+	pcapngMagic    = 0x0a0d0d0a // block type of the section header block
+)
+
+// Link types. https://www.tcpdump.org/linktypes.html
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkSLL2     = 276
+)
+
+// isCapture reports whether the input starts like a pcap or pcapng file.
+func isCapture(r *bufio.Reader) bool {
+	b, err := r.Peek(4)
+	if err != nil {
+		return false
+	}
+	for _, m := range []uint32{binary.LittleEndian.Uint32(b), binary.BigEndian.Uint32(b)} {
+		switch m {
+		case pcapMagic, pcapMagicNanos, pcapngMagic:
+			return true
+		}
+	}
+	return false
+}
+
+// readCapture reads a pcap or pcapng file, calling fn for each LIFX packet in it.
+func readCapture(r *bufio.Reader, fn func(packet)) error {
+	b, _ := r.Peek(4)
+	if binary.LittleEndian.Uint32(b) == pcapngMagic {
+		return readPcapng(r, fn)
+	}
+	return readPcap(r, fn)
+}
+
+func readPcap(r io.Reader, fn func(packet)) error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("reading pcap header: %w", err)
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	magic := bo.Uint32(hdr[0:4])
+	if magic != pcapMagic && magic != pcapMagicNanos {
+		bo = binary.BigEndian
+		magic = bo.Uint32(hdr[0:4])
+	}
+	tsUnit := time.Microsecond
+	if magic == pcapMagicNanos {
+		tsUnit = time.Nanosecond
+	}
+	link := bo.Uint32(hdr[20:24]) & 0x0FFFFFFF // the upper bits are FCS information
+
+	var rec [16]byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading pcap record: %w", err)
+		}
+		ts := time.Unix(int64(bo.Uint32(rec[0:4])), int64(bo.Uint32(rec[4:8]))*int64(tsUnit))
+		data := make([]byte, bo.Uint32(rec[8:12]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("reading pcap record: %w", err)
+		}
+		if p, ok := extract(link, data); ok {
+			p.time = ts
+			fn(p)
+		}
+	}
+}
+
+func readPcapng(r io.Reader, fn func(packet)) error {
+	var bo binary.ByteOrder = binary.LittleEndian
+	type iface struct {
+		link   uint32
+		tsUnit time.Duration
+	}
+	var ifaces []iface
+	for {
+		var bh [8]byte
+		if _, err := io.ReadFull(r, bh[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading pcapng block: %w", err)
+		}
+		typ := bo.Uint32(bh[0:4])
+		if typ == pcapngMagic {
+			// The byte order magic follows the length, so peek at it first.
+			var bom [4]byte
+			if _, err := io.ReadFull(r, bom[:]); err != nil {
+				return fmt.Errorf("reading pcapng section header: %w", err)
+			}
+			if binary.LittleEndian.Uint32(bom[:]) == 0x1a2b3c4d {
+				bo = binary.LittleEndian
+			} else {
+				bo = binary.BigEndian
+			}
+			ifaces = nil
+			length := bo.Uint32(bh[4:8])
+			if length < 16 {
+				return fmt.Errorf("pcapng section header block too short: %d", length)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(length)-12); err != nil {
+				return fmt.Errorf("reading pcapng section header: %w", err)
+			}
+			continue
+		}
+		length := bo.Uint32(bh[4:8])
+		if length < 12 || length%4 != 0 {
+			return fmt.Errorf("pcapng block has bad length %d", length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("reading pcapng block: %w", err)
+		}
+		body = body[:len(body)-4] // trailing length
+
+		switch typ {
+		case 1: // Interface Description Block
+			if len(body) < 8 {
+				return errors.New("pcapng interface description block too short")
+			}
+			ifc := iface{link: uint32(bo.Uint16(body[0:2])), tsUnit: time.Microsecond}
+			// Look for the if_tsresol option.
+			for opts := body[8:]; len(opts) >= 4; {
+				code, olen := bo.Uint16(opts[0:2]), int(bo.Uint16(opts[2:4]))
+				if code == 0 || len(opts) < 4+olen {
+					break
+				}
+				if code == 9 && olen >= 1 {
+					res := opts[4]
+					if res&0x80 == 0 {
+						ifc.tsUnit = time.Second
+						for i := byte(0); i < res; i++ {
+							ifc.tsUnit /= 10
+						}
+					}
+					// Power-of-two resolutions are rare enough to ignore.
+				}
+				opts = opts[4+(olen+3)&^3:]
+			}
+			ifaces = append(ifaces, ifc)
+		case 6: // Enhanced Packet Block
+			if len(body) < 20 {
+				return errors.New("pcapng enhanced packet block too short")
+			}
+			id := bo.Uint32(body[0:4])
+			if int(id) >= len(ifaces) {
+				return fmt.Errorf("pcapng packet for unknown interface %d", id)
+			}
+			ifc := ifaces[id]
+			ts := uint64(bo.Uint32(body[4:8]))<<32 | uint64(bo.Uint32(body[8:12]))
+			capLen := int(bo.Uint32(body[12:16]))
+			if 20+capLen > len(body) {
+				return errors.New("pcapng enhanced packet block truncated")
+			}
+			if p, ok := extract(ifc.link, body[20:20+capLen]); ok {
+				p.time = time.Unix(0, 0).Add(time.Duration(ts) * ifc.tsUnit)
+				fn(p)
+			}
+		}
+	}
+}
+
+// extract returns the LIFX packet in a captured frame, if any.
+// Only unfragmented IPv4 UDP to or from the LIFX port is considered.
+func extract(link uint32, b []byte) (packet, bool) {
+	switch link {
+	case linkNull, linkLoop:
+		// A 4-byte address family, in either byte order.
+		if len(b) < 4 {
+			return packet{}, false
+		}
+		if af := binary.LittleEndian.Uint32(b); af != 2 && binary.BigEndian.Uint32(b) != 2 {
+			return packet{}, false
+		}
+		b = b[4:]
+	case linkEthernet:
+		if len(b) < 14 {
+			return packet{}, false
+		}
+		et := binary.BigEndian.Uint16(b[12:14])
+		b = b[14:]
+		for et == 0x8100 || et == 0x88a8 { // VLAN tags
+			if len(b) < 4 {
+				return packet{}, false
+			}
+			et = binary.BigEndian.Uint16(b[2:4])
+			b = b[4:]
+		}
+		if et != 0x0800 {
+			return packet{}, false
+		}
+	case linkSLL:
+		if len(b) < 16 || binary.BigEndian.Uint16(b[14:16]) != 0x0800 {
+			return packet{}, false
+		}
+		b = b[16:]
+	case linkSLL2:
+		if len(b) < 20 || binary.BigEndian.Uint16(b[0:2]) != 0x0800 {
+			return packet{}, false
+		}
+		b = b[20:]
+	case linkRaw, linkIPv4:
+	default:
+		return packet{}, false
+	}
+
+	// IPv4.
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return packet{}, false
+	}
+	ihl := int(b[0]&0x0F) * 4
+	total := int(binary.BigEndian.Uint16(b[2:4]))
+	if ihl < 20 || total < ihl || total > len(b) {
+		return packet{}, false
+	}
+	if b[9] != 17 { // UDP
+		return packet{}, false
+	}
+	if flags := binary.BigEndian.Uint16(b[6:8]); flags&0x2000 != 0 || flags&0x1FFF != 0 {
+		return packet{}, false // fragmented
+	}
+	srcIP, dstIP := net.IP(append([]byte(nil), b[12:16]...)), net.IP(append([]byte(nil), b[16:20]...))
+	b = b[ihl:total]
+
+	// UDP.
+	if len(b) < 8 {
+		return packet{}, false
+	}
+	srcPort, dstPort := int(binary.BigEndian.Uint16(b[0:2])), int(binary.BigEndian.Uint16(b[2:4]))
+	ulen := int(binary.BigEndian.Uint16(b[4:6]))
+	if ulen < 8 || ulen > len(b) {
+		return packet{}, false
+	}
+	if srcPort != *port && dstPort != *port {
+		return packet{}, false
+	}
+	return packet{
+		src:  &net.UDPAddr{IP: srcIP, Port: srcPort},
+		dst:  &net.UDPAddr{IP: dstIP, Port: dstPort},
+		data: b[8:ulen],
+	}, true
+}
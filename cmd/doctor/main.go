@@ -0,0 +1,199 @@
+// The doctor command diagnoses common network problems that stop LIFX LAN control working.
+//
+// It checks local network configuration, broadcast discovery,
+// and per-device packet loss and latency, and prints its findings.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+var (
+	wait  = flag.Duration("wait", 2*time.Second, "how long to wait for discovery responses")
+	pings = flag.Int("pings", 10, "number of echo requests to send to each device")
+)
+
+// Thresholds for per-device findings.
+const (
+	lossWarn = 0.1
+	rttWarn  = 200 * time.Millisecond
+)
+
+type finding struct {
+	problem bool
+	text    string
+}
+
+var findings []finding
+
+func ok(format string, args ...interface{}) {
+	findings = append(findings, finding{false, fmt.Sprintf(format, args...)})
+}
+
+func problem(format string, args ...interface{}) {
+	findings = append(findings, finding{true, fmt.Sprintf(format, args...)})
+}
+
+func main() {
+	flag.Parse()
+	ctx := context.Background()
+
+	checkInterfaces()
+	checkPort()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		problem("Creating a client failed: %v. Check that this host permits UDP sockets with broadcast enabled.", err)
+		report()
+	}
+	defer client.Close()
+
+	devs := checkDiscovery(ctx, client)
+	for _, dev := range devs {
+		checkDevice(ctx, dev)
+	}
+	report()
+}
+
+func checkInterfaces() {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		problem("Listing network interfaces failed: %v", err)
+		return
+	}
+	n := 0
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 || ifi.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok || ipn.IP.To4() == nil {
+				continue
+			}
+			n++
+			fmt.Printf("Interface %s: %v\n", ifi.Name, ipn)
+		}
+	}
+	if n == 0 {
+		problem("No up, broadcast-capable IPv4 interfaces found. LIFX devices are only reachable over IPv4 on the local network.")
+	} else if n > 1 {
+		ok("Multiple IPv4 interfaces are up; discovery broadcasts go out whichever the OS routes 255.255.255.255 through. " +
+			"If devices are missing, check that interface is the one on the lights' network.")
+	}
+}
+
+func checkPort() {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: 56700})
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			ok("UDP port 56700 is in use, probably by another LIFX app or relay on this host. " +
+				"That's fine for this library, which uses an ephemeral port.")
+		} else {
+			ok("Binding UDP port 56700 failed (%v). That's fine for this library, which uses an ephemeral port.", err)
+		}
+		return
+	}
+	conn.Close()
+}
+
+func checkDiscovery(ctx context.Context, client *lifx.Client) []*lifx.Device {
+	// Discover twice; devices that only show up once suggest lossy Wi-Fi.
+	seen := make(map[[6]byte]int)
+	var all []*lifx.Device
+	for i := 0; i < 2; i++ {
+		dctx, cancel := context.WithTimeout(ctx, *wait)
+		devs, err := client.Discover(dctx)
+		cancel()
+		if err != nil {
+			problem("Discovery failed: %v", err)
+			return nil
+		}
+		for _, dev := range devs {
+			if seen[dev.Serial] == 0 {
+				all = append(all, dev)
+			}
+			seen[dev.Serial]++
+		}
+	}
+	fmt.Printf("Discovered %d device(s)\n", len(all))
+
+	if len(all) == 0 {
+		problem("No devices responded to broadcast discovery. Common causes:\n" +
+			"    - a host firewall dropping inbound UDP from port 56700 (responses are unicast back to this host)\n" +
+			"    - Wi-Fi \"client isolation\" or \"AP isolation\" on the access point\n" +
+			"    - this host and the lights being on different subnets or VLANs (see the relay command)\n" +
+			"    - the lights being powered off at the wall")
+		return nil
+	}
+	for _, dev := range all {
+		if seen[dev.Serial] < 2 {
+			problem("Device %x (%v) only answered one of two discovery broadcasts; its connection may be lossy.", dev.Serial, dev.Addr.IP)
+		}
+	}
+	return all
+}
+
+func checkDevice(ctx context.Context, dev *lifx.Device) {
+	name := fmt.Sprintf("%x (%v)", dev.Serial, dev.Addr.IP)
+	if label, err := dev.GetLabel(ctx); err == nil {
+		name = fmt.Sprintf("%q %s", label, name)
+	}
+	stats, err := dev.Ping(ctx, *pings)
+	if err != nil {
+		problem("Device %s: ping failed: %v", name, err)
+		return
+	}
+	fmt.Printf("Device %s: %v\n", name, stats)
+	if wi, err := dev.GetWifiInfo(ctx); err == nil {
+		db, rssi := wi.Strength()
+		unit := "dB SNR"
+		if rssi {
+			unit = "dBm RSSI"
+		}
+		fmt.Printf("Device %s: Wi-Fi signal %d %s (%v)\n", name, db, unit, wi.Quality())
+		if wi.Quality() <= lifx.BadSignal {
+			problem("Device %s has a %v Wi-Fi signal. Consider moving the access point closer or adding another.", name, wi.Quality())
+		}
+	}
+	switch {
+	case stats.Received == 0:
+		problem("Device %s answered discovery but no echo requests. "+
+			"Unicast traffic to it may be blocked, or its address may have changed.", name)
+	case stats.Loss() >= lossWarn:
+		problem("Device %s has %.0f%% packet loss. Check its Wi-Fi signal strength and distance from the access point.", name, stats.Loss()*100)
+	case stats.Avg >= rttWarn:
+		problem("Device %s has a high average round trip time of %v. The Wi-Fi network may be congested.", name, stats.Avg)
+	}
+}
+
+func report() {
+	fmt.Println()
+	problems := 0
+	for _, f := range findings {
+		mark := "info"
+		if f.problem {
+			mark = "PROBLEM"
+			problems++
+		}
+		fmt.Printf("[%s] %s\n", mark, f.text)
+	}
+	if problems == 0 {
+		fmt.Println("No problems found.")
+		os.Exit(0)
+	}
+	os.Exit(1)
+}
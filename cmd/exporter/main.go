@@ -0,0 +1,207 @@
+// The exporter command exposes the state of LIFX devices as Prometheus metrics.
+//
+// Devices are polled every -interval, and /metrics serves gauges for each
+// device's reachability, power, color, Wi-Fi signal and uptime, labeled with
+// its serial, label and product name.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+var (
+	listenAddr = flag.String("listen", ":9750", "`address` to serve metrics on")
+	interval   = flag.Duration("interval", 30*time.Second, "how often to poll devices")
+)
+
+// deviceMetrics is what is known about one device.
+type deviceMetrics struct {
+	dev     *lifx.Device
+	state   lifx.WatchedState
+	product string
+
+	hasWifi bool
+	wifi    int // dB
+
+	hasInfo bool
+	uptime  time.Duration
+}
+
+type exporter struct {
+	mu   sync.Mutex
+	devs map[[6]byte]*deviceMetrics
+}
+
+func main() {
+	flag.Parse()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	e := &exporter{devs: make(map[[6]byte]*deviceMetrics)}
+	ctx := context.Background()
+	go e.watch(ctx, client)
+	go e.poll(ctx)
+
+	http.Handle("/metrics", e)
+	log.Printf("Serving metrics on %s/metrics", *listenAddr)
+	log.Fatal(http.ListenAndServe(*listenAddr, nil))
+}
+
+// watch tracks reachability, power and color.
+func (e *exporter) watch(ctx context.Context, client *lifx.Client) {
+	for ev := range client.Watch(ctx, *interval) {
+		e.mu.Lock()
+		dm, ok := e.devs[ev.State.Serial]
+		if !ok {
+			dm = &deviceMetrics{dev: ev.Device}
+			e.devs[ev.State.Serial] = dm
+		}
+		dm.state = ev.State
+		e.mu.Unlock()
+	}
+}
+
+// poll collects the metrics that Watch doesn't.
+func (e *exporter) poll(ctx context.Context) {
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		e.mu.Lock()
+		var devs lifx.Collection
+		for _, dm := range e.devs {
+			if dm.state.Reachable {
+				devs = append(devs, dm.dev)
+			}
+		}
+		e.mu.Unlock()
+
+		pctx, cancel := context.WithTimeout(ctx, *interval)
+		err := devs.Each(pctx, func(ctx context.Context, d *lifx.Device) error {
+			var product string
+			if p, err := d.Product(ctx); err == nil {
+				product = p.Name
+			}
+			wi, werr := d.GetWifiInfo(ctx)
+			info, ierr := d.GetInfo(ctx)
+
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			dm := e.devs[d.Serial]
+			if product != "" {
+				dm.product = product
+			}
+			if dm.hasWifi = werr == nil; dm.hasWifi {
+				dm.wifi, _ = wi.Strength()
+			}
+			if dm.hasInfo = ierr == nil; dm.hasInfo {
+				dm.uptime = info.Uptime
+			}
+			if werr != nil {
+				return fmt.Errorf("GetWifiInfo: %w", werr)
+			}
+			if ierr != nil {
+				return fmt.Errorf("GetInfo: %w", ierr)
+			}
+			return nil
+		})
+		cancel()
+		if err != nil {
+			log.Printf("Polling: %v", err)
+		}
+	}
+}
+
+// metric is a gauge, with a function that returns its value for a device, if it has one.
+type metric struct {
+	name, help string
+	value      func(dm *deviceMetrics) (float64, bool)
+}
+
+var metrics = []metric{
+	{"lifx_device_up", "Whether the device is reachable.", func(dm *deviceMetrics) (float64, bool) {
+		if dm.state.Reachable {
+			return 1, true
+		}
+		return 0, true
+	}},
+	{"lifx_device_power", "Power level, from 0 to 1.", func(dm *deviceMetrics) (float64, bool) {
+		return float64(dm.state.Power) / 0xFFFF, dm.state.Reachable
+	}},
+	{"lifx_device_hue_degrees", "Hue of the light.", func(dm *deviceMetrics) (float64, bool) {
+		return float64(dm.state.Color.Hue) / 0x10000 * 360, dm.state.Reachable
+	}},
+	{"lifx_device_saturation", "Saturation of the light, from 0 to 1.", func(dm *deviceMetrics) (float64, bool) {
+		return float64(dm.state.Color.Saturation) / 0xFFFF, dm.state.Reachable
+	}},
+	{"lifx_device_brightness", "Brightness of the light, from 0 to 1.", func(dm *deviceMetrics) (float64, bool) {
+		return float64(dm.state.Color.Brightness) / 0xFFFF, dm.state.Reachable
+	}},
+	{"lifx_device_kelvin", "Color temperature of the light.", func(dm *deviceMetrics) (float64, bool) {
+		return float64(dm.state.Color.Kelvin), dm.state.Reachable
+	}},
+	{"lifx_device_wifi_signal_db", "Wi-Fi signal strength.", func(dm *deviceMetrics) (float64, bool) {
+		return float64(dm.wifi), dm.state.Reachable && dm.hasWifi
+	}},
+	{"lifx_device_uptime_seconds", "Time since the device booted.", func(dm *deviceMetrics) (float64, bool) {
+		return dm.uptime.Seconds(), dm.state.Reachable && dm.hasInfo
+	}},
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.write(w)
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+func (e *exporter) write(w io.Writer) {
+	serials := make([][6]byte, 0, len(e.devs))
+	for serial := range e.devs {
+		serials = append(serials, serial)
+	}
+	sort.Slice(serials, func(i, j int) bool { return bytes.Compare(serials[i][:], serials[j][:]) < 0 })
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, serial := range serials {
+			dm := e.devs[serial]
+			v, ok := m.value(dm)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "%s{serial=\"%x\",label=\"%s\",product=\"%s\"} %g\n",
+				m.name, serial, escape(dm.state.Label), escape(dm.product), v)
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape escapes a label value for the text exposition format.
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
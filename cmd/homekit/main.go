@@ -0,0 +1,278 @@
+// The homekit command exposes LIFX devices to Apple HomeKit.
+//
+// It discovers devices at startup and presents each as a lightbulb accessory
+// behind a HomeKit bridge, with power and brightness, plus hue and saturation
+// for color devices and color temperature for those with a temperature range.
+// Changes made in HomeKit are sent to the devices, and changes made elsewhere
+// are reflected in HomeKit.
+//
+// Add the bridge in the Home app using the -pin setup code.
+// Pairing data is kept in the -db directory, which must persist between runs.
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"github.com/dsymonds/lifx"
+)
+
+var (
+	pin      = flag.String("pin", "00102003", "HomeKit setup `code`")
+	dbDir    = flag.String("db", "homekit-db", "`directory` in which to store pairing data")
+	labels   = flag.String("labels", "", "comma-separated `labels` of devices to expose; empty means all")
+	discover = flag.Duration("discover", 5*time.Second, "how long to wait for devices to respond to discovery")
+	interval = flag.Duration("interval", 5*time.Second, "how often to poll devices for state changes")
+)
+
+// opTimeout bounds each change sent to a device.
+const opTimeout = 10 * time.Second
+
+// light is a LIFX device exposed as a HomeKit lightbulb.
+type light struct {
+	dev *lifx.Device
+	acc *accessory.A
+
+	on         *characteristic.On
+	brightness *characteristic.Brightness
+	hue        *characteristic.Hue              // nil for devices without color
+	saturation *characteristic.Saturation       // nil for devices without color
+	temp       *characteristic.ColorTemperature // nil for devices without a temperature range
+
+	mu     sync.Mutex
+	kelvin uint16 // last known, for devices without temperature control
+}
+
+func main() {
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	lights := findLights(ctx, client)
+	if len(lights) == 0 {
+		log.Fatalf("No matching devices found")
+	}
+	bySerial := make(map[[6]byte]*light)
+	var accs []*accessory.A
+	for _, l := range lights {
+		bySerial[l.dev.Serial] = l
+		accs = append(accs, l.acc)
+	}
+
+	bridge := accessory.NewBridge(accessory.Info{
+		Name:         "LIFX",
+		Manufacturer: "LIFX",
+	})
+	server, err := hap.NewServer(hap.NewFsStore(*dbDir), bridge.A, accs...)
+	if err != nil {
+		log.Fatalf("Creating HomeKit server: %v", err)
+	}
+	server.Pin = *pin
+
+	go func() {
+		for ev := range client.Watch(ctx, *interval) {
+			if l, ok := bySerial[ev.State.Serial]; ok {
+				l.update(ev.State)
+			}
+		}
+	}()
+
+	log.Printf("Exposing %d device(s) to HomeKit", len(lights))
+	if err := server.ListenAndServe(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("Serving HomeKit: %v", err)
+	}
+}
+
+func findLights(ctx context.Context, client *lifx.Client) []*light {
+	dctx, cancel := context.WithTimeout(ctx, *discover)
+	devs, err := client.Discover(dctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Discover: %v", err)
+	}
+	want := make(map[string]bool)
+	if *labels != "" {
+		for _, l := range strings.Split(*labels, ",") {
+			want[strings.TrimSpace(l)] = true
+		}
+	}
+	var lights []*light
+	for _, dev := range devs {
+		label, err := dev.GetLabel(ctx)
+		if err != nil {
+			log.Printf("GetLabel on %x: %v", dev.Serial, err)
+			continue
+		}
+		if len(want) > 0 && !want[label] {
+			continue
+		}
+		p, err := dev.Product(ctx)
+		if err != nil {
+			log.Printf("Product of %x: %v", dev.Serial, err)
+			continue
+		}
+		lights = append(lights, newLight(dev, label, p))
+	}
+	return lights
+}
+
+func newLight(dev *lifx.Device, label string, p lifx.Product) *light {
+	l := &light{dev: dev}
+	l.acc = accessory.New(accessory.Info{
+		Name:         label,
+		SerialNumber: strings.ToUpper(hex.EncodeToString(dev.Serial[:])),
+		Manufacturer: "LIFX",
+		Model:        p.Name,
+	}, accessory.TypeLightbulb)
+	// Keep accessory IDs stable across restarts, so HomeKit keeps its configuration.
+	// IDs 1 (the bridge) and 0 are reserved.
+	var id [8]byte
+	copy(id[2:], dev.Serial[:])
+	l.acc.Id = binary.BigEndian.Uint64(id[:]) + 2
+
+	svc := service.NewLightbulb()
+	l.on = svc.On
+	l.brightness = characteristic.NewBrightness()
+	svc.AddC(l.brightness.C)
+	if p.Features.Color != nil && *p.Features.Color {
+		l.hue = characteristic.NewHue()
+		svc.AddC(l.hue.C)
+		l.saturation = characteristic.NewSaturation()
+		svc.AddC(l.saturation.C)
+	}
+	if tr := p.Features.TemperatureRange; len(tr) == 2 && tr[0] < tr[1] {
+		l.temp = characteristic.NewColorTemperature()
+		// HomeKit uses mireds, which are inversely proportional to kelvin.
+		l.temp.SetMinValue(clampMired(kelvinToMired(tr[1])))
+		l.temp.SetMaxValue(clampMired(kelvinToMired(tr[0])))
+		svc.AddC(l.temp.C)
+	}
+	l.acc.AddS(svc.S)
+
+	l.on.OnValueRemoteUpdate(func(on bool) {
+		var level uint16
+		if on {
+			level = 0xFFFF
+		}
+		l.do("SetLightPower", func(ctx context.Context) error {
+			return l.dev.SetLightPower(ctx, level, 0)
+		})
+	})
+	l.brightness.OnValueRemoteUpdate(func(int) { l.setColor() })
+	if l.hue != nil {
+		l.hue.OnValueRemoteUpdate(func(float64) { l.setColor() })
+		l.saturation.OnValueRemoteUpdate(func(float64) { l.setColor() })
+	}
+	if l.temp != nil {
+		l.temp.OnValueRemoteUpdate(func(int) {
+			// Picking a temperature means white light.
+			if l.saturation != nil {
+				l.saturation.SetValue(0)
+			}
+			l.setColor()
+		})
+	}
+	return l
+}
+
+// do runs a device operation, logging any error.
+func (l *light) do(what string, op func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := op(ctx); err != nil {
+		log.Printf("%s on %x: %v", what, l.dev.Serial, err)
+	}
+}
+
+// color returns the color described by the HomeKit characteristics.
+func (l *light) color() lifx.Color {
+	l.mu.Lock()
+	c := lifx.Color{Kelvin: l.kelvin}
+	l.mu.Unlock()
+	c.Brightness = uint16(math.Round(float64(l.brightness.Value()) / 100 * 0xFFFF))
+	if l.hue != nil {
+		c.Hue = uint16(int(math.Round(l.hue.Value()/360*0x10000)) & 0xFFFF)
+		c.Saturation = uint16(math.Round(l.saturation.Value() / 100 * 0xFFFF))
+	}
+	if l.temp != nil {
+		c.Kelvin = miredToKelvin(l.temp.Value())
+	}
+	if c.Kelvin == 0 {
+		c.Kelvin = lifx.DefaultKelvin
+	}
+	return c
+}
+
+func (l *light) setColor() {
+	c := l.color()
+	l.do("SetColor", func(ctx context.Context) error {
+		return l.dev.SetColor(ctx, c, 0)
+	})
+}
+
+// update reflects a device's state in HomeKit.
+func (l *light) update(st lifx.WatchedState) {
+	if !st.Reachable {
+		return
+	}
+	l.on.SetValue(st.Power > 0)
+	l.brightness.SetValue(int(math.Round(float64(st.Color.Brightness) / 0xFFFF * 100)))
+	if l.hue != nil {
+		l.hue.SetValue(float64(st.Color.Hue) / 0x10000 * 360)
+		l.saturation.SetValue(float64(st.Color.Saturation) / 0xFFFF * 100)
+	}
+	if l.temp != nil && st.Color.Kelvin != 0 {
+		l.temp.SetValue(clampMired(kelvinToMired(st.Color.Kelvin)))
+	}
+	l.mu.Lock()
+	l.kelvin = st.Color.Kelvin
+	l.mu.Unlock()
+}
+
+func kelvinToMired(k uint16) int {
+	if k == 0 {
+		return 0
+	}
+	return int(math.Round(1e6 / float64(k)))
+}
+
+func miredToKelvin(m int) uint16 {
+	if m <= 0 {
+		return 0
+	}
+	return uint16(math.Round(1e6 / float64(m)))
+}
+
+// clampMired limits m to the range HomeKit accepts.
+func clampMired(m int) int {
+	const lo, hi = 140, 500
+	switch {
+	case m < lo:
+		return lo
+	case m > hi:
+		return hi
+	}
+	return m
+}
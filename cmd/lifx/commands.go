@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/internal/command"
+	"github.com/dsymonds/lifx/scene"
+)
+
+// listEntry is the JSON form of a device in the output of list.
+type listEntry struct {
+	command.State
+	Alias   string `json:"alias,omitempty"`
+	Product string `json:"product,omitempty"`
+	Addr    string `json:"addr"`
+	Error   string `json:"error,omitempty"`
+
+	color lifx.Color
+}
+
+func runList(ctx context.Context, client *lifx.Client, args []string) error {
+	if len(args) != 0 {
+		return usageError("list takes no arguments")
+	}
+	fs, err := discover(ctx, client)
+	if err != nil {
+		return err
+	}
+	if *quiet {
+		for _, f := range fs {
+			fmt.Printf("%x\n", f.dev.Serial)
+		}
+		return nil
+	}
+
+	names := make(map[[6]byte]string)
+	if a, err := client.Aliases(); err == nil {
+		for name, serial := range a {
+			names[serial] = name
+		}
+	}
+	entries := make([]listEntry, len(fs))
+	var wg sync.WaitGroup
+	for i, f := range fs {
+		i, f := i, f
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := &entries[i]
+			e.Addr = f.dev.Addr.String()
+			e.Alias = names[f.dev.Serial]
+			st := lifx.WatchedState{Serial: f.dev.Serial, Label: f.label}
+			var err error
+			if st.Power, err = f.dev.GetLightPower(ctx); err == nil {
+				st.Color, err = f.dev.GetColor(ctx)
+			}
+			st.Reachable = err == nil
+			if err != nil {
+				e.Error = err.Error()
+			}
+			e.State, e.color = command.StateOf(st), st.Color
+			if p, err := f.dev.Product(ctx); err == nil {
+				e.Product = p.Name
+			}
+		}()
+	}
+	wg.Wait()
+	if *jsonOut {
+		return writeJSON(entries)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SERIAL\tALIAS\tLABEL\tPOWER\tCOLOR\tPRODUCT\tADDRESS\n")
+	for _, e := range entries {
+		power, color := "?", "error: "+e.Error
+		if e.Reachable {
+			power, color = e.Power, formatColor(e.color)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Serial, e.Alias, e.Label, power, color, e.Product, e.Addr)
+	}
+	return tw.Flush()
+}
+
+// infoEntry is the JSON form of a device in the output of info.
+// Fields that couldn't be determined are omitted, and their errors listed.
+type infoEntry struct {
+	Serial   string            `json:"serial"`
+	Addr     string            `json:"addr"`
+	Label    string            `json:"label,omitempty"`
+	Product  *productEntry     `json:"product,omitempty"`
+	Firmware string            `json:"firmware,omitempty"`
+	State    *command.State    `json:"state,omitempty"`
+	Zones    *int              `json:"zones,omitempty"` // absent for non-multizone devices
+	Ping     *pingEntry        `json:"ping,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+
+	color lifx.Color
+	ping  lifx.PingStats
+}
+
+type productEntry struct {
+	PID      uint32                   `json:"pid"`
+	Name     string                   `json:"name"`
+	Features lifx.ProductCapabilities `json:"features"`
+}
+
+type pingEntry struct {
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	AvgMS    float64 `json:"avg_ms,omitempty"`
+}
+
+func runInfo(ctx context.Context, client *lifx.Client, args []string) error {
+	if len(args) != 1 {
+		return usageError("info needs a device")
+	}
+	devs, err := resolve(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	if *quiet {
+		for _, d := range devs {
+			fmt.Printf("%x\n", d.Serial)
+		}
+		return nil
+	}
+
+	entries := make([]infoEntry, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries[i] = info(ctx, d)
+		}()
+	}
+	wg.Wait()
+	if *jsonOut {
+		return writeJSON(entries)
+	}
+
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%s)\n", e.Serial, e.Addr)
+		show := func(what string, v interface{}) {
+			if err, ok := e.Errors[what]; ok {
+				v = "[" + err + "]"
+			}
+			fmt.Printf("  %-10s %v\n", what+":", v)
+		}
+		show("label", fmt.Sprintf("%q", e.Label))
+		if p := e.Product; p != nil {
+			show("product", fmt.Sprintf("%s (pid %d)", p.Name, p.PID))
+			show("features", p.Features)
+		} else {
+			show("product", nil)
+		}
+		show("firmware", e.Firmware)
+		if st := e.State; st != nil {
+			show("power", st.Power)
+			show("color", formatColor(e.color))
+		} else {
+			show("state", nil)
+		}
+		if e.Zones != nil {
+			show("zones", *e.Zones)
+		} else if _, ok := e.Errors["zones"]; ok {
+			show("zones", nil)
+		}
+		show("ping", e.ping)
+	}
+	return nil
+}
+
+// info gathers the details of a device shown by the info command.
+func info(ctx context.Context, d *lifx.Device) infoEntry {
+	e := infoEntry{
+		Serial: hex.EncodeToString(d.Serial[:]),
+		Addr:   d.Addr.String(),
+		Errors: make(map[string]string),
+	}
+	fail := func(what string, err error) { e.Errors[what] = err.Error() }
+
+	st := lifx.WatchedState{Serial: d.Serial}
+	if label, err := d.GetLabel(ctx); err != nil {
+		fail("label", err)
+	} else {
+		e.Label, st.Label = label, label
+	}
+	if p, err := d.Product(ctx); err != nil {
+		fail("product", err)
+	} else {
+		e.Product = &productEntry{PID: p.PID, Name: p.Name, Features: p.Features}
+	}
+	if hf, err := d.GetHostFirmware(ctx); err != nil {
+		fail("firmware", err)
+	} else {
+		e.Firmware = hf.String()
+	}
+	var err error
+	if st.Power, err = d.GetLightPower(ctx); err == nil {
+		st.Color, err = d.GetColor(ctx)
+	}
+	if err != nil {
+		fail("state", err)
+	} else {
+		st.Reachable = true
+		s := command.StateOf(st)
+		e.State, e.color = &s, st.Color
+	}
+	if zones, err := d.GetZones(ctx); err == nil {
+		n := len(zones)
+		e.Zones = &n
+	} else if !errors.Is(err, lifx.ErrUnhandled) {
+		fail("zones", err)
+	}
+	if stats, err := d.Ping(ctx, 5); err != nil {
+		fail("ping", err)
+	} else {
+		e.ping = stats
+		e.Ping = &pingEntry{Sent: stats.Sent, Received: stats.Received}
+		if stats.Received > 0 {
+			e.Ping.AvgMS = float64(stats.Avg) / float64(time.Millisecond)
+		}
+	}
+	if len(e.Errors) == 0 {
+		e.Errors = nil
+	}
+	return e
+}
+
+func runOn(ctx context.Context, client *lifx.Client, args []string) error {
+	return setPower(ctx, client, "on", args, 0xFFFF)
+}
+
+func runOff(ctx context.Context, client *lifx.Client, args []string) error {
+	return setPower(ctx, client, "off", args, 0)
+}
+
+func setPower(ctx context.Context, client *lifx.Client, name string, args []string, level uint16) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	duration := fs.Duration("duration", 0, "transition `duration`")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	if len(args) != 1 {
+		return usageError(name + " needs a device")
+	}
+	devs, err := resolve(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	return each(ctx, devs, func(ctx context.Context, d *lifx.Device) error {
+		return d.SetLightPower(ctx, level, *duration)
+	})
+}
+
+func runColor(ctx context.Context, client *lifx.Client, args []string) error {
+	fs := flag.NewFlagSet("color", flag.ContinueOnError)
+	duration := fs.Duration("duration", 0, "transition `duration`")
+	brightness := fs.Float64("brightness", -1, "brightness `percentage`; the color's own brightness if negative")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	if len(args) != 2 {
+		return usageError("color needs a device and a color")
+	}
+	c, err := lifx.ParseColor(args[1])
+	if err != nil {
+		return err
+	}
+	if *brightness >= 0 {
+		if *brightness > 100 {
+			return usageError("brightness must be at most 100")
+		}
+		c.Brightness = uint16(math.Round(*brightness / 100 * 0xFFFF))
+	}
+	devs, err := resolve(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	return each(ctx, devs, func(ctx context.Context, d *lifx.Device) error {
+		return d.SetColor(ctx, c, *duration)
+	})
+}
+
+func runZones(ctx context.Context, client *lifx.Client, args []string) error {
+	fs := flag.NewFlagSet("zones", flag.ContinueOnError)
+	duration := fs.Duration("duration", 0, "transition `duration`")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	if len(args) < 2 {
+		return usageError("zones needs a device and at least one color")
+	}
+	var stops []lifx.ColorStop
+	for _, s := range args[1:] {
+		c, err := lifx.ParseColor(s)
+		if err != nil {
+			return err
+		}
+		stops = append(stops, lifx.ColorStop{Color: c})
+	}
+	devs, err := resolve(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	return each(ctx, devs, func(ctx context.Context, d *lifx.Device) error {
+		zones, err := d.GetZones(ctx)
+		if errors.Is(err, lifx.ErrUnhandled) {
+			return errors.New("not a multizone device")
+		} else if err != nil {
+			return err
+		}
+		return d.SetZones(ctx, *duration, lifx.GradientZones(stops, len(zones)))
+	})
+}
+
+func runCapture(ctx context.Context, client *lifx.Client, args []string) error {
+	if len(args) != 2 {
+		return usageError("capture needs a device and a file")
+	}
+	devs, err := resolve(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(args[1])
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	s, err := scene.Capture(ctx, name, devs)
+	if len(s.Entries) == 0 {
+		return err
+	}
+	if err != nil {
+		// Save what we can.
+		warnf("capture: %v", err)
+	}
+	if err := s.WriteFile(args[1]); err != nil {
+		return err
+	}
+	if *jsonOut {
+		results := make([]result, len(s.Entries))
+		for i, e := range s.Entries {
+			results[i].Serial = hex.EncodeToString(e.Selector.Serial[:])
+		}
+		return writeJSON(results)
+	}
+	return nil
+}
+
+func runRestore(ctx context.Context, client *lifx.Client, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	duration := fs.Duration("duration", 0, "transition `duration`; overrides the scene's own")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	if len(args) != 1 {
+		return usageError("restore needs a file")
+	}
+	s, err := scene.ParseFile(args[0])
+	if err != nil {
+		return err
+	}
+	return s.Recall(ctx, client, *duration)
+}
+
+// formatColor describes a color for people.
+func formatColor(c lifx.Color) string {
+	bri := float64(c.Brightness) / 0xFFFF * 100
+	if c.Saturation == 0 {
+		return fmt.Sprintf("%dK %.0f%%", c.Kelvin, bri)
+	}
+	r, g, b := c.RGB()
+	return fmt.Sprintf("#%02x%02x%02x %.0f%%", r, g, b, bri)
+}
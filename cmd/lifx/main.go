@@ -0,0 +1,244 @@
+// The lifx command controls LIFX devices on the local network.
+//
+// Usage:
+//
+//	lifx [flags] <command> [args]
+//
+// The commands are:
+//
+//	list                            list devices and their state
+//	info <device>                   show details of devices
+//	on <device>                     turn devices on
+//	off <device>                    turn devices off
+//	color <device> <color>          set the color of devices
+//	zones <device> <color>...       spread a gradient across multizone devices
+//	capture <device> <file>         save the state of devices to a scene file
+//	restore <file>                  restore a scene file
+//
+// A <device> is an alias, a label, a serial number in hex, or "all".
+// Aliases are read from ~/.config/lifx/aliases (see lifx.ParseAliases),
+// and take precedence over labels:
+//
+//	Living room = d073d5010203
+//
+// A <color> is anything accepted by lifx.ParseColor, such as "#ff8000",
+// "orange" or "kelvin:2700".
+//
+// Flags for each command may come before or after its arguments,
+// so "lifx color Lounge red -duration 2s" works as expected.
+//
+// For use in scripts, -json writes results to stdout as JSON: the devices for
+// list and info, and for other commands the outcome for each device affected:
+//
+//	[{"serial":"d073d5010203"},{"serial":"d073d5040506","error":"..."}]
+//
+// -quiet makes list and info write only device serials, one per line,
+// and suppresses warnings. Errors are always written to stderr,
+// and the exit status is non-zero if any device could not be handled.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+var (
+	wait    = flag.Duration("wait", 2*time.Second, "how long to wait for discovery responses")
+	timeout = flag.Duration("timeout", 30*time.Second, "overall time limit")
+	aliases = flag.String("aliases", "", "aliases `file`; the default is ~/.config/lifx/aliases")
+)
+
+type subcommand struct {
+	name  string
+	args  string // synopsis of the arguments
+	short string
+	run   func(ctx context.Context, client *lifx.Client, args []string) error
+}
+
+var commands = []*subcommand{
+	{"list", "", "list devices and their state", runList},
+	{"info", "<device>", "show details of devices", runInfo},
+	{"on", "<device> [-duration d]", "turn devices on", runOn},
+	{"off", "<device> [-duration d]", "turn devices off", runOff},
+	{"color", "<device> <color> [-brightness pct] [-duration d]", "set the color of devices", runColor},
+	{"zones", "<device> <color>... [-duration d]", "spread a gradient across multizone devices", runZones},
+	{"capture", "<device> <file>", "save the state of devices to a scene file", runCapture},
+	{"restore", "<file> [-duration d]", "restore a scene file", runRestore},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: lifx [flags] <command> [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// usageError is returned by commands given bad arguments.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if *jsonOut && *quiet {
+		fmt.Fprintf(os.Stderr, "lifx: -json and -quiet are mutually exclusive\n")
+		os.Exit(2)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	var cmd *subcommand
+	for _, c := range commands {
+		if c.name == name {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "lifx: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var opts []lifx.Option
+	if *aliases != "" {
+		a, err := lifx.LoadAliases(*aliases)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lifx: %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, lifx.WithAliases(a))
+	}
+	client, err := lifx.NewClient(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lifx: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	if err := cmd.run(ctx, client, args); err != nil {
+		fmt.Fprintf(os.Stderr, "lifx %s: %v\n", cmd.name, err)
+		var ue usageError
+		if errors.As(err, &ue) {
+			fmt.Fprintf(os.Stderr, "usage: lifx %s %s\n", cmd.name, cmd.args)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses a command's flags, which may be interspersed with its arguments,
+// and returns the arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard) // errors are reported by main
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// found is a discovered device with its label.
+type found struct {
+	dev   *lifx.Device
+	label string
+}
+
+// discover finds all devices and their labels, sorted by label.
+// Devices that don't report a label are left out.
+func discover(ctx context.Context, client *lifx.Client) ([]found, error) {
+	dctx, cancel := context.WithTimeout(ctx, *wait)
+	devs, err := client.Discover(dctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	fs := make([]found, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fs[i].dev = d
+			fs[i].label, _ = d.GetLabel(ctx)
+		}()
+	}
+	wg.Wait()
+	var out []found
+	for _, f := range fs {
+		if f.label != "" {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].label != out[j].label {
+			return out[i].label < out[j].label
+		}
+		return string(out[i].dev.Serial[:]) < string(out[j].dev.Serial[:])
+	})
+	return out, nil
+}
+
+// resolve finds the devices named by an alias, a label, a serial in hex, or "all".
+// Aliases and labels are matched without regard to case, and labels may match several devices.
+func resolve(ctx context.Context, client *lifx.Client, name string) ([]*lifx.Device, error) {
+	a, err := client.Aliases()
+	if err != nil {
+		warnf("%v", err)
+	}
+	serial, ok := a.Lookup(name)
+	if raw, err := hex.DecodeString(name); !ok && err == nil && len(raw) == 6 {
+		serial, ok = [6]byte(raw), true
+	}
+	if ok {
+		dctx, cancel := context.WithTimeout(ctx, *wait)
+		d, err := client.DiscoverSerial(dctx, serial)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("device %s (%x): %w", name, serial, err)
+		}
+		return []*lifx.Device{d}, nil
+	}
+	fs, err := discover(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	var devs []*lifx.Device
+	for _, f := range fs {
+		if name == "all" || strings.EqualFold(f.label, name) {
+			devs = append(devs, f.dev)
+		}
+	}
+	if len(devs) == 0 {
+		if name == "all" {
+			return nil, errors.New("no devices found")
+		}
+		return nil, &lifx.NotFoundError{Label: name}
+	}
+	return devs, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/dsymonds/lifx"
+)
+
+var (
+	jsonOut = flag.Bool("json", false, "write results to stdout as JSON")
+	quiet   = flag.Bool("quiet", false, "list only device serials, and suppress warnings")
+)
+
+// result is the JSON form of the outcome of a command on one device.
+type result struct {
+	Serial string `json:"serial"`
+	Error  string `json:"error,omitempty"`
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// warnf reports a non-fatal problem, unless -quiet is set.
+func warnf(format string, args ...interface{}) {
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "lifx: "+format+"\n", args...)
+	}
+}
+
+// each runs op on each device concurrently.
+// With -json, it writes the outcome for each device to stdout.
+// The returned error joins the errors of the devices that failed.
+func each(ctx context.Context, devs []*lifx.Device, op func(context.Context, *lifx.Device) error) error {
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = op(ctx, d)
+		}()
+	}
+	wg.Wait()
+
+	results := make([]result, len(devs))
+	for i, d := range devs {
+		results[i].Serial = hex.EncodeToString(d.Serial[:])
+		if errs[i] != nil {
+			results[i].Error = errs[i].Error()
+			errs[i] = fmt.Errorf("device %x: %w", d.Serial, errs[i])
+		}
+	}
+	if *jsonOut {
+		if err := writeJSON(results); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/internal/command"
+	"github.com/dsymonds/lifx/internal/mqtt"
+)
+
+// Home Assistant MQTT discovery, using the JSON light schema.
+// https://www.home-assistant.io/integrations/light.mqtt/#json-schema
+//
+// For each device, a config is published (retained) to
+// <ha-prefix>/light/lifx_<serial>/config, and the device's state
+// in Home Assistant's form to <prefix>/<serial>/ha. Commands from
+// Home Assistant arrive on <prefix>/<serial>/ha/set.
+
+type haConfig struct {
+	Name                string           `json:"name"`
+	UniqueID            string           `json:"unique_id"`
+	Schema              string           `json:"schema"`
+	StateTopic          string           `json:"state_topic"`
+	CommandTopic        string           `json:"command_topic"`
+	Availability        []haAvailability `json:"availability"`
+	AvailabilityMode    string           `json:"availability_mode"`
+	Brightness          bool             `json:"brightness"`
+	SupportedColorModes []string         `json:"supported_color_modes"`
+	ColorTempKelvin     bool             `json:"color_temp_kelvin,omitempty"`
+	MinKelvin           uint16           `json:"min_kelvin,omitempty"`
+	MaxKelvin           uint16           `json:"max_kelvin,omitempty"`
+	Device              haDevice         `json:"device"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// haState is both the state published to Home Assistant and the commands it sends.
+type haState struct {
+	State      string   `json:"state"`                // "ON" or "OFF"
+	Brightness *int     `json:"brightness,omitempty"` // 0-255
+	ColorMode  string   `json:"color_mode,omitempty"`
+	Color      *haColor `json:"color,omitempty"`
+	ColorTemp  *uint16  `json:"color_temp,omitempty"` // kelvin
+	Transition *float64 `json:"transition,omitempty"` // seconds; commands only
+}
+
+type haColor struct {
+	H float64 `json:"h"` // degrees
+	S float64 `json:"s"` // percent
+}
+
+func (b *bridge) haTopic(serial [6]byte) string {
+	return b.prefix + "/" + hex.EncodeToString(serial[:]) + "/ha"
+}
+
+// haColorModes returns the Home Assistant color modes supported by a product.
+func haColorModes(p *lifx.Product) (modes []string, minK, maxK uint16) {
+	if p == nil {
+		return []string{"brightness"}, 0, 0
+	}
+	if c := p.Features.Color; c != nil && *c {
+		modes = append(modes, "hs")
+	}
+	if tr := p.Features.TemperatureRange; len(tr) == 2 && tr[0] < tr[1] {
+		modes = append(modes, "color_temp")
+		minK, maxK = tr[0], tr[1]
+	}
+	if len(modes) == 0 {
+		modes = []string{"brightness"}
+	}
+	return modes, minK, maxK
+}
+
+// publishHAConfig publishes the Home Assistant discovery config for a device.
+func (b *bridge) publishHAConfig(conn *mqtt.Conn, st lifx.WatchedState, p *lifx.Product) {
+	id := "lifx_" + hex.EncodeToString(st.Serial[:])
+	modes, minK, maxK := haColorModes(p)
+	cfg := haConfig{
+		Name:         st.Label,
+		UniqueID:     id,
+		Schema:       "json",
+		StateTopic:   b.haTopic(st.Serial),
+		CommandTopic: b.haTopic(st.Serial) + "/set",
+		Availability: []haAvailability{
+			{Topic: b.prefix + "/status"},
+			{Topic: b.haTopic(st.Serial) + "/availability"},
+		},
+		AvailabilityMode:    "all",
+		Brightness:          true,
+		SupportedColorModes: modes,
+		Device: haDevice{
+			Identifiers:  []string{id},
+			Name:         st.Label,
+			Manufacturer: "LIFX",
+		},
+	}
+	if minK != 0 {
+		cfg.ColorTempKelvin = true
+		cfg.MinKelvin, cfg.MaxKelvin = minK, maxK
+	}
+	if p != nil {
+		cfg.Device.Model = p.Name
+	}
+	b.publishJSON(conn, *haPrefix+"/light/"+id+"/config", cfg)
+}
+
+// publishHAState publishes a device's state in Home Assistant's form.
+func (b *bridge) publishHAState(conn *mqtt.Conn, st lifx.WatchedState, p *lifx.Product) {
+	avail := "offline"
+	if st.Reachable {
+		avail = "online"
+	}
+	if err := conn.Publish(mqtt.Message{Topic: b.haTopic(st.Serial) + "/availability", Payload: []byte(avail), Retain: true}); err != nil {
+		log.Printf("Publishing availability of %x: %v", st.Serial, err)
+	}
+
+	bri := int(math.Round(float64(st.Color.Brightness) / 0xFFFF * 255))
+	hs := haState{State: "OFF", Brightness: &bri}
+	if st.Power > 0 {
+		hs.State = "ON"
+	}
+	var hasHS, hasCT bool
+	modes, _, _ := haColorModes(p)
+	for _, m := range modes {
+		hasHS = hasHS || m == "hs"
+		hasCT = hasCT || m == "color_temp"
+	}
+	switch {
+	case hasHS && (st.Color.Saturation > 0 || !hasCT):
+		hs.ColorMode = "hs"
+		hs.Color = &haColor{H: command.Degrees(st.Color.Hue), S: command.Percent(st.Color.Saturation)}
+	case hasCT:
+		hs.ColorMode = "color_temp"
+		k := st.Color.Kelvin
+		hs.ColorTemp = &k
+	default:
+		hs.ColorMode = "brightness"
+	}
+	b.publishJSON(conn, b.haTopic(st.Serial), hs)
+}
+
+func (b *bridge) publishJSON(conn *mqtt.Conn, topic string, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Encoding %s: %v", topic, err)
+		return
+	}
+	if err := conn.Publish(mqtt.Message{Topic: topic, Payload: payload, Retain: true}); err != nil {
+		log.Printf("Publishing %s: %v", topic, err)
+	}
+}
+
+// handleHA handles a command from Home Assistant.
+func (b *bridge) handleHA(ctx context.Context, serialHex string, payload []byte) error {
+	d := b.lookup(serialHex)
+	if d == nil {
+		return fmt.Errorf("no device %q", serialHex)
+	}
+	var hs haState
+	if err := json.Unmarshal(payload, &hs); err != nil {
+		return fmt.Errorf("bad command: %w", err)
+	}
+	var cmd command.Command
+	if hs.State != "" {
+		power := strings.ToLower(hs.State)
+		cmd.Power = &power
+	}
+	if hs.Brightness != nil {
+		p := float64(*hs.Brightness) / 255 * 100
+		cmd.Brightness = &p
+	}
+	if hs.Color != nil {
+		cmd.Hue = &hs.Color.H
+		cmd.Saturation = &hs.Color.S
+	}
+	if hs.ColorTemp != nil {
+		var white float64
+		cmd.Kelvin = hs.ColorTemp
+		cmd.Saturation = &white
+	}
+	if hs.Transition != nil {
+		cmd.Duration = fmt.Sprintf("%gs", *hs.Transition)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opTimeout)
+	defer cancel()
+	return cmd.Apply(ctx, d)
+}
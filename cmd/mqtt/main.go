@@ -0,0 +1,286 @@
+// The mqtt command bridges LIFX devices to an MQTT broker,
+// so they can be controlled by MQTT-based automation without the LIFX cloud.
+//
+// The state of each device is published, retained, as JSON to
+// <prefix>/<serial>/state whenever it changes:
+//
+//	{"serial":"d073d5010203","label":"Lounge","reachable":true,"power":"on",
+//	 "hue":120,"saturation":100,"brightness":60,"kelvin":3500}
+//
+// Commands are accepted on <prefix>/<device>/set, where <device> is a serial
+// or a label. All fields are optional; hue is in degrees, saturation and
+// brightness are percentages, and color is anything accepted by lifx.ParseColor:
+//
+//	{"power":"on","color":"#ff8000","brightness":40,"duration":"2s"}
+//
+// The bridge's own availability is published, retained, to <prefix>/status
+// as "online" or "offline".
+//
+// With -homeassistant, devices are also announced using Home Assistant's MQTT
+// discovery, so they appear in Home Assistant as lights with brightness,
+// color and color temperature control as the device supports.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/internal/command"
+	"github.com/dsymonds/lifx/internal/mqtt"
+)
+
+var (
+	broker    = flag.String("broker", "localhost:1883", "MQTT broker `address`")
+	useTLS    = flag.Bool("tls", false, "connect to the broker using TLS")
+	clientID  = flag.String("client-id", "lifx-bridge", "MQTT client `ID`")
+	username  = flag.String("username", "", "MQTT user `name`; the password is read from $MQTT_PASSWORD")
+	prefix    = flag.String("prefix", "lifx", "topic `prefix`")
+	interval  = flag.Duration("interval", 5*time.Second, "how often to poll devices for state changes")
+	keepAlive = flag.Duration("keepalive", 60*time.Second, "MQTT keepalive interval")
+
+	homeAssistant = flag.Bool("homeassistant", false, "publish Home Assistant MQTT discovery configs")
+	haPrefix      = flag.String("ha-prefix", "homeassistant", "Home Assistant discovery topic `prefix`")
+)
+
+// reconnectDelay is how long to wait between attempts to connect to the broker.
+const reconnectDelay = 5 * time.Second
+
+// opTimeout bounds each command sent to a device.
+const opTimeout = 10 * time.Second
+
+type bridge struct {
+	prefix string
+
+	mu   sync.Mutex
+	devs map[[6]byte]*known
+	conn *mqtt.Conn // nil while disconnected
+}
+
+type known struct {
+	dev     *lifx.Device
+	state   lifx.WatchedState
+	product *lifx.Product // only fetched for Home Assistant; nil if unknown
+}
+
+func main() {
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	b := &bridge{
+		prefix: strings.TrimSuffix(*prefix, "/"),
+		devs:   make(map[[6]byte]*known),
+	}
+	go b.watch(ctx, client)
+
+	for ctx.Err() == nil {
+		if err := b.serve(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("MQTT: %v; reconnecting in %v", err, reconnectDelay)
+			select {
+			case <-ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}
+}
+
+// watch publishes device state changes.
+func (b *bridge) watch(ctx context.Context, client *lifx.Client) {
+	for ev := range client.Watch(ctx, *interval) {
+		b.mu.Lock()
+		k, ok := b.devs[ev.State.Serial]
+		if !ok {
+			k = &known{dev: ev.Device}
+			b.devs[ev.State.Serial] = k
+		}
+		k.state = ev.State
+		needProduct := *homeAssistant && k.product == nil && ev.State.Reachable
+		b.mu.Unlock()
+
+		// Home Assistant needs to know what the device can do.
+		// Announce it again when that's learned or its label changes.
+		announce := !ok
+		if needProduct {
+			pctx, cancel := context.WithTimeout(ctx, opTimeout)
+			p, err := ev.Device.Product(pctx)
+			cancel()
+			if err != nil {
+				log.Printf("Product of %x: %v", ev.State.Serial, err)
+			} else {
+				b.mu.Lock()
+				k.product = &p
+				b.mu.Unlock()
+				announce = true
+			}
+		}
+		if ev.Prev != nil && ev.Prev.Label != ev.State.Label {
+			announce = true
+		}
+
+		b.mu.Lock()
+		snap := *k
+		b.mu.Unlock()
+		b.publishState(snap, announce)
+	}
+}
+
+// serve connects to the broker and handles commands until the connection fails.
+func (b *bridge) serve(ctx context.Context) error {
+	opts := mqtt.Options{
+		ClientID:  *clientID,
+		Username:  *username,
+		Password:  os.Getenv("MQTT_PASSWORD"),
+		KeepAlive: *keepAlive,
+		Will:      &mqtt.Message{Topic: b.prefix + "/status", Payload: []byte("offline"), Retain: true},
+	}
+	if *useTLS {
+		opts.TLSConfig = &tls.Config{}
+	}
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := mqtt.Dial(dctx, *broker, opts)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	filters := []string{b.prefix + "/+/set"}
+	if *homeAssistant {
+		filters = append(filters, b.prefix+"/+/ha/set")
+	}
+	if err := conn.Subscribe(filters...); err != nil {
+		return err
+	}
+	if err := conn.Publish(mqtt.Message{Topic: b.prefix + "/status", Payload: []byte("online"), Retain: true}); err != nil {
+		return err
+	}
+	log.Printf("Connected to MQTT broker at %s", *broker)
+
+	b.mu.Lock()
+	b.conn = conn
+	var snaps []known
+	for _, k := range b.devs {
+		snaps = append(snaps, *k)
+	}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+	}()
+	for _, k := range snaps {
+		b.publishState(k, true)
+	}
+
+	// Ping, and close the connection to unblock ReadMessage when ctx is done.
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(*keepAlive / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pctx.Done():
+				if ctx.Err() != nil {
+					conn.Publish(mqtt.Message{Topic: b.prefix + "/status", Payload: []byte("offline"), Retain: true})
+					conn.Close()
+				}
+				return
+			case <-ticker.C:
+				conn.Ping()
+			}
+		}
+	}()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := b.handle(ctx, msg); err != nil {
+				log.Printf("Handling %s: %v", msg.Topic, err)
+			}
+		}()
+	}
+}
+
+// publishState publishes a device's state,
+// and its Home Assistant discovery config if announce is set.
+func (b *bridge) publishState(k known, announce bool) {
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	st := k.state
+	if *homeAssistant {
+		if announce {
+			b.publishHAConfig(conn, st, k.product)
+		}
+		b.publishHAState(conn, st, k.product)
+	}
+	sm := command.StateOf(st)
+	payload, err := json.Marshal(sm)
+	if err != nil {
+		log.Printf("Encoding state of %x: %v", st.Serial, err)
+		return
+	}
+	topic := b.prefix + "/" + sm.Serial + "/state"
+	if err := conn.Publish(mqtt.Message{Topic: topic, Payload: payload, Retain: true}); err != nil {
+		log.Printf("Publishing %s: %v", topic, err)
+	}
+}
+
+func (b *bridge) handle(ctx context.Context, msg mqtt.Message) error {
+	name := strings.TrimSuffix(strings.TrimPrefix(msg.Topic, b.prefix+"/"), "/set")
+	if serial, ok := strings.CutSuffix(name, "/ha"); ok && *homeAssistant {
+		return b.handleHA(ctx, serial, msg.Payload)
+	}
+	d := b.lookup(name)
+	if d == nil {
+		return fmt.Errorf("no device %q", name)
+	}
+	var cmd command.Command
+	if err := json.Unmarshal(msg.Payload, &cmd); err != nil {
+		return fmt.Errorf("bad command: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opTimeout)
+	defer cancel()
+	return cmd.Apply(ctx, d)
+}
+
+// lookup finds a device by serial or label.
+func (b *bridge) lookup(name string) *lifx.Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if raw, err := hex.DecodeString(name); err == nil && len(raw) == 6 {
+		if k, ok := b.devs[[6]byte(raw)]; ok {
+			return k.dev
+		}
+	}
+	for _, k := range b.devs {
+		if strings.EqualFold(k.state.Label, name) {
+			return k.dev
+		}
+	}
+	return nil
+}
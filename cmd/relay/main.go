@@ -0,0 +1,55 @@
+// The relay command forwards LIFX traffic from one network segment to another.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/dsymonds/lifx/relay"
+)
+
+var (
+	listenAddr = flag.String("listen", ":56700", "UDP `address` to serve clients on")
+	broadcast  = flag.String("broadcast", "", "broadcast `address` of the device segment, e.g. 10.0.20.255:56700")
+	allow      = flag.String("allow", "", "comma-separated `CIDRs` of clients to serve; empty means all")
+)
+
+func main() {
+	flag.Parse()
+
+	if *broadcast == "" {
+		log.Fatalf("-broadcast is required")
+	}
+	bcast, err := net.ResolveUDPAddr("udp4", *broadcast)
+	if err != nil {
+		log.Fatalf("Bad -broadcast: %v", err)
+	}
+	r := &relay.Relay{
+		Broadcast: bcast,
+		Logf:      log.Printf,
+	}
+	if *allow != "" {
+		var nets []*net.IPNet
+		for _, s := range strings.Split(*allow, ",") {
+			_, n, err := net.ParseCIDR(strings.TrimSpace(s))
+			if err != nil {
+				log.Fatalf("Bad -allow: %v", err)
+			}
+			nets = append(nets, n)
+		}
+		r.Filter = relay.AllowClients(nets...)
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp4", *listenAddr)
+	if err != nil {
+		log.Fatalf("Bad -listen: %v", err)
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		log.Fatalf("net.ListenUDP: %v", err)
+	}
+	log.Printf("Relaying LIFX traffic from %v to %v", conn.LocalAddr(), bcast)
+	log.Fatal(r.Serve(conn))
+}
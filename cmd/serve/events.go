@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/internal/command"
+	"github.com/dsymonds/lifx/internal/websocket"
+)
+
+// event is sent to WebSocket subscribers when a device's state changes.
+//
+//	{"serial":"d073d5010203","state":{...},"prev":{...},"changed":["power"]}
+type event struct {
+	Serial  string         `json:"serial"`
+	State   command.State  `json:"state"`
+	Prev    *command.State `json:"prev,omitempty"`    // absent for newly seen devices
+	Changed []string       `json:"changed,omitempty"` // of "power", "color", "label" and "reachable"
+}
+
+// eventBuffer is how many events may be queued for a subscriber
+// before it is considered too slow and disconnected.
+const eventBuffer = 64
+
+// eventWriteTimeout bounds the time to write each event to a subscriber.
+const eventWriteTimeout = 10 * time.Second
+
+func newEvent(ev lifx.Event) event {
+	e := event{State: command.StateOf(ev.State)}
+	e.Serial = e.State.Serial
+	if p := ev.Prev; p != nil {
+		prev := command.StateOf(*p)
+		e.Prev = &prev
+		if p.Power != ev.State.Power {
+			e.Changed = append(e.Changed, "power")
+		}
+		if p.Color != ev.State.Color {
+			e.Changed = append(e.Changed, "color")
+		}
+		if p.Label != ev.State.Label {
+			e.Changed = append(e.Changed, "label")
+		}
+		if p.Reachable != ev.State.Reachable {
+			e.Changed = append(e.Changed, "reachable")
+		}
+	}
+	return e
+}
+
+// publish sends an event to every subscriber,
+// dropping those that aren't keeping up.
+func (s *server) publish(e event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// serveEvents streams events over a WebSocket, starting with the current
+// state of every known device.
+func (s *server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("Upgrading connection from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer ws.Close()
+
+	ch := make(chan event, eventBuffer)
+	s.mu.Lock()
+	for _, k := range s.devs {
+		st := command.StateOf(k.state)
+		ch <- event{Serial: st.Serial, State: st}
+		if len(ch) == cap(ch) {
+			break
+		}
+	}
+	s.subs[ch] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.subs[ch] {
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}()
+
+	// Read (and discard) messages, so pings and closes are handled.
+	go func() {
+		defer ws.Close() // unblocks the writer
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for e := range ch {
+		b, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("Encoding event: %v", err)
+			continue
+		}
+		ws.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if err := ws.WriteMessage(websocket.TextMessage, b); err != nil {
+			return
+		}
+	}
+}
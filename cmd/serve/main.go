@@ -0,0 +1,436 @@
+// The serve command exposes LIFX devices through a local HTTP JSON API,
+// for use by web dashboards and shell scripts.
+//
+// Devices are identified in URLs by serial or label. The endpoints are:
+//
+//	GET  /devices               the last known state of every device seen
+//	POST /discover              discover devices now, returning those found
+//	GET  /devices/<id>          the current state of a device, including its zones
+//	PUT  /devices/<id>/state    change power and color; see below
+//	PUT  /devices/<id>/zones    set zone colors: {"zones":[...]} or {"gradient":[...]}, with optional "duration"
+//	GET  /scenes                the names of the scenes in the -scenes directory
+//	POST /scenes/<name>         recall a scene, with an optional {"duration":"2s"}
+//	GET  /events                a WebSocket stream of JSON events as device state changes
+//
+// State changes take a JSON object with any of
+//
+//	{"power":"on","color":"#ff8000","hue":30,"saturation":100,"brightness":40,"kelvin":3500,"duration":"2s"}
+//
+// where color is anything accepted by lifx.ParseColor,
+// and saturation and brightness are percentages.
+//
+// Errors are reported as {"error":"..."}.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/internal/command"
+	"github.com/dsymonds/lifx/scene"
+)
+
+var (
+	listenAddr = flag.String("listen", "localhost:8080", "`address` to serve on")
+	interval   = flag.Duration("interval", 5*time.Second, "how often to poll devices for state changes")
+	scenesDir  = flag.String("scenes", "", "`directory` of scene files (.yaml, .yml or .json)")
+)
+
+// opTimeout bounds each operation on devices.
+const opTimeout = 10 * time.Second
+
+// discoverWait is how long to wait for devices to respond to discovery.
+const discoverWait = 2 * time.Second
+
+type server struct {
+	client *lifx.Client
+
+	mu   sync.Mutex
+	devs map[[6]byte]*known
+	subs map[chan event]bool // event subscribers
+}
+
+type known struct {
+	dev   *lifx.Device
+	state lifx.WatchedState
+}
+
+func main() {
+	flag.Parse()
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	s := &server{
+		client: client,
+		devs:   make(map[[6]byte]*known),
+		subs:   make(map[chan event]bool),
+	}
+	go s.watch(context.Background())
+
+	log.Printf("Serving on %s", *listenAddr)
+	log.Fatal(http.ListenAndServe(*listenAddr, s))
+}
+
+func (s *server) watch(ctx context.Context) {
+	for ev := range s.client.Watch(ctx, *interval) {
+		s.mu.Lock()
+		s.devs[ev.State.Serial] = &known{dev: ev.Device, state: ev.State}
+		s.mu.Unlock()
+		s.publish(newEvent(ev))
+	}
+}
+
+// httpError is an error with an HTTP status code.
+type httpError struct {
+	code int
+	err  error
+}
+
+func (he *httpError) Error() string { return he.err.Error() }
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &httpError{code, fmt.Errorf(format, args...)}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/events" {
+		s.serveEvents(w, r)
+		return
+	}
+	v, err := s.route(r)
+	if err != nil {
+		code := http.StatusBadGateway // most failures are from devices
+		var he *httpError
+		if errors.As(err, &he) {
+			code = he.code
+		}
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// route handles a request, returning a value to encode as the response, if any.
+func (s *server) route(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	method := func(want string) error {
+		if r.Method != want {
+			return errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), opTimeout)
+	defer cancel()
+
+	switch {
+	case len(parts) == 1 && parts[0] == "devices":
+		if err := method(http.MethodGet); err != nil {
+			return nil, err
+		}
+		return s.list(), nil
+	case len(parts) == 1 && parts[0] == "discover":
+		if err := method(http.MethodPost); err != nil {
+			return nil, err
+		}
+		return s.discover(ctx)
+	case len(parts) >= 2 && parts[0] == "devices":
+		d := s.lookup(parts[1])
+		if d == nil {
+			return nil, errorf(http.StatusNotFound, "no device %q", parts[1])
+		}
+		switch {
+		case len(parts) == 2:
+			if err := method(http.MethodGet); err != nil {
+				return nil, err
+			}
+			return s.get(ctx, d)
+		case len(parts) == 3 && parts[2] == "state":
+			if err := method(http.MethodPut); err != nil {
+				return nil, err
+			}
+			var cmd command.Command
+			if err := decode(r, &cmd); err != nil {
+				return nil, err
+			}
+			return nil, cmd.Apply(ctx, d)
+		case len(parts) == 3 && parts[2] == "zones":
+			if err := method(http.MethodPut); err != nil {
+				return nil, err
+			}
+			return nil, s.setZones(ctx, r, d)
+		}
+	case len(parts) == 1 && parts[0] == "scenes":
+		if err := method(http.MethodGet); err != nil {
+			return nil, err
+		}
+		return listScenes()
+	case len(parts) == 2 && parts[0] == "scenes":
+		if err := method(http.MethodPost); err != nil {
+			return nil, err
+		}
+		return nil, s.recall(ctx, r, parts[1])
+	}
+	return nil, errorf(http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+}
+
+// decode decodes a JSON request body into v. An empty body leaves v alone.
+func decode(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errorf(http.StatusBadRequest, "bad request body: %v", err)
+	}
+	return nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errorf(http.StatusBadRequest, "bad duration: %v", err)
+	}
+	return d, nil
+}
+
+func (s *server) list() []command.State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]command.State, 0, len(s.devs))
+	for _, k := range s.devs {
+		states = append(states, command.StateOf(k.state))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Serial < states[j].Serial })
+	return states
+}
+
+// lookup finds a device by serial or label.
+func (s *server) lookup(name string) *lifx.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if raw, err := hex.DecodeString(name); err == nil && len(raw) == 6 {
+		if k, ok := s.devs[[6]byte(raw)]; ok {
+			return k.dev
+		}
+	}
+	for _, k := range s.devs {
+		if strings.EqualFold(k.state.Label, name) {
+			return k.dev
+		}
+	}
+	return nil
+}
+
+func (s *server) discover(ctx context.Context) ([]command.State, error) {
+	dctx, cancel := context.WithTimeout(ctx, discoverWait)
+	devs, err := s.client.Discover(dctx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	err = lifx.Collection(devs).Each(ctx, func(ctx context.Context, d *lifx.Device) error {
+		label, err := d.GetLabel(ctx)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		k, ok := s.devs[d.Serial]
+		if !ok {
+			k = &known{dev: d, state: lifx.WatchedState{Serial: d.Serial, Reachable: true}}
+			s.devs[d.Serial] = k
+		}
+		k.state.Label = label
+		return nil
+	})
+	if err != nil {
+		log.Printf("Discovery: %v", err)
+	}
+	states := []command.State{}
+	s.mu.Lock()
+	for _, d := range devs {
+		if k, ok := s.devs[d.Serial]; ok {
+			states = append(states, command.StateOf(k.state))
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].Serial < states[j].Serial })
+	return states, nil
+}
+
+// deviceState is the detailed state of a single device.
+type deviceState struct {
+	command.State
+	Zones []zoneState `json:"zones,omitempty"`
+}
+
+type zoneState struct {
+	Hue        float64 `json:"hue"`
+	Saturation float64 `json:"saturation"`
+	Brightness float64 `json:"brightness"`
+	Kelvin     uint16  `json:"kelvin"`
+}
+
+func (s *server) get(ctx context.Context, d *lifx.Device) (*deviceState, error) {
+	st, err := d.CaptureState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ds := &deviceState{State: command.StateOf(lifx.WatchedState{
+		Serial:    d.Serial,
+		Label:     st.Label(),
+		Power:     st.Power(),
+		Color:     st.Color(),
+		Reachable: true,
+	})}
+	for _, z := range st.Zones() {
+		ds.Zones = append(ds.Zones, zoneState{
+			Hue:        command.Degrees(z.Hue),
+			Saturation: command.Percent(z.Saturation),
+			Brightness: command.Percent(z.Brightness),
+			Kelvin:     z.Kelvin,
+		})
+	}
+	return ds, nil
+}
+
+func (s *server) setZones(ctx context.Context, r *http.Request, d *lifx.Device) error {
+	var req struct {
+		Zones    []string `json:"zones"`
+		Gradient []string `json:"gradient"`
+		Duration string   `json:"duration"`
+	}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	dur, err := parseDuration(req.Duration)
+	if err != nil {
+		return err
+	}
+	if (len(req.Zones) == 0) == (len(req.Gradient) == 0) {
+		return errorf(http.StatusBadRequest, "need exactly one of zones and gradient")
+	}
+	parse := func(ss []string) ([]lifx.Color, error) {
+		cols := make([]lifx.Color, len(ss))
+		for i, s := range ss {
+			c, err := lifx.ParseColor(s)
+			if err != nil {
+				return nil, errorf(http.StatusBadRequest, "%v", err)
+			}
+			cols[i] = c
+		}
+		return cols, nil
+	}
+	zones, err := parse(req.Zones)
+	if err != nil {
+		return err
+	}
+	if len(req.Gradient) > 0 {
+		stops, err := parse(req.Gradient)
+		if err != nil {
+			return err
+		}
+		cur, err := d.GetZones(ctx)
+		if errors.Is(err, lifx.ErrUnhandled) {
+			return errorf(http.StatusBadRequest, "device is not multizone")
+		} else if err != nil {
+			return fmt.Errorf("GetZones: %w", err)
+		}
+		cs := make([]lifx.ColorStop, len(stops))
+		for i, c := range stops {
+			cs[i].Color = c
+		}
+		zones = lifx.GradientZones(cs, len(cur))
+	}
+	err = d.SetZones(ctx, dur, zones)
+	if errors.Is(err, lifx.ErrUnhandled) {
+		return errorf(http.StatusBadRequest, "device is not multizone")
+	}
+	return err
+}
+
+// sceneExts are the extensions of scene files, in order of preference.
+var sceneExts = []string{".yaml", ".yml", ".json"}
+
+func listScenes() ([]string, error) {
+	if *scenesDir == "" {
+		return []string{}, nil
+	}
+	ents, err := os.ReadDir(*scenesDir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, ent := range ents {
+		ext := filepath.Ext(ent.Name())
+		name := strings.TrimSuffix(ent.Name(), ext)
+		for _, e := range sceneExts {
+			if ext == e && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *server) recall(ctx context.Context, r *http.Request, name string) error {
+	var req struct {
+		Duration string `json:"duration"`
+	}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	dur, err := parseDuration(req.Duration)
+	if err != nil {
+		return err
+	}
+	if *scenesDir == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return errorf(http.StatusNotFound, "no scene %q", name)
+	}
+	var sc *scene.Scene
+	for _, ext := range sceneExts {
+		sc, err = scene.ParseFile(filepath.Join(*scenesDir, name+ext))
+		if !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return errorf(http.StatusNotFound, "no scene %q", name)
+	} else if err != nil {
+		return errorf(http.StatusInternalServerError, "%v", err)
+	}
+	return sc.Recall(ctx, s.client, dur)
+}
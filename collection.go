@@ -0,0 +1,85 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Collection is a set of devices to operate on together.
+// Its methods run on every device concurrently, and return an error
+// joining those from each device that failed, if any.
+//
+// A Collection is unrelated to the LIFX notion of a group;
+// see Client.Groups for that.
+type Collection []*Device
+
+// Each runs op on each device concurrently.
+// Unlike Synchronize, it makes no attempt to align the devices' start times.
+func (col Collection) Each(ctx context.Context, op func(context.Context, *Device) error) error {
+	errs := make([]error, len(col))
+	var wg sync.WaitGroup
+	for i, d := range col {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := op(ctx, d); err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (col Collection) SetColor(ctx context.Context, color Color, duration time.Duration) error {
+	return col.Each(ctx, func(ctx context.Context, d *Device) error {
+		return d.SetColor(ctx, color, duration)
+	})
+}
+
+func (col Collection) SetLightPower(ctx context.Context, level uint16, duration time.Duration) error {
+	return col.Each(ctx, func(ctx context.Context, d *Device) error {
+		return d.SetLightPower(ctx, level, duration)
+	})
+}
+
+func (col Collection) SetPower(ctx context.Context, level uint16) error {
+	return col.Each(ctx, func(ctx context.Context, d *Device) error {
+		return d.SetPower(ctx, level)
+	})
+}
+
+// CaptureState captures the state of each device, keyed by serial.
+// Devices whose state couldn't be captured are omitted,
+// so the result is still useful if the error is non-nil.
+func (col Collection) CaptureState(ctx context.Context) (map[[6]byte]State, error) {
+	states := make(map[[6]byte]State)
+	var mu sync.Mutex
+	err := col.Each(ctx, func(ctx context.Context, d *Device) error {
+		state, err := d.CaptureState(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		states[d.Serial] = state
+		mu.Unlock()
+		return nil
+	})
+	return states, err
+}
+
+// RestoreState restores each device to its state in states, as returned by CaptureState.
+// Devices without a state in states are left alone.
+func (col Collection) RestoreState(ctx context.Context, states map[[6]byte]State) error {
+	return col.Each(ctx, func(ctx context.Context, d *Device) error {
+		state, ok := states[d.Serial]
+		if !ok {
+			return nil
+		}
+		return d.RestoreState(ctx, state)
+	})
+}
@@ -36,30 +36,77 @@ func (c *Color) decode(b []byte) {
 	c.Kelvin = binary.LittleEndian.Uint16(b[6:8])
 }
 
+// lightState is the decoded form of a LightState message.
+//
+// https://lan.developer.lifx.com/docs/information-messages#lightstate---packet-107
+type lightState struct {
+	color Color
+	power uint16
+	label string
+}
+
+func decodeLightState(payload []byte) (lightState, error) {
+	if err := checkLength(pktLightState, payload, encodedColorLength+2+2+32+8); err != nil {
+		return lightState{}, err
+	}
+	var ls lightState
+	ls.color.decode(payload[:encodedColorLength])
+	off := encodedColorLength + 2 // skip reserved field
+	ls.power = binary.LittleEndian.Uint16(payload[off : off+2])
+	off += 2
+	ls.label = trimLabel(payload[off : off+32])
+	return ls, nil
+}
+
 func (d *Device) GetColor(ctx context.Context) (Color, error) {
 	payload, err := d.query(ctx, pktGetColor, pktLightState, nil)
 	if err != nil {
 		return Color{}, err
 	}
-	if len(payload) != encodedColorLength+2+2+32+8 {
-		return Color{}, fmt.Errorf("LightState malformed: length=%d", len(payload))
+	ls, err := decodeLightState(payload)
+	if err != nil {
+		return Color{}, err
 	}
-	var color Color
-	color.decode(payload[:encodedColorLength])
-	return color, nil
+	return ls.color, nil
 }
 
 func (d *Device) SetColor(ctx context.Context, color Color, duration time.Duration) error {
-	dur, err := uint32Millis(duration)
+	payload, err := encodeSetColor(color, duration)
 	if err != nil {
 		return err
 	}
+	return d.set(ctx, pktSetColor, payload)
+}
+
+// SetColorVerified is like SetColor, but also requests the device's state
+// in response, and returns the color it reports. This catches devices that
+// acknowledge a change but clamp or ignore some of its values.
+// If duration is non-zero, the reported color is that at the start of the transition.
+func (d *Device) SetColorVerified(ctx context.Context, color Color, duration time.Duration) (Color, error) {
+	payload, err := encodeSetColor(color, duration)
+	if err != nil {
+		return Color{}, err
+	}
+	payload, err = d.setVerified(ctx, pktSetColor, pktLightState, payload)
+	if err != nil {
+		return Color{}, err
+	}
+	ls, err := decodeLightState(payload)
+	if err != nil {
+		return Color{}, err
+	}
+	return ls.color, nil
+}
 
+func encodeSetColor(color Color, duration time.Duration) ([]byte, error) {
+	dur, err := uint32Millis(duration)
+	if err != nil {
+		return nil, err
+	}
 	payload := make([]byte, 1+encodedColorLength+4)
 	color.encode(payload[1 : 1+encodedColorLength])
 	binary.LittleEndian.PutUint32(payload[1+encodedColorLength:], dur) // duration
-
-	return d.set(ctx, pktSetColor, payload)
+	return payload, nil
 }
 
 // QuietOn turns on the light power if it isn't already turned on.
@@ -76,55 +123,163 @@ func (d *Device) QuietOn(ctx context.Context) error {
 	return d.SetLightPower(ctx, 0xFFFF, 0)
 }
 
+// SetBrightness changes the light's brightness over the given duration,
+// keeping its hue, saturation and kelvin.
+// On multizone and matrix devices, each zone or pixel keeps its own color.
+//
+// This is done with a single non-transient waveform that only affects brightness.
+func (d *Device) SetBrightness(ctx context.Context, level uint16, duration time.Duration) error {
+	return d.SetWaveform(ctx, WaveformConfig{
+		Waveform: SawWaveform,
+		Color:    Color{Brightness: level},
+		Period:   duration,
+		Cycles:   1,
+		Only:     WaveformBrightness,
+	})
+}
+
+// GetExtendedColorZones returns the colors of all the device's zones.
+// Devices with more than 82 zones reply with several messages,
+// which are collected by zone index.
 func (d *Device) GetExtendedColorZones(ctx context.Context) (zones []Color, err error) {
-	payload, err := d.query(ctx, pktGetExtendedColorZones, pktStateExtendedColorZones, nil)
-	if err != nil {
+	if err := d.requireFeature("extended_multizone", hasExtendedMultizone); err != nil {
 		return nil, err
 	}
-	if len(payload) < 5 {
-		return nil, fmt.Errorf("StateExtendedColorZones too short: length=%d", len(payload))
+	var zc zoneCollector
+	err = d.queryParts(ctx, pktGetExtendedColorZones, pktStateExtendedColorZones, func(payload []byte) (bool, error) {
+		count, index, colors, err := decodeExtendedColorZonesPart(payload)
+		if err != nil {
+			return false, err
+		}
+		if err := zc.add(count, index, colors); err != nil {
+			return false, malformed(pktStateExtendedColorZones, payload, "%v", err)
+		}
+		return !zc.complete(), nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	zonesCount := int(binary.LittleEndian.Uint16(payload[0:2])) // "The number of zones on your strip"
-	zoneIndex := int(binary.LittleEndian.Uint16(payload[2:4]))  // "The first zone represented in the packet"
-	colorsCount := int(payload[4])                              // "The number of HSBK values in the colors array that map to zones."
+	return zc.zones, nil
+}
 
-	colors := payload[5:]
-	if want := colorsCount * encodedColorLength; want > len(colors) {
-		return nil, fmt.Errorf("StateExtendedColorZones too short: colorsCount=%d length=%d", colorsCount, len(payload))
-	} else if want < len(colors) {
-		colors = colors[:want]
+// decodeExtendedColorZones decodes a StateExtendedColorZones payload
+// that holds the colors of all the device's zones.
+func decodeExtendedColorZones(payload []byte) ([]Color, error) {
+	count, index, colors, err := decodeExtendedColorZonesPart(payload)
+	if err != nil {
+		return nil, err
+	}
+	if count != len(colors) || index != 0 {
+		return nil, malformed(pktStateExtendedColorZones, payload, "can't handle partial message (count=%d index=%d colors_count=%d)", count, index, len(colors))
 	}
+	return colors, nil
+}
 
-	// TODO: We don't handle the case where the entire strip's color state is returned
-	// in a single message. What happens? Will we get multiple StateExtendedColorZones messages?
-	// The documentation is unclear on this point. Let's proceed under the assumption that
-	// the zones are all given.
-	if zonesCount != colorsCount || zoneIndex != 0 {
-		return nil, fmt.Errorf("can't handle partial/complex StateExtendedColorZones message")
+// decodeExtendedColorZonesPart decodes a StateExtendedColorZones payload,
+// which holds the colors of some of the device's zones, starting at index.
+func decodeExtendedColorZonesPart(payload []byte) (count, index int, colors []Color, err error) {
+	if err := checkMinLength(pktStateExtendedColorZones, payload, 5); err != nil {
+		return 0, 0, nil, err
 	}
+	count = int(binary.LittleEndian.Uint16(payload[0:2])) // "The number of zones on your strip"
+	index = int(binary.LittleEndian.Uint16(payload[2:4])) // "The first zone represented in the packet"
+	colorsCount := int(payload[4])                        // "The number of HSBK values in the colors array that map to zones."
 
-	zones = make([]Color, colorsCount)
-	for i := 0; i < colorsCount; i++ {
+	raw := payload[5:]
+	if want := colorsCount * encodedColorLength; want > len(raw) {
+		return 0, 0, nil, malformed(pktStateExtendedColorZones, payload, "too short for colors_count %d", colorsCount)
+	}
+	colors = make([]Color, colorsCount)
+	for i := range colors {
 		off := i * encodedColorLength
-		zones[i].decode(colors[off : off+encodedColorLength])
+		colors[i].decode(raw[off : off+encodedColorLength])
+	}
+	return count, index, colors, nil
+}
+
+// zoneCollector assembles the colors of a device's zones
+// from messages that each carry some of them.
+type zoneCollector struct {
+	zones []Color
+	have  []bool
+	n     int // number of zones in have that are set
+}
+
+// add records the colors of the zones starting at index, on a device with count zones.
+// Colors beyond the last zone are ignored.
+func (zc *zoneCollector) add(count, index int, colors []Color) error {
+	if zc.zones == nil {
+		zc.zones = make([]Color, count)
+		zc.have = make([]bool, count)
+	}
+	if count != len(zc.zones) {
+		return fmt.Errorf("inconsistent zone count %d, want %d", count, len(zc.zones))
 	}
+	for i, c := range colors {
+		if index+i >= count {
+			break
+		}
+		zc.zones[index+i] = c
+		if !zc.have[index+i] {
+			zc.have[index+i] = true
+			zc.n++
+		}
+	}
+	return nil
+}
 
-	return
+// complete reports whether every zone has been collected.
+func (zc *zoneCollector) complete() bool {
+	return zc.zones != nil && zc.n == len(zc.zones)
 }
 
+// maxExtendedZones is the number of zones a single SetExtendedColorZones message can carry.
+const maxExtendedZones = 82
+
+// SetExtendedColorZones sets the colors of the device's zones, starting from the first.
+// Devices with more than 82 zones are updated with several messages,
+// the last of which applies the whole change at once.
 func (d *Device) SetExtendedColorZones(ctx context.Context, duration time.Duration, zones []Color) error {
-	if len(zones) > 82 {
-		return fmt.Errorf("too many zones to set; %d > 82", len(zones))
+	if err := d.requireFeature("extended_multizone", hasExtendedMultizone); err != nil {
+		return err
+	}
+	if len(zones) > 0xFFFF {
+		return fmt.Errorf("too many zones to set; %d > %d", len(zones), 0xFFFF)
 	}
 	dur, err := uint32Millis(duration)
 	if err != nil {
 		return err
 	}
 
+	if len(zones) > maxExtendedZones {
+		// Journal the zones once, rather than once per message.
+		je := d.capture(ctx, pktSetExtendedColorZones)
+		ctx = withoutJournal(ctx)
+		defer func() {
+			if err == nil {
+				d.journal(je)
+			}
+		}()
+	}
+	for start := 0; start == 0 || start < len(zones); start += maxExtendedZones {
+		end := start + maxExtendedZones
+		apply := NoApply
+		if end >= len(zones) {
+			end = len(zones)
+			apply = Apply
+		}
+		if err = d.setExtendedColorZones(ctx, dur, uint16(start), zones[start:end], apply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Device) setExtendedColorZones(ctx context.Context, dur uint32, index uint16, zones []Color, apply ZoneApplication) error {
 	payload := make([]byte, 4+1+2+1+len(zones)*encodedColorLength)
 	binary.LittleEndian.PutUint32(payload[0:4], dur) // duration
-	payload[4] = 1                                   // apply; MultiZoneExtendedApplicationRequest(APPLY)
-	binary.LittleEndian.PutUint16(payload[5:7], 0)   // zone_index
+	payload[4] = byte(apply)                         // MultiZoneExtendedApplicationRequest
+	binary.LittleEndian.PutUint16(payload[5:7], index)
 	payload[7] = uint8(len(zones))
 	for i, off := 0, 8; i < len(zones); i++ {
 		// The next line doesn't strictly need the second slice arg, but it is a useful sanity check.
@@ -135,6 +290,48 @@ func (d *Device) SetExtendedColorZones(ctx context.Context, duration time.Durati
 	return d.set(ctx, pktSetExtendedColorZones, payload)
 }
 
+// ZoneApplication controls when zone changes take effect.
+//
+// https://lan.developer.lifx.com/docs/field-types#multizoneapplicationrequest
+type ZoneApplication uint8
+
+const (
+	// NoApply stages the change without displaying it.
+	NoApply = ZoneApplication(0)
+	// Apply displays the change along with any previously staged changes.
+	Apply = ZoneApplication(1)
+	// ApplyOnly ignores the zones and color of the message,
+	// and displays previously staged changes.
+	ApplyOnly = ZoneApplication(2)
+)
+
+// SetColorZones sets the zones from start to end (inclusive) to a single color.
+// This is the legacy multizone message, supported by all multizone devices.
+//
+// Several ranges can be updated atomically by sending all but the last
+// with NoApply, and the last with Apply.
+func (d *Device) SetColorZones(ctx context.Context, start, end uint8, color Color, duration time.Duration, apply ZoneApplication) error {
+	if err := d.requireFeature("multizone", hasMultizone); err != nil {
+		return err
+	}
+	if start > end {
+		return fmt.Errorf("bad zone range [%d,%d]", start, end)
+	}
+	dur, err := uint32Millis(duration)
+	if err != nil {
+		return err
+	}
+
+	payload := make([]byte, 1+1+encodedColorLength+4+1)
+	payload[0] = start
+	payload[1] = end
+	color.encode(payload[2 : 2+encodedColorLength])
+	binary.LittleEndian.PutUint32(payload[2+encodedColorLength:], dur) // duration
+	payload[len(payload)-1] = byte(apply)
+
+	return d.set(ctx, pktSetColorZones, payload)
+}
+
 type Waveform int
 
 const (
@@ -154,22 +351,67 @@ type WaveformConfig struct {
 	Period time.Duration
 	Cycles float32
 
-	// TODO: skew_ratio, if needed. Also, optionality (and use SetWaveformOptional).
+	// Only, if non-zero, limits the waveform to the given components of Color.
+	// The other components stay at their current values.
+	// For example, WaveformBrightness pulses brightness while preserving hue.
+	Only WaveformComponents
+
+	// SkewRatio controls the duty cycle of PulseWaveform,
+	// as the fraction of each period spent at the original color.
+	// If set, it must be in [0,1]; nil means the default of 0.5.
+	// A value near 1 gives short blips of Color; near 0 gives long holds.
+	SkewRatio *float32
 }
 
+// encodeSkewRatio maps a skew ratio in [0,1] to the wire format,
+// which spans the int16 range. A nil ratio is the default, 0.5.
+func encodeSkewRatio(r *float32) (int16, error) {
+	if r == nil {
+		return 0, nil
+	}
+	if *r < 0 || *r > 1 {
+		return 0, fmt.Errorf("skew ratio %v out of range [0,1]", *r)
+	}
+	return int16(math.Round(float64(*r)*0xFFFF) - 0x8000), nil
+}
+
+// WaveformComponents is a set of color components affected by a waveform.
+type WaveformComponents uint8
+
+const (
+	WaveformHue = WaveformComponents(1 << iota)
+	WaveformSaturation
+	WaveformBrightness
+	WaveformKelvin
+)
+
 func (d *Device) SetWaveform(ctx context.Context, cfg WaveformConfig) error {
 	period, err := uint32Millis(cfg.Period)
 	if err != nil {
 		return err
 	}
 
+	skew, err := encodeSkewRatio(cfg.SkewRatio)
+	if err != nil {
+		return err
+	}
+
 	payload := make([]byte, 21)
 	payload[1] = boolInt(cfg.Transient)                                         // transient
 	cfg.Color.encode(payload[2:10])                                             // hue, saturation, brightness, kelvin
 	binary.LittleEndian.PutUint32(payload[10:14], period)                       // period
 	binary.LittleEndian.PutUint32(payload[14:18], math.Float32bits(cfg.Cycles)) // cycles; this encoding is a guess
-	// skew_ratio left at 0 (only used for Pulse), which encodes 0.5.
+	binary.LittleEndian.PutUint16(payload[18:20], uint16(skew))                 // skew_ratio; only used for Pulse
 	payload[20] = byte(cfg.Waveform)
 
-	return d.set(ctx, pktSetWaveform, payload)
+	if cfg.Only == 0 {
+		return d.set(ctx, pktSetWaveform, payload)
+	}
+	payload = append(payload,
+		boolInt(cfg.Only&WaveformHue != 0),
+		boolInt(cfg.Only&WaveformSaturation != 0),
+		boolInt(cfg.Only&WaveformBrightness != 0),
+		boolInt(cfg.Only&WaveformKelvin != 0),
+	)
+	return d.set(ctx, pktSetWaveformOptional, payload)
 }
@@ -0,0 +1,90 @@
+package lifx_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestSetBrightness(t *testing.T) {
+	light := &lifxtest.Light{}
+	light.SetColor(lifx.Color{Hue: 0x5555, Saturation: 0x8000, Brightness: 0xFFFF, Kelvin: 3500}, 0)
+	_, dev, ctx := newTestDevice(t, light)
+	dev.Cache = &lifx.DefaultCacheConfig
+
+	for _, level := range []uint16{0x4000, 0xFFFF, 0} {
+		if err := dev.SetBrightness(ctx, level, time.Second); err != nil {
+			t.Fatalf("SetBrightness(%d): %v", level, err)
+		}
+		want := lifx.Color{Hue: 0x5555, Saturation: 0x8000, Brightness: level, Kelvin: 3500}
+		if got := light.Color(); got != want {
+			t.Errorf("After SetBrightness(%d), light has color %+v, want %+v", level, got, want)
+		}
+	}
+}
+
+func TestSetBrightnessMultizone(t *testing.T) {
+	light := lifxtest.NewStrip(8)
+	zones := make([]lifx.Color, 8)
+	for i := range zones {
+		zones[i] = lifx.Color{Hue: uint16(i * 0x2000), Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: uint16(2500 + i*100)}
+	}
+	light.SetZones(0, zones, 0)
+	_, dev, ctx := newTestDevice(t, light)
+
+	if err := dev.SetBrightness(ctx, 0x4000, time.Second); err != nil {
+		t.Fatalf("SetBrightness: %v", err)
+	}
+	want := make([]lifx.Color, len(zones))
+	for i, c := range zones {
+		c.Brightness = 0x4000
+		want[i] = c
+	}
+	if got := light.Zones(); !reflect.DeepEqual(got, want) {
+		t.Errorf("After SetBrightness, strip has zones\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSetExtendedColorZonesChunked(t *testing.T) {
+	light := lifxtest.NewStrip(120)
+	_, dev, ctx := newTestDevice(t, light)
+
+	want := make([]lifx.Color, 120)
+	for i := range want {
+		want[i] = lifx.Color{Hue: uint16(i * 500), Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	}
+	if err := dev.SetExtendedColorZones(ctx, 0, want); err != nil {
+		t.Fatalf("SetExtendedColorZones: %v", err)
+	}
+	if got := light.Zones(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after SetExtendedColorZones of 120 zones, zones = %v, want %v", got, want)
+	}
+
+	// The device replies to GetExtendedColorZones with two messages.
+	if got, err := dev.GetExtendedColorZones(ctx); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetExtendedColorZones = %v, %v; want %v, nil", got, err, want)
+	}
+	if got, err := dev.GetZones(ctx); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetZones = %v, %v; want %v, nil", got, err, want)
+	}
+}
+
+func TestGetExtendedColorZonesCached(t *testing.T) {
+	light := lifxtest.NewStrip(100)
+	light.SetColor(lifx.Color{Hue: 0x4000, Kelvin: 3500}, 0)
+	_, dev, ctx := newTestDevice(t, light)
+	dev.Cache = &lifx.CacheConfig{Color: time.Minute}
+
+	first, err := dev.GetExtendedColorZones(ctx)
+	if err != nil || len(first) != 100 {
+		t.Fatalf("GetExtendedColorZones = %d zones, %v; want 100 zones", len(first), err)
+	}
+	// A change behind the client's back isn't seen while the result is cached.
+	light.SetColor(lifx.Color{Kelvin: 9000}, 0)
+	if got, err := dev.GetExtendedColorZones(ctx); err != nil || !reflect.DeepEqual(got, first) {
+		t.Errorf("cached GetExtendedColorZones = %v, %v; want %v, nil", got, err, first)
+	}
+}
@@ -0,0 +1,224 @@
+package lifx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ColorSpace selects how colors are interpolated during client-side transitions.
+type ColorSpace int
+
+const (
+	// HSBKSpace interpolates each of hue, saturation, brightness and kelvin
+	// linearly, with hue taking the shorter way around the color wheel.
+	// This matches what devices do for their own transitions, but can pass
+	// through dull, muddy colors when the hues are far apart.
+	HSBKSpace = ColorSpace(0)
+
+	// OKLCHSpace interpolates in the OKLCH color space, which is designed
+	// so that equal steps look equally different. Fades between distant
+	// hues stay vivid, and brightness changes evenly.
+	// Kelvin is still interpolated linearly.
+	//
+	// https://bottosson.github.io/posts/oklab/
+	OKLCHSpace = ColorSpace(1)
+)
+
+// Interpolate returns the color a fraction t of the way from a to b,
+// where t is in [0,1].
+func Interpolate(a, b Color, t float64, space ColorSpace) Color {
+	if t <= 0 {
+		return a
+	}
+	if t >= 1 {
+		return b
+	}
+	if space == OKLCHSpace {
+		return interpolateOKLCH(a, b, t)
+	}
+	return interpolateHue(a, b, t, HueShortest)
+}
+
+func lerp16(a, b uint16, t float64) uint16 {
+	return uint16(math.Round(float64(a) + (float64(b)-float64(a))*t))
+}
+
+func interpolateOKLCH(a, b Color, t float64) Color {
+	la, ca, ha := toOKLCH(a)
+	lb, cb, hb := toOKLCH(b)
+
+	// An achromatic endpoint has no meaningful hue; borrow the other's
+	// so the fade doesn't swing through unrelated hues.
+	const achromatic = 1e-4
+	if ca < achromatic {
+		ha = hb
+	}
+	if cb < achromatic {
+		hb = ha
+	}
+	dh := math.Remainder(hb-ha, 2*math.Pi) // shortest way around
+
+	c := fromOKLCH(la+(lb-la)*t, ca+(cb-ca)*t, ha+dh*t)
+	c.Kelvin = lerp16(a.Kelvin, b.Kelvin, t)
+	return c
+}
+
+// ColorFromRGB converts an 8-bit sRGB color to HSBK, with the given kelvin.
+// Hue and saturation are derived from the RGB color's HSV representation,
+// and brightness from its value, so pure white is full brightness with no saturation.
+func ColorFromRGB(r, g, b uint8, kelvin uint16) Color {
+	h, s, v := rgbToHSV(float64(r)/255, float64(g)/255, float64(b)/255)
+	return Color{
+		Hue:        uint16(int(math.Round(h*0x10000)) & 0xFFFF),
+		Saturation: uint16(math.Round(s * 0xFFFF)),
+		Brightness: uint16(math.Round(v * 0xFFFF)),
+		Kelvin:     kelvin,
+	}
+}
+
+// DefaultKelvin is the kelvin used by ParseColor for colors that don't specify one.
+const DefaultKelvin = 3500
+
+// ParseColor parses a color in one of the forms
+//
+//	#rrggbb or #rgb
+//	a CSS color name, such as "orange" or "rebeccapurple"
+//	kelvin:2700
+//
+// Case and surrounding space are ignored. RGB colors are converted with ColorFromRGB
+// using DefaultKelvin; kelvin colors are white at full brightness.
+func ParseColor(s string) (Color, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if k, ok := strings.CutPrefix(s, "kelvin:"); ok {
+		n, err := strconv.ParseUint(k, 10, 16)
+		if err != nil {
+			return Color{}, fmt.Errorf("bad kelvin value %q", k)
+		}
+		return Color{Brightness: 0xFFFF, Kelvin: uint16(n)}, nil
+	}
+	rgb, ok := cssColors[s]
+	if hex, isHex := strings.CutPrefix(s, "#"); isHex && (len(hex) == 6 || len(hex) == 3) {
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return Color{}, fmt.Errorf("bad hex color %q", s)
+		}
+		if len(hex) == 3 {
+			// Each digit is doubled, so #f80 is #ff8800.
+			n = (n&0xF00)<<12 | (n&0xF0)<<8 | (n&0xF)<<4
+			n |= n >> 4
+		}
+		rgb, ok = uint32(n), true
+	}
+	if !ok {
+		return Color{}, fmt.Errorf("unknown color %q", s)
+	}
+	return ColorFromRGB(uint8(rgb>>16), uint8(rgb>>8), uint8(rgb), DefaultKelvin), nil
+}
+
+// RGB returns the 8-bit sRGB equivalent of the color.
+// Kelvin is ignored, so unsaturated colors are pure grays.
+func (c Color) RGB() (r, g, b uint8) {
+	rf, gf, bf := hsvToRGB(float64(c.Hue)/0x10000, float64(c.Saturation)/0xFFFF, float64(c.Brightness)/0xFFFF)
+	to8 := func(x float64) uint8 { return uint8(math.Round(clamp01(x) * 255)) }
+	return to8(rf), to8(gf), to8(bf)
+}
+
+// hsvToRGB converts hue (in [0,1)), saturation and value to RGB, all in [0,1].
+func hsvToRGB(h, s, v float64) (r, g, b float64) {
+	h = math.Mod(h, 1) * 6
+	i := math.Floor(h)
+	f := h - i
+	p, q, u := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	switch int(i) {
+	case 0:
+		return v, u, p
+	case 1:
+		return q, v, p
+	case 2:
+		return p, v, u
+	case 3:
+		return p, q, v
+	case 4:
+		return u, p, v
+	default:
+		return v, p, q
+	}
+}
+
+// rgbToHSV converts RGB in [0,1] to hue (in [0,1)), saturation and value.
+func rgbToHSV(r, g, b float64) (h, s, v float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+	v = max
+	if max > 0 {
+		s = delta / max
+	}
+	switch {
+	case delta == 0:
+		h = 0
+	case max == r:
+		h = math.Mod((g-b)/delta, 6) / 6
+	case max == g:
+		h = ((b-r)/delta + 2) / 6
+	default:
+		h = ((r-g)/delta + 4) / 6
+	}
+	if h < 0 {
+		h++
+	}
+	return
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(c float64) float64 {
+	if c <= 0.0031308 {
+		return 12.92 * c
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+func clamp01(x float64) float64 { return math.Max(0, math.Min(1, x)) }
+
+func toOKLCH(c Color) (l, chroma, hue float64) {
+	r, g, b := hsvToRGB(float64(c.Hue)/0x10000, float64(c.Saturation)/0xFFFF, float64(c.Brightness)/0xFFFF)
+	r, g, b = srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)
+
+	lc := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	mc := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	sc := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	l = 0.2104542553*lc + 0.7936177850*mc - 0.0040720468*sc
+	A := 1.9779984951*lc - 2.4285922050*mc + 0.4505937099*sc
+	B := 0.0259040371*lc + 0.7827717662*mc - 0.8086757660*sc
+	return l, math.Hypot(A, B), math.Atan2(B, A)
+}
+
+func fromOKLCH(l, chroma, hue float64) Color {
+	A, B := chroma*math.Cos(hue), chroma*math.Sin(hue)
+
+	lc := l + 0.3963377774*A + 0.2158037573*B
+	mc := l - 0.1055613458*A - 0.0638541728*B
+	sc := l - 0.0894841775*A - 1.2914855480*B
+	lc, mc, sc = lc*lc*lc, mc*mc*mc, sc*sc*sc
+
+	r := 4.0767416621*lc - 3.3077115913*mc + 0.2309699292*sc
+	g := -1.2684380046*lc + 2.6097574011*mc - 0.3413193965*sc
+	b := -0.0041960863*lc - 0.7034186147*mc + 1.7076147010*sc
+	r, g, b = clamp01(linearToSRGB(r)), clamp01(linearToSRGB(g)), clamp01(linearToSRGB(b))
+
+	h, s, v := rgbToHSV(r, g, b)
+	return Color{
+		Hue:        uint16(int(math.Round(h*0x10000)) & 0xFFFF),
+		Saturation: uint16(math.Round(s * 0xFFFF)),
+		Brightness: uint16(math.Round(v * 0xFFFF)),
+	}
+}
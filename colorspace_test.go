@@ -0,0 +1,104 @@
+package lifx
+
+import (
+	"testing"
+)
+
+func TestOKLCHRoundTrip(t *testing.T) {
+	for _, c := range []Color{
+		{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF},
+		{Hue: 0x5555, Saturation: 0x8000, Brightness: 0xC000},
+		{Hue: 0xAAAA, Saturation: 0xFFFF, Brightness: 0x4000},
+		{Hue: 0, Saturation: 0, Brightness: 0xFFFF},
+	} {
+		got := fromOKLCH(toOKLCH(c))
+		if diff(got.Hue, c.Hue) > 64 && c.Saturation > 0 || diff(got.Saturation, c.Saturation) > 64 || diff(got.Brightness, c.Brightness) > 64 {
+			t.Errorf("OKLCH round trip of %+v gave %+v", c, got)
+		}
+	}
+}
+
+func diff(a, b uint16) uint16 {
+	d := a - b
+	if int16(d) < 0 {
+		return -d
+	}
+	return d
+}
+
+func TestInterpolateOKLCH(t *testing.T) {
+	red := Color{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 2500}
+	blue := Color{Hue: 0xAAAA, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 9000}
+
+	if got := Interpolate(red, blue, 0, OKLCHSpace); got != red {
+		t.Errorf("Interpolate at t=0 = %+v, want %+v", got, red)
+	}
+	if got := Interpolate(red, blue, 1, OKLCHSpace); got != blue {
+		t.Errorf("Interpolate at t=1 = %+v, want %+v", got, blue)
+	}
+
+	// The midpoint should stay vivid (HSBK interpolation also does here,
+	// but a naive RGB blend would give a dull purple), and get the average kelvin.
+	mid := Interpolate(red, blue, 0.5, OKLCHSpace)
+	if mid.Saturation < 0xC000 {
+		t.Errorf("OKLCH midpoint %+v is not saturated", mid)
+	}
+	if mid.Kelvin != 5750 {
+		t.Errorf("OKLCH midpoint kelvin = %d, want 5750", mid.Kelvin)
+	}
+}
+
+func TestRGB(t *testing.T) {
+	tests := []struct {
+		r, g, b uint8
+		want    Color
+	}{
+		{255, 0, 0, Color{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}},
+		{0, 255, 0, Color{Hue: 0x5555, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}},
+		{0, 0, 255, Color{Hue: 0xAAAB, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}},
+		{255, 255, 255, Color{Hue: 0, Saturation: 0, Brightness: 0xFFFF, Kelvin: 3500}},
+		{0, 0, 0, Color{Kelvin: 3500}},
+	}
+	for _, tc := range tests {
+		got := ColorFromRGB(tc.r, tc.g, tc.b, 3500)
+		if got != tc.want {
+			t.Errorf("ColorFromRGB(%d, %d, %d) = %+v, want %+v", tc.r, tc.g, tc.b, got, tc.want)
+		}
+	}
+
+	// 8-bit colors should survive a round trip.
+	for i := 0; i < 1<<24; i += 997 {
+		r, g, b := uint8(i>>16), uint8(i>>8), uint8(i)
+		if r2, g2, b2 := ColorFromRGB(r, g, b, 3500).RGB(); r2 != r || g2 != g || b2 != b {
+			t.Errorf("RGB round trip of (%d, %d, %d) gave (%d, %d, %d)", r, g, b, r2, g2, b2)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Color
+	}{
+		{"#ff0000", Color{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: DefaultKelvin}},
+		{"#F80", ColorFromRGB(0xFF, 0x88, 0x00, DefaultKelvin)},
+		{" RebeccaPurple ", ColorFromRGB(0x66, 0x33, 0x99, DefaultKelvin)},
+		{"white", Color{Brightness: 0xFFFF, Kelvin: DefaultKelvin}},
+		{"kelvin:2700", Color{Brightness: 0xFFFF, Kelvin: 2700}},
+	}
+	for _, tc := range tests {
+		got, err := ParseColor(tc.in)
+		if err != nil {
+			t.Errorf("ParseColor(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseColor(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "#ff00", "#gggggg", "kelvin:hot", "kelvin:70000", "octarine"} {
+		if c, err := ParseColor(bad); err == nil {
+			t.Errorf("ParseColor(%q) = %+v, want error", bad, c)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package compat
+
+import (
+	"net"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// HSBK is a color, in the style of github.com/2tvenom/golifx.
+type HSBK struct {
+	Hue        uint16
+	Saturation uint16
+	Brightness uint16
+	Kelvin     uint16
+}
+
+// BulbState is the state of a bulb, in the style of github.com/2tvenom/golifx.
+type BulbState struct {
+	Color *HSBK
+	Power bool
+	Label string
+}
+
+// Bulb adapts a *lifx.Device to the API of github.com/2tvenom/golifx's Bulb.
+// Durations are in milliseconds, as in that package.
+type Bulb struct {
+	Device  *lifx.Device
+	Timeout time.Duration // per operation; zero means DefaultTimeout
+}
+
+// LookupBulbs discovers devices on the network, waiting for the given duration
+// for responses (zero means DefaultTimeout), and returns them as Bulbs.
+func LookupBulbs(c *lifx.Client, wait time.Duration) ([]*Bulb, error) {
+	ctx, cancel := timeoutCtx(wait)
+	defer cancel()
+	devs, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bulbs := make([]*Bulb, len(devs))
+	for i, d := range devs {
+		bulbs[i] = &Bulb{Device: d}
+	}
+	return bulbs, nil
+}
+
+// MacAddress returns the bulb's serial number, formatted as a MAC address.
+func (b *Bulb) MacAddress() string {
+	return net.HardwareAddr(b.Device.Serial[:]).String()
+}
+
+// IP returns the bulb's IP address.
+func (b *Bulb) IP() string { return b.Device.Addr.IP.String() }
+
+func (b *Bulb) GetPowerState() (bool, error) {
+	ctx, cancel := timeoutCtx(b.Timeout)
+	defer cancel()
+	p, err := b.Device.GetLightPower(ctx)
+	return p != 0, err
+}
+
+func (b *Bulb) SetPowerState(state bool) error {
+	return b.SetPowerDurationState(state, 0)
+}
+
+func (b *Bulb) SetPowerDurationState(state bool, duration uint32) error {
+	ctx, cancel := timeoutCtx(b.Timeout)
+	defer cancel()
+	return b.Device.SetLightPower(ctx, powerLevel(state), time.Duration(duration)*time.Millisecond)
+}
+
+func (b *Bulb) GetColorState() (*BulbState, error) {
+	ctx, cancel := timeoutCtx(b.Timeout)
+	defer cancel()
+	col, err := b.Device.GetColor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	power, err := b.Device.GetLightPower(ctx)
+	if err != nil {
+		return nil, err
+	}
+	label, err := b.Device.GetLabel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &BulbState{
+		Color: &HSBK{Hue: col.Hue, Saturation: col.Saturation, Brightness: col.Brightness, Kelvin: col.Kelvin},
+		Power: power != 0,
+		Label: label,
+	}, nil
+}
+
+func (b *Bulb) SetColorState(color *HSBK, duration uint32) error {
+	ctx, cancel := timeoutCtx(b.Timeout)
+	defer cancel()
+	col := lifx.Color{Hue: color.Hue, Saturation: color.Saturation, Brightness: color.Brightness, Kelvin: color.Kelvin}
+	return b.Device.SetColor(ctx, col, time.Duration(duration)*time.Millisecond)
+}
+
+func (b *Bulb) GetLabel() (string, error) {
+	ctx, cancel := timeoutCtx(b.Timeout)
+	defer cancel()
+	return b.Device.GetLabel(ctx)
+}
+
+func (b *Bulb) SetLabel(label string) error {
+	ctx, cancel := timeoutCtx(b.Timeout)
+	defer cancel()
+	return b.Device.SetLabel(ctx, label)
+}
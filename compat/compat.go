@@ -0,0 +1,36 @@
+/*
+Package compat provides adapters that mimic the APIs of other LIFX Go libraries,
+backed by the lifx package, so that code written against those libraries
+can be migrated incrementally.
+
+Go interfaces are satisfied only by identical types, so these adapters cannot
+be dropped into code that imports the other libraries' types directly.
+Rather, their method sets and types mirror the originals closely enough that
+switching most call sites is a matter of changing an import path.
+
+The other libraries' methods do not take a context, so the adapters bound each
+operation by a timeout instead.
+*/
+package compat
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeout is the default bound on each operation made through an adapter.
+const DefaultTimeout = 5 * time.Second
+
+func timeoutCtx(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func powerLevel(on bool) uint16 {
+	if on {
+		return 0xFFFF
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package compat
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Light adapts a *lifx.Device to the API of github.com/pdf/golifx's common.Light.
+type Light struct {
+	Device  *lifx.Device
+	Timeout time.Duration // per operation; zero means DefaultTimeout
+}
+
+// ID returns the device's serial number as an integer,
+// in the same byte order as github.com/pdf/golifx.
+func (l *Light) ID() uint64 {
+	var b [8]byte
+	copy(b[:], l.Device.Serial[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (l *Light) GetLabel() (string, error) {
+	ctx, cancel := timeoutCtx(l.Timeout)
+	defer cancel()
+	return l.Device.GetLabel(ctx)
+}
+
+func (l *Light) SetLabel(label string) error {
+	ctx, cancel := timeoutCtx(l.Timeout)
+	defer cancel()
+	return l.Device.SetLabel(ctx, label)
+}
+
+func (l *Light) GetPower() (bool, error) {
+	ctx, cancel := timeoutCtx(l.Timeout)
+	defer cancel()
+	p, err := l.Device.GetLightPower(ctx)
+	return p != 0, err
+}
+
+func (l *Light) SetPower(state bool) error {
+	return l.SetPowerDuration(state, 0)
+}
+
+func (l *Light) SetPowerDuration(state bool, duration time.Duration) error {
+	ctx, cancel := timeoutCtx(l.Timeout)
+	defer cancel()
+	return l.Device.SetLightPower(ctx, powerLevel(state), duration)
+}
+
+func (l *Light) GetColor() (lifx.Color, error) {
+	ctx, cancel := timeoutCtx(l.Timeout)
+	defer cancel()
+	return l.Device.GetColor(ctx)
+}
+
+func (l *Light) SetColor(color lifx.Color, duration time.Duration) error {
+	ctx, cancel := timeoutCtx(l.Timeout)
+	defer cancel()
+	return l.Device.SetColor(ctx, color, duration)
+}
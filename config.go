@@ -0,0 +1,73 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Config is the user-assigned configuration of a device,
+// suitable for transferring to a replacement device.
+// It can be marshaled to and from JSON.
+type Config struct {
+	Label    string     `json:"label"`
+	Group    Membership `json:"group"`
+	Location Membership `json:"location"`
+
+	// Power and Color are the device's state at the time of export.
+	// Color is only set for lights.
+	Power uint16 `json:"power"`
+	Color *Color `json:"color,omitempty"`
+}
+
+// ExportConfig reads the device's configuration.
+func (d *Device) ExportConfig(ctx context.Context) (cfg Config, err error) {
+	if cfg.Label, err = d.GetLabel(ctx); err != nil {
+		return Config{}, fmt.Errorf("GetLabel: %w", err)
+	}
+	if cfg.Group, err = d.GetGroup(ctx); err != nil {
+		return Config{}, fmt.Errorf("GetGroup: %w", err)
+	}
+	if cfg.Location, err = d.GetLocation(ctx); err != nil {
+		return Config{}, fmt.Errorf("GetLocation: %w", err)
+	}
+	if cfg.Power, err = d.GetPower(ctx); err != nil {
+		return Config{}, fmt.Errorf("GetPower: %w", err)
+	}
+	col, err := d.GetColor(ctx)
+	var ue unhandledError
+	if err == nil {
+		cfg.Color = &col
+	} else if !errors.As(err, &ue) {
+		return Config{}, fmt.Errorf("GetColor: %w", err)
+	}
+	return cfg, nil
+}
+
+// ApplyConfig writes a configuration obtained from ExportConfig to the device,
+// which may be a different device to the one it was exported from.
+func (d *Device) ApplyConfig(ctx context.Context, cfg Config) error {
+	if err := d.SetLabel(ctx, cfg.Label); err != nil {
+		return fmt.Errorf("SetLabel: %w", err)
+	}
+	if err := d.SetGroup(ctx, cfg.Group.ID, cfg.Group.Label, cfg.Group.UpdatedAt); err != nil {
+		return fmt.Errorf("SetGroup: %w", err)
+	}
+	if err := d.SetLocation(ctx, cfg.Location.ID, cfg.Location.Label, cfg.Location.UpdatedAt); err != nil {
+		return fmt.Errorf("SetLocation: %w", err)
+	}
+	if cfg.Color == nil {
+		// Not a light.
+		if err := d.SetPower(ctx, cfg.Power); err != nil {
+			return fmt.Errorf("SetPower: %w", err)
+		}
+		return nil
+	}
+	if err := d.SetColor(ctx, *cfg.Color, 0); err != nil {
+		return fmt.Errorf("SetColor: %w", err)
+	}
+	if err := d.SetLightPower(ctx, cfg.Power, 0); err != nil {
+		return fmt.Errorf("SetLightPower: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,17 @@
 package lifx
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx/protocol"
 )
 
 const (
@@ -20,10 +26,29 @@ type Device struct {
 	Serial [6]byte
 
 	client *Client
-	seq    uint8 // sequence number for this device
+	brk    breaker
+	cache  cache
+	limit  limiter
+
+	productMu sync.Mutex
+	product   *Product // nil until determined by Product
 
 	// Tracef, if set, will be used to write trace lines.
 	Tracef func(ctx context.Context, format string, args ...interface{})
+
+	// Logger, if set, will be used for structured logging. See WithLogger.
+	Logger *slog.Logger
+
+	// Breaker, if set, enables a circuit breaker for this device.
+	// See BreakerConfig for details.
+	Breaker *BreakerConfig
+
+	// Cache, if set, enables caching of query results for this device.
+	// See CacheConfig for details.
+	Cache *CacheConfig
+
+	// Retry, if set, overrides the client's RetryPolicy for this device.
+	Retry *RetryPolicy
 }
 
 func (d *Device) tracef(ctx context.Context, format string, args ...interface{}) {
@@ -32,13 +57,58 @@ func (d *Device) tracef(ctx context.Context, format string, args ...interface{})
 	}
 }
 
+// NewDevice returns a Device for the device at the given address with the given serial,
+// without any network traffic. This suits programs with static IP assignments
+// that want to skip discovery. Use DeviceAt if the serial isn't known.
+//
+// The port defaults to the standard LIFX port if it is zero.
+func (c *Client) NewDevice(addr net.UDPAddr, serial [6]byte) *Device {
+	if addr.Port == 0 {
+		addr.Port = stdPort
+	}
+	return &Device{
+		Addr:   addr,
+		Serial: serial,
+
+		client: c,
+
+		Tracef: c.tracef,
+		Logger: c.logger,
+	}
+}
+
+// broadcast sends a tagged message to all devices on the network.
+func (c *Client) broadcast(conn net.PacketConn, typ msgType, payload []byte) error {
+	return c.broadcastTo(conn, [6]byte{}, typ, payload)
+}
+
+// broadcastTo broadcasts a message addressed to the device with the given serial,
+// or to all devices if the serial is zero.
+func (c *Client) broadcastTo(conn net.PacketConn, serial [6]byte, typ msgType, payload []byte) error {
+	var hdr protocol.Header
+	hdr.Tagged = serial == [6]byte{}
+	hdr.Source = c.source
+	copy(hdr.Target[0:6], serial[:])
+	hdr.ResRequired = false // documented recommendation
+	hdr.AckRequired = false // ditto
+	hdr.Type = typ
+	msg := protocol.Encode(hdr, payload)
+
+	for _, dst := range c.broadcastDsts() {
+		if _, err := conn.WriteTo(msg, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Discover probes the network for LIFX devices.
 // The provided context controls how long to wait for responses;
 // its cancellation or deadline expiry will stop execution of Discover
 // but will not return an error.
 func (c *Client) Discover(ctx context.Context) ([]*Device, error) {
 	// Use a distinct UDP conn just for discovery so we control the timeout.
-	conn, err := udpConn(ctx)
+	conn, err := c.listen(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -47,25 +117,14 @@ func (c *Client) Discover(ctx context.Context) ([]*Device, error) {
 	// https://lan.developer.lifx.com/docs/querying-the-device-for-data#discovery
 
 	// Discovery: GetService(2) with tagged=1.
-	var hdr header
-	hdr.frameHeader.tagged = true
-	hdr.frameHeader.source = c.source
-	// hdr.frameAddress.target left as zero (all devices)
-	hdr.frameAddress.resRequired = false // documented recommendation
-	hdr.frameAddress.ackRequired = false // ditto
-	hdr.protocolHeader.typ = uint16(pktGetService)
-	msg := encodeMessage(hdr, nil)
-
-	dst := &net.UDPAddr{
-		IP:   net.IPv4(255, 255, 255, 255),
-		Port: stdPort,
-	}
-	if _, err := conn.WriteToUDP(msg, dst); err != nil {
+	if err := c.broadcast(conn, pktGetService, nil); err != nil {
 		return nil, fmt.Errorf("sending discovery request: %v", err)
 	}
 
 	// Wait for any responses.
+	// A device may respond more than once if it is reachable several ways.
 	var devs []*Device
+	seen := make(map[[6]byte]bool)
 	for {
 		hdr, payload, raddr, err := readOnePacket(conn)
 		if err != nil {
@@ -77,35 +136,259 @@ func (c *Client) Discover(ctx context.Context) ([]*Device, error) {
 			return nil, err
 		}
 
-		if hdr.frameHeader.source != c.source {
-			return nil, fmt.Errorf("received message source 0x%x (want 0x%x)", hdr.frameHeader.source, c.source)
+		if c.admit([6]byte(hdr.Target[0:6]), raddr) != nil {
+			continue
+		}
+		if hdr.Source != c.source {
+			return nil, fmt.Errorf("received message source 0x%x (want 0x%x)", hdr.Source, c.source)
 		}
-		if rt := msgType(hdr.protocolHeader.typ); rt != pktStateService {
+		if rt := hdr.Type; rt != pktStateService {
 			// Some different message for someone else?
 			return nil, fmt.Errorf("received message type %d (want %d)", rt, pktStateService)
 		}
-		if len(payload) != 5 {
-			return nil, fmt.Errorf("StateService response had bad payload length %d", len(payload))
+		addr, ok, err := decodeService(payload, raddr)
+		if err != nil {
+			return nil, err
 		}
-		if payload[0] != 0x01 { // We only care about service=UDP
+		serial := [6]byte(hdr.Target[0:6])
+		if !ok || seen[serial] {
 			continue
 		}
-		port := binary.LittleEndian.Uint32(payload[1:5])
-		if port > 0xffff {
-			return nil, fmt.Errorf("StateService response payload has illegal port field %x", payload[1:5])
+		seen[serial] = true
+		d := c.NewDevice(addr, serial)
+		d.log(ctx, slog.LevelDebug, "LIFX discovered device", slog.String("addr", addr.String()))
+		devs = append(devs, d)
+	}
+	return devs, nil
+}
+
+// decodeService decodes a StateService payload received from raddr,
+// returning the device's address and whether it is a UDP service.
+func decodeService(payload []byte, raddr *net.UDPAddr) (net.UDPAddr, bool, error) {
+	if err := checkLength(pktStateService, payload, 5); err != nil {
+		return net.UDPAddr{}, false, err
+	}
+	if payload[0] != 0x01 { // We only care about service=UDP
+		return net.UDPAddr{}, false, nil
+	}
+	port := binary.LittleEndian.Uint32(payload[1:5])
+	if port > 0xffff {
+		return net.UDPAddr{}, false, malformed(pktStateService, payload, "illegal port %d", port)
+	}
+
+	// Per docs, use the remote IP address, but the port from the payload.
+	return net.UDPAddr{IP: raddr.IP, Port: int(port)}, true, nil
+}
+
+// discoverResend is how often DiscoverSerial repeats its request.
+const discoverResend = 500 * time.Millisecond
+
+// DiscoverSerial locates the device with the given serial,
+// returning as soon as it responds. This is quicker than Discover
+// when looking for a specific device, and only that device responds.
+//
+// The request is repeated until the context is done, in which case
+// the context's error is returned.
+func (c *Client) DiscoverSerial(ctx context.Context, serial [6]byte) (*Device, error) {
+	conn, err := c.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	for {
+		if err := c.broadcastTo(conn, serial, pktGetService, nil); err != nil {
+			return nil, fmt.Errorf("sending discovery request: %v", err)
+		}
+		deadline := time.Now().Add(discoverResend)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+
+		for {
+			hdr, payload, raddr, err := readOnePacket(conn)
+			if err != nil {
+				var neterr net.Error
+				if errors.As(err, &neterr) && neterr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if hdr.Source != c.source || [6]byte(hdr.Target[0:6]) != serial ||
+				hdr.Type != pktStateService {
+				continue
+			}
+			if c.admit(serial, raddr) != nil {
+				continue
+			}
+			addr, ok, err := decodeService(payload, raddr)
+			if err != nil || !ok {
+				continue
+			}
+			return c.NewDevice(addr, serial), nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Probe sends GetService directly to each of the given addresses,
+// and returns the devices that respond. This finds devices that broadcasts
+// don't reach, such as those on other subnets or VLANs.
+// Addresses without a port use the standard LIFX port.
+//
+// Like Discover, the provided context controls how long to wait for responses,
+// and its expiry is not an error. Probe returns early once every address has responded.
+// Requests are repeated periodically to cope with packet loss.
+func (c *Client) Probe(ctx context.Context, addrs []net.UDPAddr) ([]*Device, error) {
+	conn, err := c.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var hdr protocol.Header
+	hdr.Tagged = true // we don't know their serials
+	hdr.Source = c.source
+	hdr.Type = pktGetService
+	msg := protocol.Encode(hdr, nil)
+
+	pending := make(map[string]net.UDPAddr) // keyed by IP
+	for _, a := range addrs {
+		if a.Port == 0 {
+			a.Port = stdPort
 		}
+		pending[a.IP.String()] = a
+	}
 
-		devs = append(devs, &Device{
-			// Per docs, use the remote IP address, but the port from the payload.
-			Addr: net.UDPAddr{
-				IP:   raddr.IP,
-				Port: int(port),
-			},
-			Serial: [6]byte(hdr.frameAddress.target[0:6]),
+	var devs []*Device
+	seen := make(map[[6]byte]bool)
+	for len(pending) > 0 {
+		for _, a := range pending {
+			a := a
+			if _, err := conn.WriteTo(msg, &a); err != nil {
+				return nil, fmt.Errorf("sending GetService to %v: %v", &a, err)
+			}
+		}
+		deadline := time.Now().Add(discoverResend)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
 
-			client: c,
-			seq:    1,
-		})
+		for len(pending) > 0 {
+			hdr, payload, raddr, err := readOnePacket(conn)
+			if err != nil {
+				var neterr net.Error
+				if errors.As(err, &neterr) && neterr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			serial := [6]byte(hdr.Target[0:6])
+			if hdr.Source != c.source || hdr.Type != pktStateService {
+				continue
+			}
+			if c.admit(serial, raddr) != nil {
+				continue
+			}
+			addr, ok, err := decodeService(payload, raddr)
+			if err != nil || !ok {
+				continue
+			}
+			delete(pending, raddr.IP.String())
+			if seen[serial] {
+				continue
+			}
+			seen[serial] = true
+			devs = append(devs, c.NewDevice(addr, serial))
+		}
+		if ctx.Err() != nil {
+			break
+		}
 	}
 	return devs, nil
 }
+
+// DeviceAt returns a Device for the device at the given address,
+// querying its serial with a unicast GetService.
+// If the device doesn't respond before the context is done, the context's error is returned.
+func (c *Client) DeviceAt(ctx context.Context, addr net.UDPAddr) (*Device, error) {
+	devs, err := c.Probe(ctx, []net.UDPAddr{addr})
+	if err != nil {
+		return nil, err
+	}
+	if len(devs) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no LIFX device at %v", &addr)
+	}
+	return devs[0], nil
+}
+
+// labelDiscoverWait is how long DeviceByLabel waits for discovery responses.
+const labelDiscoverWait = 2 * time.Second
+
+// labelQueryWait is how long DeviceByLabel waits for each device's label.
+const labelQueryWait = 1 * time.Second
+
+// NotFoundError is returned by DeviceByLabel when no device has the label.
+type NotFoundError struct {
+	Label string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no LIFX device with label %q", e.Label)
+}
+
+// DeviceByLabel discovers devices, queries their labels concurrently,
+// and returns the device with the given label.
+// If several devices share the label, the one with the lowest serial is returned.
+// If none do, the error is a *NotFoundError.
+//
+// Discovery waits for up to two seconds, and each label query for up to one second,
+// or less if the context expires sooner.
+func (c *Client) DeviceByLabel(ctx context.Context, label string) (*Device, error) {
+	dctx, cancel := context.WithTimeout(ctx, labelDiscoverWait)
+	devs, err := c.Discover(dctx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]string, len(devs))
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Don't let a device that has gone quiet since discovery hold up the others.
+			lctx, cancel := context.WithTimeout(ctx, labelQueryWait)
+			defer cancel()
+			labels[i], errs[i] = d.GetLabel(lctx)
+		}()
+	}
+	wg.Wait()
+
+	var found *Device
+	for i, d := range devs {
+		if errs[i] != nil || labels[i] != label {
+			continue
+		}
+		if found == nil || bytes.Compare(d.Serial[:], found.Serial[:]) < 0 {
+			found = d
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, &NotFoundError{Label: label}
+}
@@ -0,0 +1,91 @@
+package lifx_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+	"github.com/dsymonds/lifx/protocol"
+)
+
+func TestProbe(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	ed := n.Add(testSerial, "", &lifxtest.Light{})
+	client := n.Client()
+	ctx := testContext(t)
+
+	addr := *ed.Addr()
+	devs, err := client.Probe(ctx, []net.UDPAddr{addr})
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if len(devs) != 1 || devs[0].Serial != ed.Serial {
+		t.Fatalf("Probe found %v, want one device with serial %x", devs, ed.Serial)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Probe waited for the context to expire despite every address responding")
+	}
+
+	dev, err := client.DeviceAt(ctx, addr)
+	if err != nil {
+		t.Fatalf("DeviceAt: %v", err)
+	}
+	if dev.Serial != ed.Serial || dev.Addr.Port != addr.Port {
+		t.Errorf("DeviceAt = %x at %v, want %x at %v", dev.Serial, &dev.Addr, ed.Serial, &addr)
+	}
+}
+
+// labelDropConn drops GetLabel requests sent to one address.
+type labelDropConn struct {
+	net.PacketConn
+	drop string
+}
+
+func (lc *labelDropConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if hdr, _, err := protocol.Decode(b); err == nil && hdr.Type == protocol.GetLabel && addr.String() == lc.drop {
+		return len(b), nil
+	}
+	return lc.PacketConn.WriteTo(b, addr)
+}
+
+func TestDeviceByLabelUnresponsive(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	good := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 1}, "Lamp", &lifxtest.Light{})
+	quiet := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 2}, "Quiet", &lifxtest.Light{})
+
+	// The quiet device answers discovery, but never its label query.
+	tf := lifx.TransportFunc(func(ctx context.Context) (net.PacketConn, error) {
+		conn, err := n.ListenPacket(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &labelDropConn{PacketConn: conn, drop: quiet.Addr().String()}, nil
+	})
+	client, err := lifx.NewClient(lifx.WithTransport(tf))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	type result struct {
+		dev *lifx.Device
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// No deadline, as a caller might reasonably do.
+		dev, err := client.DeviceByLabel(context.Background(), "Lamp")
+		done <- result{dev, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil || r.dev.Serial != good.Serial {
+			t.Errorf("DeviceByLabel = %v, %v; want device %x", r.dev, r.err, good.Serial)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("DeviceByLabel blocked on an unresponsive device")
+	}
+}
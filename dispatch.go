@@ -0,0 +1,141 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// dispatcher demultiplexes responses arriving on a client's persistent
+// connection to the requests waiting for them.
+//
+// Responses are matched on the target serial and sequence number;
+// packets with a different source belong to another client and are dropped.
+// Sequence numbers are allocated per serial by the dispatcher, so that several
+// Device values for the same device don't reuse each other's.
+type dispatcher struct {
+	mu      sync.Mutex
+	waiters map[waitKey]*waiter
+	seqs    map[[6]byte]uint8 // last sequence number allocated for each serial
+}
+
+type waitKey struct {
+	serial [6]byte
+	seq    uint8
+}
+
+type waiter struct {
+	dev     *Device
+	ch      chan response // buffered; see waiterQueue
+	skipAck bool          // whether to ignore acknowledgements, because a state response is wanted
+}
+
+// waiterQueue is how many responses a waiter buffers,
+// for requests that are answered with several messages.
+// Any more than that are dropped, as are duplicates from retries.
+const waiterQueue = 8
+
+type response struct {
+	hdr     protocol.Header
+	payload []byte
+}
+
+// nextSeq allocates a sequence number for a request to the device with the given serial.
+// It skips any sequence number that still has a request waiting on it.
+func (dp *dispatcher) nextSeq(serial [6]byte) uint8 {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	if dp.seqs == nil {
+		dp.seqs = make(map[[6]byte]uint8)
+	}
+	seq := dp.seqs[serial]
+	for i := 0; i < 256; i++ {
+		seq++
+		if _, busy := dp.waiters[waitKey{serial, seq}]; !busy {
+			break
+		}
+	}
+	dp.seqs[serial] = seq
+	return seq
+}
+
+// register arranges for the response to the given request to be delivered
+// on the returned channel. The caller must call unregister when done.
+func (dp *dispatcher) register(d *Device, seq uint8, skipAck bool) *waiter {
+	w := &waiter{dev: d, ch: make(chan response, waiterQueue), skipAck: skipAck}
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	if dp.waiters == nil {
+		dp.waiters = make(map[waitKey]*waiter)
+	}
+	dp.waiters[waitKey{d.Serial, seq}] = w
+	return w
+}
+
+func (dp *dispatcher) unregister(d *Device, seq uint8, w *waiter) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	k := waitKey{d.Serial, seq}
+	if dp.waiters[k] == w {
+		delete(dp.waiters, k)
+	}
+}
+
+// deliver hands a response to its waiter, if any.
+func (dp *dispatcher) deliver(c *Client, hdr protocol.Header, payload []byte, raddr *net.UDPAddr) {
+	serial := [6]byte(hdr.Target[0:6])
+	dp.mu.Lock()
+	w, ok := dp.waiters[waitKey{serial, hdr.Sequence}]
+	if !ok {
+		// Devices constructed without a serial may still get their responses,
+		// but only from their own address.
+		w, ok = dp.waiters[waitKey{[6]byte{}, hdr.Sequence}]
+		ok = ok && raddr.IP.Equal(w.dev.Addr.IP) && raddr.Port == w.dev.Addr.Port
+	}
+	dp.mu.Unlock()
+	if !ok {
+		return
+	}
+	if w.skipAck && hdr.Type == pktAcknowledgement {
+		return
+	}
+	if c.policy != nil && !w.dev.fromSelf(hdr, raddr) {
+		w.dev.tracef(context.Background(), "LIFX ignoring unexpected packet from %v", raddr)
+		w.dev.log(context.Background(), slog.LevelDebug, "LIFX ignoring unexpected packet",
+			slog.String("from", raddr.String()), slog.String("type", hdr.Type.String()), slog.Int("seq", int(hdr.Sequence)))
+		return
+	}
+	select {
+	case w.ch <- response{hdr, payload}:
+	default:
+		// The waiter is not keeping up; drop this one.
+	}
+}
+
+// readLoop reads responses from the client's persistent connection until it fails,
+// usually because the client is closed.
+func (c *Client) readLoop() {
+	defer close(c.readDone)
+	buf := make([]byte, 4<<10)
+	for {
+		nb, ra, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			c.readErr = fmt.Errorf("reading responses: %w", err)
+			return
+		}
+		raddr, ok := ra.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		hdr, payload, err := protocol.Decode(buf[:nb])
+		if err != nil || hdr.Source != c.source {
+			// Garbage, or not for us.
+			continue
+		}
+		c.dispatcher.deliver(c, hdr, append([]byte(nil), payload...), raddr)
+	}
+}
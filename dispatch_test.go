@@ -0,0 +1,71 @@
+package lifx_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestConcurrentRequests(t *testing.T) {
+	vd, dev, ctx := newTestDevice(t, &lifxtest.Light{})
+	vd.SetLabel("Busy")
+
+	// All responses arrive on the client's single connection,
+	// and must each be routed to the right caller.
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = dev.GetLabel(ctx)
+			} else {
+				_, err = dev.GetColor(ctx)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+}
+
+func TestDuplicateDevices(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	light := &lifxtest.Light{}
+	light.SetColor(lifx.Color{Hue: 0x1234, Kelvin: 3500}, 0)
+	ed := n.Add(testSerial, "Twin", light)
+	client := n.Client(lifx.WithRetryPolicy(lifx.RetryPolicy{Base: time.Second, Multiplier: 1, Max: time.Second, MaxAttempts: 1}))
+	ctx := testContext(t)
+
+	// Separate Device values for one device must not steal each other's responses.
+	devs := []*lifx.Device{
+		client.NewDevice(*ed.Addr(), ed.Serial),
+		client.NewDevice(*ed.Addr(), ed.Serial),
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 40)
+	for i := range errs {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = devs[i%2].GetColor(ctx)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+}
@@ -4,5 +4,9 @@ communicating with LIFX devices.
 
 This is based on the LAN protocol documented at https://lan.developer.lifx.com/docs,
 so only supports local (same network) communication.
+
+Malformed responses from devices are reported with a *protocol.DecodeError.
+Once a device's product is known (see Device.Product), methods that need a
+capability it lacks fail immediately with an ErrUnsupported.
 */
 package lifx
@@ -0,0 +1,278 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// MultiZoneEffectType identifies a firmware effect on a multizone device.
+//
+// https://lan.developer.lifx.com/docs/field-types#multizoneeffecttype
+type MultiZoneEffectType uint8
+
+const (
+	MultiZoneEffectOff  = MultiZoneEffectType(0)
+	MultiZoneEffectMove = MultiZoneEffectType(1)
+)
+
+// MoveDirection is the direction of a MOVE effect.
+type MoveDirection uint32
+
+const (
+	MoveRight = MoveDirection(0)
+	MoveLeft  = MoveDirection(1)
+)
+
+// MultiZoneEffectConfig describes a firmware effect on a multizone device.
+type MultiZoneEffectConfig struct {
+	Type MultiZoneEffectType
+
+	// The remaining fields only apply to MultiZoneEffectMove.
+
+	Direction MoveDirection
+	// Speed is the time taken for the pattern to move the full length of the device.
+	Speed time.Duration
+	// Duration is how long the effect runs for. Zero means indefinitely.
+	Duration time.Duration
+	// Palette, if non-empty, is repeated across the device's zones
+	// before the effect starts. Otherwise the current zone colors are moved.
+	Palette []Color
+}
+
+func (cfg *MultiZoneEffectConfig) validate() error {
+	switch cfg.Type {
+	case MultiZoneEffectOff:
+		return nil
+	case MultiZoneEffectMove:
+	default:
+		return fmt.Errorf("unknown multizone effect type %d", cfg.Type)
+	}
+	if cfg.Direction != MoveRight && cfg.Direction != MoveLeft {
+		return fmt.Errorf("unknown move direction %d", cfg.Direction)
+	}
+	if cfg.Speed <= 0 {
+		return fmt.Errorf("move speed %v must be positive", cfg.Speed)
+	}
+	if cfg.Duration < 0 {
+		return fmt.Errorf("effect duration %v must not be negative", cfg.Duration)
+	}
+	if len(cfg.Palette) > maxExtendedZones {
+		return fmt.Errorf("too many palette colors; %d > %d", len(cfg.Palette), maxExtendedZones)
+	}
+	return nil
+}
+
+// SetMultiZoneEffect starts or stops a firmware effect on a multizone device.
+func (d *Device) SetMultiZoneEffect(ctx context.Context, cfg MultiZoneEffectConfig) error {
+	if err := d.requireFeature("multizone", hasMultizone); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	speed, err := uint32Millis(cfg.Speed)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Palette) > 0 {
+		zones, err := d.GetZones(ctx)
+		if err != nil {
+			return fmt.Errorf("GetZones: %w", err)
+		}
+		for i := range zones {
+			zones[i] = cfg.Palette[i%len(cfg.Palette)]
+		}
+		if err := d.SetZones(ctx, 0, zones); err != nil {
+			return fmt.Errorf("SetZones: %w", err)
+		}
+	}
+
+	payload := make([]byte, 4+1+2+4+8+4+4+32)
+	binary.LittleEndian.PutUint32(payload[0:4], rand.Uint32()) // instanceid
+	payload[4] = byte(cfg.Type)
+	// 2 bytes reserved
+	binary.LittleEndian.PutUint32(payload[7:11], speed)
+	binary.LittleEndian.PutUint64(payload[11:19], uint64(cfg.Duration)) // nanoseconds; validated as non-negative
+	// 8 bytes reserved
+	params := payload[27:59]
+	// params[0:4] is reserved for MOVE.
+	binary.LittleEndian.PutUint32(params[4:8], uint32(cfg.Direction))
+
+	return d.set(ctx, pktSetMultiZoneEffect, payload)
+}
+
+// GetMultiZoneEffect returns the firmware effect running on a multizone device.
+// The returned config never has a Palette.
+func (d *Device) GetMultiZoneEffect(ctx context.Context) (MultiZoneEffectConfig, error) {
+	if err := d.requireFeature("multizone", hasMultizone); err != nil {
+		return MultiZoneEffectConfig{}, err
+	}
+	payload, err := d.query(ctx, pktGetMultiZoneEffect, pktStateMultiZoneEffect, nil)
+	if err != nil {
+		return MultiZoneEffectConfig{}, err
+	}
+	return decodeMultiZoneEffect(payload)
+}
+
+func decodeMultiZoneEffect(payload []byte) (MultiZoneEffectConfig, error) {
+	if err := checkLength(pktStateMultiZoneEffect, payload, 4+1+2+4+8+4+4+32); err != nil {
+		return MultiZoneEffectConfig{}, err
+	}
+	cfg := MultiZoneEffectConfig{
+		Type:     MultiZoneEffectType(payload[4]),
+		Speed:    time.Duration(binary.LittleEndian.Uint32(payload[7:11])) * time.Millisecond,
+		Duration: time.Duration(binary.LittleEndian.Uint64(payload[11:19])),
+	}
+	params := payload[27:59]
+	if cfg.Type == MultiZoneEffectMove {
+		cfg.Direction = MoveDirection(binary.LittleEndian.Uint32(params[4:8]))
+	}
+	return cfg, nil
+}
+
+// TileEffectType identifies a firmware effect on a matrix device.
+//
+// https://lan.developer.lifx.com/docs/field-types#tileeffecttype
+type TileEffectType uint8
+
+const (
+	TileEffectOff   = TileEffectType(0)
+	TileEffectMorph = TileEffectType(2)
+	TileEffectFlame = TileEffectType(3)
+	TileEffectSky   = TileEffectType(5)
+)
+
+// SkyType is the kind of sky simulated by the SKY effect.
+type SkyType uint8
+
+const (
+	SkySunrise = SkyType(0)
+	SkySunset  = SkyType(1)
+	SkyClouds  = SkyType(2)
+)
+
+// TileEffectConfig describes a firmware effect on a matrix device.
+type TileEffectConfig struct {
+	Type TileEffectType
+
+	// Speed is the time taken for one cycle of the effect.
+	Speed time.Duration
+	// Duration is how long the effect runs for. Zero means indefinitely.
+	Duration time.Duration
+	// Palette is the set of colors used by the MORPH effect.
+	// If empty, the device uses its default palette.
+	Palette Palette
+
+	// Sky, CloudSaturationMin and CloudSaturationMax only apply to TileEffectSky.
+	// The cloud saturation bounds only apply to SkyClouds.
+	Sky                                    SkyType
+	CloudSaturationMin, CloudSaturationMax uint8
+}
+
+func (cfg *TileEffectConfig) validate() error {
+	switch cfg.Type {
+	case TileEffectOff, TileEffectMorph, TileEffectFlame:
+	case TileEffectSky:
+		if cfg.Sky > SkyClouds {
+			return fmt.Errorf("unknown sky type %d", cfg.Sky)
+		}
+		if cfg.CloudSaturationMin > cfg.CloudSaturationMax {
+			return fmt.Errorf("cloud saturation range [%d,%d] is inverted", cfg.CloudSaturationMin, cfg.CloudSaturationMax)
+		}
+	default:
+		return fmt.Errorf("unknown tile effect type %d", cfg.Type)
+	}
+	if cfg.Type != TileEffectOff && cfg.Speed <= 0 {
+		return fmt.Errorf("effect speed %v must be positive", cfg.Speed)
+	}
+	if cfg.Duration < 0 {
+		return fmt.Errorf("effect duration %v must not be negative", cfg.Duration)
+	}
+	return nil
+}
+
+// SetTileEffect starts or stops a firmware effect on a matrix device.
+func (d *Device) SetTileEffect(ctx context.Context, cfg TileEffectConfig) error {
+	if err := d.requireFeature("matrix", hasMatrix); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	speed, err := uint32Millis(cfg.Speed)
+	if err != nil {
+		return err
+	}
+	palette, err := cfg.Palette.encodeTile()
+	if err != nil {
+		return err
+	}
+
+	payload := make([]byte, 0, 2+4+1+4+8+4+4+32+len(palette))
+	payload = append(payload, 0, 0) // reserved
+	payload = binary.LittleEndian.AppendUint32(payload, rand.Uint32())
+	payload = append(payload, byte(cfg.Type))
+	payload = binary.LittleEndian.AppendUint32(payload, speed)
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(cfg.Duration)) // nanoseconds; validated as non-negative
+	payload = append(payload, make([]byte, 4+4)...)                           // reserved
+	payload = append(payload, cfg.encodeParams()...)
+	payload = append(payload, palette...)
+
+	return d.set(ctx, pktSetTileEffect, payload)
+}
+
+// encodeParams encodes the effect-specific parameters.
+// https://lan.developer.lifx.com/docs/field-types#tileeffectparameter
+func (cfg *TileEffectConfig) encodeParams() []byte {
+	params := make([]byte, 32)
+	if cfg.Type == TileEffectSky {
+		params[0] = byte(cfg.Sky)
+		params[4] = cfg.CloudSaturationMin
+		params[8] = cfg.CloudSaturationMax
+	}
+	return params
+}
+
+// GetTileEffect returns the firmware effect running on a matrix device.
+func (d *Device) GetTileEffect(ctx context.Context) (TileEffectConfig, error) {
+	if err := d.requireFeature("matrix", hasMatrix); err != nil {
+		return TileEffectConfig{}, err
+	}
+	payload, err := d.query(ctx, pktGetTileEffect, pktStateTileEffect, []byte{0, 0})
+	if err != nil {
+		return TileEffectConfig{}, err
+	}
+	return decodeTileEffect(payload)
+}
+
+func decodeTileEffect(payload []byte) (TileEffectConfig, error) {
+	if err := checkLength(pktStateTileEffect, payload, 1+4+1+4+8+4+4+32+1+maxTilePalette*encodedColorLength); err != nil {
+		return TileEffectConfig{}, err
+	}
+	cfg := TileEffectConfig{
+		Type:     TileEffectType(payload[5]),
+		Speed:    time.Duration(binary.LittleEndian.Uint32(payload[6:10])) * time.Millisecond,
+		Duration: time.Duration(binary.LittleEndian.Uint64(payload[10:18])),
+	}
+	params := payload[26:58]
+	if cfg.Type == TileEffectSky {
+		cfg.Sky = SkyType(params[0])
+		cfg.CloudSaturationMin = params[4]
+		cfg.CloudSaturationMax = params[8]
+	}
+	n := int(payload[58])
+	if n > maxTilePalette {
+		return TileEffectConfig{}, malformed(pktStateTileEffect, payload, "palette_count %d > %d", n, maxTilePalette)
+	}
+	for i := 0; i < n; i++ {
+		off := 59 + i*encodedColorLength
+		var c Color
+		c.decode(payload[off : off+encodedColorLength])
+		cfg.Palette = append(cfg.Palette, c)
+	}
+	return cfg, nil
+}
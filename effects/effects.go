@@ -0,0 +1,272 @@
+/*
+Package effects runs software effects on LIFX devices.
+
+Unlike the firmware effects (see lifx.Device.SetMultiZoneEffect and SetTileEffect),
+these work on any light, and are driven from the client by sending a stream of
+color updates. Each running effect has its own goroutine:
+
+	r, err := effects.Start(ctx, dev, &effects.Breathe{Period: 4 * time.Second, Min: 0.2})
+	...
+	err = r.Stop() // restores the device's prior state
+
+Effects should not be run faster than the device's rate limit allows;
+see lifx.WithRateLimit.
+*/
+package effects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// An Effect computes the frames of an effect.
+type Effect interface {
+	// Interval is the time between frames.
+	Interval() time.Duration
+
+	// Frame returns the colors for the frame at time t after the effect started,
+	// and the transition time to them. base holds the device's colors when
+	// the effect started: one per zone for multizone devices, or just one otherwise.
+	// The returned slice must be the same length as base.
+	Frame(t time.Duration, base []lifx.Color) (colors []lifx.Color, transition time.Duration)
+}
+
+// restoreTimeout bounds how long Stop spends restoring the device's state.
+const restoreTimeout = 10 * time.Second
+
+// Runner runs an effect on a device.
+type Runner struct {
+	dev    *lifx.Device
+	state  lifx.State
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error // set before done is closed
+
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// Start captures the device's state and starts running the effect on it.
+// The light is turned on if it was off. The effect runs until Stop is called,
+// the context is done, or an update fails; in any case, Stop should be called
+// to restore the device's state.
+func Start(ctx context.Context, d *lifx.Device, e Effect) (*Runner, error) {
+	if e.Interval() <= 0 {
+		return nil, fmt.Errorf("effect interval %v must be positive", e.Interval())
+	}
+	state, err := d.CaptureState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CaptureState: %w", err)
+	}
+	base := state.Zones()
+	if len(base) == 0 {
+		base = []lifx.Color{state.Color()}
+	}
+	if state.Power() == 0 {
+		if err := d.SetLightPower(ctx, 0xFFFF, 0); err != nil {
+			return nil, fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Runner{
+		dev:    d,
+		state:  state,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.run(ctx, e, base)
+	return r, nil
+}
+
+func (r *Runner) run(ctx context.Context, e Effect, base []lifx.Color) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(e.Interval())
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		colors, transition := e.Frame(time.Since(start), base)
+		var err error
+		if len(colors) == 1 {
+			err = r.dev.SetColor(ctx, colors[0], transition)
+		} else {
+			err = r.dev.SetZones(ctx, transition, colors)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				r.err = err
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Done returns a channel that is closed when the effect stops running.
+func (r *Runner) Done() <-chan struct{} { return r.done }
+
+// Stop stops the effect, and restores the device to its state from when the effect started.
+// It returns the error that stopped the effect early, if any, and any error restoring the state.
+func (r *Runner) Stop() error {
+	r.stopOnce.Do(func() {
+		r.cancel()
+		<-r.done
+		ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+		defer cancel()
+		var rerr error
+		if err := r.dev.RestoreState(ctx, r.state); err != nil {
+			rerr = fmt.Errorf("RestoreState: %w", err)
+		}
+		r.stopErr = errors.Join(r.err, rerr)
+	})
+	return r.stopErr
+}
+
+// Candle flickers like a candle flame, varying brightness randomly
+// and warming the color slightly as it dims.
+// A Candle should only be used by one Runner at a time.
+type Candle struct {
+	// Depth is how far the brightness dips, as a fraction of the base brightness.
+	// Zero means 0.4.
+	Depth float64
+
+	rng *rand.Rand
+}
+
+func (c *Candle) Interval() time.Duration { return 100 * time.Millisecond }
+
+func (c *Candle) Frame(t time.Duration, base []lifx.Color) ([]lifx.Color, time.Duration) {
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	depth := c.Depth
+	if depth == 0 {
+		depth = 0.4
+	}
+	out := make([]lifx.Color, len(base))
+	for i, b := range base {
+		dip := depth * c.rng.Float64() * c.rng.Float64() // mostly small dips
+		out[i] = b
+		out[i].Brightness = scale16(b.Brightness, 1-dip)
+		out[i].Kelvin = scale16(b.Kelvin, 1-dip/4)
+	}
+	return out, c.Interval()
+}
+
+// Breathe smoothly pulses brightness between the base brightness and a fraction of it.
+type Breathe struct {
+	Period time.Duration // time for one breath
+	Min    float64       // lowest brightness, as a fraction of the base brightness
+}
+
+func (b *Breathe) Interval() time.Duration { return frameInterval(b.Period) }
+
+func (b *Breathe) Frame(t time.Duration, base []lifx.Color) ([]lifx.Color, time.Duration) {
+	phase := 0.5 + 0.5*math.Cos(2*math.Pi*t.Seconds()/b.Period.Seconds()) // 1 at the start
+	f := b.Min + (1-b.Min)*phase
+	out := make([]lifx.Color, len(base))
+	for i, c := range base {
+		out[i] = c
+		out[i].Brightness = scale16(c.Brightness, f)
+	}
+	return out, b.Interval()
+}
+
+// ColorLoop cycles through all hues at full saturation.
+// On multizone devices, the hues are spread along the device.
+type ColorLoop struct {
+	Period time.Duration // time for a full cycle of hues
+	Spread float64       // fraction of the hue circle spread across the zones
+}
+
+func (cl *ColorLoop) Interval() time.Duration { return frameInterval(cl.Period) }
+
+func (cl *ColorLoop) Frame(t time.Duration, base []lifx.Color) ([]lifx.Color, time.Duration) {
+	shift := t.Seconds() / cl.Period.Seconds()
+	out := make([]lifx.Color, len(base))
+	for i, c := range base {
+		h := shift + cl.Spread*float64(i)/float64(len(base))
+		out[i] = c
+		out[i].Hue = uint16(int(math.Round((h-math.Floor(h))*0x10000)) & 0xFFFF)
+		out[i].Saturation = 0xFFFF
+	}
+	return out, cl.Interval()
+}
+
+// Strobe alternates between Color and darkness.
+type Strobe struct {
+	Period time.Duration // time for one flash and one dark phase
+	Color  lifx.Color
+}
+
+func (s *Strobe) Interval() time.Duration { return s.Period / 2 }
+
+func (s *Strobe) Frame(t time.Duration, base []lifx.Color) ([]lifx.Color, time.Duration) {
+	c := s.Color
+	if (t+s.Period/4)%s.Period >= s.Period/2 {
+		c.Brightness = 0
+	}
+	out := make([]lifx.Color, len(base))
+	for i := range out {
+		out[i] = c
+	}
+	return out, 0
+}
+
+// Sparkle briefly flashes random zones to Color over the base colors.
+// On single-zone lights, the whole light sparkles.
+// A Sparkle should only be used by one Runner at a time.
+type Sparkle struct {
+	Color   lifx.Color
+	Density float64 // fraction of zones sparkling in each frame
+
+	rng *rand.Rand
+}
+
+func (s *Sparkle) Interval() time.Duration { return 150 * time.Millisecond }
+
+func (s *Sparkle) Frame(t time.Duration, base []lifx.Color) ([]lifx.Color, time.Duration) {
+	if s.rng == nil {
+		s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	out := make([]lifx.Color, len(base))
+	for i, c := range base {
+		out[i] = c
+		if s.rng.Float64() < s.Density {
+			out[i] = s.Color
+		}
+	}
+	return out, s.Interval() / 2
+}
+
+// frameInterval picks a frame interval for a periodic effect:
+// 20 frames per period, but no faster than 10 per second.
+// It returns zero for a non-positive period, which Start rejects.
+func frameInterval(period time.Duration) time.Duration {
+	const minInterval = 100 * time.Millisecond
+	if period <= 0 {
+		return 0
+	}
+	if iv := period / 20; iv > minInterval {
+		return iv
+	}
+	return minInterval
+}
+
+// scale16 scales v by f, clamped to [0,1].
+func scale16(v uint16, f float64) uint16 {
+	f = math.Max(0, math.Min(1, f))
+	return uint16(math.Round(float64(v) * f))
+}
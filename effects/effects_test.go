@@ -0,0 +1,57 @@
+package effects
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestBreathe(t *testing.T) {
+	base := []lifx.Color{{Brightness: 0xFFFF, Kelvin: 3500}}
+	b := &Breathe{Period: 4 * time.Second, Min: 0.5}
+	for _, tc := range []struct {
+		t    time.Duration
+		want uint16
+	}{
+		{0, 0xFFFF},
+		{2 * time.Second, 0x8000},
+		{4 * time.Second, 0xFFFF},
+	} {
+		got, _ := b.Frame(tc.t, base)
+		if got[0].Brightness != tc.want {
+			t.Errorf("Breathe brightness at %v = %#x, want %#x", tc.t, got[0].Brightness, tc.want)
+		}
+	}
+}
+
+func TestColorLoop(t *testing.T) {
+	base := make([]lifx.Color, 4)
+	cl := &ColorLoop{Period: 8 * time.Second, Spread: 0.5}
+	got, _ := cl.Frame(2*time.Second, base)
+	want := []uint16{0x4000, 0x6000, 0x8000, 0xA000}
+	for i, c := range got {
+		if c.Hue != want[i] || c.Saturation != 0xFFFF {
+			t.Errorf("ColorLoop zone %d = %+v, want hue %#x at full saturation", i, c, want[i])
+		}
+	}
+}
+
+func TestStrobe(t *testing.T) {
+	s := &Strobe{Period: time.Second, Color: lifx.Color{Brightness: 0xFFFF}}
+	base := make([]lifx.Color, 1)
+	for i := 0; i < 4; i++ {
+		got, _ := s.Frame(time.Duration(i)*s.Interval(), base)
+		if on := got[0].Brightness > 0; on != (i%2 == 0) {
+			t.Errorf("Strobe frame %d on = %t, want %t", i, on, i%2 == 0)
+		}
+	}
+}
+
+func TestPeriodRequired(t *testing.T) {
+	for _, e := range []Effect{&Breathe{}, &ColorLoop{}, &Strobe{}} {
+		if iv := e.Interval(); iv != 0 {
+			t.Errorf("%T with no period has interval %v, want 0", e, iv)
+		}
+	}
+}
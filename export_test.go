@@ -0,0 +1,21 @@
+package lifx
+
+import (
+	"context"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// HandleForTest passes a message to the virtual device as if from a client,
+// discarding any responses.
+func (vd *VirtualDevice) HandleForTest(hdr protocol.Header, payload []byte) {
+	vd.handle(hdr, payload, stdPort)
+}
+
+// BlendForTest exposes Palette.blend.
+func (p Palette) BlendForTest(n int) []Color { return p.blend(n) }
+
+// SweepZonesForTest is SweepState, but also asking for zone colors.
+func (c *Client) SweepZonesForTest(ctx context.Context) ([]*SweptState, error) {
+	return c.sweep(ctx, true)
+}
@@ -0,0 +1,58 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultFadeStep is the default interval between updates in Fade.
+// This keeps well under the recommended limit of 20 messages per second.
+const defaultFadeStep = 100 * time.Millisecond
+
+// FadeOptions configures Fade.
+type FadeOptions struct {
+	// Space is the color space to interpolate in.
+	Space ColorSpace
+	// Step is the interval between color updates. Zero means 100ms.
+	Step time.Duration
+}
+
+// Fade transitions the device from its current color to the given color
+// over the duration, stepping through intermediate colors from the client.
+// Unlike SetColor, whose transitions are performed by the device in HSBK space,
+// this permits interpolating in another color space; see ColorSpace.
+//
+// Each step is itself sent as a short device-side transition, so the result is smooth.
+func (d *Device) Fade(ctx context.Context, to Color, duration time.Duration, opts FadeOptions) error {
+	from, err := d.GetColor(ctx)
+	if err != nil {
+		return fmt.Errorf("GetColor: %w", err)
+	}
+	step := opts.Step
+	if step <= 0 {
+		step = defaultFadeStep
+	}
+	steps := int(duration / step)
+	if steps < 1 {
+		return d.SetColor(ctx, to, duration)
+	}
+
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	for i := 1; i <= steps; i++ {
+		c := Interpolate(from, to, float64(i)/float64(steps), opts.Space)
+		if err := d.SetColor(ctx, c, step); err != nil {
+			return fmt.Errorf("SetColor: %w", err)
+		}
+		if i == steps {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package lifx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+// testSerial is the serial of the device started by newTestDevice.
+var testSerial = [6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBB, 0xCC}
+
+// testContext returns a context that expires if the test takes too long.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// newTestDevice starts an emulated device serving light, and returns it along with
+// a Device for it from a new client with the given options.
+func newTestDevice(t *testing.T, light lifx.VirtualLight, opts ...lifx.Option) (*lifxtest.Device, *lifx.Device, context.Context) {
+	t.Helper()
+	n := lifxtest.NewNetwork(t)
+	ed := n.Add(testSerial, "", light)
+	dev := n.Client(opts...).NewDevice(*ed.Addr(), ed.Serial)
+	return ed, dev, testContext(t)
+}
@@ -0,0 +1,286 @@
+/*
+Package fleet manages the configuration of many LIFX devices declaratively.
+
+A Spec describes the desired label, group, location and color of each device.
+MakePlan compares that against the devices' current state and produces a Plan
+listing the changes needed, which can be reviewed and then applied.
+*/
+package fleet
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Spec is the desired state of a set of devices.
+type Spec struct {
+	Devices []DeviceSpec `json:"devices"`
+}
+
+// DeviceSpec is the desired state of a single device.
+// Empty or nil fields are left unmanaged.
+type DeviceSpec struct {
+	Serial   Serial      `json:"serial"`
+	Label    string      `json:"label,omitempty"`
+	Group    string      `json:"group,omitempty"`
+	Location string      `json:"location,omitempty"`
+	Color    *lifx.Color `json:"color,omitempty"`
+}
+
+// Serial is a device serial number. It is encoded in JSON as a hex string.
+type Serial [6]byte
+
+func (s Serial) String() string { return hex.EncodeToString(s[:]) }
+
+func (s Serial) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+func (s *Serial) UnmarshalText(b []byte) error {
+	raw, err := hex.DecodeString(strings.ReplaceAll(string(b), ":", ""))
+	if err != nil || len(raw) != len(s) {
+		return fmt.Errorf("bad serial %q (want 12 hex digits)", b)
+	}
+	copy(s[:], raw)
+	return nil
+}
+
+// observed is the current state of a device, as far as a plan cares.
+type observed struct {
+	dev      *lifx.Device
+	label    string
+	group    lifx.Membership
+	location lifx.Membership
+	color    *lifx.Color // nil if not a light
+}
+
+// Change is a single modification to a single device.
+type Change struct {
+	Device   *lifx.Device
+	Field    string // "label", "group", "location" or "color"
+	From, To string // human-readable descriptions
+
+	apply func(context.Context) error
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%x: %s %s -> %s", c.Device.Serial, c.Field, c.From, c.To)
+}
+
+// Plan is the set of changes needed to bring devices into line with a Spec.
+type Plan struct {
+	Changes []Change
+
+	// Missing lists the serials in the Spec that were not among the devices.
+	Missing []Serial
+}
+
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for _, c := range p.Changes {
+		fmt.Fprintf(&sb, "%v\n", c)
+	}
+	for _, s := range p.Missing {
+		fmt.Fprintf(&sb, "%v: missing\n", s)
+	}
+	if sb.Len() == 0 {
+		return "no changes\n"
+	}
+	return sb.String()
+}
+
+// MakePlan queries the devices and determines the changes needed
+// to bring them into line with the spec. Devices not in the spec are ignored.
+func MakePlan(ctx context.Context, devs []*lifx.Device, spec Spec) (*Plan, error) {
+	bySerial := make(map[Serial]*lifx.Device)
+	for _, d := range devs {
+		bySerial[d.Serial] = d
+	}
+
+	// Query all devices in the spec, not just those needing changes,
+	// so existing group/location IDs can be reused.
+	var wanted []*lifx.Device
+	for _, ds := range spec.Devices {
+		if d, ok := bySerial[ds.Serial]; ok {
+			wanted = append(wanted, d)
+		}
+	}
+	obs := make([]observed, len(wanted))
+	errs := make([]error, len(wanted))
+	var wg sync.WaitGroup
+	for i, d := range wanted {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			obs[i], errs[i] = observe(ctx, d)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return makePlan(obs, spec, time.Now()), nil
+}
+
+func observe(ctx context.Context, d *lifx.Device) (o observed, err error) {
+	o.dev = d
+	if o.label, err = d.GetLabel(ctx); err != nil {
+		return o, fmt.Errorf("device %x: GetLabel: %w", d.Serial, err)
+	}
+	if o.group, err = d.GetGroup(ctx); err != nil {
+		return o, fmt.Errorf("device %x: GetGroup: %w", d.Serial, err)
+	}
+	if o.location, err = d.GetLocation(ctx); err != nil {
+		return o, fmt.Errorf("device %x: GetLocation: %w", d.Serial, err)
+	}
+	col, err := d.GetColor(ctx)
+	if err == nil {
+		o.color = &col
+	} else if !errors.Is(err, lifx.ErrUnhandled) {
+		return o, fmt.Errorf("device %x: GetColor: %w", d.Serial, err)
+	}
+	return o, nil
+}
+
+// makePlan is the pure part of MakePlan.
+func makePlan(obs []observed, spec Spec, now time.Time) *Plan {
+	bySerial := make(map[Serial]observed)
+	for _, o := range obs {
+		bySerial[o.dev.Serial] = o
+	}
+
+	// Each distinct group/location label maps to a single Membership,
+	// reusing the ID of an existing one with that label if there is one.
+	// All devices being moved get the same UpdatedAt, so the newest-wins rule
+	// treats them consistently.
+	groups := memberships(obs, func(o observed) lifx.Membership { return o.group }, now)
+	locations := memberships(obs, func(o observed) lifx.Membership { return o.location }, now)
+
+	p := new(Plan)
+	for _, ds := range spec.Devices {
+		o, ok := bySerial[ds.Serial]
+		if !ok {
+			p.Missing = append(p.Missing, ds.Serial)
+			continue
+		}
+		d := o.dev
+		if ds.Label != "" && ds.Label != o.label {
+			label := ds.Label
+			p.Changes = append(p.Changes, Change{
+				Device: d, Field: "label", From: fmt.Sprintf("%q", o.label), To: fmt.Sprintf("%q", label),
+				apply: func(ctx context.Context) error { return d.SetLabel(ctx, label) },
+			})
+		}
+		if ds.Group != "" && ds.Group != o.group.Label {
+			m := groups.get(ds.Group)
+			p.Changes = append(p.Changes, Change{
+				Device: d, Field: "group", From: fmt.Sprintf("%q", o.group.Label), To: fmt.Sprintf("%q", m.Label),
+				apply: func(ctx context.Context) error { return d.SetGroup(ctx, m.ID, m.Label, m.UpdatedAt) },
+			})
+		}
+		if ds.Location != "" && ds.Location != o.location.Label {
+			m := locations.get(ds.Location)
+			p.Changes = append(p.Changes, Change{
+				Device: d, Field: "location", From: fmt.Sprintf("%q", o.location.Label), To: fmt.Sprintf("%q", m.Label),
+				apply: func(ctx context.Context) error { return d.SetLocation(ctx, m.ID, m.Label, m.UpdatedAt) },
+			})
+		}
+		if ds.Color != nil && (o.color == nil || *o.color != *ds.Color) {
+			col := *ds.Color
+			from := "unknown"
+			if o.color != nil {
+				from = fmt.Sprintf("%+v", *o.color)
+			}
+			p.Changes = append(p.Changes, Change{
+				Device: d, Field: "color", From: from, To: fmt.Sprintf("%+v", col),
+				apply: func(ctx context.Context) error { return d.SetColor(ctx, col, 0) },
+			})
+		}
+	}
+	return p
+}
+
+type membershipSet struct {
+	byLabel map[string]lifx.Membership
+	now     time.Time
+}
+
+func memberships(obs []observed, f func(observed) lifx.Membership, now time.Time) *membershipSet {
+	ms := &membershipSet{byLabel: make(map[string]lifx.Membership), now: now}
+	for _, o := range obs {
+		m := f(o)
+		if m.Label == "" {
+			continue
+		}
+		if prev, ok := ms.byLabel[m.Label]; !ok || m.UpdatedAt.After(prev.UpdatedAt) {
+			ms.byLabel[m.Label] = m
+		}
+	}
+	// Everything handed out from here on is being changed.
+	for label, m := range ms.byLabel {
+		m.UpdatedAt = now
+		ms.byLabel[label] = m
+	}
+	return ms
+}
+
+func (ms *membershipSet) get(label string) lifx.Membership {
+	m, ok := ms.byLabel[label]
+	if !ok {
+		m = lifx.Membership{ID: lifx.NewMembershipID(), Label: label, UpdatedAt: ms.now}
+		ms.byLabel[label] = m
+	}
+	return m
+}
+
+// Result is the outcome of applying a plan to one device.
+type Result struct {
+	Serial  Serial
+	Applied []Change // changes that were successfully applied, in order
+	Err     error    // the first failure, after which no more changes were attempted
+}
+
+// Apply applies the plan. Devices are processed concurrently,
+// and the changes for each device are applied in order.
+// The results are sorted by serial.
+func (p *Plan) Apply(ctx context.Context) []Result {
+	var order []Serial
+	byDev := make(map[Serial][]Change)
+	for _, c := range p.Changes {
+		s := Serial(c.Device.Serial)
+		if _, ok := byDev[s]; !ok {
+			order = append(order, s)
+		}
+		byDev[s] = append(byDev[s], c)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].String() < order[j].String() })
+
+	results := make([]Result, len(order))
+	var wg sync.WaitGroup
+	for i, s := range order {
+		i, s := i, s
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := Result{Serial: s}
+			for _, c := range byDev[s] {
+				if err := c.apply(ctx); err != nil {
+					res.Err = fmt.Errorf("%s: %w", c.Field, err)
+					break
+				}
+				res.Applied = append(res.Applied, c)
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,53 @@
+package fleet
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestMakePlan(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	lounge := lifx.Membership{ID: [16]byte{1}, Label: "Lounge", UpdatedAt: now.Add(-time.Hour)}
+	home := lifx.Membership{ID: [16]byte{2}, Label: "Home", UpdatedAt: now.Add(-time.Hour)}
+	red := lifx.Color{Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+
+	dev := func(b byte) *lifx.Device { return &lifx.Device{Serial: [6]byte{0xd0, 0x73, 0xd5, 0, 0, b}} }
+	obs := []observed{
+		{dev: dev(1), label: "TV", group: lounge, location: home, color: &red},
+		{dev: dev(2), label: "Lamp", group: lifx.Membership{Label: "Spare"}, location: home, color: &red},
+	}
+
+	var spec Spec
+	const specJSON = `{"devices": [
+		{"serial": "d073d5000001", "label": "TV", "group": "Lounge", "location": "Home"},
+		{"serial": "d073d5000002", "label": "Floor lamp", "group": "Lounge", "color": {"Hue": 100, "Saturation": 0, "Brightness": 65535, "Kelvin": 2700}},
+		{"serial": "d073d5000003", "label": "Gone"}
+	]}`
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	p := makePlan(obs, spec, now)
+	want := strings.Join([]string{
+		`d073d5000002: label "Lamp" -> "Floor lamp"`,
+		`d073d5000002: group "Spare" -> "Lounge"`,
+		`d073d5000002: color {Hue:0 Saturation:65535 Brightness:65535 Kelvin:3500} -> {Hue:100 Saturation:0 Brightness:65535 Kelvin:2700}`,
+		`d073d5000003: missing`,
+	}, "\n") + "\n"
+	if got := p.String(); got != want {
+		t.Errorf("Plan mismatch.\n got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Group changes should reuse the existing ID, with a fresh timestamp.
+	groups := memberships(obs, func(o observed) lifx.Membership { return o.group }, now)
+	if m := groups.get("Lounge"); m.ID != lounge.ID || !m.UpdatedAt.Equal(now) {
+		t.Errorf("Lounge membership = %+v, want ID %x with UpdatedAt %v", m, lounge.ID, now)
+	}
+	if m := groups.get("New"); m.ID == ([16]byte{}) || m.ID[6]>>4 != 4 {
+		t.Errorf("new membership has bad ID %x", m.ID)
+	}
+}
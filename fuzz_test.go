@@ -0,0 +1,75 @@
+package lifx
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// payloadDecoders are the decoders of payloads received from devices,
+// with the nominal size of each payload.
+var payloadDecoders = []struct {
+	typ    msgType
+	size   int
+	decode func([]byte) error
+}{
+	{pktStateService, 5, func(b []byte) error {
+		_, _, err := decodeService(b, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1)})
+		return err
+	}},
+	{pktStateHostFirmware, 20, func(b []byte) error { _, err := decodeHostFirmware(b); return err }},
+	{pktStateWifiInfo, 14, func(b []byte) error { _, err := decodeWifiInfo(b); return err }},
+	{pktStatePower, 2, func(b []byte) error { _, err := decodeLevel(pktStatePower, b); return err }},
+	{pktStateVersion, 12, func(b []byte) error { _, _, err := decodeVersion(b); return err }},
+	{pktStateInfo, 24, func(b []byte) error { _, err := decodeInfo(b); return err }},
+	{pktStateGroup, 56, func(b []byte) error { _, err := decodeMembership(pktStateGroup, b); return err }},
+	{pktLightState, 52, func(b []byte) error { _, err := decodeLightState(b); return err }},
+	{pktStateHevCycle, 9, func(b []byte) error { _, err := decodeHevCycle(b); return err }},
+	{pktStateHevCycleConfig, 5, func(b []byte) error { _, err := decodeHevCycleConfig(b); return err }},
+	{pktStateMultiZone, 66, func(b []byte) error { _, _, _, err := decodeMultiZone(b); return err }},
+	{pktStateMultiZoneEffect, 59, func(b []byte) error { _, err := decodeMultiZoneEffect(b); return err }},
+	{pktStateExtendedColorZones, 661, func(b []byte) error { _, err := decodeExtendedColorZones(b); return err }},
+	{pktStateDeviceChain, 882, func(b []byte) error { _, err := decodeDeviceChain(b); return err }},
+	{pktState64, 517, func(b []byte) error { _, _, err := decodeState64(b); return err }},
+	{pktStateTileEffect, 187, func(b []byte) error { _, err := decodeTileEffect(b); return err }},
+	{pktStateRPower, 3, func(b []byte) error { _, _, err := decodeRelayPower(b); return err }},
+	{pktStateButton, 811, func(b []byte) error { _, err := decodeButtons(b); return err }},
+	{pktStateButtonConfig, 18, func(b []byte) error { _, err := decodeButtonConfig(b); return err }},
+}
+
+// FuzzDecodePayload checks that payload decoders don't panic,
+// and that they report problems with a *protocol.DecodeError.
+func FuzzDecodePayload(f *testing.F) {
+	for i, pd := range payloadDecoders {
+		f.Add(uint8(i), make([]byte, pd.size))
+		f.Add(uint8(i), []byte{})
+	}
+	// Counts that exceed what the payloads hold.
+	seed := func(typ msgType, fill func(b []byte)) {
+		for i, pd := range payloadDecoders {
+			if pd.typ == typ {
+				b := make([]byte, pd.size)
+				fill(b)
+				f.Add(uint8(i), b)
+			}
+		}
+	}
+	seed(pktStateExtendedColorZones, func(b []byte) { b[0], b[4] = 82, 255 })
+	seed(pktStateDeviceChain, func(b []byte) { b[len(b)-1] = maxChainTiles + 1 })
+	seed(pktStateTileEffect, func(b []byte) { b[58] = maxTilePalette + 1 })
+	seed(pktStateButton, func(b []byte) { b[0], b[2], b[3] = 1, 1, 200 })
+
+	f.Fuzz(func(t *testing.T, i uint8, payload []byte) {
+		pd := payloadDecoders[int(i)%len(payloadDecoders)]
+		err := pd.decode(payload)
+		var de *protocol.DecodeError
+		if err != nil && !errors.As(err, &de) {
+			t.Errorf("decoding %v payload: got %T error %v, want *protocol.DecodeError", pd.typ, err, err)
+		}
+		if de != nil && de.Type != pd.typ {
+			t.Errorf("decoding %v payload: error has type %v", pd.typ, de.Type)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package lifx
+
+import (
+	"math"
+	"sort"
+)
+
+// HueDirection controls which way around the color wheel hue is interpolated.
+type HueDirection int
+
+const (
+	// HueShortest takes the shorter way around the color wheel.
+	HueShortest = HueDirection(0)
+	// HueIncreasing always increases hue, wrapping from red through yellow, green and blue.
+	HueIncreasing = HueDirection(1)
+	// HueDecreasing always decreases hue, the opposite way to HueIncreasing.
+	HueDecreasing = HueDirection(2)
+)
+
+// ColorStop is a color at a position in a gradient.
+type ColorStop struct {
+	Color Color
+
+	// Position is where the stop is in the gradient, in [0,1].
+	Position float64
+
+	// Hue controls how hue is interpolated from the previous stop to this one.
+	Hue HueDirection
+}
+
+// GradientZones spreads the stops across n zones, interpolating each HSBK component
+// linearly between adjacent stops. The first and last zones are at positions 0 and 1.
+// Zones before the first stop or after the last take that stop's color.
+//
+// If every stop's Position is zero, the stops are spread evenly.
+// The result is suitable for SetExtendedColorZones or SetZones.
+func GradientZones(stops []ColorStop, n int) []Color {
+	if n <= 0 || len(stops) == 0 {
+		return nil
+	}
+	stops = append([]ColorStop(nil), stops...)
+	even := true
+	for _, s := range stops {
+		if s.Position != 0 {
+			even = false
+		}
+	}
+	if even && len(stops) > 1 {
+		for i := range stops {
+			stops[i].Position = float64(i) / float64(len(stops)-1)
+		}
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Position < stops[j].Position })
+
+	zones := make([]Color, n)
+	j := 0 // stops[j] is the last stop at or before the current position
+	for i := range zones {
+		var pos float64
+		if n > 1 {
+			pos = float64(i) / float64(n-1)
+		}
+		for j+1 < len(stops) && stops[j+1].Position <= pos {
+			j++
+		}
+		a := stops[j]
+		if pos <= a.Position || j+1 == len(stops) {
+			zones[i] = a.Color
+			continue
+		}
+		b := stops[j+1]
+		t := (pos - a.Position) / (b.Position - a.Position)
+		zones[i] = interpolateHue(a.Color, b.Color, t, b.Hue)
+	}
+	return zones
+}
+
+// interpolateHue is like Interpolate in HSBKSpace, but with control over
+// the direction that hue goes.
+func interpolateHue(a, b Color, t float64, dir HueDirection) Color {
+	var dh float64
+	switch dir {
+	case HueIncreasing:
+		dh = float64(b.Hue - a.Hue)
+	case HueDecreasing:
+		dh = -float64(a.Hue - b.Hue)
+	default:
+		dh = float64(int16(b.Hue - a.Hue)) // signed, so this goes the short way
+	}
+	return Color{
+		Hue:        uint16(int(math.Round(float64(a.Hue)+dh*t)) & 0xFFFF),
+		Saturation: lerp16(a.Saturation, b.Saturation, t),
+		Brightness: lerp16(a.Brightness, b.Brightness, t),
+		Kelvin:     lerp16(a.Kelvin, b.Kelvin, t),
+	}
+}
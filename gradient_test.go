@@ -0,0 +1,31 @@
+package lifx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGradientZones(t *testing.T) {
+	red := Color{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	cyan := Color{Hue: 0x8000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+
+	// Evenly spread stops, with the hue wrapping each way.
+	inc := GradientZones([]ColorStop{{Color: red}, {Color: cyan, Hue: HueIncreasing}}, 3)
+	dec := GradientZones([]ColorStop{{Color: red}, {Color: cyan, Hue: HueDecreasing}}, 3)
+	if got := inc[1].Hue; got != 0x4000 {
+		t.Errorf("increasing midpoint hue = %#x, want 0x4000", got)
+	}
+	if got := dec[1].Hue; got != 0xC000 {
+		t.Errorf("decreasing midpoint hue = %#x, want 0xc000", got)
+	}
+
+	// Positioned stops hold their colors outside the range they cover.
+	got := GradientZones([]ColorStop{
+		{Color: cyan, Position: 0.75},
+		{Color: red, Position: 0.25},
+	}, 5)
+	want := []Color{red, red, Interpolate(red, cyan, 0.5, HSBKSpace), cyan, cyan}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GradientZones with positions = %+v, want %+v", got, want)
+	}
+}
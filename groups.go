@@ -0,0 +1,172 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Topology is the organizational structure of a set of devices,
+// as presented by the LIFX app: devices are in groups, which are in locations.
+type Topology struct {
+	Locations []*LocationNode // sorted by label
+}
+
+// LocationNode is a location and the groups within it.
+type LocationNode struct {
+	Membership
+	Groups []*GroupNode // sorted by label
+}
+
+// GroupNode is a group and the devices within it.
+type GroupNode struct {
+	Membership
+	Devices []*Device
+}
+
+// Groups queries the group and location of each device,
+// and assembles them into a Topology. The devices would normally come from Discover.
+//
+// Devices that fail to respond are omitted from the topology,
+// and their errors are joined in the returned error.
+// Where devices disagree on the label of a group or location,
+// the most recently updated label is used.
+func (c *Client) Groups(ctx context.Context, devs []*Device) (*Topology, error) {
+	type membership struct{ group, location Membership }
+	ms := make([]membership, len(devs))
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if ms[i].group, err = d.GetGroup(ctx); err != nil {
+				errs[i] = fmt.Errorf("device %x: GetGroup: %w", d.Serial, err)
+				return
+			}
+			if ms[i].location, err = d.GetLocation(ctx); err != nil {
+				errs[i] = fmt.Errorf("device %x: GetLocation: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// newest merges m into the latest membership seen for its ID.
+	newest := func(seen map[[16]byte]Membership, m Membership) {
+		if prev, ok := seen[m.ID]; !ok || m.UpdatedAt.After(prev.UpdatedAt) {
+			seen[m.ID] = m
+		}
+	}
+	groupInfo := make(map[[16]byte]Membership)
+	locInfo := make(map[[16]byte]Membership)
+	for i := range devs {
+		if errs[i] == nil {
+			newest(groupInfo, ms[i].group)
+			newest(locInfo, ms[i].location)
+		}
+	}
+
+	top := new(Topology)
+	locs := make(map[[16]byte]*LocationNode)
+	groups := make(map[[2][16]byte]*GroupNode) // keyed by (location, group)
+	for i, d := range devs {
+		if errs[i] != nil {
+			continue
+		}
+		lid, gid := ms[i].location.ID, ms[i].group.ID
+		ln, ok := locs[lid]
+		if !ok {
+			ln = &LocationNode{Membership: locInfo[lid]}
+			locs[lid] = ln
+			top.Locations = append(top.Locations, ln)
+		}
+		gn, ok := groups[[2][16]byte{lid, gid}]
+		if !ok {
+			gn = &GroupNode{Membership: groupInfo[gid]}
+			groups[[2][16]byte{lid, gid}] = gn
+			ln.Groups = append(ln.Groups, gn)
+		}
+		gn.Devices = append(gn.Devices, d)
+	}
+
+	sort.Slice(top.Locations, func(i, j int) bool { return top.Locations[i].Label < top.Locations[j].Label })
+	for _, ln := range top.Locations {
+		sort.Slice(ln.Groups, func(i, j int) bool { return ln.Groups[i].Label < ln.Groups[j].Label })
+	}
+	return top, errors.Join(errs...)
+}
+
+// RenameGroup changes the label of the group with the given ID on every
+// member among devs. Non-members are left alone.
+//
+// All members are given an identical Membership, timestamped later than
+// any existing one, so the new label wins everywhere it is seen.
+// If some members fail to update, the rename can safely be retried.
+func RenameGroup(ctx context.Context, devs []*Device, id [16]byte, label string) error {
+	return rename(ctx, devs, id, label, pktGetGroup, pktSetGroup)
+}
+
+// RenameLocation is like RenameGroup, but for locations.
+func RenameLocation(ctx context.Context, devs []*Device, id [16]byte, label string) error {
+	return rename(ctx, devs, id, label, pktGetLocation, pktSetLocation)
+}
+
+func rename(ctx context.Context, devs []*Device, id [16]byte, label string, get, set msgType) error {
+	if err := ValidateLabel(label); err != nil {
+		return err
+	}
+
+	// Find the members, and the newest timestamp among them.
+	current := make([]Membership, len(devs))
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if current[i], err = d.getMembership(ctx, get); err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		// Without knowing every device's membership we can't be sure
+		// of picking a timestamp newer than all of them.
+		return err
+	}
+
+	m := Membership{ID: id, Label: label, UpdatedAt: time.Now()}
+	var members []*Device
+	for i, cur := range current {
+		if cur.ID != id {
+			continue
+		}
+		members = append(members, devs[i])
+		if !cur.UpdatedAt.Before(m.UpdatedAt) {
+			// Clock skew; make sure we're still the newest.
+			m.UpdatedAt = cur.UpdatedAt.Add(time.Millisecond)
+		}
+	}
+
+	errs = errs[:len(members)]
+	for i, d := range members {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.setMembership(ctx, set, m); err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,260 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// HevCycle is the state of the HEV (germicidal) cycle on a LIFX Clean.
+type HevCycle struct {
+	Duration  time.Duration // total duration of the current cycle
+	Remaining time.Duration // zero if no cycle is running
+	LastPower bool          // whether the light was on before the cycle started
+}
+
+// Running reports whether a cycle is in progress.
+func (hc HevCycle) Running() bool { return hc.Remaining > 0 }
+
+// GetHevCycle returns the state of the HEV cycle.
+func (d *Device) GetHevCycle(ctx context.Context) (HevCycle, error) {
+	if err := d.requireFeature("hev", hasHEV); err != nil {
+		return HevCycle{}, err
+	}
+	payload, err := d.query(ctx, pktGetHevCycle, pktStateHevCycle, nil)
+	if err != nil {
+		return HevCycle{}, err
+	}
+	return decodeHevCycle(payload)
+}
+
+func decodeHevCycle(payload []byte) (HevCycle, error) {
+	if err := checkLength(pktStateHevCycle, payload, 9); err != nil {
+		return HevCycle{}, err
+	}
+	return HevCycle{
+		Duration:  time.Duration(binary.LittleEndian.Uint32(payload[0:4])) * time.Second,
+		Remaining: time.Duration(binary.LittleEndian.Uint32(payload[4:8])) * time.Second,
+		LastPower: payload[8] != 0,
+	}, nil
+}
+
+// SetHevCycle starts or stops an HEV cycle.
+// A zero duration uses the device's configured default duration.
+func (d *Device) SetHevCycle(ctx context.Context, enable bool, duration time.Duration) error {
+	if err := d.requireFeature("hev", hasHEV); err != nil {
+		return err
+	}
+	secs := duration / time.Second
+	if secs < 0 || secs > math.MaxUint32 {
+		return fmt.Errorf("duration %v out of range", duration)
+	}
+	payload := []byte{boolInt(enable)}
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(secs))
+	return d.set(ctx, pktSetHevCycle, payload)
+}
+
+// HevCycleConfig is the default configuration for HEV cycles on a LIFX Clean.
+type HevCycleConfig struct {
+	// Indication is whether the light briefly flashes green
+	// at the end of a cycle.
+	Indication bool
+	// Duration is the default cycle duration, used by SetHevCycle
+	// when no duration is given.
+	Duration time.Duration
+}
+
+// GetHevCycleConfig returns the default HEV cycle configuration.
+func (d *Device) GetHevCycleConfig(ctx context.Context) (HevCycleConfig, error) {
+	if err := d.requireFeature("hev", hasHEV); err != nil {
+		return HevCycleConfig{}, err
+	}
+	payload, err := d.query(ctx, pktGetHevCycleConfig, pktStateHevCycleConfig, nil)
+	if err != nil {
+		return HevCycleConfig{}, err
+	}
+	return decodeHevCycleConfig(payload)
+}
+
+func decodeHevCycleConfig(payload []byte) (HevCycleConfig, error) {
+	if err := checkLength(pktStateHevCycleConfig, payload, 5); err != nil {
+		return HevCycleConfig{}, err
+	}
+	return HevCycleConfig{
+		Indication: payload[0] != 0,
+		Duration:   time.Duration(binary.LittleEndian.Uint32(payload[1:5])) * time.Second,
+	}, nil
+}
+
+// SetHevCycleConfig sets the default HEV cycle configuration.
+// The duration is rounded down to whole seconds.
+func (d *Device) SetHevCycleConfig(ctx context.Context, cfg HevCycleConfig) error {
+	if err := d.requireFeature("hev", hasHEV); err != nil {
+		return err
+	}
+	secs := cfg.Duration / time.Second
+	if secs < 0 || secs > math.MaxUint32 {
+		return fmt.Errorf("duration %v out of range", cfg.Duration)
+	}
+	payload := []byte{boolInt(cfg.Indication)}
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(secs))
+	return d.set(ctx, pktSetHevCycleConfig, payload)
+}
+
+// HevCycleResult is the outcome of the most recent HEV cycle.
+type HevCycleResult uint8
+
+const (
+	HevResultSuccess              = HevCycleResult(0)
+	HevResultBusy                 = HevCycleResult(1)
+	HevResultInterruptedByReset   = HevCycleResult(2)
+	HevResultInterruptedByHomeKit = HevCycleResult(3)
+	HevResultInterruptedByLAN     = HevCycleResult(4)
+	HevResultInterruptedByCloud   = HevCycleResult(5)
+	HevResultNone                 = HevCycleResult(255)
+)
+
+func (r HevCycleResult) String() string {
+	switch r {
+	case HevResultSuccess:
+		return "success"
+	case HevResultBusy:
+		return "busy"
+	case HevResultInterruptedByReset:
+		return "interrupted by reset"
+	case HevResultInterruptedByHomeKit:
+		return "interrupted by HomeKit"
+	case HevResultInterruptedByLAN:
+		return "interrupted by LAN"
+	case HevResultInterruptedByCloud:
+		return "interrupted by cloud"
+	case HevResultNone:
+		return "none"
+	}
+	return fmt.Sprintf("HevCycleResult(%d)", r)
+}
+
+// GetLastHevCycleResult returns the outcome of the most recent HEV cycle.
+func (d *Device) GetLastHevCycleResult(ctx context.Context) (HevCycleResult, error) {
+	if err := d.requireFeature("hev", hasHEV); err != nil {
+		return 0, err
+	}
+	payload, err := d.query(ctx, pktGetLastHevCycleResult, pktStateLastHevCycleResult, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkLength(pktStateLastHevCycleResult, payload, 1); err != nil {
+		return 0, err
+	}
+	return HevCycleResult(payload[0]), nil
+}
+
+// CleanOptions configures CleanCycles.
+type CleanOptions struct {
+	// Duration of each cycle. Zero uses each device's configured default.
+	Duration time.Duration
+	// Stagger is the delay between starting successive devices,
+	// to spread out the load on the network and power supply.
+	Stagger time.Duration
+	// PollInterval is how often to check progress. Zero means every minute.
+	PollInterval time.Duration
+	// Progress, if set, is called after each progress check.
+	// It may be called concurrently.
+	Progress func(d *Device, hc HevCycle)
+}
+
+// CleanResult is the outcome of an HEV cycle on one device.
+type CleanResult struct {
+	Device *Device
+	Result HevCycleResult // only valid if Err is nil
+	Err    error
+}
+
+// CleanSummary summarises the outcome of CleanCycles.
+type CleanSummary struct {
+	Results []CleanResult // in the same order as the devices passed to CleanCycles
+
+	Succeeded, Failed int
+}
+
+// CleanCycles runs HEV cycles on a set of LIFX Clean devices, starting them
+// Stagger apart, waits for them all to finish, and reports how each went.
+// If the context is done, the remaining cycles are left running.
+func CleanCycles(ctx context.Context, devs []*Device, opts CleanOptions) CleanSummary {
+	poll := opts.PollInterval
+	if poll <= 0 {
+		poll = time.Minute
+	}
+
+	results := make([]CleanResult, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := cleanOne(ctx, d, time.Duration(i)*opts.Stagger, poll, opts)
+			results[i] = CleanResult{Device: d, Result: res, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	sum := CleanSummary{Results: results}
+	for _, r := range results {
+		if r.Err == nil && r.Result == HevResultSuccess {
+			sum.Succeeded++
+		} else {
+			sum.Failed++
+		}
+	}
+	return sum
+}
+
+func cleanOne(ctx context.Context, d *Device, delay, poll time.Duration, opts CleanOptions) (HevCycleResult, error) {
+	if err := sleepCtx(ctx, delay); err != nil {
+		return 0, err
+	}
+	if err := d.SetHevCycle(ctx, true, opts.Duration); err != nil {
+		return 0, fmt.Errorf("SetHevCycle: %w", err)
+	}
+	for {
+		if err := sleepCtx(ctx, poll); err != nil {
+			return 0, err
+		}
+		hc, err := d.GetHevCycle(ctx)
+		if cerr := ctx.Err(); cerr != nil {
+			return 0, cerr
+		}
+		if err != nil {
+			// Keep trying; the cycle is still running on the device.
+			d.tracef(ctx, "LIFX GetHevCycle on %x: %v", d.Serial, err)
+			continue
+		}
+		if opts.Progress != nil {
+			opts.Progress(d, hc)
+		}
+		if !hc.Running() {
+			break
+		}
+	}
+	res, err := d.GetLastHevCycleResult(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("GetLastHevCycleResult: %w", err)
+	}
+	return res, nil
+}
+
+// sleepCtx waits for the duration, or until the context is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package lifx
+
+import (
+	"context"
+	"net"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// A RequestHook observes each request the client makes to a device,
+// for instrumentation such as tracing. The lifxotel package provides one
+// that records requests as OpenTelemetry spans.
+//
+// Hooks may be called concurrently.
+type RequestHook interface {
+	// StartRequest is called before a request is first sent.
+	// The returned context is used for the rest of the request,
+	// and the returned RequestTrace is told how it progresses.
+	StartRequest(ctx context.Context, req RequestInfo) (context.Context, RequestTrace)
+}
+
+// RequestInfo describes a request, for a RequestHook.
+type RequestInfo struct {
+	Serial       [6]byte
+	Addr         net.UDPAddr
+	Type         protocol.Type // the request message type
+	ResponseType protocol.Type // the expected response type
+	Size         int           // of the request payload
+}
+
+// A RequestTrace follows one request that was passed to a RequestHook.
+type RequestTrace interface {
+	// AttemptFailed is called after each failed attempt,
+	// numbered from 1. The request may then be retried.
+	AttemptFailed(attempt int, err error)
+	// End is called once the request is finished, with the number of attempts made,
+	// and either the size of the response payload or the request's error.
+	End(attempts, respSize int, err error)
+}
+
+// WithRequestHook sets a hook that observes every request the client makes to a device.
+func WithRequestHook(h RequestHook) Option {
+	return func(c *Client) { c.requestHook = h }
+}
+
+// noopTrace is the RequestTrace of clients without a RequestHook.
+type noopTrace struct{}
+
+func (noopTrace) AttemptFailed(int, error) {}
+func (noopTrace) End(int, int, error)      {}
+
+// startRequest tells the client's RequestHook, if any, of a request to the device.
+func (d *Device) startRequest(ctx context.Context, reqType, respType msgType, reqBody []byte) (context.Context, RequestTrace) {
+	h := d.client.requestHook
+	if h == nil {
+		return ctx, noopTrace{}
+	}
+	return h.StartRequest(ctx, RequestInfo{
+		Serial:       d.Serial,
+		Addr:         d.Addr,
+		Type:         reqType,
+		ResponseType: respType,
+		Size:         len(reqBody),
+	})
+}
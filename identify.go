@@ -0,0 +1,75 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// identifyPeriod is the period of each pulse used by Identify.
+const identifyPeriod = 600 * time.Millisecond
+
+// Identify makes the device visibly pulse for approximately the given duration,
+// then restores its prior state. This is useful for asking a person to confirm
+// which physical light a Device refers to.
+//
+// The light is turned on for the duration if it was off.
+// If the context is cancelled before the pulsing ends, the state is still restored.
+func (d *Device) Identify(ctx context.Context, duration time.Duration) error {
+	state, err := d.CaptureState(ctx)
+	if err != nil {
+		return fmt.Errorf("CaptureState: %w", err)
+	}
+
+	cycles := float32(duration / identifyPeriod)
+	if cycles < 1 {
+		cycles = 1
+	}
+
+	err = d.identify(ctx, state, cycles)
+
+	// Restore even if the pulsing failed or ctx was cancelled,
+	// in which case ctx is not usable.
+	rctx, cancel := context.WithTimeout(context.Background(), maxTimeout)
+	defer cancel()
+	if rerr := d.RestoreState(rctx, state); rerr != nil && err == nil {
+		err = fmt.Errorf("RestoreState: %w", rerr)
+	}
+	return err
+}
+
+func (d *Device) identify(ctx context.Context, state State, cycles float32) error {
+	if state.power == 0 {
+		if err := d.SetLightPower(ctx, 0xFFFF, 0); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
+	err := d.SetWaveform(ctx, WaveformConfig{
+		Waveform:  PulseWaveform,
+		Transient: true,
+
+		// A bright, saturated magenta is rarely used for normal lighting,
+		// so it stands out.
+		Color: Color{
+			Hue:        0xD555,
+			Saturation: 0xFFFF,
+			Brightness: 0xFFFF,
+			Kelvin:     3500,
+		},
+
+		Period: identifyPeriod,
+		Cycles: cycles,
+	})
+	if err != nil {
+		return fmt.Errorf("SetWaveform: %w", err)
+	}
+
+	t := time.NewTimer(time.Duration(cycles * float32(identifyPeriod)))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -2,7 +2,9 @@ package lifx
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -13,10 +15,7 @@ func (d *Device) GetLightPower(ctx context.Context) (uint16, error) {
 	if err != nil {
 		return 0, err
 	}
-	if len(payload) != 2 {
-		return 0, fmt.Errorf("StateLightPower malformed: length=%d", len(payload))
-	}
-	return binary.LittleEndian.Uint16(payload), nil
+	return decodeLevel(pktStateLightPower, payload)
 }
 
 func (d *Device) SetLightPower(ctx context.Context, level uint16, duration time.Duration) error {
@@ -27,37 +26,103 @@ func (d *Device) SetLightPower(ctx context.Context, level uint16, duration time.
 
 	var payload []byte
 	payload = binary.LittleEndian.AppendUint16(payload, level)
-	binary.LittleEndian.AppendUint32(payload, dur)
+	payload = binary.LittleEndian.AppendUint32(payload, dur)
 
 	return d.set(ctx, pktSetLightPower, payload)
 }
 
+// SetLightPowerVerified is like SetLightPower, but also requests the device's
+// state in response, and returns the power level it reports.
+// See SetColorVerified.
+func (d *Device) SetLightPowerVerified(ctx context.Context, level uint16, duration time.Duration) (uint16, error) {
+	dur, err := uint32Millis(duration)
+	if err != nil {
+		return 0, err
+	}
+
+	var payload []byte
+	payload = binary.LittleEndian.AppendUint16(payload, level)
+	payload = binary.LittleEndian.AppendUint32(payload, dur)
+
+	payload, err = d.setVerified(ctx, pktSetLightPower, pktStateLightPower, payload)
+	if err != nil {
+		return 0, err
+	}
+	return decodeLevel(pktStateLightPower, payload)
+}
+
+// On turns the light on, fading in over the given duration.
+func (d *Device) On(ctx context.Context, fade time.Duration) error {
+	return d.SetLightPower(ctx, 0xFFFF, fade)
+}
+
+// Off turns the light off, fading out over the given duration.
+func (d *Device) Off(ctx context.Context, fade time.Duration) error {
+	return d.SetLightPower(ctx, 0, fade)
+}
+
+// Toggle turns the light off if it is on, and on otherwise,
+// fading over the given duration.
+func (d *Device) Toggle(ctx context.Context, fade time.Duration) error {
+	level, err := d.GetLightPower(ctx)
+	if err != nil {
+		return fmt.Errorf("GetLightPower: %w", err)
+	}
+	if level != 0 {
+		return d.Off(ctx, fade)
+	}
+	return d.On(ctx, fade)
+}
+
 func (d *Device) GetPower(ctx context.Context) (uint16, error) {
 	payload, err := d.query(ctx, pktGetPower, pktStatePower, nil)
 	if err != nil {
 		return 0, err
 	}
-	if len(payload) != 2 {
-		return 0, fmt.Errorf("StatePower malformed: length=%d", len(payload))
+	return decodeLevel(pktStatePower, payload)
+}
+
+// decodeLevel decodes a payload that is just a uint16 level, such as StatePower.
+func decodeLevel(typ msgType, payload []byte) (uint16, error) {
+	if err := checkLength(typ, payload, 2); err != nil {
+		return 0, err
 	}
 	return binary.LittleEndian.Uint16(payload), nil
 }
 
+// SetPower sets the device's power level immediately.
+// Only 0 (off) and 65535 (on) are valid levels.
+// Unlike SetLightPower, this works for non-light devices too.
+func (d *Device) SetPower(ctx context.Context, level uint16) error {
+	if level != 0 && level != 0xFFFF {
+		return fmt.Errorf("bad power level %d; must be 0 or 65535", level)
+	}
+	return d.set(ctx, pktSetPower, binary.LittleEndian.AppendUint16(nil, level))
+}
+
+// Reboot restarts the device. It will be unreachable for a few seconds;
+// use WaitForOnline to wait for it to return.
+func (d *Device) Reboot(ctx context.Context) error {
+	return d.set(ctx, pktSetReboot, nil)
+}
+
 func (d *Device) GetLabel(ctx context.Context) (string, error) {
 	payload, err := d.query(ctx, pktGetLabel, pktStateLabel, nil)
 	if err != nil {
 		return "", err
 	}
+	return trimLabel(payload), nil
+}
 
-	// Ignore trailing NULs in payload.
-	for i := len(payload) - 1; i >= 0; i-- {
-		if payload[i] != 0x00 {
-			break
-		}
-		payload = payload[:i]
+// SetLabel sets the device's label.
+// The label must satisfy ValidateLabel; use TruncateLabel to shorten
+// longer labels without splitting UTF-8 sequences.
+func (d *Device) SetLabel(ctx context.Context, label string) error {
+	payload, err := encodeLabel(label)
+	if err != nil {
+		return err
 	}
-
-	return string(payload), nil
+	return d.set(ctx, pktSetLabel, payload)
 }
 
 func (d *Device) GetVersion(ctx context.Context) (vendor, product uint32, err error) {
@@ -65,26 +130,189 @@ func (d *Device) GetVersion(ctx context.Context) (vendor, product uint32, err er
 	if err != nil {
 		return 0, 0, err
 	}
-	if len(payload) != 12 {
-		return 0, 0, fmt.Errorf("StateVersion malformed: length=%d", len(payload))
+	return decodeVersion(payload)
+}
+
+func decodeVersion(payload []byte) (vendor, product uint32, err error) {
+	if err := checkLength(pktStateVersion, payload, 12); err != nil {
+		return 0, 0, err
 	}
 	vendor = binary.LittleEndian.Uint32(payload[0:4])
 	product = binary.LittleEndian.Uint32(payload[4:8])
 	return
 }
 
+// Info is runtime information about a device.
+type Info struct {
+	Time     time.Time     // the device's clock
+	Uptime   time.Duration // since the device last booted
+	Downtime time.Duration // approximately how long the device was off before it last booted
+}
+
+func (d *Device) GetInfo(ctx context.Context) (Info, error) {
+	payload, err := d.query(ctx, pktGetInfo, pktStateInfo, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	return decodeInfo(payload)
+}
+
+func decodeInfo(payload []byte) (Info, error) {
+	if err := checkLength(pktStateInfo, payload, 24); err != nil {
+		return Info{}, err
+	}
+	return Info{
+		Time:     time.Unix(0, int64(binary.LittleEndian.Uint64(payload[0:8]))),
+		Uptime:   time.Duration(binary.LittleEndian.Uint64(payload[8:16])),
+		Downtime: time.Duration(binary.LittleEndian.Uint64(payload[16:24])),
+	}, nil
+}
+
+// Membership describes a device's group or location.
+// All devices in the same group (or location) share the same ID.
+type Membership struct {
+	ID        [16]byte  `json:"id"`
+	Label     string    `json:"label"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewMembershipID generates a random (version 4) UUID suitable as a group or location ID.
+// To create a new group or location, pass it to SetGroup or SetLocation
+// with the same label and time for each device that should belong to it.
+func NewMembershipID() (id [16]byte) {
+	if _, err := rand.Read(id[:]); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	id[6] = id[6]&0x0F | 0x40
+	id[8] = id[8]&0x3F | 0x80
+	return
+}
+
+// decodeMembership decodes the payload of a message of the given type,
+// which is one of StateGroup, StateLocation, SetGroup or SetLocation.
+func decodeMembership(typ msgType, payload []byte) (Membership, error) {
+	if err := checkLength(typ, payload, 16+32+8); err != nil {
+		return Membership{}, err
+	}
+	var m Membership
+	copy(m.ID[:], payload[0:16])
+	m.Label = trimLabel(payload[16:48])
+	if ts := binary.LittleEndian.Uint64(payload[48:56]); ts != 0 {
+		m.UpdatedAt = time.Unix(0, int64(ts))
+	}
+	return m, nil
+}
+
+func (m Membership) encode() ([]byte, error) {
+	if err := ValidateLabel(m.Label); err != nil {
+		return nil, err
+	}
+	return m.encodeUnchecked(), nil
+}
+
+// encodeUnchecked is like encode, but doesn't validate the label.
+// It is for echoing labels that came from messages.
+func (m Membership) encodeUnchecked() []byte {
+	payload := make([]byte, 0, 16+labelLength+8)
+	payload = append(payload, m.ID[:]...)
+	payload = append(payload, padLabel(m.Label)...)
+	var ts uint64
+	if !m.UpdatedAt.IsZero() {
+		ts = uint64(m.UpdatedAt.UnixNano())
+	}
+	payload = binary.LittleEndian.AppendUint64(payload, ts)
+	return payload
+}
+
+// getMembership queries the device's group, if get is pktGetGroup,
+// or its location, if get is pktGetLocation.
+func (d *Device) getMembership(ctx context.Context, get msgType) (Membership, error) {
+	state := pktStateGroup
+	if get == pktGetLocation {
+		state = pktStateLocation
+	}
+	payload, err := d.query(ctx, get, state, nil)
+	if err != nil {
+		return Membership{}, err
+	}
+	return decodeMembership(state, payload)
+}
+
+// GetGroup returns the group that the device belongs to.
+func (d *Device) GetGroup(ctx context.Context) (Membership, error) {
+	return d.getMembership(ctx, pktGetGroup)
+}
+
+// SetGroup sets the group that the device belongs to.
+//
+// Clients reconcile conflicting group information by taking the one with
+// the newest updatedAt, so every device in a group should be given identical
+// arguments, and changes should use a newer updatedAt than before.
+// If updatedAt is zero, the current time is used.
+// To rename a group, use RenameGroup.
+func (d *Device) SetGroup(ctx context.Context, id [16]byte, label string, updatedAt time.Time) error {
+	return d.setMembership(ctx, pktSetGroup, Membership{ID: id, Label: label, UpdatedAt: updatedAt})
+}
+
+// GetLocation returns the location that the device belongs to.
+func (d *Device) GetLocation(ctx context.Context) (Membership, error) {
+	return d.getMembership(ctx, pktGetLocation)
+}
+
+// SetLocation sets the location that the device belongs to.
+// The same considerations apply as for SetGroup.
+// To rename a location, use RenameLocation.
+func (d *Device) SetLocation(ctx context.Context, id [16]byte, label string, updatedAt time.Time) error {
+	return d.setMembership(ctx, pktSetLocation, Membership{ID: id, Label: label, UpdatedAt: updatedAt})
+}
+
+// setMembership sets the device's group or location,
+// depending on whether typ is pktSetGroup or pktSetLocation.
+//
+// Clients reconcile conflicting group or location information by taking
+// the one with the newest UpdatedAt, so every member should be given an identical
+// Membership, and changes should use a newer UpdatedAt than before.
+// If m.UpdatedAt is zero, the current time is used.
+func (d *Device) setMembership(ctx context.Context, typ msgType, m Membership) error {
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = time.Now()
+	}
+	payload, err := m.encode()
+	if err != nil {
+		return err
+	}
+	return d.set(ctx, typ, payload)
+}
+
 type HostFirmware struct {
 	Build        time.Time
 	Major, Minor uint16
 }
 
+// Before reports whether hf is an older version than o.
+// Only the version numbers are compared, not the build time.
+func (hf HostFirmware) Before(o HostFirmware) bool {
+	if hf.Major != o.Major {
+		return hf.Major < o.Major
+	}
+	return hf.Minor < o.Minor
+}
+
+func (hf HostFirmware) String() string {
+	return fmt.Sprintf("%d.%d", hf.Major, hf.Minor)
+}
+
 func (d *Device) GetHostFirmware(ctx context.Context) (HostFirmware, error) {
 	payload, err := d.query(ctx, pktGetHostFirmware, pktStateHostFirmware, nil)
 	if err != nil {
 		return HostFirmware{}, err
 	}
-	if len(payload) != 20 {
-		return HostFirmware{}, fmt.Errorf("StateHostFirmware malformed: length=%d", len(payload))
+	return decodeHostFirmware(payload)
+}
+
+func decodeHostFirmware(payload []byte) (HostFirmware, error) {
+	if err := checkLength(pktStateHostFirmware, payload, 20); err != nil {
+		return HostFirmware{}, err
 	}
 	var hf HostFirmware
 	hf.Build = time.Unix(0, int64(binary.LittleEndian.Uint64(payload[0:8]))) // empirically seems to be unix nanos
@@ -93,47 +321,269 @@ func (d *Device) GetHostFirmware(ctx context.Context) (HostFirmware, error) {
 	return hf, nil
 }
 
+// State is a snapshot of a device's configuration, as captured by CaptureState.
 type State struct {
 	power uint16
+	color Color
+	label string
+
+	infrared *uint16 // nil if the device has no infrared channel
 
 	zones []Color // nil if not a multi-zone device
 
-	// TODO: will need to capture effects too.
+	// effect is the multizone effect, if any.
+	// It is nil for non-multizone devices, and those that don't support effects.
+	effect *MultiZoneEffectConfig
+
+	// tileEffect is the matrix effect, if any.
+	// It is nil for non-matrix devices.
+	tileEffect *TileEffectConfig
+}
+
+// Power returns the light power level.
+func (s State) Power() uint16 { return s.power }
+
+// Color returns the color of the light.
+// For multi-zone devices, this is the color of one zone; see Zones.
+func (s State) Color() Color { return s.color }
+
+// Label returns the device's label.
+func (s State) Label() string { return s.label }
+
+// Infrared returns the infrared brightness, and whether the device has infrared.
+func (s State) Infrared() (uint16, bool) {
+	if s.infrared == nil {
+		return 0, false
+	}
+	return *s.infrared, true
+}
+
+// MultiZoneEffect returns the multizone effect that was running when the state
+// was captured, and whether one was.
+func (s State) MultiZoneEffect() (MultiZoneEffectConfig, bool) {
+	if s.effect == nil || s.effect.Type == MultiZoneEffectOff {
+		return MultiZoneEffectConfig{}, false
+	}
+	return *s.effect, true
+}
+
+// TileEffect returns the matrix effect that was running when the state
+// was captured, and whether one was.
+func (s State) TileEffect() (TileEffectConfig, bool) {
+	if s.tileEffect == nil || s.tileEffect.Type == TileEffectOff {
+		return TileEffectConfig{}, false
+	}
+	return *s.tileEffect, true
 }
 
 func (s State) NumZones() int { return len(s.zones) }
 
+// Zones returns the colors of the zones of a multi-zone device.
+func (s State) Zones() []Color { return append([]Color(nil), s.zones...) }
+
+// stateVersion is the version of the JSON encoding of State.
+// It should be incremented for any incompatible change.
+const stateVersion = 1
+
+// stateJSON is the JSON encoding of State.
+type stateJSON struct {
+	Version int    `json:"version"`
+	Power   uint16 `json:"power"`
+	Color   Color  `json:"color"`
+	Label   string `json:"label"`
+
+	Infrared        *uint16                `json:"infrared,omitempty"`
+	Zones           []Color                `json:"zones,omitempty"`
+	MultiZoneEffect *MultiZoneEffectConfig `json:"multizone_effect,omitempty"`
+	TileEffect      *TileEffectConfig      `json:"tile_effect,omitempty"`
+}
+
+// MarshalJSON encodes the state as JSON, so it may be stored and restored later,
+// even by a different process.
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stateJSON{
+		Version: stateVersion,
+		Power:   s.power,
+		Color:   s.color,
+		Label:   s.label,
+
+		Infrared:        s.infrared,
+		Zones:           s.zones,
+		MultiZoneEffect: s.effect,
+		TileEffect:      s.tileEffect,
+	})
+}
+
+// UnmarshalJSON decodes a state encoded by MarshalJSON.
+// It fails for states encoded by a newer, incompatible version of this package.
+func (s *State) UnmarshalJSON(b []byte) error {
+	var sj stateJSON
+	if err := json.Unmarshal(b, &sj); err != nil {
+		return err
+	}
+	if sj.Version != stateVersion {
+		return fmt.Errorf("unsupported State version %d (want %d)", sj.Version, stateVersion)
+	}
+	*s = State{
+		power: sj.Power,
+		color: sj.Color,
+		label: sj.Label,
+
+		infrared:   sj.Infrared,
+		zones:      sj.Zones,
+		effect:     sj.MultiZoneEffect,
+		tileEffect: sj.TileEffect,
+	}
+	return nil
+}
+
 // CaptureState queries the device and returns its current configuration.
+// Optional capabilities (zones, infrared and effects) are captured if the device has them.
 func (d *Device) CaptureState(ctx context.Context) (state State, err error) {
-	state.power, err = d.GetLightPower(ctx)
-	if err != nil {
-		err = fmt.Errorf("GetLightPower: %w", err)
-		return
-	}
-	state.zones, err = d.GetExtendedColorZones(ctx)
-	var ue unhandledError
-	if err == nil {
-		// OK
-	} else if errors.As(err, &ue) {
-		// This is okay; the device doesn't have this capability.
-		state.zones, err = nil, nil
+	payload, err := d.query(ctx, pktGetColor, pktLightState, nil)
+	if err != nil {
+		return State{}, fmt.Errorf("GetColor: %w", err)
+	}
+	ls, err := decodeLightState(payload)
+	if err != nil {
+		return State{}, err
+	}
+	state.power, state.color, state.label = ls.power, ls.color, ls.label
+
+	// optional runs a query for an optional capability,
+	// treating ErrUnhandled as the device lacking it.
+	optional := func(name string, f func() error) bool {
+		if err != nil {
+			return false
+		}
+		ferr := f()
+		if ferr == nil {
+			return true
+		}
+		if !errors.Is(ferr, ErrUnhandled) {
+			err = fmt.Errorf("%s: %w", name, ferr)
+		}
+		return false
+	}
+
+	optional("GetInfrared", func() error {
+		ir, err := d.GetInfrared(ctx)
+		if err == nil {
+			state.infrared = &ir
+		}
+		return err
+	})
+	optional("GetZones", func() error {
+		zones, err := d.GetZones(ctx)
+		if len(zones) > 0 {
+			state.zones = zones
+		}
+		return err
+	})
+	if state.zones != nil {
+		optional("GetMultiZoneEffect", func() error {
+			effect, err := d.GetMultiZoneEffect(ctx)
+			if err == nil {
+				state.effect = &effect
+			}
+			return err
+		})
 	} else {
-		err = fmt.Errorf("GetExtendedColorZones: %w", err)
-		return
+		optional("GetTileEffect", func() error {
+			effect, err := d.GetTileEffect(ctx)
+			if err == nil {
+				state.tileEffect = &effect
+			}
+			return err
+		})
 	}
-	return
+	if err != nil {
+		return State{}, err
+	}
+	return state, nil
 }
 
 // RestoreState restores a device to its configuration at the time CaptureState was invoked.
+// Changes are made immediately; use RestoreStateDuration to fade instead.
 func (d *Device) RestoreState(ctx context.Context, state State) error {
+	return d.RestoreStateDuration(ctx, state, 0)
+}
+
+// RestoreStateDuration is like RestoreState, but fades the light's color and power
+// over the given duration. The changes are ordered so that a light being turned on
+// fades up in its restored color, and one being turned off fades down without
+// a visible change of color beforehand. An empty or invalid label in state
+// leaves the device's label unchanged.
+func (d *Device) RestoreStateDuration(ctx context.Context, state State, duration time.Duration) error {
+	// Stop any effects so they don't overwrite the colors.
+	if state.effect != nil {
+		if err := d.SetMultiZoneEffect(ctx, MultiZoneEffectConfig{Type: MultiZoneEffectOff}); err != nil {
+			return fmt.Errorf("SetMultiZoneEffect: %w", err)
+		}
+	}
+	if state.tileEffect != nil {
+		if err := d.SetTileEffect(ctx, TileEffectConfig{Type: TileEffectOff}); err != nil {
+			return fmt.Errorf("SetTileEffect: %w", err)
+		}
+	}
+
+	// If the light is currently off, set the color first and instantly,
+	// since it won't be seen. Otherwise fade the color alongside the power.
+	colorDur, powerFirst := duration, false
+	if duration > 0 {
+		power, err := d.GetLightPower(ctx)
+		if err != nil {
+			return fmt.Errorf("GetLightPower: %w", err)
+		}
+		if power == 0 {
+			colorDur = 0
+		} else if state.power == 0 {
+			// Start fading out before the color changes,
+			// so the two transitions run together.
+			powerFirst = true
+		}
+	}
+	if powerFirst {
+		if err := d.SetLightPower(ctx, state.power, duration); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
 	if state.zones != nil {
-		err := d.SetExtendedColorZones(ctx, 0, state.zones)
+		err := d.SetZones(ctx, colorDur, state.zones)
 		if err != nil {
-			return fmt.Errorf("SetExtendedColorZones: %w", err)
+			return fmt.Errorf("SetZones: %w", err)
+		}
+	} else if err := d.SetColor(ctx, state.color, colorDur); err != nil {
+		return fmt.Errorf("SetColor: %w", err)
+	}
+	if ir, ok := state.Infrared(); ok {
+		if err := d.SetInfrared(ctx, ir); err != nil {
+			return fmt.Errorf("SetInfrared: %w", err)
+		}
+	}
+	// Only set the label if it changed, to spare the device's flash.
+	// A missing or unusable label, or one that can't be compared, is left alone.
+	if state.label != "" && ValidateLabel(state.label) == nil {
+		if label, err := d.GetLabel(ctx); err == nil && label != state.label {
+			if err := d.SetLabel(ctx, state.label); err != nil {
+				return fmt.Errorf("SetLabel: %w", err)
+			}
 		}
 	}
-	if err := d.SetLightPower(ctx, state.power, 0); err != nil {
-		return fmt.Errorf("SetLightPower: %w", err)
+	if effect, ok := state.MultiZoneEffect(); ok {
+		if err := d.SetMultiZoneEffect(ctx, effect); err != nil {
+			return fmt.Errorf("SetMultiZoneEffect: %w", err)
+		}
+	}
+	if effect, ok := state.TileEffect(); ok {
+		if err := d.SetTileEffect(ctx, effect); err != nil {
+			return fmt.Errorf("SetTileEffect: %w", err)
+		}
+	}
+	if !powerFirst {
+		if err := d.SetLightPower(ctx, state.power, duration); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
 	}
 	return nil
 }
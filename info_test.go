@@ -0,0 +1,101 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestOnOffToggle(t *testing.T) {
+	light := &lifxtest.Light{}
+	_, dev, ctx := newTestDevice(t, light)
+
+	for _, step := range []struct {
+		name string
+		f    func(context.Context, time.Duration) error
+		want uint16
+	}{
+		{"On", dev.On, 0xFFFF},
+		{"Toggle", dev.Toggle, 0},
+		{"Toggle", dev.Toggle, 0xFFFF},
+		{"Off", dev.Off, 0},
+	} {
+		if err := step.f(ctx, time.Second); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := light.Power(); got != step.want {
+			t.Errorf("After %s, light has power %d, want %d", step.name, got, step.want)
+		}
+	}
+
+	// Any non-zero level counts as on.
+	light.SetPower(1, 0)
+	if err := dev.Toggle(ctx, 0); err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	if got := light.Power(); got != 0 {
+		t.Errorf("Toggle of dimly powered light left power %d, want 0", got)
+	}
+}
+
+func TestCaptureRestoreState(t *testing.T) {
+	orig := lifx.Color{Hue: 0x1234, Saturation: 0xFFFF, Brightness: 0x8000, Kelvin: 3500}
+	light := &lifxtest.Light{}
+	light.SetPower(0xFFFF, 0)
+	light.SetColor(orig, 0)
+	vd, dev, ctx := newTestDevice(t, light)
+	vd.SetLabel("Lamp")
+
+	state, err := dev.CaptureState(ctx)
+	if err != nil {
+		t.Fatalf("CaptureState: %v", err)
+	}
+	if state.Color() != orig || state.Power() != 0xFFFF || state.Label() != "Lamp" {
+		t.Errorf("CaptureState = color %+v, power %d, label %q; want %+v, 65535, %q", state.Color(), state.Power(), state.Label(), orig, "Lamp")
+	}
+
+	if err := dev.SetColor(ctx, lifx.Color{Kelvin: 9000}, 0); err != nil {
+		t.Fatalf("SetColor: %v", err)
+	}
+	if err := dev.SetLabel(ctx, "Changed"); err != nil {
+		t.Fatalf("SetLabel: %v", err)
+	}
+	if err := dev.SetLightPower(ctx, 0, 0); err != nil {
+		t.Fatalf("SetLightPower: %v", err)
+	}
+
+	if err := dev.RestoreState(ctx, state); err != nil {
+		t.Fatalf("RestoreState: %v", err)
+	}
+	if got := light.Color(); got != orig {
+		t.Errorf("after RestoreState, color = %+v, want %+v", got, orig)
+	}
+	if got := light.Power(); got != 0xFFFF {
+		t.Errorf("after RestoreState, power = %d, want 65535", got)
+	}
+	if got, err := dev.GetLabel(ctx); err != nil || got != "Lamp" {
+		t.Errorf("after RestoreState, GetLabel = %q, %v; want %q, nil", got, err, "Lamp")
+	}
+}
+
+func TestRestoreStateKeepsLabel(t *testing.T) {
+	vd, dev, ctx := newTestDevice(t, &lifxtest.Light{})
+	vd.SetLabel("Lamp")
+
+	// A state without a label, such as one saved before labels were recorded,
+	// mustn't wipe the device's label.
+	var state lifx.State
+	if err := json.Unmarshal([]byte(`{"version": 1, "power": 65535}`), &state); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if err := dev.RestoreState(ctx, state); err != nil {
+		t.Fatalf("RestoreState: %v", err)
+	}
+	if got, err := dev.GetLabel(ctx); err != nil || got != "Lamp" {
+		t.Errorf("after RestoreState without a label, GetLabel = %q, %v; want %q, nil", got, err, "Lamp")
+	}
+}
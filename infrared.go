@@ -0,0 +1,29 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// GetInfrared returns the maximum brightness of the infrared channel
+// on devices with night vision capability.
+func (d *Device) GetInfrared(ctx context.Context) (uint16, error) {
+	if err := d.requireFeature("infrared", hasInfrared); err != nil {
+		return 0, err
+	}
+	payload, err := d.query(ctx, pktGetInfrared, pktStateInfrared, nil)
+	if err != nil {
+		return 0, err
+	}
+	return decodeLevel(pktStateInfrared, payload)
+}
+
+// SetInfrared sets the maximum brightness of the infrared channel
+// on devices with night vision capability. The device decides when
+// to use infrared, based on ambient light.
+func (d *Device) SetInfrared(ctx context.Context, brightness uint16) error {
+	if err := d.requireFeature("infrared", hasInfrared); err != nil {
+		return err
+	}
+	return d.set(ctx, pktSetInfrared, binary.LittleEndian.AppendUint16(nil, brightness))
+}
@@ -0,0 +1,149 @@
+// Package command implements the JSON light commands and states shared by the bridge commands.
+package command
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Command is a change to a light's power and color. All fields are optional.
+//
+//	{"power":"on","color":"#ff8000","brightness":40,"duration":"2s"}
+type Command struct {
+	Power *string `json:"power"` // "on" or "off"
+
+	// Color is anything accepted by lifx.ParseColor.
+	// The other color fields modify it, or the light's current color if it is not set.
+	Color      *string  `json:"color"`
+	Hue        *float64 `json:"hue"`        // degrees
+	Saturation *float64 `json:"saturation"` // percent
+	Brightness *float64 `json:"brightness"` // percent
+	Kelvin     *uint16  `json:"kelvin"`
+
+	Duration string `json:"duration"` // such as "1.5s"
+}
+
+func (c *Command) hasColor() bool {
+	return c.Color != nil || c.Hue != nil || c.Saturation != nil || c.Brightness != nil || c.Kelvin != nil
+}
+
+// Apply applies the command to the device.
+func (c *Command) Apply(ctx context.Context, d *lifx.Device) error {
+	var dur time.Duration
+	if c.Duration != "" {
+		var err error
+		if dur, err = time.ParseDuration(c.Duration); err != nil {
+			return fmt.Errorf("bad duration: %w", err)
+		}
+	}
+	var on, off bool
+	if c.Power != nil {
+		switch strings.ToLower(*c.Power) {
+		case "on":
+			on = true
+		case "off":
+			off = true
+		default:
+			return fmt.Errorf("bad power %q", *c.Power)
+		}
+	}
+	var col lifx.Color
+	if c.Color != nil {
+		var err error
+		if col, err = lifx.ParseColor(*c.Color); err != nil {
+			return err
+		}
+	}
+
+	// Turn off first, so a color change isn't visible;
+	// turn on last, so it lands on the new color.
+	if off {
+		if err := d.SetLightPower(ctx, 0, dur); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
+	if c.hasColor() {
+		if c.Color == nil {
+			var err error
+			if col, err = d.GetColor(ctx); err != nil {
+				return fmt.Errorf("GetColor: %w", err)
+			}
+		}
+		if c.Hue != nil {
+			col.Hue = uint16(int(math.Round(*c.Hue/360*0x10000)) & 0xFFFF)
+		}
+		if c.Saturation != nil {
+			col.Saturation = Percent16(*c.Saturation)
+		}
+		if c.Brightness != nil {
+			col.Brightness = Percent16(*c.Brightness)
+		}
+		if c.Kelvin != nil {
+			col.Kelvin = *c.Kelvin
+		}
+		if err := d.SetColor(ctx, col, dur); err != nil {
+			return fmt.Errorf("SetColor: %w", err)
+		}
+	}
+	if on {
+		if err := d.SetLightPower(ctx, 0xFFFF, dur); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
+	return nil
+}
+
+// Percent16 converts a percentage to the protocol's 16-bit scale, clamping it to [0,100].
+func Percent16(p float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(100, p)) / 100 * 0xFFFF))
+}
+
+// Percent converts a value on the protocol's 16-bit scale to a percentage,
+// rounded to one decimal place.
+func Percent(v uint16) float64 {
+	return math.Round(float64(v)/0xFFFF*1000) / 10
+}
+
+// Degrees converts a protocol hue to degrees, rounded to one decimal place.
+func Degrees(hue uint16) float64 {
+	return math.Round(float64(hue)/0x10000*3600) / 10
+}
+
+// State is the JSON form of a device's state.
+//
+//	{"serial":"d073d5010203","label":"Lounge","reachable":true,"power":"on",
+//	 "hue":120,"saturation":100,"brightness":60,"kelvin":3500}
+type State struct {
+	Serial     string  `json:"serial"`
+	Label      string  `json:"label"`
+	Reachable  bool    `json:"reachable"`
+	Power      string  `json:"power"` // "on" or "off"
+	Hue        float64 `json:"hue"`
+	Saturation float64 `json:"saturation"`
+	Brightness float64 `json:"brightness"`
+	Kelvin     uint16  `json:"kelvin"`
+}
+
+// StateOf returns the JSON form of a watched state.
+func StateOf(st lifx.WatchedState) State {
+	s := State{
+		Serial:     hex.EncodeToString(st.Serial[:]),
+		Label:      st.Label,
+		Reachable:  st.Reachable,
+		Power:      "off",
+		Hue:        Degrees(st.Color.Hue),
+		Saturation: Percent(st.Color.Saturation),
+		Brightness: Percent(st.Color.Brightness),
+		Kelvin:     st.Color.Kelvin,
+	}
+	if st.Power > 0 {
+		s.Power = "on"
+	}
+	return s
+}
@@ -0,0 +1,332 @@
+/*
+Package mqtt implements the small subset of MQTT 3.1.1 needed by this module:
+connecting (optionally with credentials and a will), publishing and subscribing
+at QoS 0, and keepalive pings.
+
+It deliberately omits QoS 1 and 2 publishing and session persistence.
+*/
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types.
+// https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html#_Toc398718021
+const (
+	typeConnect    = 1
+	typeConnAck    = 2
+	typePublish    = 3
+	typePubAck     = 4
+	typeSubscribe  = 8
+	typeSubAck     = 9
+	typePingReq    = 12
+	typePingResp   = 13
+	typeDisconnect = 14
+)
+
+// maxPacketSize bounds the size of a single packet.
+const maxPacketSize = 1 << 20
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure a connection.
+type Options struct {
+	ClientID           string
+	Username, Password string // optional
+
+	// KeepAlive is the interval within which the client promises to send something.
+	// The caller is responsible for calling Ping often enough.
+	KeepAlive time.Duration
+
+	// Will, if set, is published by the broker if the connection is lost.
+	Will *Message
+
+	// TLSConfig, if set, causes the connection to use TLS.
+	TLSConfig *tls.Config
+}
+
+// Conn is an MQTT connection.
+//
+// ReadMessage must not be called concurrently with itself or Subscribe,
+// but Publish and Ping are safe for concurrent use.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu    sync.Mutex // guards writes to conn
+	nextID uint16
+}
+
+// Dial connects to the broker at addr ("host:port") and performs the MQTT handshake.
+func Dial(ctx context.Context, addr string, opts Options) (*Conn, error) {
+	var conn net.Conn
+	var err error
+	if opts.TLSConfig != nil {
+		cfg := opts.TLSConfig.Clone()
+		if cfg.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg.ServerName = host
+		}
+		d := &tls.Dialer{Config: cfg}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: dialing %s: %w", addr, err)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	c := &Conn{conn: conn, br: bufio.NewReader(conn)}
+	if err := c.connect(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (c *Conn) connect(opts Options) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if w := opts.Will; w != nil {
+		flags |= 0x04
+		if w.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, w.Topic)
+		payload = appendBytes(payload, w.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+		payload = appendString(payload, opts.Password)
+	}
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = append(body, payload...)
+	if err := c.writePacket(typeConnect<<4, body); err != nil {
+		return fmt.Errorf("mqtt: writing CONNECT: %w", err)
+	}
+
+	typ, _, body, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("mqtt: reading CONNACK: %w", err)
+	}
+	if typ != typeConnAck || len(body) != 2 {
+		return fmt.Errorf("mqtt: got packet type %d, want CONNACK", typ)
+	}
+	if code := body[1]; code != 0 {
+		return fmt.Errorf("mqtt: connection refused: %s", connectError(code))
+	}
+	return nil
+}
+
+func connectError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// Publish publishes a message at QoS 0.
+func (c *Conn) Publish(m Message) error {
+	var flags byte
+	if m.Retain {
+		flags |= 0x01
+	}
+	body := appendString(nil, m.Topic)
+	body = append(body, m.Payload...)
+	return c.writePacket(typePublish<<4|flags, body)
+}
+
+// Subscribe subscribes to the topic filters at QoS 0, and waits for the broker to acknowledge.
+// Messages that arrive before the acknowledgement are discarded,
+// so it is best to subscribe before publishing anything that may provoke them.
+func (c *Conn) Subscribe(filters ...string) error {
+	c.wmu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID++
+	}
+	id := c.nextID
+	c.wmu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0) // QoS 0
+	}
+	if err := c.writePacket(typeSubscribe<<4|0x02, body); err != nil {
+		return fmt.Errorf("mqtt: writing SUBSCRIBE: %w", err)
+	}
+	for {
+		typ, _, body, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf("mqtt: reading SUBACK: %w", err)
+		}
+		if typ != typeSubAck || len(body) < 2 || binary.BigEndian.Uint16(body) != id {
+			continue
+		}
+		for i, rc := range body[2:] {
+			if rc&0x80 != 0 && i < len(filters) {
+				return fmt.Errorf("mqtt: subscription to %q refused", filters[i])
+			}
+		}
+		return nil
+	}
+}
+
+// ReadMessage reads the next published message,
+// handling acknowledgements and ping responses transparently.
+func (c *Conn) ReadMessage() (Message, error) {
+	for {
+		typ, flags, body, err := c.readPacket()
+		if err != nil {
+			return Message{}, err
+		}
+		switch typ {
+		case typePingResp, typeSubAck:
+			continue
+		case typePublish:
+		default:
+			return Message{}, fmt.Errorf("mqtt: unexpected packet type %d", typ)
+		}
+		topic, rest, err := readString(body)
+		if err != nil {
+			return Message{}, err
+		}
+		if qos := flags >> 1 & 0x03; qos > 0 {
+			// The broker may send at up to the QoS it received at.
+			if len(rest) < 2 {
+				return Message{}, errors.New("mqtt: PUBLISH missing packet identifier")
+			}
+			id := rest[:2]
+			rest = rest[2:]
+			if qos == 1 {
+				if err := c.writePacket(typePubAck<<4, id); err != nil {
+					return Message{}, err
+				}
+			}
+		}
+		return Message{Topic: topic, Payload: rest, Retain: flags&0x01 != 0}, nil
+	}
+}
+
+// Ping sends a keepalive ping. The response is consumed by ReadMessage.
+func (c *Conn) Ping() error {
+	return c.writePacket(typePingReq<<4, nil)
+}
+
+// Close sends a DISCONNECT (best effort) and closes the underlying connection.
+// The broker does not publish the will after a clean disconnect.
+func (c *Conn) Close() error {
+	c.writePacket(typeDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+func (c *Conn) readPacket() (typ, flags byte, body []byte, err error) {
+	hdr, err := c.br.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var n int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, 0, nil, errors.New("mqtt: bad remaining length")
+		}
+		b, err := c.br.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n |= int(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if n > maxPacketSize {
+		return 0, 0, nil, fmt.Errorf("mqtt: packet of %d bytes exceeds %d bytes", n, maxPacketSize)
+	}
+	body = make([]byte, n)
+	if _, err := io.ReadFull(c.br, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return hdr >> 4, hdr & 0x0F, body, nil
+}
+
+func (c *Conn) writePacket(hdr byte, body []byte) error {
+	if len(body) > maxPacketSize {
+		return fmt.Errorf("mqtt: packet of %d bytes exceeds %d bytes", len(body), maxPacketSize)
+	}
+	pkt := make([]byte, 0, 5+len(body))
+	pkt = append(pkt, hdr)
+	for n := len(body); ; {
+		b := byte(n & 0x7F)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	pkt = append(pkt, body...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(pkt)
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (s string, rest []byte, err error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
@@ -0,0 +1,224 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bufConn is a net.Conn that only supports writing, to a buffer.
+type bufConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (bc *bufConn) Write(b []byte) (int, error) { return bc.buf.Write(b) }
+
+func TestPacketRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		size    int
+		lenHead []byte // expected encoding of the remaining length
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xFF, 0x7F}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{maxPacketSize, []byte{0x80, 0x80, 0x40}},
+	} {
+		body := bytes.Repeat([]byte{0xAB}, tc.size)
+		bc := new(bufConn)
+		w := &Conn{conn: bc}
+		if err := w.writePacket(typePublish<<4|0x01, body); err != nil {
+			t.Fatalf("writePacket of %d bytes: %v", tc.size, err)
+		}
+		raw := bc.buf.Bytes()
+		if got := raw[1 : 1+len(tc.lenHead)]; !bytes.Equal(got, tc.lenHead) {
+			t.Errorf("%d byte body has remaining length encoded as %x, want %x", tc.size, got, tc.lenHead)
+		}
+
+		r := &Conn{br: bufio.NewReader(bytes.NewReader(raw))}
+		typ, flags, got, err := r.readPacket()
+		if err != nil {
+			t.Fatalf("readPacket of %d bytes: %v", tc.size, err)
+		}
+		if typ != typePublish || flags != 0x01 || !bytes.Equal(got, body) {
+			t.Errorf("readPacket = type %d, flags %#x, %d bytes; want type %d, flags 0x1, %d bytes", typ, flags, len(got), typePublish, tc.size)
+		}
+	}
+
+	if err := (&Conn{conn: new(bufConn)}).writePacket(typePublish<<4, make([]byte, maxPacketSize+1)); err == nil {
+		t.Errorf("writePacket of an oversized packet succeeded, want error")
+	}
+}
+
+func TestReadPacketErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"five length bytes", []byte{0x30, 0x80, 0x80, 0x80, 0x80, 0x01}},
+		{"oversized", []byte{0x30, 0x81, 0x80, 0x40}},
+		{"truncated body", []byte{0x30, 0x05, 0x00, 0x01}},
+	} {
+		r := &Conn{br: bufio.NewReader(bytes.NewReader(tc.raw))}
+		if _, _, _, err := r.readPacket(); err == nil {
+			t.Errorf("%s: readPacket succeeded, want error", tc.desc)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	b := appendString(nil, "lifx/lamp")
+	b = append(b, "rest"...)
+	s, rest, err := readString(b)
+	if err != nil || s != "lifx/lamp" || string(rest) != "rest" {
+		t.Errorf("readString = %q, %q, %v; want %q, %q, nil", s, rest, err, "lifx/lamp", "rest")
+	}
+	for _, bad := range [][]byte{nil, {0}, {0, 5, 'a'}} {
+		if _, _, err := readString(bad); err == nil {
+			t.Errorf("readString(%x) succeeded, want error", bad)
+		}
+	}
+}
+
+// broker accepts one connection on a loopback listener and runs script on it,
+// using a Conn for its packet framing.
+func broker(t *testing.T, script func(*Conn)) (addr string, done <-chan struct{}) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		script(&Conn{conn: conn, br: bufio.NewReader(conn)})
+	}()
+	return l.Addr().String(), ch
+}
+
+// expect reads a packet and checks its type and flags.
+func expect(t *testing.T, c *Conn, typ, flags byte) []byte {
+	t.Helper()
+	gotType, gotFlags, body, err := c.readPacket()
+	if err != nil {
+		t.Errorf("broker reading packet type %d: %v", typ, err)
+		return nil
+	}
+	if gotType != typ || gotFlags != flags {
+		t.Errorf("broker got packet type %d with flags %#x, want type %d with flags %#x", gotType, gotFlags, typ, flags)
+	}
+	return body
+}
+
+func TestBroker(t *testing.T) {
+	addr, done := broker(t, func(c *Conn) {
+		body := expect(t, c, typeConnect, 0)
+		var want []byte
+		want = appendString(want, "MQTT")
+		want = append(want, 4, 0x80|0x40|0x20|0x04|0x02, 0, 30)
+		want = appendString(want, "lifx-test")
+		want = appendString(want, "lifx/status")
+		want = appendBytes(want, []byte("offline"))
+		want = appendString(want, "user")
+		want = appendString(want, "pass")
+		if !bytes.Equal(body, want) {
+			t.Errorf("CONNECT body is\n%x\nwant\n%x", body, want)
+		}
+		c.writePacket(typeConnAck<<4, []byte{0, 0})
+
+		body = expect(t, c, typeSubscribe, 0x02)
+		want = []byte{0, 1}
+		want = appendString(want, "lifx/+/set")
+		want = append(want, 0)
+		if !bytes.Equal(body, want) {
+			t.Errorf("SUBSCRIBE body is %x, want %x", body, want)
+		}
+		c.writePacket(typeSubAck<<4, []byte{0, 1, 0})
+
+		// A QoS 1 message must be acknowledged with its packet identifier.
+		pub := appendString(nil, "lifx/lamp/set")
+		pub = append(pub, 0x12, 0x34)
+		pub = append(pub, "on"...)
+		c.writePacket(typePublish<<4|0x02, pub)
+		if body := expect(t, c, typePubAck, 0); !bytes.Equal(body, []byte{0x12, 0x34}) {
+			t.Errorf("PUBACK body is %x, want 1234", body)
+		}
+
+		body = expect(t, c, typePublish, 0x01)
+		topic, payload, err := readString(body)
+		if err != nil || topic != "lifx/lamp/state" || string(payload) != `{"on":true}` {
+			t.Errorf("PUBLISH = %q, %q, %v", topic, payload, err)
+		}
+
+		expect(t, c, typePingReq, 0)
+		c.writePacket(typePingResp<<4, nil)
+		pub = appendString(nil, "lifx/lamp/set")
+		pub = append(pub, "off"...)
+		c.writePacket(typePublish<<4|0x01, pub)
+
+		expect(t, c, typeDisconnect, 0)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, addr, Options{
+		ClientID:  "lifx-test",
+		Username:  "user",
+		Password:  "pass",
+		KeepAlive: 30 * time.Second,
+		Will:      &Message{Topic: "lifx/status", Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if err := c.Subscribe("lifx/+/set"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	m, err := c.ReadMessage()
+	if want := (Message{Topic: "lifx/lamp/set", Payload: []byte("on")}); err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("ReadMessage = %+v, %v; want %+v, nil", m, err, want)
+	}
+	if err := c.Publish(Message{Topic: "lifx/lamp/state", Payload: []byte(`{"on":true}`), Retain: true}); err != nil {
+		t.Errorf("Publish: %v", err)
+	}
+	if err := c.Ping(); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	// The ping response is skipped.
+	m, err = c.ReadMessage()
+	if want := (Message{Topic: "lifx/lamp/set", Payload: []byte("off"), Retain: true}); err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("ReadMessage = %+v, %v; want %+v, nil", m, err, want)
+	}
+	c.Close()
+	<-done
+}
+
+func TestConnectRefused(t *testing.T) {
+	addr, done := broker(t, func(c *Conn) {
+		expect(t, c, typeConnect, 0)
+		c.writePacket(typeConnAck<<4, []byte{0, 5})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Dial(ctx, addr, Options{ClientID: "lifx-test"}); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("Dial = %v, want not authorized error", err)
+	}
+	<-done
+}
@@ -0,0 +1,228 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNothingToUndo is returned by Undo when the journal has no applicable entries.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// WithJournal enables an undo journal holding up to size entries.
+//
+// Before each state-changing operation, the client captures the relevant part
+// of the device's state (its color, power, label, group, location or zones),
+// at the cost of extra round trips. Client.Undo and Device.Undo restore it.
+// Once the journal is full, the oldest entries are discarded.
+// Operations whose prior state can't be captured are performed anyway,
+// but are not journaled.
+func WithJournal(size int) Option {
+	return func(c *Client) { c.journal = &journal{size: size} }
+}
+
+type journal struct {
+	size int
+
+	mu      sync.Mutex
+	entries []journalEntry // oldest first
+}
+
+type journalEntry struct {
+	dev  *Device
+	what string // message type that was undone, for errors
+	undo func(ctx context.Context) error
+}
+
+// noJournalKey is a context key that suppresses journaling,
+// either because an operation has already been journaled at a higher level,
+// or because it is itself an undo.
+type noJournalKey struct{}
+
+func withoutJournal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noJournalKey{}, true)
+}
+
+// journaling reports whether operations on the device should be journaled.
+func (d *Device) journaling(ctx context.Context) bool {
+	return d.client.journal != nil && ctx.Value(noJournalKey{}) == nil
+}
+
+// capture returns a journal entry recording the state that an operation
+// of the given type is about to change, or nil if it isn't to be journaled.
+// The entry should be recorded with d.journal if the operation succeeds.
+func (d *Device) capture(ctx context.Context, reqType msgType) *journalEntry {
+	if !d.journaling(ctx) {
+		return nil
+	}
+	ctx = withoutJournal(ctx)
+	var undo func(context.Context) error
+	var err error
+	switch reqType {
+	case pktSetColor, pktSetWaveform, pktSetWaveformOptional:
+		undo, err = d.captureColors(ctx)
+	case pktSetLightPower:
+		var p uint16
+		p, err = d.GetLightPower(ctx)
+		undo = func(ctx context.Context) error { return d.SetLightPower(ctx, p, 0) }
+	case pktSetPower:
+		var p uint16
+		p, err = d.GetPower(ctx)
+		undo = func(ctx context.Context) error { return d.SetPower(ctx, p) }
+	case pktSetLabel:
+		var l string
+		l, err = d.GetLabel(ctx)
+		undo = func(ctx context.Context) error { return d.SetLabel(ctx, l) }
+	case pktSetGroup:
+		var m Membership
+		m, err = d.GetGroup(ctx)
+		undo = func(ctx context.Context) error { return d.SetGroup(ctx, m.ID, m.Label, m.UpdatedAt) }
+	case pktSetLocation:
+		var m Membership
+		m, err = d.GetLocation(ctx)
+		undo = func(ctx context.Context) error { return d.SetLocation(ctx, m.ID, m.Label, m.UpdatedAt) }
+	case pktSetColorZones, pktSetExtendedColorZones:
+		var zones []Color
+		zones, err = d.GetZones(ctx)
+		undo = func(ctx context.Context) error { return d.SetZones(ctx, 0, zones) }
+	default:
+		return nil
+	}
+	if err != nil {
+		d.tracef(ctx, "LIFX device %x: not journaling message type %d: %v", d.Serial, reqType, err)
+		return nil
+	}
+	return &journalEntry{
+		dev:  d,
+		what: fmt.Sprintf("message type %d", reqType),
+		undo: undo,
+	}
+}
+
+// captureColors returns a function restoring the device's current colors:
+// each pixel of a matrix device, each zone of a multizone device,
+// or otherwise its single color.
+func (d *Device) captureColors(ctx context.Context) (func(context.Context) error, error) {
+	chain, err := d.GetDeviceChain(ctx)
+	if err == nil && len(chain.Tiles) > 0 {
+		return d.captureTiles(ctx, chain)
+	} else if err != nil && !errors.Is(err, ErrUnhandled) {
+		return nil, fmt.Errorf("GetDeviceChain: %w", err)
+	}
+
+	zones, err := d.GetZones(ctx)
+	if err == nil && len(zones) > 0 {
+		return func(ctx context.Context) error { return d.SetZones(ctx, 0, zones) }, nil
+	} else if err != nil && !errors.Is(err, ErrUnhandled) {
+		return nil, fmt.Errorf("GetZones: %w", err)
+	}
+
+	c, err := d.GetColor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error { return d.SetColor(ctx, c, 0) }, nil
+}
+
+// captureTiles reads every pixel of the tiles in chain,
+// returning a function that writes them back.
+func (d *Device) captureTiles(ctx context.Context, chain TileChain) (func(context.Context) error, error) {
+	type block struct {
+		rect   TileRect
+		colors []Color
+	}
+	var blocks []block
+	for i, t := range chain.Tiles {
+		w, h := int(t.Width), int(t.Height)
+		if w == 0 || h == 0 {
+			continue
+		}
+		// As in Palette.applyTiles, read as many whole rows as fit
+		// in each message, or part of a row for very wide tiles.
+		rows, cols := max(maxSet64Colors/w, 1), min(w, maxSet64Colors)
+		for y := 0; y < h; y += rows {
+			for x := 0; x < w; x += cols {
+				rect := TileRect{TileIndex: uint8(chain.StartIndex + i), X: uint8(x), Y: uint8(y), Width: uint8(cols)}
+				colors, err := d.Get64(ctx, rect)
+				if err != nil {
+					return nil, fmt.Errorf("Get64 on tile %d: %w", i, err)
+				}
+				// Keep only the pixels that are on the tile,
+				// so that restoring doesn't spill onto the next block.
+				n := (min(y+rows, h)-y-1)*cols + min(cols, w-x)
+				blocks = append(blocks, block{rect, colors[:n]})
+			}
+		}
+	}
+	return func(ctx context.Context) error {
+		for _, b := range blocks {
+			if err := d.Set64(ctx, b.rect, 0, b.colors); err != nil {
+				return fmt.Errorf("Set64 on tile %d: %w", b.rect.TileIndex, err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// journal records e, which may be nil.
+func (d *Device) journal(e *journalEntry) {
+	if e != nil {
+		d.client.journal.push(*e)
+	}
+}
+
+func (j *journal) push(e journalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, e)
+	if n := len(j.entries) - j.size; n > 0 {
+		j.entries = append(j.entries[:0], j.entries[n:]...)
+	}
+}
+
+// pop removes and returns the most recent entry for the device,
+// or for any device if dev is nil.
+func (j *journal) pop(dev *Device) (journalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		e := j.entries[i]
+		if dev != nil && e.dev.Serial != dev.Serial {
+			continue
+		}
+		j.entries = append(j.entries[:i], j.entries[i+1:]...)
+		return e, true
+	}
+	return journalEntry{}, false
+}
+
+func (c *Client) undo(ctx context.Context, dev *Device) error {
+	if c.journal == nil {
+		return fmt.Errorf("%w: journal not enabled", ErrNothingToUndo)
+	}
+	e, ok := c.journal.pop(dev)
+	if !ok {
+		return ErrNothingToUndo
+	}
+	if err := e.undo(withoutJournal(ctx)); err != nil {
+		return fmt.Errorf("undoing %s on device %x: %w", e.what, e.dev.Serial, err)
+	}
+	return nil
+}
+
+// Undo reverts the most recent journaled operation on any device.
+// The entry is removed from the journal even if reverting fails.
+// It returns ErrNothingToUndo if there are no journaled operations;
+// see WithJournal.
+func (c *Client) Undo(ctx context.Context) error {
+	return c.undo(ctx, nil)
+}
+
+// Undo reverts the most recent journaled operation on this device.
+// The entry is removed from the journal even if reverting fails.
+// It returns ErrNothingToUndo if there are no journaled operations for this device;
+// see WithJournal.
+func (d *Device) Undo(ctx context.Context) error {
+	return d.client.undo(ctx, d)
+}
@@ -0,0 +1,73 @@
+package lifx_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestJournal(t *testing.T) {
+	orig := lifx.Color{Hue: 0x1234, Saturation: 0xFFFF, Brightness: 0x8000, Kelvin: 3500}
+	light := &lifxtest.Light{}
+	light.SetColor(orig, 0)
+	n := lifxtest.NewNetwork(t)
+	ed := n.Add(testSerial, "", light)
+	client := n.Client(lifx.WithJournal(4))
+	dev := client.NewDevice(*ed.Addr(), ed.Serial)
+	ctx := testContext(t)
+
+	if err := dev.SetColor(ctx, lifx.Color{Hue: 0xAAAA, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}, 0); err != nil {
+		t.Fatalf("SetColor: %v", err)
+	}
+	if err := dev.Undo(ctx); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got := light.Color(); got != orig {
+		t.Errorf("after Undo, color = %+v, want %+v", got, orig)
+	}
+	if err := client.Undo(ctx); !errors.Is(err, lifx.ErrNothingToUndo) {
+		t.Errorf("second Undo = %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestJournalZones(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	client := n.Client(lifx.WithJournal(4))
+	ctx := testContext(t)
+
+	strip := lifxtest.NewStrip(20)
+	matrix := lifxtest.NewMatrix(5, 20) // needs two Set64 messages
+	lights := []struct {
+		name   string
+		light  lifx.VirtualLight
+		colors func() []lifx.Color
+		set    func([]lifx.Color)
+	}{
+		{"strip", strip, strip.Zones, func(c []lifx.Color) { strip.SetZones(0, c, 0) }},
+		{"matrix", matrix, matrix.Pixels, func(c []lifx.Color) { matrix.SetPixels(c, 0) }},
+	}
+	for i, l := range lights {
+		t.Run(l.name, func(t *testing.T) {
+			orig := make([]lifx.Color, len(l.colors()))
+			for j := range orig {
+				orig[j] = lifx.Color{Hue: uint16(j * 1000), Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+			}
+			l.set(orig)
+			ed := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, byte(i)}, "", l.light)
+			dev := client.NewDevice(*ed.Addr(), ed.Serial)
+
+			if err := dev.SetColor(ctx, lifx.Color{Brightness: 0x8000, Kelvin: 3500}, 0); err != nil {
+				t.Fatalf("SetColor: %v", err)
+			}
+			if err := dev.Undo(ctx); err != nil {
+				t.Fatalf("Undo: %v", err)
+			}
+			if got := l.colors(); !slices.Equal(got, orig) {
+				t.Errorf("after Undo, colors = %+v, want %+v", got, orig)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package lifx
+
+import "context"
+
+// Color temperatures of common whites, in kelvin.
+const (
+	KelvinCandlelight = 1500
+	KelvinSunset      = 2000
+	KelvinUltraWarm   = 2500
+	KelvinWarm        = 2700
+	KelvinSoftWhite   = 3000
+	KelvinNeutral     = 3500
+	KelvinCool        = 4000
+	KelvinDaylight    = 5600
+	KelvinCloudy      = 6500
+	KelvinBlueSky     = 9000
+)
+
+// ClampKelvin limits k to the product's supported temperature range.
+// If the range is unknown, k is returned unchanged.
+func (pc ProductCapabilities) ClampKelvin(k uint16) uint16 {
+	tr := pc.TemperatureRange
+	if len(tr) < 2 {
+		return k
+	}
+	if k < tr[0] {
+		return tr[0]
+	}
+	if k > tr[1] {
+		return tr[1]
+	}
+	return k
+}
+
+// ClampKelvin limits k to the device's supported temperature range,
+// as determined by Product.
+func (d *Device) ClampKelvin(ctx context.Context, k uint16) (uint16, error) {
+	p, err := d.Product(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return p.Features.ClampKelvin(k), nil
+}
@@ -0,0 +1,79 @@
+package lifx
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// labelLength is the size of label fields in messages.
+// This applies to device labels, and group and location labels.
+const labelLength = 32
+
+var (
+	// ErrLabelTooLong is returned for labels longer than 32 bytes.
+	// See TruncateLabel.
+	ErrLabelTooLong = errors.New("label too long")
+
+	// ErrLabelInvalid is returned for labels that are not valid UTF-8,
+	// or that contain control characters. Devices store such labels
+	// happily, but they render oddly in the LIFX app.
+	ErrLabelInvalid = errors.New("label invalid")
+)
+
+// ValidateLabel reports whether label is suitable for a device, group or location label.
+// The returned error wraps ErrLabelTooLong or ErrLabelInvalid.
+func ValidateLabel(label string) error {
+	if !utf8.ValidString(label) {
+		return fmt.Errorf("%w: %q is not valid UTF-8", ErrLabelInvalid, label)
+	}
+	for _, r := range label {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: %q contains control character %U", ErrLabelInvalid, label, r)
+		}
+	}
+	if len(label) > labelLength {
+		return fmt.Errorf("%w: %q is %d bytes > %d", ErrLabelTooLong, label, len(label), labelLength)
+	}
+	return nil
+}
+
+// TruncateLabel shortens label to fit in a label field,
+// without splitting a multi-byte UTF-8 sequence.
+func TruncateLabel(label string) string {
+	if len(label) <= labelLength {
+		return label
+	}
+	n := labelLength
+	for n > 0 && !utf8.RuneStart(label[n]) {
+		n--
+	}
+	return label[:n]
+}
+
+// encodeLabel encodes a label field, padding it with NULs.
+func encodeLabel(label string) ([]byte, error) {
+	if err := ValidateLabel(label); err != nil {
+		return nil, err
+	}
+	return padLabel(label), nil
+}
+
+// padLabel encodes a label field without validating it.
+// Labels longer than the field are truncated.
+func padLabel(label string) []byte {
+	b := make([]byte, labelLength)
+	copy(b, label)
+	return b
+}
+
+// trimLabel decodes a label field, which is terminated by the first NUL.
+func trimLabel(b []byte) string {
+	for i, c := range b {
+		if c == 0x00 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
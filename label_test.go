@@ -0,0 +1,69 @@
+package lifx
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidateLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  error
+	}{
+		{"Kitchen", nil},
+		{"Küche 💡", nil},
+		{"0123456789abcdef0123456789abcdef", nil},
+		{"0123456789abcdef0123456789abcdefg", ErrLabelTooLong},
+		{"Bad\nlabel", ErrLabelInvalid},
+		{"Bad\x00label", ErrLabelInvalid},
+		{"Bad\xfflabel", ErrLabelInvalid},
+	}
+	for _, tc := range tests {
+		err := ValidateLabel(tc.label)
+		if !errors.Is(err, tc.want) || (err == nil) != (tc.want == nil) {
+			t.Errorf("ValidateLabel(%q) = %v, want %v", tc.label, err, tc.want)
+		}
+	}
+}
+
+func TestTruncateLabel(t *testing.T) {
+	// 31 bytes of ASCII, then a 4-byte emoji that would straddle the limit.
+	in := "0123456789abcdef0123456789abcde💡"
+	want := "0123456789abcdef0123456789abcde"
+	if got := TruncateLabel(in); got != want {
+		t.Errorf("TruncateLabel(%q) = %q, want %q", in, got, want)
+	}
+	if got := TruncateLabel("short"); got != "short" {
+		t.Errorf("TruncateLabel(%q) = %q", "short", got)
+	}
+}
+
+func TestLabelRoundTrip(t *testing.T) {
+	b, err := encodeLabel("Lounge")
+	if err != nil {
+		t.Fatalf("encodeLabel: %v", err)
+	}
+	if len(b) != labelLength {
+		t.Errorf("encodeLabel gave %d bytes, want %d", len(b), labelLength)
+	}
+	if got := trimLabel(b); got != "Lounge" {
+		t.Errorf("trimLabel = %q, want %q", got, "Lounge")
+	}
+}
+
+func TestEncodeLabelRejectsInvalid(t *testing.T) {
+	// encodeLabel is what SetLabel and group and location updates send;
+	// it must never produce a truncated multi-byte sequence.
+	long := "0123456789abcdef0123456789abcde💡"
+	if _, err := encodeLabel(long); !errors.Is(err, ErrLabelTooLong) {
+		t.Errorf("encodeLabel(%q) = %v, want ErrLabelTooLong", long, err)
+	}
+	b, err := encodeLabel(TruncateLabel(long))
+	if err != nil {
+		t.Fatalf("encodeLabel(TruncateLabel(%q)): %v", long, err)
+	}
+	if got := trimLabel(b); !utf8.ValidString(got) {
+		t.Errorf("encoded truncated label %q is not valid UTF-8", got)
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/dsymonds/lifx/lifxotel
+
+go 1.21
+
+require (
+	github.com/dsymonds/lifx v0.0.0-20261016230048-a9adf2bc11e1
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
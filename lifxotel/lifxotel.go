@@ -0,0 +1,62 @@
+// Package lifxotel records the requests made by the lifx package as OpenTelemetry spans.
+package lifxotel
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/dsymonds/lifx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies this package's spans.
+const tracerName = "github.com/dsymonds/lifx/lifxotel"
+
+// WithTracerProvider enables OpenTelemetry tracing for a lifx.Client.
+// Each request to a device is recorded as a span named after the message type,
+// with the device's serial, the payload sizes and the number of attempts as attributes;
+// each failed attempt that is retried is recorded as an event on the span.
+func WithTracerProvider(tp trace.TracerProvider) lifx.Option {
+	return lifx.WithRequestHook(hook{tp.Tracer(tracerName)})
+}
+
+// hook is a lifx.RequestHook that starts a span for each request.
+type hook struct {
+	tracer trace.Tracer
+}
+
+func (h hook) StartRequest(ctx context.Context, req lifx.RequestInfo) (context.Context, lifx.RequestTrace) {
+	ctx, span := h.tracer.Start(ctx, "LIFX "+req.Type.String(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("lifx.serial", hex.EncodeToString(req.Serial[:])),
+			attribute.String("lifx.message_type", req.Type.String()),
+			attribute.String("lifx.response_type", req.ResponseType.String()),
+			attribute.Int("lifx.request_size", req.Size),
+			attribute.String("net.peer.name", req.Addr.String()),
+		))
+	return ctx, spanTrace{span}
+}
+
+// spanTrace records the progress of a request on its span.
+type spanTrace struct {
+	span trace.Span
+}
+
+func (st spanTrace) AttemptFailed(attempt int, err error) {
+	st.span.AddEvent("attempt failed", trace.WithAttributes(
+		attribute.Int("lifx.attempt", attempt), attribute.String("error", err.Error())))
+}
+
+func (st spanTrace) End(attempts, respSize int, err error) {
+	st.span.SetAttributes(attribute.Int("lifx.attempts", attempts))
+	if err != nil {
+		st.span.RecordError(err)
+		st.span.SetStatus(codes.Error, err.Error())
+	} else {
+		st.span.SetAttributes(attribute.Int("lifx.response_size", respSize))
+	}
+	st.span.End()
+}
@@ -0,0 +1,88 @@
+package lifxotel
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	n := lifxtest.NewNetwork(t)
+	ed := n.Add([6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBB, 0xCC}, "", &lifxtest.Light{})
+	client := n.Client(WithTracerProvider(tp))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dev := client.NewDevice(*ed.Addr(), ed.Serial)
+	if _, err := dev.GetPower(ctx); err != nil {
+		t.Fatalf("GetPower: %v", err)
+	}
+
+	// A device that never answers.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer silent.Close()
+	gone := client.NewDevice(*silent.LocalAddr().(*net.UDPAddr), [6]byte{0xd0, 0x73, 0xd5, 9, 9, 9})
+	gone.Retry = &lifx.RetryPolicy{Base: 5 * time.Millisecond, Multiplier: 1, Max: 5 * time.Millisecond, MaxAttempts: 3}
+	if _, err := gone.GetPower(ctx); err == nil {
+		t.Fatalf("GetPower of absent device succeeded")
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Got %d spans, want 2", len(spans))
+	}
+	attrs := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range s.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	ok := spans[0]
+	if ok.Name() != "LIFX GetPower" {
+		t.Errorf("Span name = %q, want %q", ok.Name(), "LIFX GetPower")
+	}
+	a := attrs(ok)
+	if got := a["lifx.serial"].AsString(); got != "d073d5aabbcc" {
+		t.Errorf("lifx.serial = %q, want d073d5aabbcc", got)
+	}
+	if got := a["lifx.attempts"].AsInt64(); got != 1 {
+		t.Errorf("lifx.attempts = %d, want 1", got)
+	}
+	if got := a["lifx.response_size"].AsInt64(); got != 2 {
+		t.Errorf("lifx.response_size = %d, want 2", got)
+	}
+	if ok.Status().Code == codes.Error {
+		t.Errorf("Successful span has error status %v", ok.Status())
+	}
+
+	failed := spans[1]
+	if got := attrs(failed)["lifx.attempts"].AsInt64(); got != 3 {
+		t.Errorf("Failed span has lifx.attempts = %d, want 3", got)
+	}
+	if failed.Status().Code != codes.Error {
+		t.Errorf("Failed span has status %v, want error", failed.Status())
+	}
+	events := 0
+	for _, ev := range failed.Events() {
+		if ev.Name == "attempt failed" {
+			events++
+		}
+	}
+	if events != 3 {
+		t.Errorf("Failed span has %d attempt events, want 3", events)
+	}
+}
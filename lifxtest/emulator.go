@@ -0,0 +1,255 @@
+package lifxtest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Light is the state of an emulated single-zone light.
+// It implements lifx.VirtualLight, with changes taking effect immediately.
+// The zero value is a light that is off.
+type Light struct {
+	mu    sync.Mutex
+	power uint16
+	color lifx.Color
+}
+
+// Power implements lifx.VirtualLight.
+func (l *Light) Power() uint16 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.power
+}
+
+// SetPower implements lifx.VirtualLight.
+func (l *Light) SetPower(level uint16, _ time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.power = level
+}
+
+// Color implements lifx.VirtualLight.
+func (l *Light) Color() lifx.Color {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.color
+}
+
+// SetColor implements lifx.VirtualLight.
+func (l *Light) SetColor(c lifx.Color, _ time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.color = c
+}
+
+// Strip is the state of an emulated multizone light.
+// It implements lifx.VirtualLight and lifx.VirtualZones.
+// As with real devices, setting its color sets every zone.
+type Strip struct {
+	Light
+	zones []lifx.Color // guarded by Light.mu
+}
+
+// NewStrip returns an emulated multizone light with n zones.
+func NewStrip(n int) *Strip {
+	return &Strip{zones: make([]lifx.Color, n)}
+}
+
+// SetColor implements lifx.VirtualLight.
+func (s *Strip) SetColor(c lifx.Color, _ time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.color = c
+	for i := range s.zones {
+		s.zones[i] = c
+	}
+}
+
+// Zones implements lifx.VirtualZones.
+func (s *Strip) Zones() []lifx.Color {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]lifx.Color(nil), s.zones...)
+}
+
+// SetZones implements lifx.VirtualZones.
+func (s *Strip) SetZones(index int, colors []lifx.Color, _ time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index < len(s.zones) {
+		copy(s.zones[index:], colors)
+	}
+}
+
+// Matrix is the state of an emulated single-tile matrix light.
+// It implements lifx.VirtualLight and lifx.VirtualMatrix.
+// As with real devices, setting its color sets every pixel.
+type Matrix struct {
+	Light
+	width, height int
+	pixels        []lifx.Color // guarded by Light.mu
+}
+
+// NewMatrix returns an emulated matrix light with a tile of the given size.
+func NewMatrix(width, height int) *Matrix {
+	return &Matrix{width: width, height: height, pixels: make([]lifx.Color, width*height)}
+}
+
+// SetColor implements lifx.VirtualLight.
+func (m *Matrix) SetColor(c lifx.Color, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.color = c
+	for i := range m.pixels {
+		m.pixels[i] = c
+	}
+}
+
+// TileSize implements lifx.VirtualMatrix.
+func (m *Matrix) TileSize() (width, height int) { return m.width, m.height }
+
+// Pixels implements lifx.VirtualMatrix.
+func (m *Matrix) Pixels() []lifx.Color {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]lifx.Color(nil), m.pixels...)
+}
+
+// SetPixels implements lifx.VirtualMatrix.
+func (m *Matrix) SetPixels(colors []lifx.Color, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copy(m.pixels, colors)
+}
+
+// Device is an emulated LIFX device, answering the LAN protocol on the loopback interface.
+type Device struct {
+	*lifx.VirtualDevice
+	conn net.PacketConn
+}
+
+// Addr returns the address that the device is listening on.
+func (d *Device) Addr() *net.UDPAddr { return d.conn.LocalAddr().(*net.UDPAddr) }
+
+// Close stops the device.
+func (d *Device) Close() error { return d.conn.Close() }
+
+// Network is a set of emulated devices, which clients can discover and control
+// as if they were real devices on the local network:
+//
+//	n := lifxtest.NewNetwork(t)
+//	lounge := &lifxtest.Light{}
+//	n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 1}, "Lounge", lounge)
+//	client := n.Client()
+//	// ... exercise client; check lounge.Power(), lounge.Color() ...
+//
+// Network is a lifx.Transport which delivers broadcasts to each device,
+// so it may also be used with lifx.WithTransport directly,
+// or as the underlying transport of a Recorder.
+type Network struct {
+	t testing.TB
+
+	mu   sync.Mutex
+	devs []*Device
+}
+
+// NewNetwork returns an empty network.
+// Its devices and clients are closed when the test finishes.
+func NewNetwork(t testing.TB) *Network {
+	return &Network{t: t}
+}
+
+// Add starts an emulated device serving light, which is typically a *Light, *Strip or *Matrix.
+// The device claims to be a LIFX A19, a LIFX Z if light implements lifx.VirtualZones,
+// or a LIFX Tile if it implements lifx.VirtualMatrix;
+// use AddVirtual to emulate other products.
+func (n *Network) Add(serial [6]byte, label string, light lifx.VirtualLight) *Device {
+	n.t.Helper()
+	vd := &lifx.VirtualDevice{
+		Serial: serial,
+		Light:  light,
+	}
+	vd.SetLabel(label)
+	return n.AddVirtual(vd)
+}
+
+// AddVirtual starts an emulated device that serves vd, which must not be changed
+// other than through its methods. If vd.Logf is nil, it is set to log to the test.
+func (n *Network) AddVirtual(vd *lifx.VirtualDevice) *Device {
+	n.t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		n.t.Fatalf("Starting emulated device: %v", err)
+	}
+	if vd.Logf == nil {
+		vd.Logf = n.t.Logf
+	}
+	d := &Device{
+		VirtualDevice: vd,
+		conn:          conn,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Serve(conn)
+	}()
+	n.t.Cleanup(func() {
+		conn.Close()
+		<-done // so Logf isn't called after the test ends
+	})
+
+	n.mu.Lock()
+	n.devs = append(n.devs, d)
+	n.mu.Unlock()
+	return d
+}
+
+// Devices returns the devices in the network.
+func (n *Network) Devices() []*Device {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*Device(nil), n.devs...)
+}
+
+// Client returns a client that uses the network as its transport.
+func (n *Network) Client(opts ...lifx.Option) *lifx.Client {
+	n.t.Helper()
+	client, err := lifx.NewClient(append([]lifx.Option{lifx.WithTransport(n)}, opts...)...)
+	if err != nil {
+		n.t.Fatalf("NewClient: %v", err)
+	}
+	n.t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// ListenPacket implements lifx.Transport.
+func (n *Network) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &networkConn{PacketConn: conn, n: n}, nil
+}
+
+type networkConn struct {
+	net.PacketConn
+	n *Network
+}
+
+func (nc *networkConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok || !ua.IP.Equal(net.IPv4bcast) {
+		return nc.PacketConn.WriteTo(b, addr)
+	}
+	for _, d := range nc.n.Devices() {
+		if _, err := nc.PacketConn.WriteTo(b, d.Addr()); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
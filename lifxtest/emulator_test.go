@@ -0,0 +1,71 @@
+package lifxtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestNetwork(t *testing.T) {
+	n := NewNetwork(t)
+	bulb := &Light{}
+	strip := NewStrip(8)
+	bulbDev := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 1}, "Bulb", bulb)
+	stripDev := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 2}, "Strip", strip)
+	client := n.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dctx, dcancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	devs, err := client.Discover(dctx)
+	dcancel()
+	if err != nil || len(devs) != 2 {
+		t.Fatalf("Discover = %v, %v; want two devices", devs, err)
+	}
+
+	dev, err := client.DiscoverSerial(ctx, bulbDev.Serial)
+	if err != nil {
+		t.Fatalf("DiscoverSerial: %v", err)
+	}
+	red := lifx.Color{Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	if err := dev.SetColor(ctx, red, 0); err != nil {
+		t.Fatalf("SetColor: %v", err)
+	}
+	if err := dev.SetLightPower(ctx, 0xFFFF, 0); err != nil {
+		t.Fatalf("SetLightPower: %v", err)
+	}
+	if got := bulb.Color(); got != red {
+		t.Errorf("After SetColor, bulb color = %+v, want %+v", got, red)
+	}
+	if got := bulb.Power(); got != 0xFFFF {
+		t.Errorf("After SetLightPower, bulb power = %d, want 65535", got)
+	}
+	if _, err := dev.GetZones(ctx); err == nil {
+		t.Errorf("GetZones on a bulb succeeded, want error")
+	}
+
+	dev, err = client.DiscoverSerial(ctx, stripDev.Serial)
+	if err != nil {
+		t.Fatalf("DiscoverSerial: %v", err)
+	}
+	zones := lifx.GradientZones([]lifx.ColorStop{{Color: red}, {Color: lifx.Color{Hue: 0x5555, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}}}, 8)
+	if err := dev.SetZones(ctx, 0, zones); err != nil {
+		t.Fatalf("SetZones: %v", err)
+	}
+	got, err := dev.GetZones(ctx)
+	if err != nil {
+		t.Fatalf("GetZones: %v", err)
+	}
+	if len(got) != 8 || got[0] != zones[0] || got[7] != zones[7] {
+		t.Errorf("GetZones = %+v, want %+v", got, zones)
+	}
+	if err := dev.SetLabel(ctx, "Renamed"); err != nil {
+		t.Fatalf("SetLabel: %v", err)
+	}
+	if got := stripDev.Label(); got != "Renamed" {
+		t.Errorf("After SetLabel, label = %q, want %q", got, "Renamed")
+	}
+}
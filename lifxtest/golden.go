@@ -0,0 +1,95 @@
+package lifxtest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("lifxtest.update", false, "rewrite golden files instead of comparing against them")
+
+// CompareGolden compares got against the contents of the golden file at path,
+// reporting a test error with a line-based diff if they differ.
+// A missing golden file is treated as empty.
+//
+// If the -lifxtest.update flag is set, the golden file is written instead.
+func CompareGolden(t testing.TB, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Creating golden file directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Writing golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Reading golden file: %v", err)
+	}
+	if string(want) == got {
+		return
+	}
+	t.Errorf("Output differs from golden file %s (-want +got):\n%s\nRerun with -lifxtest.update to accept the new output.",
+		path, Diff(string(want), got))
+}
+
+// Diff returns a line-based diff between want and got,
+// with removed lines prefixed by "-", added lines by "+", and common lines by " ".
+func Diff(want, got string) string {
+	a, b := splitLines(want), splitLines(got)
+
+	// Classic longest common subsequence table.
+	// Golden logs are small, so quadratic space is fine.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&sb, " %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "-%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "+%s\n", b[j])
+			j++
+		}
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,142 @@
+/*
+Package lifxtest provides utilities for testing code that uses the lifx package.
+
+A Recorder is a lifx.Transport that records every packet sent through it,
+so that tests can check the exact sequence of packets a scenario produces.
+Combined with CompareGolden, this catches protocol-level regressions in
+higher-level helpers:
+
+	rec := &lifxtest.Recorder{}
+	client, _ := lifx.NewClient(lifx.WithTransport(rec))
+	// ... exercise client ...
+	lifxtest.CompareGolden(t, "testdata/scenario.golden", rec.Log())
+
+Golden files are rewritten by running the tests with -lifxtest.update.
+
+A Network emulates LIFX devices on the loopback interface, so that code
+using the lifx package can be tested without hardware.
+*/
+package lifxtest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// Packet is a single packet sent through a Recorder.
+type Packet struct {
+	Addr net.Addr // destination, as passed to WriteTo
+	Data []byte
+}
+
+// Recorder is a lifx.Transport that records all packets sent through it.
+// It is safe for concurrent use.
+type Recorder struct {
+	// Transport is the underlying transport.
+	// If nil, plain UDP sockets are used.
+	Transport lifx.Transport
+
+	// Broadcast, if set, is where packets sent to the broadcast address
+	// are delivered instead. This permits discovering a lifx.VirtualDevice
+	// listening on the loopback interface.
+	Broadcast *net.UDPAddr
+
+	mu      sync.Mutex
+	packets []Packet
+}
+
+// ListenPacket implements lifx.Transport.
+func (r *Recorder) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	var conn net.PacketConn
+	var err error
+	if r.Transport != nil {
+		conn, err = r.Transport.ListenPacket(ctx)
+	} else {
+		conn, err = net.ListenPacket("udp4", ":0")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{PacketConn: conn, r: r}, nil
+}
+
+// Packets returns a copy of the packets recorded so far.
+func (r *Recorder) Packets() []Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Packet(nil), r.packets...)
+}
+
+// Reset discards the packets recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = nil
+}
+
+// Log returns a readable description of the packets recorded so far,
+// one per line, suitable for comparing against a golden file.
+//
+// Fields that vary between runs, namely the client's source identifier
+// and device addresses, are omitted. Broadcast packets are marked as such.
+func (r *Recorder) Log() string {
+	var sb strings.Builder
+	for _, p := range r.Packets() {
+		sb.WriteString(FormatPacket(p))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// FormatPacket returns a single line describing a packet.
+func FormatPacket(p Packet) string {
+	data := p.Data
+	if len(data) < protocol.HeaderLength {
+		return fmt.Sprintf("short packet % x", data)
+	}
+	var sb strings.Builder
+	if ua, ok := p.Addr.(*net.UDPAddr); ok && ua.IP.Equal(net.IPv4bcast) {
+		sb.WriteString("broadcast ")
+	}
+	fmt.Fprintf(&sb, "type=%d", binary.LittleEndian.Uint16(data[32:34]))
+	if binary.LittleEndian.Uint16(data[2:4])&(1<<13) != 0 {
+		sb.WriteString(" tagged")
+	} else {
+		fmt.Fprintf(&sb, " target=%x", data[8:14])
+	}
+	fmt.Fprintf(&sb, " seq=%d", data[23])
+	if data[22]&0x02 != 0 {
+		sb.WriteString(" ack")
+	}
+	if data[22]&0x01 != 0 {
+		sb.WriteString(" res")
+	}
+	if payload := data[protocol.HeaderLength:]; len(payload) > 0 {
+		fmt.Fprintf(&sb, " payload=%s", hex.EncodeToString(payload))
+	}
+	return sb.String()
+}
+
+type recordingConn struct {
+	net.PacketConn
+	r *Recorder
+}
+
+func (rc *recordingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	rc.r.mu.Lock()
+	rc.r.packets = append(rc.r.packets, Packet{Addr: addr, Data: append([]byte(nil), b...)})
+	rc.r.mu.Unlock()
+
+	if ua, ok := addr.(*net.UDPAddr); ok && ua.IP.Equal(net.IPv4bcast) && rc.r.Broadcast != nil {
+		addr = rc.r.Broadcast
+	}
+	return rc.PacketConn.WriteTo(b, addr)
+}
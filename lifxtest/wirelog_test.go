@@ -0,0 +1,61 @@
+package lifxtest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestRecorderGolden(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer conn.Close()
+	vd := &lifx.VirtualDevice{
+		Serial: [6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBB, 0xCC},
+		Light:  &Light{},
+	}
+	vd.SetLabel("Virtual")
+	go vd.Serve(conn)
+
+	rec := &Recorder{Broadcast: conn.LocalAddr().(*net.UDPAddr)}
+	client, err := lifx.NewClient(lifx.WithTransport(rec))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dctx, dcancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	devs, err := client.Discover(dctx)
+	dcancel()
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("Discover = %v, %v; want one device", devs, err)
+	}
+	dev := devs[0]
+	if err := dev.SetColor(ctx, lifx.Color{Hue: 0x5555, Saturation: 0xFFFF, Brightness: 0x8000, Kelvin: 3500}, time.Second); err != nil {
+		t.Fatalf("SetColor: %v", err)
+	}
+	if err := dev.SetLightPower(ctx, 0xFFFF, 0); err != nil {
+		t.Fatalf("SetLightPower: %v", err)
+	}
+	if _, err := dev.GetLabel(ctx); err != nil {
+		t.Fatalf("GetLabel: %v", err)
+	}
+
+	CompareGolden(t, "testdata/recorder.golden", rec.Log())
+}
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\nc\n", "a\nx\nc\nd\n")
+	want := " a\n-b\n+x\n c\n+d\n"
+	if got != want {
+		t.Errorf("Diff =\n%s\nwant\n%s", got, want)
+	}
+}
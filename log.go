@@ -0,0 +1,39 @@
+package lifx
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"time"
+)
+
+// WithLogger sets a structured logger for the client and its devices.
+// Each message exchange is logged at debug level with the device serial,
+// message type, sequence number, attempt number and round-trip time;
+// less routine events, such as a device becoming unreachable, are logged at higher levels.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) { c.logger = l }
+}
+
+// log writes a structured log record, if the device has a Logger.
+func (d *Device) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if d.Logger == nil || !d.Logger.Enabled(ctx, level) {
+		return
+	}
+	attrs = append([]slog.Attr{slog.String("serial", hex.EncodeToString(d.Serial[:]))}, attrs...)
+	d.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logExchange logs one attempt at a message exchange.
+func (d *Device) logExchange(ctx context.Context, typ msgType, seq uint8, attempt int, rtt time.Duration, err error) {
+	attrs := []slog.Attr{
+		slog.String("type", typ.String()),
+		slog.Int("seq", int(seq)),
+		slog.Int("attempt", attempt),
+	}
+	if err != nil {
+		d.log(ctx, slog.LevelDebug, "LIFX exchange failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	d.log(ctx, slog.LevelDebug, "LIFX exchange", append(attrs, slog.Duration("rtt", rtt))...)
+}
@@ -0,0 +1,39 @@
+package lifx_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, dev, ctx := newTestDevice(t, &lifxtest.Light{}, lifx.WithLogger(logger))
+	if _, err := dev.GetPower(ctx); err != nil {
+		t.Fatalf("GetPower: %v", err)
+	}
+
+	var rec map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Log output %q isn't one JSON record: %v", buf.Bytes(), err)
+	}
+	for k, want := range map[string]interface{}{
+		"msg":     "LIFX exchange",
+		"serial":  "d073d5aabbcc",
+		"type":    "GetPower",
+		"seq":     1.0,
+		"attempt": 1.0,
+	} {
+		if rec[k] != want {
+			t.Errorf("Log record has %s=%v, want %v", k, rec[k], want)
+		}
+	}
+	if _, ok := rec["rtt"]; !ok {
+		t.Errorf("Log record %v has no rtt", rec)
+	}
+}
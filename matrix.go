@@ -0,0 +1,205 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Tile describes one tile in a matrix device's chain.
+// Single-tile devices such as the Candle and Ceiling have a chain of one.
+type Tile struct {
+	// AccelX, AccelY and AccelZ are accelerometer measurements,
+	// which indicate the tile's orientation.
+	AccelX, AccelY, AccelZ int16
+	// UserX and UserY are the tile's position as arranged by the user,
+	// in units of tile widths.
+	UserX, UserY float32
+	// Width and Height are the tile's dimensions in pixels.
+	Width, Height uint8
+
+	Vendor, Product uint32
+	Firmware        HostFirmware
+}
+
+// TileChain is the chain of tiles in a matrix device.
+type TileChain struct {
+	StartIndex int // index of the first tile in Tiles
+	Tiles      []Tile
+}
+
+// Sizes of the tile structures in messages.
+// https://lan.developer.lifx.com/docs/field-types#tile
+const (
+	tileLength    = 55
+	maxChainTiles = 16
+)
+
+func decodeTile(b []byte) Tile {
+	var t Tile
+	t.AccelX = int16(binary.LittleEndian.Uint16(b[0:2]))
+	t.AccelY = int16(binary.LittleEndian.Uint16(b[2:4]))
+	t.AccelZ = int16(binary.LittleEndian.Uint16(b[4:6]))
+	// b[6:8] reserved
+	t.UserX = math.Float32frombits(binary.LittleEndian.Uint32(b[8:12]))
+	t.UserY = math.Float32frombits(binary.LittleEndian.Uint32(b[12:16]))
+	t.Width, t.Height = b[16], b[17]
+	// b[18] reserved
+	t.Vendor = binary.LittleEndian.Uint32(b[19:23])
+	t.Product = binary.LittleEndian.Uint32(b[23:27])
+	// b[27:31] reserved
+	if build := binary.LittleEndian.Uint64(b[31:39]); build != 0 {
+		t.Firmware.Build = time.Unix(0, int64(build))
+	}
+	// b[39:47] reserved
+	t.Firmware.Minor = binary.LittleEndian.Uint16(b[47:49])
+	t.Firmware.Major = binary.LittleEndian.Uint16(b[49:51])
+	// b[51:55] reserved
+	return t
+}
+
+// GetDeviceChain returns the chain of tiles in a matrix device.
+//
+// https://lan.developer.lifx.com/docs/querying-the-device-for-data#getdevicechain---packet-701
+func (d *Device) GetDeviceChain(ctx context.Context) (TileChain, error) {
+	if err := d.requireFeature("matrix", hasMatrix); err != nil {
+		return TileChain{}, err
+	}
+	payload, err := d.query(ctx, pktGetDeviceChain, pktStateDeviceChain, nil)
+	if err != nil {
+		return TileChain{}, err
+	}
+	return decodeDeviceChain(payload)
+}
+
+func decodeDeviceChain(payload []byte) (TileChain, error) {
+	if err := checkLength(pktStateDeviceChain, payload, 1+maxChainTiles*tileLength+1); err != nil {
+		return TileChain{}, err
+	}
+	n := int(payload[len(payload)-1])
+	if n > maxChainTiles {
+		return TileChain{}, malformed(pktStateDeviceChain, payload, "tile_devices_count %d > %d", n, maxChainTiles)
+	}
+	chain := TileChain{
+		StartIndex: int(payload[0]),
+		Tiles:      make([]Tile, n),
+	}
+	for i := range chain.Tiles {
+		off := 1 + i*tileLength
+		chain.Tiles[i] = decodeTile(payload[off : off+tileLength])
+	}
+	return chain, nil
+}
+
+// maxSet64Colors is the number of colors a single Set64 message can carry.
+const maxSet64Colors = 64
+
+// TileRect addresses a rectangle of pixels on one or more tiles of a matrix device.
+// Pixels are written row by row, starting at (X, Y), wrapping after Width pixels.
+type TileRect struct {
+	TileIndex uint8 // first tile to write to
+	Length    uint8 // number of tiles to write the same colors to; zero is treated as 1
+	X, Y      uint8
+	Width     uint8
+}
+
+// SetUserPosition records the position of a tile in the chain, as arranged by the user,
+// in units of tile widths. This is reported as Tile.UserX and Tile.UserY by GetDeviceChain,
+// and does not otherwise affect the device.
+//
+// https://lan.developer.lifx.com/docs/changing-a-device#setuserposition---packet-703
+func (d *Device) SetUserPosition(ctx context.Context, tileIndex uint8, x, y float32) error {
+	if err := d.requireFeature("matrix", hasMatrix); err != nil {
+		return err
+	}
+	payload := make([]byte, 11)
+	payload[0] = tileIndex
+	// payload[1:3] reserved
+	binary.LittleEndian.PutUint32(payload[3:7], math.Float32bits(x))
+	binary.LittleEndian.PutUint32(payload[7:11], math.Float32bits(y))
+	return d.set(ctx, pktSetUserPosition, payload)
+}
+
+// Get64 reads 64 pixels from a rectangle on one tile of a matrix device.
+// The pixels are returned row by row, starting at (X, Y), wrapping after Width pixels.
+// rect.Length must be 0 or 1; to read several tiles, call Get64 once per tile.
+//
+// https://lan.developer.lifx.com/docs/querying-the-device-for-data#get64---packet-707
+func (d *Device) Get64(ctx context.Context, rect TileRect) ([]Color, error) {
+	if err := d.requireFeature("matrix", hasMatrix); err != nil {
+		return nil, err
+	}
+	if rect.Length > 1 {
+		return nil, fmt.Errorf("Get64 can only read one tile at a time")
+	}
+	if rect.Width == 0 {
+		return nil, fmt.Errorf("rect width must be positive")
+	}
+	req := []byte{rect.TileIndex, 1, 0, rect.X, rect.Y, rect.Width}
+	payload, err := d.query(ctx, pktGet64, pktState64, req)
+	if err != nil {
+		return nil, err
+	}
+	tileIndex, colors, err := decodeState64(payload)
+	if err != nil {
+		return nil, err
+	}
+	if tileIndex != rect.TileIndex {
+		return nil, fmt.Errorf("State64 for tile %d, want %d", tileIndex, rect.TileIndex)
+	}
+	return colors, nil
+}
+
+func decodeState64(payload []byte) (tileIndex uint8, colors []Color, err error) {
+	if err := checkLength(pktState64, payload, 5+maxSet64Colors*encodedColorLength); err != nil {
+		return 0, nil, err
+	}
+	colors = make([]Color, maxSet64Colors)
+	for i := range colors {
+		off := 5 + i*encodedColorLength
+		colors[i].decode(payload[off : off+encodedColorLength])
+	}
+	return payload[0], colors, nil
+}
+
+// Set64 writes up to 64 colors to a rectangle of pixels on a matrix device.
+// The device always applies 64 colors, so if fewer are given the rest are black;
+// rect should be chosen so that those fall outside the tile or are later overwritten.
+//
+// https://lan.developer.lifx.com/docs/changing-a-device#set64---packet-715
+func (d *Device) Set64(ctx context.Context, rect TileRect, duration time.Duration, colors []Color) error {
+	if err := d.requireFeature("matrix", hasMatrix); err != nil {
+		return err
+	}
+	if len(colors) > maxSet64Colors {
+		return fmt.Errorf("too many colors to set; %d > %d", len(colors), maxSet64Colors)
+	}
+	if rect.Width == 0 {
+		return fmt.Errorf("rect width must be positive")
+	}
+	dur, err := uint32Millis(duration)
+	if err != nil {
+		return err
+	}
+	length := rect.Length
+	if length == 0 {
+		length = 1
+	}
+
+	payload := make([]byte, 6+4+maxSet64Colors*encodedColorLength)
+	payload[0] = rect.TileIndex
+	payload[1] = length
+	// payload[2] reserved
+	payload[3] = rect.X
+	payload[4] = rect.Y
+	payload[5] = rect.Width
+	binary.LittleEndian.PutUint32(payload[6:10], dur)
+	for i := range colors {
+		off := 10 + i*encodedColorLength
+		colors[i].encode(payload[off : off+encodedColorLength])
+	}
+
+	return d.set(ctx, pktSet64, payload)
+}
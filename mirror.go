@@ -0,0 +1,156 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MirroredState is the last known state of a device held by a Mirror.
+type MirroredState struct {
+	Device *Device
+	Label  string
+	Power  uint16  // light power for lights, device power otherwise
+	Color  Color   // zero for non-lights
+	Zones  []Color // nil if not a multi-zone device, or not yet seen
+
+	// Reachable reports whether the device has been responding to recent sweeps.
+	Reachable bool
+	// LastSeen is when the device last responded to a sweep.
+	LastSeen time.Time
+}
+
+// Mirror maintains an in-memory copy of the state of every device on the network,
+// kept up to date by periodic sweeps (see SweepState).
+// Its methods do no network I/O, so they are cheap enough to call from
+// request handlers, dashboards and the like.
+// It is safe for concurrent use.
+type Mirror struct {
+	c *Client
+
+	mu     sync.RWMutex
+	devs   map[[6]byte]*mirrorEntry
+	swept  time.Time // time of the last completed sweep
+	update chan struct{}
+}
+
+type mirrorEntry struct {
+	state  MirroredState
+	light  bool // whether a LightState has been seen
+	misses int
+}
+
+// Mirror starts mirroring the state of devices on the network, sweeping every interval
+// (or DefaultPollInterval if interval is not positive), until the context is done.
+// Devices that miss several consecutive sweeps are marked as unreachable,
+// but retain their last known state.
+func (c *Client) Mirror(ctx context.Context, interval time.Duration) *Mirror {
+	m := &Mirror{
+		c:      c,
+		devs:   make(map[[6]byte]*mirrorEntry),
+		update: make(chan struct{}),
+	}
+	go m.run(ctx, interval)
+	return m
+}
+
+// Device returns the mirrored state of the device with the given serial,
+// and whether it has ever been seen.
+func (m *Mirror) Device(serial [6]byte) (MirroredState, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.devs[serial]
+	if !ok {
+		return MirroredState{}, false
+	}
+	return e.copy(), true
+}
+
+// Devices returns the mirrored state of every device seen so far, ordered by serial.
+func (m *Mirror) Devices() []MirroredState {
+	m.mu.RLock()
+	states := make([]MirroredState, 0, len(m.devs))
+	for _, e := range m.devs {
+		states = append(states, e.copy())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		return bytes.Compare(states[i].Device.Serial[:], states[j].Device.Serial[:]) < 0
+	})
+	return states
+}
+
+// Updated returns a channel that is closed after the next sweep completes,
+// and the time of the most recently completed sweep (zero if none has completed).
+func (m *Mirror) Updated() (<-chan struct{}, time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.update, m.swept
+}
+
+func (e *mirrorEntry) copy() MirroredState {
+	st := e.state
+	if st.Zones != nil {
+		st.Zones = append([]Color(nil), st.Zones...)
+	}
+	return st
+}
+
+func (m *Mirror) run(ctx context.Context, interval time.Duration) {
+	poll(ctx, interval, func(sctx context.Context) bool {
+		swept, err := m.c.sweep(sctx, true)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err == nil {
+			m.apply(swept, time.Now())
+		}
+		// Otherwise it's transient, presumably. Try again next time.
+		return true
+	})
+}
+
+func (m *Mirror) apply(swept []*SweptState, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[[6]byte]bool)
+	for _, ss := range swept {
+		serial := ss.Device.Serial
+		seen[serial] = true
+		e, ok := m.devs[serial]
+		if !ok {
+			e = &mirrorEntry{state: MirroredState{Device: ss.Device}}
+			m.devs[serial] = e
+		}
+		e.misses = 0
+		e.state.Reachable = true
+		e.state.LastSeen = now
+		// Responses may be lost, so only overwrite what was observed.
+		if ss.HasColor {
+			e.light = true
+			e.state.Label, e.state.Color, e.state.Power = ss.Label, ss.Color, ss.LightPower
+		} else if ss.HasPower && !e.light {
+			e.state.Power = ss.Power
+		}
+		if ss.Zones != nil {
+			e.state.Zones = ss.Zones
+		}
+	}
+	for serial, e := range m.devs {
+		if seen[serial] {
+			continue
+		}
+		e.misses++
+		if e.misses >= watchMissLimit {
+			e.state.Reachable = false
+		}
+	}
+
+	m.swept = now
+	close(m.update)
+	m.update = make(chan struct{})
+}
@@ -2,94 +2,222 @@ package lifx
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 	"math/rand"
 	"net"
+	"sync"
 	"time"
+
+	"github.com/dsymonds/lifx/protocol"
 )
 
 type Client struct {
-	conn   *net.UDPConn // persistent connection for receiving responses
-	source uint32       // random source identifier
+	transport      Transport
+	conn           net.PacketConn // persistent connection for receiving responses
+	source         uint32         // random source identifier
+	policy         *Policy
+	iface          string         // from WithInterface
+	broadcastAddrs []*net.UDPAddr // nil means defaultBroadcastAddr
+	allInterfaces  bool           // from WithAllInterfaces
+	journal        *journal       // nil if not enabled
+	rate           float64        // per-device messages per second; zero for unlimited
+	burst          int
+	localAddr      *net.UDPAddr  // from WithLocalAddr
+	defaultTimeout time.Duration // from WithDefaultTimeout
+	retry          RetryPolicy
+	tracef         func(ctx context.Context, format string, args ...interface{})
+	logger         *slog.Logger // from WithLogger
+	requestHook    RequestHook  // from WithRequestHook
+	packetHook     func(dir Direction, addr *net.UDPAddr, raw []byte)
+	aliases        Aliases // from WithAliases, or loaded by Aliases
+	aliasesOnce    sync.Once
+	aliasesErr     error
+	closed         chan struct{} // closed by Close
+	closeOnce      sync.Once
+
+	// Responses to requests are all received on conn, and handed out by dispatcher.
+	dispatcher dispatcher
+	readDone   chan struct{} // closed when readLoop exits
+	readErr    error         // why readLoop exited; only read after readDone is closed
 }
 
-func NewClient() (*Client, error) {
-	conn, err := udpConn(context.Background())
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithTransport sets the Transport used by the client.
+// The default is to use UDP directly on the local network.
+func WithTransport(t Transport) Option {
+	return func(c *Client) { c.transport = t }
+}
+
+// WithSource sets the source identifier that the client puts in every message,
+// which devices echo in their responses.
+// The default is random, which keeps separate clients from seeing each other's responses;
+// a fixed source may be useful for recognising the client in packet captures.
+// Zero is not permitted, since it causes devices to broadcast their responses.
+func WithSource(source uint32) Option {
+	return func(c *Client) { c.source = source }
+}
+
+// WithLocalAddr binds the client's sockets to the given local address.
+// If the port is non-zero, it is used for the client's main connection,
+// on which responses to device operations are received;
+// discovery always uses ephemeral ports.
+// It has no effect on a client with a custom Transport.
+func WithLocalAddr(addr *net.UDPAddr) Option {
+	return func(c *Client) { c.localAddr = addr }
+}
+
+// WithDefaultTimeout sets the timeout for device operations
+// whose context has no deadline. Without it, such operations
+// are retried until their context is cancelled.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(c *Client) { c.defaultTimeout = d }
+}
+
+// WithTracef sets the default Tracef function for the client's devices.
+func WithTracef(f func(ctx context.Context, format string, args ...interface{})) Option {
+	return func(c *Client) { c.tracef = f }
+}
+
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		transport: udpTransport{},
+		source:    rand.Uint32(),
+		rate:      DefaultRateLimit,
+		burst:     DefaultRateBurst,
+		retry:     DefaultRetryPolicy,
+		closed:    make(chan struct{}),
+		readDone:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.source == 0 {
+		return nil, fmt.Errorf("source must be non-zero")
+	}
+	if err := c.retry.validate(); err != nil {
+		return nil, err
+	}
+	if c.iface != "" {
+		if err := c.applyInterface(); err != nil {
+			return nil, err
+		}
+	}
+	var conn net.PacketConn
+	var err error
+	if _, ok := c.transport.(udpTransport); ok && c.localAddr != nil {
+		c.transport = udpTransport{ip: c.localAddr.IP}
+		conn, err = net.ListenUDP("udp4", c.localAddr)
+		if err != nil {
+			err = fmt.Errorf("net.ListenUDP: %v", err)
+		}
+	} else {
+		conn, err = c.transport.ListenPacket(context.Background())
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		conn:   conn,
-		source: rand.Uint32(),
-	}, nil
+	if c.packetHook != nil {
+		conn = hookConn{conn, c.packetHook}
+	}
+	c.conn = conn
+	go c.readLoop()
+	return c, nil
 }
 
+// Close releases the client's resources. It is safe to call more than once.
 func (c *Client) Close() {
-	c.conn.Close()
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
 }
 
-type msgType uint16
+// msgType is a message type. The constants below are short-hands for those in the protocol package.
+type msgType = protocol.Type
 
 // Message type constants.
 const (
-	pktGetService              = msgType(2)
-	pktStateService            = msgType(3)
-	pktGetHostFirmware         = msgType(14)
-	pktStateHostFirmware       = msgType(15)
-	pktGetPower                = msgType(20)
-	pktStatePower              = msgType(22)
-	pktGetLabel                = msgType(23)
-	pktStateLabel              = msgType(25)
-	pktGetVersion              = msgType(32)
-	pktStateVersion            = msgType(33)
-	pktAcknowledgement         = msgType(45)
-	pktGetColor                = msgType(101)
-	pktSetColor                = msgType(102)
-	pktSetWaveform             = msgType(103)
-	pktLightState              = msgType(107)
-	pktGetLightPower           = msgType(116)
-	pktSetLightPower           = msgType(117)
-	pktStateLightPower         = msgType(118)
-	pktStateUnhandled          = msgType(223)
-	pktSetExtendedColorZones   = msgType(510)
-	pktGetExtendedColorZones   = msgType(511)
-	pktStateExtendedColorZones = msgType(512)
+	pktGetService              = protocol.GetService
+	pktStateService            = protocol.StateService
+	pktGetHostFirmware         = protocol.GetHostFirmware
+	pktStateHostFirmware       = protocol.StateHostFirmware
+	pktGetWifiInfo             = protocol.GetWifiInfo
+	pktStateWifiInfo           = protocol.StateWifiInfo
+	pktGetPower                = protocol.GetPower
+	pktSetPower                = protocol.SetPower
+	pktStatePower              = protocol.StatePower
+	pktGetLabel                = protocol.GetLabel
+	pktSetLabel                = protocol.SetLabel
+	pktStateLabel              = protocol.StateLabel
+	pktGetVersion              = protocol.GetVersion
+	pktStateVersion            = protocol.StateVersion
+	pktGetInfo                 = protocol.GetInfo
+	pktStateInfo               = protocol.StateInfo
+	pktSetReboot               = protocol.SetReboot
+	pktAcknowledgement         = protocol.Acknowledgement
+	pktGetLocation             = protocol.GetLocation
+	pktSetLocation             = protocol.SetLocation
+	pktStateLocation           = protocol.StateLocation
+	pktGetGroup                = protocol.GetGroup
+	pktSetGroup                = protocol.SetGroup
+	pktStateGroup              = protocol.StateGroup
+	pktEchoRequest             = protocol.EchoRequest
+	pktEchoResponse            = protocol.EchoResponse
+	pktGetColor                = protocol.GetColor
+	pktSetColor                = protocol.SetColor
+	pktSetWaveform             = protocol.SetWaveform
+	pktLightState              = protocol.LightState
+	pktGetLightPower           = protocol.GetLightPower
+	pktSetLightPower           = protocol.SetLightPower
+	pktStateLightPower         = protocol.StateLightPower
+	pktSetWaveformOptional     = protocol.SetWaveformOptional
+	pktGetInfrared             = protocol.GetInfrared
+	pktStateInfrared           = protocol.StateInfrared
+	pktSetInfrared             = protocol.SetInfrared
+	pktGetHevCycle             = protocol.GetHevCycle
+	pktSetHevCycle             = protocol.SetHevCycle
+	pktStateHevCycle           = protocol.StateHevCycle
+	pktGetHevCycleConfig       = protocol.GetHevCycleConfig
+	pktSetHevCycleConfig       = protocol.SetHevCycleConfig
+	pktStateHevCycleConfig     = protocol.StateHevCycleConfig
+	pktGetLastHevCycleResult   = protocol.GetLastHevCycleResult
+	pktStateLastHevCycleResult = protocol.StateLastHevCycleResult
+	pktStateUnhandled          = protocol.StateUnhandled
+	pktSetColorZones           = protocol.SetColorZones
+	pktGetColorZones           = protocol.GetColorZones
+	pktStateZone               = protocol.StateZone
+	pktStateMultiZone          = protocol.StateMultiZone
+	pktGetMultiZoneEffect      = protocol.GetMultiZoneEffect
+	pktSetMultiZoneEffect      = protocol.SetMultiZoneEffect
+	pktStateMultiZoneEffect    = protocol.StateMultiZoneEffect
+	pktSetExtendedColorZones   = protocol.SetExtendedColorZones
+	pktGetExtendedColorZones   = protocol.GetExtendedColorZones
+	pktStateExtendedColorZones = protocol.StateExtendedColorZones
+	pktGetDeviceChain          = protocol.GetDeviceChain
+	pktStateDeviceChain        = protocol.StateDeviceChain
+	pktSetUserPosition         = protocol.SetUserPosition
+	pktGet64                   = protocol.Get64
+	pktState64                 = protocol.State64
+	pktSet64                   = protocol.Set64
+	pktGetTileEffect           = protocol.GetTileEffect
+	pktSetTileEffect           = protocol.SetTileEffect
+	pktStateTileEffect         = protocol.StateTileEffect
+	pktGetRPower               = protocol.GetRPower
+	pktSetRPower               = protocol.SetRPower
+	pktStateRPower             = protocol.StateRPower
+	pktGetButton               = protocol.GetButton
+	pktSetButton               = protocol.SetButton
+	pktStateButton             = protocol.StateButton
+	pktGetButtonConfig         = protocol.GetButtonConfig
+	pktSetButtonConfig         = protocol.SetButtonConfig
+	pktStateButtonConfig       = protocol.StateButtonConfig
 )
 
-// header represents a LIFX message header.
-//
-// https://lan.developer.lifx.com/docs/packet-contents#header
-type header struct {
-	// This structure only contains fields that are settable.
-	// The rest are fixed or computed.
-
-	// https://lan.developer.lifx.com/docs/packet-contents#frame-header
-	frameHeader struct {
-		//size        uint16
-		//protocol    uint16
-		//addressable bool
-		tagged bool
-		//origin uint8
-		source uint32
-	}
-
-	// https://lan.developer.lifx.com/docs/packet-contents#frame-address
-	frameAddress struct {
-		target      [8]uint8
-		resRequired bool
-		ackRequired bool
-		sequence    uint8
-	}
-
-	// https://lan.developer.lifx.com/docs/packet-contents#protocol-header
-	protocolHeader struct {
-		typ uint16
-	}
-}
-
 func boolInt(b bool) byte {
 	if b {
 		return 1
@@ -97,66 +225,35 @@ func boolInt(b bool) byte {
 	return 0
 }
 
-func encodeMessage(hdr header, payload []byte) []byte {
-	bit := func(b bool) uint { return uint(boolInt(b)) }
-
-	finalSize := 8 + 16 + 12 + len(payload)
-	out := make([]byte, 0, finalSize)
-
-	// Frame header (8 bytes).
-	out = binary.LittleEndian.AppendUint16(out, uint16(finalSize))
-	out = append(out, 0)                                                   // low byte of protocol (1024)
-	out = append(out, byte(0x04|1<<4|bit(hdr.frameHeader.tagged)<<5|0<<6)) // remainder of protol, addressable, tagged, origin
-	out = binary.LittleEndian.AppendUint32(out, hdr.frameHeader.source)
-
-	// Frame address (16 bytes).
-	out = append(out, hdr.frameAddress.target[:]...)
-	out = append(out, 0, 0, 0, 0, 0, 0)                                                             // reserved
-	out = append(out, byte(bit(hdr.frameAddress.resRequired)|bit(hdr.frameAddress.ackRequired)<<1)) // and 6 reserved bits
-	out = append(out, hdr.frameAddress.sequence)
-
-	// Protocol header (12 bytes).
-	out = append(out, 0, 0, 0, 0, 0, 0, 0, 0) // reserved
-	out = binary.LittleEndian.AppendUint16(out, hdr.protocolHeader.typ)
-	out = append(out, 0, 0) // reserved
-
-	// Payload itself.
-	out = append(out, payload...)
+// malformed returns a *protocol.DecodeError for a payload of the given type.
+func malformed(typ msgType, payload []byte, format string, args ...interface{}) error {
+	return &protocol.DecodeError{Type: typ, Len: len(payload), Reason: fmt.Sprintf(format, args...)}
+}
 
-	if len(out) != finalSize {
-		panic(fmt.Sprintf("internal error: encoded message to %d bytes but it should have been %d bytes", len(out), finalSize))
+// checkLength returns an error unless the payload of the given type is exactly n bytes.
+func checkLength(typ msgType, payload []byte, n int) error {
+	if len(payload) != n {
+		return malformed(typ, payload, "want %d bytes", n)
 	}
-	return out
+	return nil
 }
 
-func decodeMessage(b []byte) (hdr header, payload []byte, err error) {
-	if len(b) < 36 {
-		err = fmt.Errorf("message too short: %d bytes < minimum 36 bytes", len(b))
-		return
-	}
-	finalSize := int(binary.LittleEndian.Uint16(b[0:2]))
-	if finalSize != len(b) {
-		err = fmt.Errorf("message has invalid size %d; got %d bytes", finalSize, len(b))
-		return
+// checkMinLength returns an error unless the payload of the given type is at least n bytes.
+func checkMinLength(typ msgType, payload []byte, n int) error {
+	if len(payload) < n {
+		return malformed(typ, payload, "want at least %d bytes", n)
 	}
-	b, payload = b[:36], b[36:]
-
-	// TODO: target?
-	hdr.frameHeader.source = binary.LittleEndian.Uint32(b[4:8])
-
-	copy(hdr.frameAddress.target[:], b[8:16])
-	// TODO: resRequired? ackRequired?
-	hdr.frameAddress.sequence = b[23]
-
-	hdr.protocolHeader.typ = binary.LittleEndian.Uint16(b[32:34])
-
-	return
+	return nil
 }
 
-func udpConn(ctx context.Context) (*net.UDPConn, error) {
-	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+// listen opens a new packet connection using the client's transport.
+func (c *Client) listen(ctx context.Context) (net.PacketConn, error) {
+	conn, err := c.transport.ListenPacket(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("net.ListenUDP: %v", err)
+		return nil, err
+	}
+	if c.packetHook != nil {
+		conn = hookConn{conn, c.packetHook}
 	}
 	if d, ok := ctx.Deadline(); ok { // TODO: force a deadline if none provided?
 		conn.SetReadDeadline(d)
@@ -164,7 +261,7 @@ func udpConn(ctx context.Context) (*net.UDPConn, error) {
 	return conn, nil
 }
 
-func readOnePacket(conn *net.UDPConn) (hdr header, payload []byte, raddr *net.UDPAddr, err error) {
+func readOnePacket(conn net.PacketConn) (hdr protocol.Header, payload []byte, raddr *net.UDPAddr, err error) {
 	var scratch [4 << 10]byte
 
 	nb, ra, err := conn.ReadFrom(scratch[:])
@@ -172,11 +269,15 @@ func readOnePacket(conn *net.UDPConn) (hdr header, payload []byte, raddr *net.UD
 		err = fmt.Errorf("reading UDP: %w", err)
 		return
 	}
-	raddr = ra.(*net.UDPAddr)
+	raddr, ok := ra.(*net.UDPAddr)
+	if !ok {
+		err = fmt.Errorf("reading UDP: unexpected address type %T", ra)
+		return
+	}
 	b := scratch[:nb]
 	//log.Printf("got back %d bytes from %s: %q", nb, raddr, b)
 
-	hdr, payload, err = decodeMessage(b)
+	hdr, payload, err = protocol.Decode(b)
 	if err != nil {
 		err = fmt.Errorf("decoding response: %w", err)
 		return
@@ -189,12 +290,58 @@ func readOnePacket(conn *net.UDPConn) (hdr header, payload []byte, raddr *net.UD
 // UDP doesn't have reliability guarantees. LIFX devices are usually pretty
 // good on a LAN, but in the event a packet is dropped we can set strict
 // timeouts and aggressively retry to improve reliability.
+// These are the defaults; see RetryPolicy.
 const (
 	baseTimeout = 300 * time.Millisecond
 	backoffMult = 1.5
 	maxTimeout  = 10 * time.Second
 )
 
+// RetryPolicy controls how device operations are retried when responses are lost.
+//
+// The first attempt waits Base for a response, and each subsequent attempt waits
+// Multiplier times longer than the previous, up to Max. Each wait is randomly
+// varied by up to Jitter (a fraction, such as 0.1 for ±10%) so that many clients
+// retrying at once don't stay in lockstep.
+// If MaxAttempts is positive, operations fail after that many attempts;
+// otherwise they are retried until their context is done.
+type RetryPolicy struct {
+	Base        time.Duration
+	Multiplier  float64
+	Max         time.Duration
+	MaxAttempts int
+	Jitter      float64
+}
+
+// DefaultRetryPolicy is the RetryPolicy used unless overridden.
+// It uses short timeouts and retries aggressively to improve reliability.
+var DefaultRetryPolicy = RetryPolicy{
+	Base:       baseTimeout,
+	Multiplier: backoffMult,
+	Max:        maxTimeout,
+}
+
+// WithRetryPolicy sets the default RetryPolicy for the client's devices.
+// Individual devices may override it by setting Device.Retry.
+func WithRetryPolicy(rp RetryPolicy) Option {
+	return func(c *Client) { c.retry = rp }
+}
+
+func (rp *RetryPolicy) validate() error {
+	if rp.Base <= 0 || rp.Multiplier < 1 || rp.Max < rp.Base || rp.MaxAttempts < 0 || rp.Jitter < 0 || rp.Jitter >= 1 {
+		return fmt.Errorf("bad retry policy %+v", *rp)
+	}
+	return nil
+}
+
+// jitter randomly varies the timeout according to the policy.
+func (rp *RetryPolicy) jitter(timeout time.Duration) time.Duration {
+	if rp.Jitter == 0 {
+		return timeout
+	}
+	return time.Duration(float64(timeout) * (1 + rp.Jitter*(2*rand.Float64()-1)))
+}
+
 type retryableOp func(context.Context) error
 
 // retryableErr reports whether the error should cause another try.
@@ -213,10 +360,29 @@ func retryableErr(err error) bool {
 }
 
 func (d *Device) retry(ctx context.Context, f retryableOp) error {
+	c := d.client
+	if _, ok := ctx.Deadline(); !ok && c.defaultTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.defaultTimeout)
+		defer cancel()
+	}
+	rp := &c.retry
+	if d.Retry != nil {
+		if err := d.Retry.validate(); err != nil {
+			return err
+		}
+		rp = d.Retry
+	}
+
 	// Classic exponential backoff.
 
-	timeout := baseTimeout
-	for {
+	base := rp.Base
+	for attempt := 1; ; attempt++ {
+		// Wait outside the per-attempt timeout, so a delay doesn't count as a lost packet.
+		if err := d.rateWait(ctx); err != nil {
+			return err
+		}
+		timeout := rp.jitter(base)
 		sub, cancel := context.WithTimeout(ctx, timeout)
 		d.tracef(ctx, "LIFX op starting with timeout %v", timeout)
 		t0 := time.Now()
@@ -232,82 +398,233 @@ func (d *Device) retry(ctx context.Context, f retryableOp) error {
 			d.tracef(ctx, "LIFX op giving up")
 			return err
 		}
+		if rp.MaxAttempts > 0 && attempt >= rp.MaxAttempts {
+			d.tracef(ctx, "LIFX op giving up after %d attempts", attempt)
+			return fmt.Errorf("no response after %d attempts: %w", attempt, err)
+		}
 		// Try again.
-		timeout = time.Duration(float64(timeout) * backoffMult)
-		if timeout > maxTimeout {
-			timeout = maxTimeout
+		base = time.Duration(float64(base) * rp.Multiplier)
+		if base > rp.Max {
+			base = rp.Max
 		}
 	}
 }
 
+// ErrUnhandled is matched by errors (using errors.Is) returned when a device
+// reports that it can't handle a request, which usually means that it lacks
+// the relevant capability.
+var ErrUnhandled = errors.New("LIFX device can't handle packet")
+
 type unhandledError int
 
 func (u unhandledError) Error() string {
 	return fmt.Sprintf("LIFX device can't handle packet type %d", u)
 }
 
+func (u unhandledError) Is(target error) bool { return target == ErrUnhandled }
+
 func (d *Device) oneRPC(ctx context.Context, reqType, respType msgType, reqBody []byte, resRequired, ackRequired bool) ([]byte, error) {
-	seq := d.seq
-	d.seq++
-
-	var hdr header
-	hdr.frameHeader.source = d.client.source
-	copy(hdr.frameAddress.target[0:6], d.Serial[:])
-	hdr.frameAddress.resRequired = resRequired
-	hdr.frameAddress.ackRequired = ackRequired
-	hdr.frameAddress.sequence = seq
-	hdr.protocolHeader.typ = uint16(reqType)
-	msg := encodeMessage(hdr, reqBody)
-
-	var respHdr header
+	if err := d.breakerCheck(); err != nil {
+		return nil, err
+	}
+	resp, err := d.rawRPC(ctx, reqType, respType, reqBody, resRequired, ackRequired)
+	d.breakerRecord(err)
+	return resp, err
+}
+
+// rawRPC is like oneRPC, but bypasses the circuit breaker.
+func (d *Device) rawRPC(ctx context.Context, reqType, respType msgType, reqBody []byte, resRequired, ackRequired bool) ([]byte, error) {
+	return d.rawRPCParts(ctx, reqType, respType, reqBody, resRequired, ackRequired, nil)
+}
+
+// rawRPCParts is like rawRPC, but passes more to exchangeParts.
+func (d *Device) rawRPCParts(ctx context.Context, reqType, respType msgType, reqBody []byte, resRequired, ackRequired bool, more func(protocol.Header, []byte) bool) ([]byte, error) {
+	seq, msg := d.encodeRequest(reqType, reqBody, resRequired, ackRequired)
+	ctx, rt := d.startRequest(ctx, reqType, respType, reqBody)
+
+	var respHdr protocol.Header
 	var respBody []byte
-	err := d.retry(ctx, func(ctx context.Context) error {
-		conn, err := udpConn(ctx)
+	attempt := 0
+	err := d.retry(ctx, func(ctx context.Context) (err error) {
+		attempt++
+		t0 := time.Now()
+		respHdr, respBody, err = d.exchangeParts(ctx, msg, more)
+		d.logExchange(ctx, reqType, seq, attempt, time.Since(t0), err)
 		if err != nil {
-			return err
+			rt.AttemptFailed(attempt, err)
 		}
-		defer conn.Close()
-
-		if _, err := conn.WriteToUDP(msg, &d.Addr); err != nil {
-			return fmt.Errorf("sending message: %v", err)
-		}
-
-		respHdr, respBody, _, err = readOnePacket(conn)
 		return err
 	})
+	if err != nil {
+		d.log(ctx, slog.LevelWarn, "LIFX request failed",
+			slog.String("type", reqType.String()), slog.Int("attempts", attempt), slog.Any("error", err))
+	} else {
+		err = d.checkResponse(respHdr, seq, reqType, respType)
+	}
+	rt.End(attempt, len(respBody), err)
 	if err != nil {
 		return nil, err
 	}
+	return respBody, nil
+}
+
+// encodeRequest encodes a message addressed to this device,
+// allocating a new sequence number for it.
+func (d *Device) encodeRequest(reqType msgType, reqBody []byte, resRequired, ackRequired bool) (seq uint8, msg []byte) {
+	seq = d.client.dispatcher.nextSeq(d.Serial)
+
+	var hdr protocol.Header
+	hdr.Source = d.client.source
+	copy(hdr.Target[0:6], d.Serial[:])
+	hdr.ResRequired = resRequired
+	hdr.AckRequired = ackRequired
+	hdr.Sequence = seq
+	hdr.Type = reqType
+	return seq, protocol.Encode(hdr, reqBody)
+}
+
+// exchange makes a single attempt at sending msg and waiting for the response,
+// which is received on the client's persistent connection.
+func (d *Device) exchange(ctx context.Context, msg []byte) (protocol.Header, []byte, error) {
+	return d.exchangeParts(ctx, msg, nil)
+}
+
+// exchangeParts is like exchange, for requests that may be answered with several messages.
+// If more is non-nil, each response is passed to it, and exchangeParts keeps waiting
+// while it reports that further responses are due; the last one is returned.
+func (d *Device) exchangeParts(ctx context.Context, msg []byte, more func(protocol.Header, []byte) bool) (protocol.Header, []byte, error) {
+	c := d.client
+	if err := c.admit(d.Serial, &d.Addr); err != nil {
+		return protocol.Header{}, nil, err
+	}
+
+	// The request's header says which response to wait for.
+	hdr, _, err := protocol.Decode(msg)
+	if err != nil {
+		return protocol.Header{}, nil, fmt.Errorf("decoding request: %w", err)
+	}
+	// A request with res_required set wants the state response, even if it also
+	// asks for an acknowledgement; the state response implies receipt anyway.
+	w := c.dispatcher.register(d, hdr.Sequence, hdr.ResRequired)
+	defer c.dispatcher.unregister(d, hdr.Sequence, w)
 
-	if respHdr.frameHeader.source != d.client.source {
-		return nil, fmt.Errorf("received message source 0x%x (want 0x%x)", respHdr.frameHeader.source, d.client.source)
+	if _, err := c.conn.WriteTo(msg, &d.Addr); err != nil {
+		return protocol.Header{}, nil, fmt.Errorf("sending message: %v", err)
 	}
-	switch rt := msgType(respHdr.protocolHeader.typ); rt {
+
+	for {
+		select {
+		case resp := <-w.ch:
+			if more == nil || !more(resp.hdr, resp.payload) {
+				return resp.hdr, resp.payload, nil
+			}
+		case <-ctx.Done():
+			return protocol.Header{}, nil, ctx.Err()
+		case <-c.readDone:
+			return protocol.Header{}, nil, c.readErr
+		}
+	}
+}
+
+// checkResponse verifies that a response matches the request that was sent.
+func (d *Device) checkResponse(respHdr protocol.Header, seq uint8, reqType, respType msgType) error {
+	if respHdr.Source != d.client.source {
+		return fmt.Errorf("received message source 0x%x (want 0x%x)", respHdr.Source, d.client.source)
+	}
+	switch rt := respHdr.Type; rt {
 	case respType:
 		// This is what we want.
 	case pktStateUnhandled:
-		return nil, unhandledError(reqType)
+		return unhandledError(reqType)
 	default:
-		return nil, fmt.Errorf("received message type %d (want %d)", rt, respType)
+		return fmt.Errorf("received message type %d (want %d)", rt, respType)
 	}
-	if respHdr.frameAddress.sequence != seq {
-		return nil, fmt.Errorf("received message with seq %d (want %d)", respHdr.frameAddress.sequence, seq)
+	if respHdr.Sequence != seq {
+		return fmt.Errorf("received message with seq %d (want %d)", respHdr.Sequence, seq)
 	}
-
-	return respBody, nil
+	return nil
 }
 
 // query sends a request and waits for a response.
 func (d *Device) query(ctx context.Context, reqType, respType msgType, reqBody []byte) ([]byte, error) {
-	return d.oneRPC(ctx, reqType, respType, reqBody, true, false)
+	if reqBody == nil {
+		if payload, ok := d.cacheGet(reqType); ok {
+			return payload, nil
+		}
+	}
+	payload, err := d.oneRPC(ctx, reqType, respType, reqBody, true, false)
+	if err == nil && reqBody == nil {
+		d.cachePut(reqType, payload)
+	}
+	return payload, err
+}
+
+// queryParts is like query, for requests that the device answers with
+// several messages of type respType. Each of their payloads is passed to add,
+// which reports whether more are due.
+func (d *Device) queryParts(ctx context.Context, reqType, respType msgType, add func(payload []byte) (more bool, err error)) error {
+	if parts, ok := d.cacheGetParts(reqType); ok {
+		more := true
+		for _, payload := range parts {
+			var err error
+			if more, err = add(payload); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+		// The cached parts were incomplete; ask the device.
+	}
+
+	if err := d.breakerCheck(); err != nil {
+		return err
+	}
+	var parts [][]byte
+	var addErr error
+	more := func(hdr protocol.Header, payload []byte) bool {
+		if hdr.Type != respType || addErr != nil {
+			return false
+		}
+		parts = append(parts, payload)
+		more, err := add(payload)
+		addErr = err
+		return more && err == nil
+	}
+	_, err := d.rawRPCParts(ctx, reqType, respType, nil, true, false, more)
+	d.breakerRecord(err)
+	if err == nil {
+		err = addErr
+	}
+	if err == nil {
+		d.cachePutParts(reqType, parts)
+	}
+	return err
 }
 
 // set performs an operation and waits for an acknowledgement.
 func (d *Device) set(ctx context.Context, reqType msgType, reqBody []byte) error {
+	je := d.capture(ctx, reqType)
+	d.cacheInvalidate()
 	_, err := d.oneRPC(ctx, reqType, pktAcknowledgement, reqBody, false, true)
+	if err == nil {
+		d.journal(je)
+	}
 	return err
 }
 
+// setVerified performs an operation, requesting both an acknowledgement
+// and the state response of type respType, and returns the latter.
+func (d *Device) setVerified(ctx context.Context, reqType, respType msgType, reqBody []byte) ([]byte, error) {
+	je := d.capture(ctx, reqType)
+	d.cacheInvalidate()
+	payload, err := d.oneRPC(ctx, reqType, respType, reqBody, true, true)
+	if err == nil {
+		d.journal(je)
+	}
+	return payload, err
+}
+
 func uint32Millis(d time.Duration) (uint32, error) {
 	dur := d.Milliseconds()
 	if dur < 0 || dur > math.MaxUint32 {
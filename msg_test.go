@@ -0,0 +1,227 @@
+package lifx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMembershipRoundTrip(t *testing.T) {
+	for _, m := range []Membership{
+		{ID: [16]byte{1, 2, 3, 15: 16}, Label: "Living Room", UpdatedAt: time.Unix(1700000000, 123456789)},
+		{Label: "Never updated"},
+	} {
+		payload, err := m.encode()
+		if err != nil {
+			t.Fatalf("encode(%+v): %v", m, err)
+		}
+		got, err := decodeMembership(pktStateGroup, payload)
+		if err != nil {
+			t.Fatalf("decodeMembership: %v", err)
+		}
+		if got.ID != m.ID || got.Label != m.Label || !got.UpdatedAt.Equal(m.UpdatedAt) {
+			t.Errorf("round trip of %+v gave %+v", m, got)
+		}
+	}
+	if _, err := decodeMembership(pktStateGroup, make([]byte, 10)); err == nil {
+		t.Errorf("decodeMembership of short payload succeeded")
+	}
+}
+
+func TestEncodeSkewRatio(t *testing.T) {
+	if got, err := encodeSkewRatio(nil); err != nil || got != 0 {
+		t.Errorf("encodeSkewRatio(nil) = %d, %v; want 0, nil", got, err)
+	}
+	tests := []struct {
+		in   float32
+		want int16
+	}{
+		{0, -32768},
+		{1, 32767},
+		{0.5, 0},
+		{0.25, -16384},
+	}
+	for _, tc := range tests {
+		in := tc.in
+		got, err := encodeSkewRatio(&in)
+		if err != nil || got != tc.want {
+			t.Errorf("encodeSkewRatio(%v) = %d, %v; want %d, nil", tc.in, got, err, tc.want)
+		}
+	}
+	bad := float32(1.5)
+	if _, err := encodeSkewRatio(&bad); err == nil {
+		t.Errorf("encodeSkewRatio(1.5) succeeded")
+	}
+}
+
+func TestStateJSON(t *testing.T) {
+	ir := uint16(0x8000)
+	state := State{
+		power: 0xFFFF,
+		color: Color{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 3500},
+		label: "Strip",
+
+		infrared: &ir,
+		zones:    []Color{{Hue: 10, Kelvin: 2700}, {Hue: 20, Kelvin: 2700}},
+		effect: &MultiZoneEffectConfig{
+			Type:      MultiZoneEffectMove,
+			Direction: MoveLeft,
+			Speed:     3 * time.Second,
+		},
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var got State
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("State JSON round trip via %s\n got %+v\nwant %+v", b, got, state)
+	}
+
+	if err := json.Unmarshal([]byte(`{"version":99,"power":0}`), &got); err == nil {
+		t.Errorf("json.Unmarshal of future State version succeeded, want error")
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	// Nothing is serving this connection, so requests go unanswered.
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	dev := client.NewDevice(*conn.LocalAddr().(*net.UDPAddr), [6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBB, 0xD1})
+	dev.Retry = &RetryPolicy{Base: 10 * time.Millisecond, Multiplier: 2, Max: 40 * time.Millisecond, MaxAttempts: 3, Jitter: 0.1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = dev.GetLabel(ctx)
+	if err == nil || ctx.Err() != nil {
+		t.Fatalf("GetLabel = %v with context error %v; want failure before the context expires", err, ctx.Err())
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetLabel = %v, want an error wrapping context.DeadlineExceeded", err)
+	}
+}
+
+// cacheTestLight is a minimal VirtualLight.
+type cacheTestLight struct {
+	mu    sync.Mutex
+	power uint16
+	color Color
+}
+
+func (l *cacheTestLight) Power() uint16 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.power
+}
+
+func (l *cacheTestLight) SetPower(level uint16, _ time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.power = level
+}
+
+func (l *cacheTestLight) Color() Color {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.color
+}
+
+func (l *cacheTestLight) SetColor(c Color, _ time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.color = c
+}
+
+// newCacheTestDevice serves a virtual device labelled "before",
+// and returns it along with a Device for it using the given cache.
+func newCacheTestDevice(t *testing.T, cc *CacheConfig) (*VirtualDevice, *Device, context.Context) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	vd := &VirtualDevice{Serial: [6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBB, 0xD2}, Light: &cacheTestLight{}}
+	vd.SetLabel("before")
+	go vd.Serve(conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	dev := client.NewDevice(*conn.LocalAddr().(*net.UDPAddr), vd.Serial)
+	dev.Cache = cc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return vd, dev, ctx
+}
+
+// checkLabel checks the result of dev.GetLabel.
+func checkLabel(ctx context.Context, t *testing.T, dev *Device, when, want string) {
+	t.Helper()
+	if got, err := dev.GetLabel(ctx); err != nil || got != want {
+		t.Errorf("%s, GetLabel = %q, %v; want %q, nil", when, got, err, want)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	vd, dev, ctx := newCacheTestDevice(t, &CacheConfig{Label: 100 * time.Millisecond})
+	checkLabel(ctx, t, dev, "Initially", "before")
+	vd.SetLabel("after")
+	checkLabel(ctx, t, dev, "Within the TTL", "before")
+	time.Sleep(150 * time.Millisecond)
+	checkLabel(ctx, t, dev, "After the TTL", "after")
+}
+
+func TestCacheInvalidatedBySet(t *testing.T) {
+	vd, dev, ctx := newCacheTestDevice(t, &CacheConfig{Label: time.Minute})
+	checkLabel(ctx, t, dev, "Initially", "before")
+	vd.SetLabel("after")
+	if err := dev.SetPower(ctx, 0xFFFF); err != nil {
+		t.Fatalf("SetPower: %v", err)
+	}
+	checkLabel(ctx, t, dev, "After SetPower", "after")
+}
+
+func TestCacheDisabled(t *testing.T) {
+	for _, cc := range []*CacheConfig{nil, {}} {
+		vd, dev, ctx := newCacheTestDevice(t, cc)
+		checkLabel(ctx, t, dev, "Initially", "before")
+		vd.SetLabel("after")
+		checkLabel(ctx, t, dev, fmt.Sprintf("With cache %+v", cc), "after")
+	}
+}
+
+func TestCacheCopies(t *testing.T) {
+	_, dev, ctx := newCacheTestDevice(t, &CacheConfig{Label: time.Minute})
+	for i := 0; i < 2; i++ {
+		// The first result is from the device, and the second from the cache.
+		payload, err := dev.query(ctx, pktGetLabel, pktStateLabel, nil)
+		if err != nil {
+			t.Fatalf("GetLabel: %v", err)
+		}
+		copy(payload, "scribbled")
+	}
+	checkLabel(ctx, t, dev, "After modifying returned payloads", "before")
+}
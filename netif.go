@@ -0,0 +1,131 @@
+package lifx
+
+import (
+	"fmt"
+	"net"
+)
+
+// WithBroadcastAddr sets the address that discovery and other broadcast
+// messages are sent to. The default is the limited broadcast address,
+// 255.255.255.255, which only reaches the network that the OS routes it to.
+// A directed broadcast address (e.g. 192.168.1.255) can reach a specific network.
+// If the address has no port, the standard LIFX port is used.
+func WithBroadcastAddr(addr *net.UDPAddr) Option {
+	return func(c *Client) {
+		a := *addr
+		if a.Port == 0 {
+			a.Port = stdPort
+		}
+		c.broadcastAddrs = []*net.UDPAddr{&a}
+	}
+}
+
+// WithInterface restricts the client to the named network interface,
+// binding its sockets to the interface's IPv4 address and,
+// unless WithBroadcastAddr is also given, broadcasting to its network's
+// broadcast address. It has no effect on a client with a custom Transport.
+//
+// NewClient fails if the interface doesn't exist or has no IPv4 address.
+func WithInterface(name string) Option {
+	return func(c *Client) { c.iface = name }
+}
+
+// WithAllInterfaces makes the client broadcast on every network interface,
+// sending to each one's broadcast address, so that devices on all attached
+// networks are discovered. Interfaces are enumerated afresh for each broadcast.
+// This overrides WithBroadcastAddr.
+func WithAllInterfaces() Option {
+	return func(c *Client) { c.allInterfaces = true }
+}
+
+// broadcastDsts returns the addresses that broadcasts should be sent to.
+func (c *Client) broadcastDsts() []*net.UDPAddr {
+	if c.allInterfaces {
+		if dsts := allInterfaceBroadcasts(); len(dsts) > 0 {
+			return dsts
+		}
+		// Fall through to the default; perhaps the OS knows better.
+	}
+	if c.broadcastAddrs != nil {
+		return c.broadcastAddrs
+	}
+	return []*net.UDPAddr{defaultBroadcastAddr}
+}
+
+// allInterfaceBroadcasts returns the broadcast address of each IPv4 network
+// on each up, non-loopback, broadcast-capable interface.
+func allInterfaceBroadcasts() []*net.UDPAddr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var dsts []*net.UDPAddr
+	seen := make(map[string]bool)
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 || ifi.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok || ipn.IP.To4() == nil {
+				continue
+			}
+			bcast := directedBroadcast(&net.IPNet{IP: ipn.IP.To4(), Mask: ipn.Mask[len(ipn.Mask)-4:]})
+			if seen[bcast.String()] {
+				continue
+			}
+			seen[bcast.String()] = true
+			dsts = append(dsts, &net.UDPAddr{IP: bcast, Port: stdPort})
+		}
+	}
+	return dsts
+}
+
+// defaultBroadcastAddr is where broadcasts go by default.
+var defaultBroadcastAddr = &net.UDPAddr{IP: net.IPv4bcast, Port: stdPort}
+
+// applyInterface configures the client for the interface named by WithInterface.
+func (c *Client) applyInterface() error {
+	ifi, err := net.InterfaceByName(c.iface)
+	if err != nil {
+		return fmt.Errorf("finding interface: %w", err)
+	}
+	ipn, err := interfaceIPv4(ifi)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.transport.(udpTransport); ok {
+		c.transport = udpTransport{ip: ipn.IP}
+	}
+	if c.broadcastAddrs == nil {
+		c.broadcastAddrs = []*net.UDPAddr{{IP: directedBroadcast(ipn), Port: stdPort}}
+	}
+	return nil
+}
+
+// interfaceIPv4 returns the first IPv4 network of the interface.
+func interfaceIPv4(ifi *net.Interface) (*net.IPNet, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing addresses of interface %s: %w", ifi.Name, err)
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok && ipn.IP.To4() != nil {
+			return &net.IPNet{IP: ipn.IP.To4(), Mask: ipn.Mask[len(ipn.Mask)-4:]}, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+}
+
+// directedBroadcast returns the broadcast address of an IPv4 network.
+func directedBroadcast(ipn *net.IPNet) net.IP {
+	ip := make(net.IP, 4)
+	for i := range ip {
+		ip[i] = ipn.IP[i] | ^ipn.Mask[i]
+	}
+	return ip
+}
@@ -0,0 +1,27 @@
+package lifx
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDirectedBroadcast(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"192.168.1.23/24", "192.168.1.255"},
+		{"10.0.20.5/22", "10.0.23.255"},
+		{"172.16.0.1/32", "172.16.0.1"},
+	}
+	for _, tc := range tests {
+		ip, ipn, err := net.ParseCIDR(tc.cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%q): %v", tc.cidr, err)
+		}
+		ipn.IP = ip.To4()
+		if got := directedBroadcast(ipn); got.String() != tc.want {
+			t.Errorf("directedBroadcast(%s) = %v, want %v", tc.cidr, got, tc.want)
+		}
+	}
+}
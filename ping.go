@@ -0,0 +1,170 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// pingTimeout is how long Ping waits for each echo response.
+const pingTimeout = 1 * time.Second
+
+// PingStats summarises the result of Ping.
+type PingStats struct {
+	Sent, Received int
+	Min, Avg, Max  time.Duration // only valid if Received > 0
+}
+
+// Loss returns the fraction of echo requests that went unanswered.
+func (ps PingStats) Loss() float64 {
+	if ps.Sent == 0 {
+		return 0
+	}
+	return float64(ps.Sent-ps.Received) / float64(ps.Sent)
+}
+
+func (ps PingStats) String() string {
+	s := fmt.Sprintf("%d sent, %d received, %.1f%% loss", ps.Sent, ps.Received, ps.Loss()*100)
+	if ps.Received > 0 {
+		s += fmt.Sprintf(", rtt min/avg/max = %v/%v/%v", ps.Min, ps.Avg, ps.Max)
+	}
+	return s
+}
+
+// Ping sends n EchoRequest messages to the device, one at a time,
+// and reports round trip time statistics.
+// For a single measurement that retries lost packets, use Echo.
+//
+// Unlike other operations, lost packets are not retried; they are counted as loss.
+// Ping stops early if the context is done, returning the statistics so far
+// along with the context's error.
+func (d *Device) Ping(ctx context.Context, n int) (PingStats, error) {
+	var ps PingStats
+	var total time.Duration
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return ps, err
+		}
+		ps.Sent++
+		rtt, err := d.echoOnce(ctx, i)
+		if err != nil {
+			var neterr net.Error
+			if errors.As(err, &neterr) && neterr.Timeout() {
+				d.tracef(ctx, "LIFX echo %d timed out", i)
+				continue
+			}
+			return ps, err
+		}
+		ps.Received++
+		total += rtt
+		if ps.Received == 1 || rtt < ps.Min {
+			ps.Min = rtt
+		}
+		if rtt > ps.Max {
+			ps.Max = rtt
+		}
+		ps.Avg = total / time.Duration(ps.Received)
+	}
+	return ps, nil
+}
+
+// Echo sends an EchoRequest with the given payload to the device,
+// and returns the round trip time of the successful attempt.
+// The device is expected to echo the payload verbatim.
+// This is a lightweight liveness and latency probe that doesn't change the device's state.
+//
+// Like other operations, Echo retries lost packets until the context is done.
+// Use Ping to measure packet loss instead.
+func (d *Device) Echo(ctx context.Context, payload [64]byte) (time.Duration, error) {
+	if err := d.breakerCheck(); err != nil {
+		return 0, err
+	}
+	var rtt time.Duration
+	err := d.retry(ctx, func(ctx context.Context) (err error) {
+		rtt, err = d.echo(ctx, payload[:])
+		return err
+	})
+	d.breakerRecord(err)
+	return rtt, err
+}
+
+// echoOnce performs a single echo exchange without retries.
+func (d *Device) echoOnce(ctx context.Context, i int) (time.Duration, error) {
+	// The payload is echoed verbatim; make it unique so stale responses are detectable.
+	payload := make([]byte, 64)
+	copy(payload, "lifx ping")
+	binary.LittleEndian.PutUint64(payload[16:24], uint64(i))
+	binary.LittleEndian.PutUint64(payload[24:32], uint64(time.Now().UnixNano()))
+
+	if err := d.rateWait(ctx); err != nil {
+		return 0, err
+	}
+	sub, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return d.echo(sub, payload)
+}
+
+// echo performs a single echo exchange.
+func (d *Device) echo(ctx context.Context, payload []byte) (time.Duration, error) {
+	seq, msg := d.encodeRequest(pktEchoRequest, payload, true, false)
+
+	t0 := time.Now()
+	hdr, resp, err := d.exchange(ctx, msg)
+	rtt := time.Since(t0)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.checkResponse(hdr, seq, pktEchoRequest, pktEchoResponse); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(resp, payload) {
+		return 0, fmt.Errorf("EchoResponse payload mismatch")
+	}
+	return rtt, nil
+}
+
+// Bounds on the interval between probes in WaitForOnline.
+const (
+	minOnlineProbeInterval = 500 * time.Millisecond
+	maxOnlineProbeInterval = 5 * time.Second
+)
+
+// WaitForOnline blocks until the device responds to an EchoRequest,
+// or the context is done. It is useful after a power outage or reboot,
+// or for lights controlled by a wall switch.
+//
+// Probes are sent with increasing intervals, up to 5s apart.
+// If the device has a circuit breaker configured, it is reset once the device responds.
+func (d *Device) WaitForOnline(ctx context.Context) error {
+	interval := minOnlineProbeInterval
+	for i := 0; ; i++ {
+		_, err := d.echoOnce(ctx, i)
+		if err == nil {
+			d.breakerRecord(nil)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryableErr(err) {
+			return err
+		}
+		d.tracef(ctx, "LIFX device %x not yet online (probe %d)", d.Serial, i)
+
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		interval *= 2
+		if interval > maxOnlineProbeInterval {
+			interval = maxOnlineProbeInterval
+		}
+	}
+}
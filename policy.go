@@ -0,0 +1,77 @@
+package lifx
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// Policy restricts which devices a Client will communicate with.
+// This is a defence against spoofed packets on networks shared with
+// untrusted hosts.
+//
+// When a policy is in effect, requests to devices outside the policy fail
+// with a *PolicyError, responses from outside the policy are ignored, and
+// responses to requests are only accepted from the address and serial of
+// the device they were sent to.
+type Policy struct {
+	// Serials, if non-empty, lists the only devices that may be communicated with.
+	Serials [][6]byte
+	// Networks, if non-empty, lists the only networks that devices may be on.
+	Networks []*net.IPNet
+}
+
+// WithPolicy restricts the client to the devices allowed by the policy.
+func WithPolicy(p Policy) Option {
+	return func(c *Client) { c.policy = &p }
+}
+
+// PolicyError is returned when an operation is disallowed by a client's Policy.
+type PolicyError struct {
+	Serial [6]byte
+	Addr   net.UDPAddr
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("LIFX device %x at %v is not allowed by policy", e.Serial, &e.Addr)
+}
+
+func (p *Policy) allows(serial [6]byte, ip net.IP) bool {
+	if len(p.Serials) > 0 {
+		ok := false
+		for _, s := range p.Serials {
+			if s == serial {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(p.Networks) > 0 {
+		for _, n := range p.Networks {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// admit returns an error if the client's policy doesn't allow
+// communication with the device.
+func (c *Client) admit(serial [6]byte, addr *net.UDPAddr) error {
+	if c.policy == nil || c.policy.allows(serial, addr.IP) {
+		return nil
+	}
+	return &PolicyError{Serial: serial, Addr: *addr}
+}
+
+// fromSelf reports whether a received packet appears to come from the device.
+func (d *Device) fromSelf(hdr protocol.Header, raddr *net.UDPAddr) bool {
+	return [6]byte(hdr.Target[0:6]) == d.Serial &&
+		raddr.IP.Equal(d.Addr.IP) && raddr.Port == d.Addr.Port
+}
@@ -0,0 +1,90 @@
+package lifx
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+func TestPolicyAdmit(t *testing.T) {
+	serialA := [6]byte{0xd0, 0x73, 0xd5, 0, 0, 1}
+	serialB := [6]byte{0xd0, 0x73, 0xd5, 0, 0, 2}
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	_, lab, _ := net.ParseCIDR("10.0.0.0/8")
+	inLAN := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: stdPort}
+	inLab := &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: stdPort}
+	outside := &net.UDPAddr{IP: net.IPv4(192, 168, 2, 20), Port: stdPort}
+
+	tests := []struct {
+		desc   string
+		policy *Policy
+		serial [6]byte
+		addr   *net.UDPAddr
+		ok     bool
+	}{
+		{"no policy", nil, serialB, outside, true},
+		{"empty policy", &Policy{}, serialB, outside, true},
+
+		{"allowed serial", &Policy{Serials: [][6]byte{serialA}}, serialA, outside, true},
+		{"disallowed serial", &Policy{Serials: [][6]byte{serialA}}, serialB, inLAN, false},
+		{"second allowed serial", &Policy{Serials: [][6]byte{serialA, serialB}}, serialB, outside, true},
+
+		{"allowed network", &Policy{Networks: []*net.IPNet{lan}}, serialB, inLAN, true},
+		{"disallowed network", &Policy{Networks: []*net.IPNet{lan}}, serialA, outside, false},
+		{"second allowed network", &Policy{Networks: []*net.IPNet{lan, lab}}, serialA, inLab, true},
+
+		{"both allowed", &Policy{Serials: [][6]byte{serialA}, Networks: []*net.IPNet{lan}}, serialA, inLAN, true},
+		{"serial allowed, network not", &Policy{Serials: [][6]byte{serialA}, Networks: []*net.IPNet{lan}}, serialA, outside, false},
+		{"network allowed, serial not", &Policy{Serials: [][6]byte{serialA}, Networks: []*net.IPNet{lan}}, serialB, inLAN, false},
+	}
+	for _, tc := range tests {
+		c := &Client{policy: tc.policy}
+		err := c.admit(tc.serial, tc.addr)
+		if tc.ok {
+			if err != nil {
+				t.Errorf("%s: admit(%x, %v) = %v, want nil", tc.desc, tc.serial, tc.addr, err)
+			}
+			continue
+		}
+		var pe *PolicyError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: admit(%x, %v) = %v, want *PolicyError", tc.desc, tc.serial, tc.addr, err)
+			continue
+		}
+		if pe.Serial != tc.serial || pe.Addr.String() != tc.addr.String() {
+			t.Errorf("%s: PolicyError for %x at %v, want %x at %v", tc.desc, pe.Serial, &pe.Addr, tc.serial, tc.addr)
+		}
+	}
+}
+
+func TestFromSelf(t *testing.T) {
+	d := &Device{
+		Addr:   net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: stdPort},
+		Serial: [6]byte{0xd0, 0x73, 0xd5, 0, 0, 1},
+	}
+	target := func(serial [6]byte) (tgt [8]byte) {
+		copy(tgt[:], serial[:])
+		return
+	}
+
+	tests := []struct {
+		desc   string
+		serial [6]byte
+		addr   *net.UDPAddr
+		want   bool
+	}{
+		{"self", d.Serial, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: stdPort}, true},
+		{"self, 16-byte IP", d.Serial, &net.UDPAddr{IP: net.ParseIP("::ffff:192.168.1.20"), Port: stdPort}, true},
+		{"other serial", [6]byte{0xd0, 0x73, 0xd5, 0, 0, 2}, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: stdPort}, false},
+		{"other IP", d.Serial, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 21), Port: stdPort}, false},
+		{"other port", d.Serial, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: stdPort + 1}, false},
+	}
+	for _, tc := range tests {
+		hdr := protocol.Header{Target: target(tc.serial), Type: protocol.StateLabel}
+		if got := d.fromSelf(hdr, tc.addr); got != tc.want {
+			t.Errorf("%s: fromSelf(%x, %v) = %t, want %t", tc.desc, tc.serial, tc.addr, got, tc.want)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package lifx
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
+	"sync"
 )
 
 // products.json, from https://github.com/LIFX/products
@@ -16,14 +21,104 @@ var rawProductsJSON []byte
 //
 // The data is decoded from a version of https://github.com/LIFX/products
 // embedded in this package.
+//
+// Deprecated: Use CurrentProducts and SetProductsFile, which are safe for concurrent use.
+// SetProductsFile does not change ProductsFile. Data assigned to ProductsFile is still
+// used by Device.Product and AuditFirmware, but only until SetProductsFile is first called.
 var ProductsFile []VendorProducts
 
+// productsFile is the data set by SetProductsFile, or nil if it hasn't been called.
+var productsFile []VendorProducts
+
+// productsMu guards productsFile.
+var productsMu sync.RWMutex
+
 func init() {
-	if err := json.Unmarshal(rawProductsJSON, &ProductsFile); err != nil {
+	var err error
+	ProductsFile, err = decodeProducts(rawProductsJSON)
+	if err != nil {
 		panic("internal error decoding products.json: " + err.Error())
 	}
 }
 
+// ProductsURL is the location of the latest products.json, for use with FetchProducts.
+const ProductsURL = "https://raw.githubusercontent.com/LIFX/products/master/products.json"
+
+// maxProductsSize limits how much FetchProducts will read.
+const maxProductsSize = 10 << 20
+
+// LoadProducts reads a products.json file, in the format of https://github.com/LIFX/products.
+// The result may be passed to DetermineProduct or SetProductsFile.
+func LoadProducts(r io.Reader) ([]VendorProducts, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeProducts(data)
+}
+
+// FetchProducts fetches a products.json file from url, such as ProductsURL.
+// The result may be passed to DetermineProduct or SetProductsFile.
+func FetchProducts(ctx context.Context, url string) ([]VendorProducts, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	file, err := LoadProducts(io.LimitReader(resp.Body, maxProductsSize))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	return file, nil
+}
+
+// SetProductsFile sets the products data used by Device.Product and AuditFirmware
+// in place of the embedded data.
+// Devices that have already determined their product are unaffected.
+// Setting nil goes back to using ProductsFile.
+func SetProductsFile(file []VendorProducts) {
+	productsMu.Lock()
+	defer productsMu.Unlock()
+	productsFile = file
+}
+
+// CurrentProducts returns the products data used by Device.Product and AuditFirmware,
+// in the format of https://github.com/LIFX/products.
+//
+// This is decoded from a version of that file embedded in this package,
+// unless replaced with SetProductsFile.
+func CurrentProducts() []VendorProducts {
+	productsMu.RLock()
+	defer productsMu.RUnlock()
+	if productsFile == nil {
+		return ProductsFile
+	}
+	return productsFile
+}
+
+func decodeProducts(data []byte) ([]VendorProducts, error) {
+	var file []VendorProducts
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding products: %w", err)
+	}
+	if len(file) == 0 {
+		return nil, fmt.Errorf("decoding products: no vendors")
+	}
+	for _, vp := range file {
+		if err := vp.validate(); err != nil {
+			return nil, fmt.Errorf("decoding products: vendor %d (%s): %w", vp.VID, vp.Name, err)
+		}
+	}
+	return file, nil
+}
+
 // VendorProducts represents a vendor and all their products.
 type VendorProducts struct {
 	VID  uint32 `json:"vid"`  // 1 == LIFX
@@ -33,21 +128,50 @@ type VendorProducts struct {
 	Products []Product           `json:"products"`
 }
 
+// validate checks the parts of the data that DetermineProduct relies on.
+func (vp VendorProducts) validate() error {
+	if err := vp.Defaults.validate(); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	for _, p := range vp.Products {
+		if err := p.Features.validate(); err != nil {
+			return fmt.Errorf("product %d (%s): %w", p.PID, p.Name, err)
+		}
+		for _, u := range p.Upgrades {
+			if err := u.Features.validate(); err != nil {
+				return fmt.Errorf("product %d (%s): upgrade %d.%d: %w", p.PID, p.Name, u.Major, u.Minor, err)
+			}
+		}
+	}
+	return nil
+}
+
 // ProductCapabilities represents the functional capabilities of a product.
 //
 // The fields in this structure are nullable because the data file has a
 // default layering semantic. Any Product returned through DetermineProduct is
 // guaranteed to set all fields, except where otherwise specified.
 type ProductCapabilities struct {
-	HEV    *bool `json:"hev,omitempty"`
-	Color  *bool `json:"color,omitempty"`
-	Matrix *bool `json:"matrix,omitempty"`
+	HEV      *bool `json:"hev,omitempty"`
+	Color    *bool `json:"color,omitempty"`
+	Chain    *bool `json:"chain,omitempty"`
+	Matrix   *bool `json:"matrix,omitempty"`
+	Relays   *bool `json:"relays,omitempty"`
+	Buttons  *bool `json:"buttons,omitempty"`
+	Infrared *bool `json:"infrared,omitempty"`
 
-	Multizone         *bool    `json:"multizone,omitempty"`
-	TemperatureRange  []uint16 `json:"temperature_range"` // should be two values (min and max); may be nil from DetermineProduct
+	Multizone *bool `json:"multizone,omitempty"`
+	// TemperatureRange should be two values (min and max); may be nil from DetermineProduct.
+	// The values are equal for products with a fixed color temperature.
+	TemperatureRange  []uint16 `json:"temperature_range"`
 	ExtendedMultizone *bool    `json:"extended_multizone,omitempty"`
 
-	// TODO: much more
+	// MinExtMZFirmware and MinExtMZFirmwareComponents identify the
+	// earliest firmware supporting extended multizone messages, as a build
+	// timestamp and as a (major, minor) version respectively.
+	// They are only set for multizone products, even by DetermineProduct.
+	MinExtMZFirmware           uint64   `json:"min_ext_mz_firmware,omitempty"`
+	MinExtMZFirmwareComponents []uint16 `json:"min_ext_mz_firmware_components,omitempty"`
 }
 
 func (pc ProductCapabilities) String() string {
@@ -59,15 +183,32 @@ func (pc ProductCapabilities) String() string {
 	}
 	checkBool(pc.HEV, "hev")
 	checkBool(pc.Color, "color")
+	checkBool(pc.Chain, "chain")
 	checkBool(pc.Matrix, "matrix")
+	checkBool(pc.Relays, "relays")
+	checkBool(pc.Buttons, "buttons")
+	checkBool(pc.Infrared, "infrared")
 	checkBool(pc.Multizone, "multizone")
-	if tr := pc.TemperatureRange; len(tr) > 0 {
+	if tr := pc.TemperatureRange; len(tr) == 2 {
 		s = append(s, fmt.Sprintf("temperature_range=[%d,%d]", tr[0], tr[1]))
 	}
 	checkBool(pc.ExtendedMultizone, "extended_multizone")
+	if v := pc.MinExtMZFirmwareComponents; len(v) == 2 {
+		s = append(s, fmt.Sprintf("min_ext_mz_firmware=%d.%d", v[0], v[1]))
+	}
 	return "{" + strings.Join(s, ",") + "}"
 }
 
+func (pc ProductCapabilities) validate() error {
+	if tr := pc.TemperatureRange; tr != nil && len(tr) != 2 {
+		return fmt.Errorf("temperature_range has %d values, want 2", len(tr))
+	}
+	if v := pc.MinExtMZFirmwareComponents; v != nil && len(v) != 2 {
+		return fmt.Errorf("min_ext_mz_firmware_components has %d values, want 2", len(v))
+	}
+	return nil
+}
+
 // merge applies values set in o.
 func (pc *ProductCapabilities) merge(o ProductCapabilities) {
 	copyBool := func(dst **bool, src *bool) {
@@ -82,13 +223,23 @@ func (pc *ProductCapabilities) merge(o ProductCapabilities) {
 
 	copyBool(&pc.HEV, o.HEV)
 	copyBool(&pc.Color, o.Color)
+	copyBool(&pc.Chain, o.Chain)
 	copyBool(&pc.Matrix, o.Matrix)
+	copyBool(&pc.Relays, o.Relays)
+	copyBool(&pc.Buttons, o.Buttons)
+	copyBool(&pc.Infrared, o.Infrared)
 
 	copyBool(&pc.Multizone, o.Multizone)
 	if tr := o.TemperatureRange; len(tr) > 0 {
 		pc.TemperatureRange = []uint16{tr[0], tr[1]}
 	}
 	copyBool(&pc.ExtendedMultizone, o.ExtendedMultizone)
+	if o.MinExtMZFirmware != 0 {
+		pc.MinExtMZFirmware = o.MinExtMZFirmware
+	}
+	if v := o.MinExtMZFirmwareComponents; len(v) > 0 {
+		pc.MinExtMZFirmwareComponents = []uint16{v[0], v[1]}
+	}
 }
 
 // Product represents information about a product.
@@ -104,12 +255,29 @@ type Product struct {
 }
 
 // DetermineProduct determines the product and its derived capabilities.
-// Use this rather than manually inspecting ProductsFile, which should be
-// passed as the first argument.
+// Use this rather than manually inspecting the products data. The first argument
+// should be the result of CurrentProducts, LoadProducts or FetchProducts.
 //
 // vendorID and productID arguments can be obtained with GetVersion,
 // and firmwareVersion can be obtained with GetHostFirmware.
 func DetermineProduct(file []VendorProducts, vendorID, productID uint32, firmwareVersion HostFirmware) (Product, error) {
+	product, err := LookupProduct(file, vendorID, productID)
+	if err != nil {
+		return Product{}, err
+	}
+	for _, u := range product.Upgrades {
+		// This logic seems wrong (majorX > majorY should ignore minorX and minorY),
+		// but this is what is documented.
+		if firmwareVersion.Major >= u.Major && firmwareVersion.Minor >= u.Minor {
+			product.Features.merge(u.Features)
+		}
+	}
+	return product, nil
+}
+
+// LookupProduct is like DetermineProduct, but without knowing the firmware version.
+// The product's features are those of its original firmware, without any upgrades applied.
+func LookupProduct(file []VendorProducts, vendorID, productID uint32) (Product, error) {
 	var vp *VendorProducts
 	for i := range file {
 		if file[i].VID == vendorID {
@@ -121,41 +289,118 @@ func DetermineProduct(file []VendorProducts, vendorID, productID uint32, firmwar
 		return Product{}, fmt.Errorf("unknown vendor ID %d", vendorID)
 	}
 
-	var product Product
-	var found bool
 	for _, p := range vp.Products {
 		if p.PID == productID {
-			product, found = p, true
-			break
+			return vp.resolve(p), nil
 		}
 	}
-	if !found {
-		return Product{}, fmt.Errorf("unknown product ID %d for vendor %d (%s)", productID, vendorID, vp.Name)
+	return Product{}, fmt.Errorf("unknown product ID %d for vendor %d (%s)", productID, vendorID, vp.Name)
+}
+
+// FindProductByName finds a product by its name, such as "LIFX Beam", ignoring case,
+// and returns it with its vendor ID. Its features are as for LookupProduct.
+// Several revisions of a product may share a name; the last listed, which is
+// generally the newest, is returned.
+func FindProductByName(file []VendorProducts, name string) (vendorID uint32, product Product, err error) {
+	for i := len(file) - 1; i >= 0; i-- {
+		vp := &file[i]
+		for j := len(vp.Products) - 1; j >= 0; j-- {
+			if p := vp.Products[j]; strings.EqualFold(p.Name, name) {
+				return vp.VID, vp.resolve(p), nil
+			}
+		}
 	}
+	return 0, Product{}, fmt.Errorf("unknown product %q", name)
+}
 
+// resolve returns p with its features layered over the vendor defaults.
+func (vp *VendorProducts) resolve(p Product) Product {
 	// Start with the default capabilities, then copy over the product capabilities.
-	// Finally, apply specific version upgrades.
+	// DetermineProduct then applies specific version upgrades.
 	cap := ProductCapabilities{
-		HEV:    boolPtr(false),
-		Color:  boolPtr(false),
-		Matrix: boolPtr(false),
+		HEV:      boolPtr(false),
+		Color:    boolPtr(false),
+		Chain:    boolPtr(false),
+		Matrix:   boolPtr(false),
+		Relays:   boolPtr(false),
+		Buttons:  boolPtr(false),
+		Infrared: boolPtr(false),
 
 		Multizone: boolPtr(false),
 		// no TemperatureRange default
 		ExtendedMultizone: boolPtr(false),
+		// no MinExtMZFirmware or MinExtMZFirmwareComponents default
 	}
 	cap.merge(vp.Defaults)
-	cap.merge(product.Features)
-	for _, u := range product.Upgrades {
-		// This logic seems wrong (majorX > majorY should ignore minorX and minorY),
-		// but this is what is documented.
-		if firmwareVersion.Major >= u.Major && firmwareVersion.Minor >= u.Minor {
-			cap.merge(u.Features)
-		}
+	cap.merge(p.Features)
+	p.Features = cap
+	return p
+}
+
+// Product determines the device's product and capabilities with DetermineProduct,
+// using the data returned by CurrentProducts.
+// The result is remembered for subsequent calls.
+func (d *Device) Product(ctx context.Context) (Product, error) {
+	d.productMu.Lock()
+	defer d.productMu.Unlock()
+	if d.product != nil {
+		return *d.product, nil
 	}
-	product.Features = cap
+	hf, err := d.GetHostFirmware(ctx)
+	if err != nil {
+		return Product{}, fmt.Errorf("GetHostFirmware: %w", err)
+	}
+	vendor, product, err := d.GetVersion(ctx)
+	if err != nil {
+		return Product{}, fmt.Errorf("GetVersion: %w", err)
+	}
+	p, err := DetermineProduct(CurrentProducts(), vendor, product, hf)
+	if err != nil {
+		return Product{}, err
+	}
+	d.product = &p
+	return p, nil
+}
 
-	return product, nil
+// ErrUnsupported is returned by methods that need a capability, named as in
+// products.json, that the device's product lacks. It is only returned once the
+// product is known, from an earlier call to Device.Product; until then, requests
+// are sent regardless, and devices lacking the capability typically reply with
+// an error matching ErrUnhandled.
+//
+// ErrUnsupported matches both ErrUnhandled and errors.ErrUnsupported (using errors.Is).
+type ErrUnsupported string
+
+func (e ErrUnsupported) Error() string {
+	return fmt.Sprintf("LIFX device does not support %s", string(e))
 }
 
+func (e ErrUnsupported) Is(target error) bool {
+	return target == ErrUnhandled || target == errors.ErrUnsupported
+}
+
+// requireFeature checks a capability of the device's product, if known,
+// returning ErrUnsupported(name) if it is lacking.
+func (d *Device) requireFeature(name string, feature func(ProductCapabilities) *bool) error {
+	d.productMu.Lock()
+	p := d.product
+	d.productMu.Unlock()
+	if p == nil {
+		return nil
+	}
+	if b := feature(p.Features); b != nil && !*b {
+		return ErrUnsupported(name)
+	}
+	return nil
+}
+
+// Feature accessors for requireFeature.
+func hasExtendedMultizone(pc ProductCapabilities) *bool { return pc.ExtendedMultizone }
+func hasMultizone(pc ProductCapabilities) *bool         { return pc.Multizone }
+func hasMatrix(pc ProductCapabilities) *bool            { return pc.Matrix }
+func hasInfrared(pc ProductCapabilities) *bool          { return pc.Infrared }
+func hasHEV(pc ProductCapabilities) *bool               { return pc.HEV }
+func hasRelays(pc ProductCapabilities) *bool            { return pc.Relays }
+func hasButtons(pc ProductCapabilities) *bool           { return pc.Buttons }
+
 func boolPtr(b bool) *bool { return &b }
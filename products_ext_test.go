@@ -0,0 +1,66 @@
+package lifx_test
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestUnsupported(t *testing.T) {
+	var sent atomic.Int32
+	hook := lifx.WithPacketHook(func(dir lifx.Direction, _ *net.UDPAddr, _ []byte) {
+		if dir == lifx.PacketSent {
+			sent.Add(1)
+		}
+	})
+	_, bd, ctx := newTestDevice(t, &lifxtest.Light{}, hook)
+	_, sd, _ := newTestDevice(t, lifxtest.NewStrip(16), hook)
+
+	// Until the product is known, the device is asked.
+	_, err := bd.GetInfrared(ctx)
+	if !errors.Is(err, lifx.ErrUnhandled) {
+		t.Errorf("GetInfrared on unknown product: got %v, want ErrUnhandled", err)
+	}
+	var eu lifx.ErrUnsupported
+	if errors.As(err, &eu) {
+		t.Errorf("GetInfrared on unknown product: got %v, want the device's error", err)
+	}
+
+	for _, d := range []*lifx.Device{bd, sd} {
+		if _, err := d.Product(ctx); err != nil {
+			t.Fatalf("Product: %v", err)
+		}
+	}
+	before := sent.Load()
+	for _, tc := range []struct {
+		feature string
+		f       func() error
+	}{
+		{"infrared", func() error { return bd.SetInfrared(ctx, 0xFFFF) }},
+		{"hev", func() error { _, err := bd.GetHevCycle(ctx); return err }},
+		{"extended_multizone", func() error { return bd.SetExtendedColorZones(ctx, 0, nil) }},
+		{"matrix", func() error { return bd.SetTileEffect(ctx, lifx.TileEffectConfig{}) }},
+		{"relays", func() error { return bd.SetRelayPower(ctx, 0, 0) }},
+		{"multizone", func() error { _, err := bd.GetZones(ctx); return err }},
+	} {
+		err := tc.f()
+		if !errors.As(err, &eu) || string(eu) != tc.feature {
+			t.Errorf("%s: got %v, want ErrUnsupported(%q)", tc.feature, err, tc.feature)
+		}
+		if !errors.Is(err, lifx.ErrUnhandled) || !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("%s: %v should match ErrUnhandled and errors.ErrUnsupported", tc.feature, err)
+		}
+	}
+	if n := sent.Load() - before; n != 0 {
+		t.Errorf("Unsupported requests sent %d packets, want 0", n)
+	}
+
+	// A supported capability still works.
+	if zones, err := sd.GetZones(ctx); err != nil || len(zones) != 16 {
+		t.Errorf("GetZones on strip = %d zones, %v; want 16 zones", len(zones), err)
+	}
+}
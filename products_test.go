@@ -1,8 +1,14 @@
 package lifx
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -30,13 +36,20 @@ func TestProducts(t *testing.T) {
 		Name: "LIFX Z",
 		Features: ProductCapabilities{
 			// DetermineProduct should set omitted entries to explicit false values.
-			HEV:    boolPtr(false),
-			Color:  boolPtr(true),
-			Matrix: boolPtr(false),
+			HEV:      boolPtr(false),
+			Color:    boolPtr(true),
+			Chain:    boolPtr(false),
+			Matrix:   boolPtr(false),
+			Relays:   boolPtr(false),
+			Buttons:  boolPtr(false),
+			Infrared: boolPtr(false),
 
 			Multizone:         boolPtr(true),
 			TemperatureRange:  []uint16{2500, 9000},
 			ExtendedMultizone: boolPtr(true),
+
+			MinExtMZFirmware:           1532997580,
+			MinExtMZFirmwareComponents: []uint16{2, 77},
 		},
 	}
 	if !reflect.DeepEqual(p, want) {
@@ -52,4 +65,160 @@ func TestProducts(t *testing.T) {
 	if got, want := p.Features.TemperatureRange, []uint16{1500, 9000}; !reflect.DeepEqual(got, want) {
 		t.Errorf("DetermineProduct on a higher firmware version gave wrong result for temperature_range.\n got %d, want %d", got, want)
 	}
+
+	// A switch has relays and buttons but no light.
+	p, err = DetermineProduct(ProductsFile, vid, 70, HostFirmware{Major: 3, Minor: 90})
+	if err != nil {
+		t.Fatalf("DetermineProduct: %v", err)
+	}
+	if got, want := p.Features.String(), "{relays,buttons}"; got != want {
+		t.Errorf("LIFX Switch has features %s, want %s", got, want)
+	}
+}
+
+func TestLookupProduct(t *testing.T) {
+	// LookupProduct gives the features before any firmware upgrades.
+	p, err := LookupProduct(CurrentProducts(), 1, 32) // LIFX Z
+	if err != nil {
+		t.Fatalf("LookupProduct: %v", err)
+	}
+	if *p.Features.ExtendedMultizone {
+		t.Errorf("LookupProduct of LIFX Z has extended_multizone from a firmware upgrade")
+	}
+	if got, want := p.Features.TemperatureRange, []uint16{2500, 9000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupProduct of LIFX Z has temperature_range %d, want %d", got, want)
+	}
+	if len(p.Upgrades) == 0 {
+		t.Errorf("LookupProduct of LIFX Z lost its upgrades")
+	}
+
+	if _, err := LookupProduct(CurrentProducts(), 1, 9999); err == nil {
+		t.Errorf("LookupProduct of unknown product succeeded")
+	}
+	if _, err := LookupProduct(CurrentProducts(), 99, 1); err == nil {
+		t.Errorf("LookupProduct of unknown vendor succeeded")
+	}
+}
+
+func TestFindProductByName(t *testing.T) {
+	vid, p, err := FindProductByName(CurrentProducts(), "lifx beam")
+	if err != nil {
+		t.Fatalf("FindProductByName: %v", err)
+	}
+	if vid != 1 || p.PID != 38 || p.Name != "LIFX Beam" || !*p.Features.Multizone {
+		t.Errorf("FindProductByName(lifx beam) = %d, %s", vid, mustJSON(t, p))
+	}
+
+	// There are two revisions of the LIFX Z (31 and 32); the newer should be found.
+	_, p, err = FindProductByName(CurrentProducts(), "LIFX Z")
+	if err != nil {
+		t.Fatalf("FindProductByName: %v", err)
+	}
+	if p.PID != 32 {
+		t.Errorf("FindProductByName(LIFX Z) found product %d, want 32", p.PID)
+	}
+
+	if _, _, err := FindProductByName(CurrentProducts(), "LIFX Toaster"); err == nil {
+		t.Errorf("FindProductByName of unknown product succeeded")
+	}
+}
+
+func TestClampKelvin(t *testing.T) {
+	pc := ProductCapabilities{TemperatureRange: []uint16{2500, 9000}}
+	for _, tc := range []struct{ in, want uint16 }{
+		{KelvinCandlelight, 2500},
+		{KelvinNeutral, KelvinNeutral},
+		{12000, 9000},
+	} {
+		if got := pc.ClampKelvin(tc.in); got != tc.want {
+			t.Errorf("ClampKelvin(%d) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+	if got := (ProductCapabilities{}).ClampKelvin(1000); got != 1000 {
+		t.Errorf("ClampKelvin(1000) with unknown range = %d, want 1000", got)
+	}
+}
+
+func TestLoadProducts(t *testing.T) {
+	file, err := LoadProducts(bytes.NewReader(rawProductsJSON))
+	if err != nil {
+		t.Fatalf("LoadProducts: %v", err)
+	}
+	if !reflect.DeepEqual(file, CurrentProducts()) {
+		t.Errorf("LoadProducts of the embedded data differs from CurrentProducts()")
+	}
+
+	for _, bad := range []string{
+		``,
+		`null`,
+		`[]`,
+		`{"vid": 1}`,
+		`[{"vid": 1, "products": [{"pid": 1, "features": {"temperature_range": [2500]}}]}]`,
+		`[{"vid": 1, "products": [{"pid": 1, "upgrades": [{"features": {"temperature_range": [1, 2, 3]}}]}]}]`,
+		`[{"vid": 1, "products": [{"pid": 1, "features": {"min_ext_mz_firmware_components": [2]}}]}]`,
+	} {
+		if _, err := LoadProducts(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadProducts(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestFetchProducts(t *testing.T) {
+	const newSKU = `[{"vid": 1, "name": "LIFX", "products": [{"pid": 9999, "name": "LIFX Future", "features": {"color": true}}]}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products.json" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, newSKU)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	file, err := FetchProducts(ctx, srv.URL+"/products.json")
+	if err != nil {
+		t.Fatalf("FetchProducts: %v", err)
+	}
+	p, err := DetermineProduct(file, 1, 9999, HostFirmware{})
+	if err != nil {
+		t.Fatalf("DetermineProduct with fetched data: %v", err)
+	}
+	if p.Name != "LIFX Future" || !*p.Features.Color {
+		t.Errorf("DetermineProduct with fetched data = %s", mustJSON(t, p))
+	}
+	if _, err := FetchProducts(ctx, srv.URL+"/missing.json"); err == nil {
+		t.Errorf("FetchProducts of missing file succeeded, want error")
+	}
+
+	defer SetProductsFile(nil)
+	SetProductsFile(file)
+	if _, err := DetermineProduct(CurrentProducts(), 1, 9999, HostFirmware{}); err != nil {
+		t.Errorf("After SetProductsFile, DetermineProduct: %v", err)
+	}
+}
+
+func TestProductsFileCompat(t *testing.T) {
+	orig := ProductsFile
+	defer func() { ProductsFile = orig }()
+	file, err := LoadProducts(strings.NewReader(`[{"vid": 1, "name": "LIFX", "products": [{"pid": 9999, "name": "LIFX Future"}]}]`))
+	if err != nil {
+		t.Fatalf("LoadProducts: %v", err)
+	}
+
+	// Assigning the deprecated var is still honoured.
+	ProductsFile = file
+	if _, err := LookupProduct(CurrentProducts(), 1, 9999); err != nil {
+		t.Errorf("After assigning ProductsFile, LookupProduct: %v", err)
+	}
+	ProductsFile = orig
+
+	// SetProductsFile takes precedence, and doesn't touch the var.
+	defer SetProductsFile(nil)
+	SetProductsFile(file)
+	if _, err := LookupProduct(CurrentProducts(), 1, 9999); err != nil {
+		t.Errorf("After SetProductsFile, LookupProduct: %v", err)
+	}
+	if !reflect.DeepEqual(ProductsFile, orig) {
+		t.Errorf("SetProductsFile changed ProductsFile")
+	}
 }
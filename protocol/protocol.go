@@ -0,0 +1,311 @@
+/*
+Package protocol implements the framing of the LIFX LAN protocol:
+message types, and the encoding and decoding of message headers.
+
+Most users should use the higher-level API of the lifx package.
+This package, together with Device.Send and Device.Request in that package,
+is for sending messages that the higher-level API doesn't cover.
+Payloads are the raw bytes described by the protocol documentation at
+https://lan.developer.lifx.com/docs/packet-contents.
+*/
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Type is a message type.
+type Type uint16
+
+// Message types.
+const (
+	GetService              Type = 2
+	StateService            Type = 3
+	GetHostFirmware         Type = 14
+	StateHostFirmware       Type = 15
+	GetWifiInfo             Type = 16
+	StateWifiInfo           Type = 17
+	GetPower                Type = 20
+	SetPower                Type = 21
+	StatePower              Type = 22
+	GetLabel                Type = 23
+	SetLabel                Type = 24
+	StateLabel              Type = 25
+	GetVersion              Type = 32
+	StateVersion            Type = 33
+	GetInfo                 Type = 34
+	StateInfo               Type = 35
+	SetReboot               Type = 38
+	Acknowledgement         Type = 45
+	GetLocation             Type = 48
+	SetLocation             Type = 49
+	StateLocation           Type = 50
+	GetGroup                Type = 51
+	SetGroup                Type = 52
+	StateGroup              Type = 53
+	EchoRequest             Type = 58
+	EchoResponse            Type = 59
+	GetColor                Type = 101
+	SetColor                Type = 102
+	SetWaveform             Type = 103
+	LightState              Type = 107
+	GetLightPower           Type = 116
+	SetLightPower           Type = 117
+	StateLightPower         Type = 118
+	SetWaveformOptional     Type = 119
+	GetInfrared             Type = 120
+	StateInfrared           Type = 121
+	SetInfrared             Type = 122
+	GetHevCycle             Type = 142
+	SetHevCycle             Type = 143
+	StateHevCycle           Type = 144
+	GetHevCycleConfig       Type = 145
+	SetHevCycleConfig       Type = 146
+	StateHevCycleConfig     Type = 147
+	GetLastHevCycleResult   Type = 148
+	StateLastHevCycleResult Type = 149
+	StateUnhandled          Type = 223
+	SetColorZones           Type = 501
+	GetColorZones           Type = 502
+	StateZone               Type = 503
+	StateMultiZone          Type = 506
+	GetMultiZoneEffect      Type = 507
+	SetMultiZoneEffect      Type = 508
+	StateMultiZoneEffect    Type = 509
+	SetExtendedColorZones   Type = 510
+	GetExtendedColorZones   Type = 511
+	StateExtendedColorZones Type = 512
+	GetDeviceChain          Type = 701
+	StateDeviceChain        Type = 702
+	SetUserPosition         Type = 703
+	Get64                   Type = 707
+	State64                 Type = 711
+	Set64                   Type = 715
+	GetTileEffect           Type = 718
+	SetTileEffect           Type = 719
+	StateTileEffect         Type = 720
+	GetRPower               Type = 816
+	SetRPower               Type = 817
+	StateRPower             Type = 818
+	GetButton               Type = 905
+	SetButton               Type = 906
+	StateButton             Type = 907
+	GetButtonConfig         Type = 909
+	SetButtonConfig         Type = 910
+	StateButtonConfig       Type = 911
+)
+
+var typeNames = map[Type]string{
+	GetService:              "GetService",
+	StateService:            "StateService",
+	GetHostFirmware:         "GetHostFirmware",
+	StateHostFirmware:       "StateHostFirmware",
+	GetWifiInfo:             "GetWifiInfo",
+	StateWifiInfo:           "StateWifiInfo",
+	GetPower:                "GetPower",
+	SetPower:                "SetPower",
+	StatePower:              "StatePower",
+	GetLabel:                "GetLabel",
+	SetLabel:                "SetLabel",
+	StateLabel:              "StateLabel",
+	GetVersion:              "GetVersion",
+	StateVersion:            "StateVersion",
+	GetInfo:                 "GetInfo",
+	StateInfo:               "StateInfo",
+	SetReboot:               "SetReboot",
+	Acknowledgement:         "Acknowledgement",
+	GetLocation:             "GetLocation",
+	SetLocation:             "SetLocation",
+	StateLocation:           "StateLocation",
+	GetGroup:                "GetGroup",
+	SetGroup:                "SetGroup",
+	StateGroup:              "StateGroup",
+	EchoRequest:             "EchoRequest",
+	EchoResponse:            "EchoResponse",
+	GetColor:                "GetColor",
+	SetColor:                "SetColor",
+	SetWaveform:             "SetWaveform",
+	LightState:              "LightState",
+	GetLightPower:           "GetLightPower",
+	SetLightPower:           "SetLightPower",
+	StateLightPower:         "StateLightPower",
+	SetWaveformOptional:     "SetWaveformOptional",
+	GetInfrared:             "GetInfrared",
+	StateInfrared:           "StateInfrared",
+	SetInfrared:             "SetInfrared",
+	GetHevCycle:             "GetHevCycle",
+	SetHevCycle:             "SetHevCycle",
+	StateHevCycle:           "StateHevCycle",
+	GetHevCycleConfig:       "GetHevCycleConfig",
+	SetHevCycleConfig:       "SetHevCycleConfig",
+	StateHevCycleConfig:     "StateHevCycleConfig",
+	GetLastHevCycleResult:   "GetLastHevCycleResult",
+	StateLastHevCycleResult: "StateLastHevCycleResult",
+	StateUnhandled:          "StateUnhandled",
+	SetColorZones:           "SetColorZones",
+	GetColorZones:           "GetColorZones",
+	StateZone:               "StateZone",
+	StateMultiZone:          "StateMultiZone",
+	GetMultiZoneEffect:      "GetMultiZoneEffect",
+	SetMultiZoneEffect:      "SetMultiZoneEffect",
+	StateMultiZoneEffect:    "StateMultiZoneEffect",
+	SetExtendedColorZones:   "SetExtendedColorZones",
+	GetExtendedColorZones:   "GetExtendedColorZones",
+	StateExtendedColorZones: "StateExtendedColorZones",
+	GetDeviceChain:          "GetDeviceChain",
+	StateDeviceChain:        "StateDeviceChain",
+	SetUserPosition:         "SetUserPosition",
+	Get64:                   "Get64",
+	State64:                 "State64",
+	Set64:                   "Set64",
+	GetTileEffect:           "GetTileEffect",
+	SetTileEffect:           "SetTileEffect",
+	StateTileEffect:         "StateTileEffect",
+	GetRPower:               "GetRPower",
+	SetRPower:               "SetRPower",
+	StateRPower:             "StateRPower",
+	GetButton:               "GetButton",
+	SetButton:               "SetButton",
+	StateButton:             "StateButton",
+	GetButtonConfig:         "GetButtonConfig",
+	SetButtonConfig:         "SetButtonConfig",
+	StateButtonConfig:       "StateButtonConfig",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Type(%d)", uint16(t))
+}
+
+// HeaderLength is the length of an encoded header, which precedes the payload of every message.
+const HeaderLength = 36
+
+// MaxPayloadLength is the length of the largest payload that can be encoded,
+// limited by the 16-bit size field of the header.
+const MaxPayloadLength = 0xFFFF - HeaderLength
+
+// Header represents a message header.
+// It only contains fields that are settable; the rest are fixed or computed.
+//
+// https://lan.developer.lifx.com/docs/packet-contents#header
+type Header struct {
+	// Frame header.
+	// https://lan.developer.lifx.com/docs/packet-contents#frame-header
+
+	// Tagged is set for messages addressed to all devices.
+	Tagged bool
+	// Source identifies the client, and is echoed by devices in their responses.
+	Source uint32
+
+	// Frame address.
+	// https://lan.developer.lifx.com/docs/packet-contents#frame-address
+
+	// Target is the serial of the device the message is for (in the first six bytes),
+	// or all zeros for all devices.
+	Target      [8]byte
+	ResRequired bool
+	AckRequired bool
+	Sequence    uint8
+
+	// Protocol header.
+	// https://lan.developer.lifx.com/docs/packet-contents#protocol-header
+
+	Type Type
+}
+
+func boolInt(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Encode returns the encoding of a message with the given header and payload.
+// It panics if the payload is longer than MaxPayloadLength.
+func Encode(hdr Header, payload []byte) []byte {
+	if len(payload) > MaxPayloadLength {
+		panic(fmt.Sprintf("protocol: %d byte payload exceeds MaxPayloadLength (%d)", len(payload), MaxPayloadLength))
+	}
+	bit := func(b bool) uint { return uint(boolInt(b)) }
+
+	finalSize := HeaderLength + len(payload)
+	out := make([]byte, 0, finalSize)
+
+	// Frame header (8 bytes).
+	out = binary.LittleEndian.AppendUint16(out, uint16(finalSize))
+	out = append(out, 0)                                       // low byte of protocol (1024)
+	out = append(out, byte(0x04|1<<4|bit(hdr.Tagged)<<5|0<<6)) // remainder of protol, addressable, tagged, origin
+	out = binary.LittleEndian.AppendUint32(out, hdr.Source)
+
+	// Frame address (16 bytes).
+	out = append(out, hdr.Target[:]...)
+	out = append(out, 0, 0, 0, 0, 0, 0)                                   // reserved
+	out = append(out, byte(bit(hdr.ResRequired)|bit(hdr.AckRequired)<<1)) // and 6 reserved bits
+	out = append(out, hdr.Sequence)
+
+	// Protocol header (12 bytes).
+	out = append(out, 0, 0, 0, 0, 0, 0, 0, 0) // reserved
+	out = binary.LittleEndian.AppendUint16(out, uint16(hdr.Type))
+	out = append(out, 0, 0) // reserved
+
+	// Payload itself.
+	out = append(out, payload...)
+
+	if len(out) != finalSize {
+		panic(fmt.Sprintf("internal error: encoded message to %d bytes but it should have been %d bytes", len(out), finalSize))
+	}
+	return out
+}
+
+// DecodeError reports a message, or the payload of a message,
+// that is malformed: truncated, oversized, or with inconsistent fields.
+type DecodeError struct {
+	Type   Type   // the message type, or zero if the header itself is malformed
+	Len    int    // the length of the payload, or of the whole message if Type is zero
+	Reason string // what is wrong
+}
+
+func (e *DecodeError) Error() string {
+	if e.Type == 0 {
+		return fmt.Sprintf("malformed message (%d bytes): %s", e.Len, e.Reason)
+	}
+	return fmt.Sprintf("malformed %v payload (%d bytes): %s", e.Type, e.Len, e.Reason)
+}
+
+// Decode decodes a message, returning its header and payload.
+// The payload aliases b.
+// If the message is malformed, the error is a *DecodeError.
+func Decode(b []byte) (hdr Header, payload []byte, err error) {
+	bad := func(format string, args ...interface{}) error {
+		return &DecodeError{Len: len(b), Reason: fmt.Sprintf(format, args...)}
+	}
+	if len(b) < HeaderLength {
+		err = bad("shorter than the %d byte header", HeaderLength)
+		return
+	}
+	finalSize := int(binary.LittleEndian.Uint16(b[0:2]))
+	if finalSize != len(b) {
+		err = bad("size field is %d", finalSize)
+		return
+	}
+	if proto := binary.LittleEndian.Uint16(b[2:4]) & 0x0FFF; proto != 1024 {
+		err = bad("protocol is %d, not 1024", proto)
+		return
+	}
+	b, payload = b[:HeaderLength], b[HeaderLength:]
+
+	hdr.Tagged = b[3]&(1<<5) != 0
+	hdr.Source = binary.LittleEndian.Uint32(b[4:8])
+
+	copy(hdr.Target[:], b[8:16])
+	hdr.ResRequired = b[22]&1 != 0
+	hdr.AckRequired = b[22]&2 != 0
+	hdr.Sequence = b[23]
+
+	hdr.Type = Type(binary.LittleEndian.Uint16(b[32:34]))
+
+	return
+}
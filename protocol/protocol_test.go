@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var hdr Header
+	hdr.Tagged = true
+	hdr.Source = 0x12345678
+	hdr.Target = [8]byte{0xd0, 0x73, 0xd5, 1, 2, 3}
+	hdr.ResRequired = true
+	hdr.AckRequired = false
+	hdr.Sequence = 42
+	hdr.Type = SetColor
+	payload := []byte("some payload")
+
+	msg := Encode(hdr, payload)
+	gotHdr, gotPayload, err := Decode(msg)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if gotHdr != hdr {
+		t.Errorf("header mismatch.\n got %+v\nwant %+v", gotHdr, hdr)
+	}
+	if !bytes.Equal(gotPayload, payload) {
+		t.Errorf("payload = %q, want %q", gotPayload, payload)
+	}
+
+	hdr.Tagged = false
+	hdr.ResRequired, hdr.AckRequired = false, true
+	gotHdr, _, err = Decode(Encode(hdr, nil))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if gotHdr != hdr {
+		t.Errorf("header mismatch.\n got %+v\nwant %+v", gotHdr, hdr)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(Encode(Header{Tagged: true, Source: 1, Type: GetService}, nil))
+	f.Add(Encode(Header{Source: 2, Target: [8]byte{0xd0, 0x73, 0xd5, 1, 2, 3}, AckRequired: true, Sequence: 7, Type: SetLightPower},
+		[]byte{0xFF, 0xFF, 0xE8, 0x03, 0, 0}))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		hdr, payload, err := Decode(b)
+		if err != nil {
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("Decode: got %T error %v, want *DecodeError", err, err)
+			}
+			return
+		}
+		// Whatever decodes should survive a round trip.
+		hdr2, payload2, err := Decode(Encode(hdr, payload))
+		if err != nil {
+			t.Fatalf("Decode(Encode(...)): %v", err)
+		}
+		if hdr2 != hdr || !bytes.Equal(payload2, payload) {
+			t.Errorf("round trip changed message.\n got %+v %x\nwant %+v %x", hdr2, payload2, hdr, payload)
+		}
+	})
+}
+
+func TestEncodeMaxPayload(t *testing.T) {
+	payload := make([]byte, MaxPayloadLength)
+	if _, got, err := Decode(Encode(Header{Type: SetColor}, payload)); err != nil || len(got) != len(payload) {
+		t.Errorf("Decode(Encode(...)) of the largest payload = %d bytes, %v; want %d bytes, nil", len(got), err, len(payload))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Encode of a payload longer than MaxPayloadLength didn't panic")
+		}
+	}()
+	Encode(Header{Type: SetColor}, make([]byte, MaxPayloadLength+1))
+}
+
+func TestDecodeErrors(t *testing.T) {
+	good := Encode(Header{Type: GetService}, []byte{1, 2, 3})
+	tests := []struct {
+		desc string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"truncated header", good[:20]},
+		{"truncated payload", good[:len(good)-1]},
+		{"excess bytes", append(good[:len(good):len(good)], 0)},
+		{"wrong protocol", append([]byte{good[0], good[1], 0x00, 0x13}, good[4:]...)},
+	}
+	for _, test := range tests {
+		_, _, err := Decode(test.b)
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: Decode returned %v, want a *DecodeError", test.desc, err)
+			continue
+		}
+		if de.Len != len(test.b) {
+			t.Errorf("%s: DecodeError.Len = %d, want %d", test.desc, de.Len, len(test.b))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package lifx
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Default outbound rate limits, following LIFX's recommendation
+// of no more than 20 messages per second to each device.
+const (
+	DefaultRateLimit = 20
+	DefaultRateBurst = 5
+)
+
+// WithRateLimit limits the rate of messages sent to each device
+// to the given number per second, allowing bursts of up to burst messages.
+// Messages over the limit are delayed rather than dropped.
+// A rate of zero disables rate limiting.
+// The default is DefaultRateLimit with bursts of DefaultRateBurst.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(c *Client) {
+		c.rate, c.burst = rate, burst
+	}
+}
+
+// limiter is a token bucket.
+type limiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last updated; zero if never used
+}
+
+// reserve takes a token from the bucket, returning how long to wait before using it.
+func (l *limiter) reserve(now time.Time, rate float64, burst int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last.IsZero() {
+		l.tokens = float64(burst)
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * rate
+		if l.tokens > float64(burst) {
+			l.tokens = float64(burst)
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / rate * float64(time.Second))
+}
+
+// rateWait blocks until the device's rate limit permits sending another message.
+func (d *Device) rateWait(ctx context.Context) error {
+	c := d.client
+	if c.rate <= 0 {
+		return nil
+	}
+	wait := d.limit.reserve(time.Now(), c.rate, c.burst)
+	if wait == 0 {
+		return nil
+	}
+	d.tracef(ctx, "LIFX op delayed %v by rate limit", wait)
+	d.log(ctx, slog.LevelDebug, "LIFX rate limit delay", slog.Duration("delay", wait))
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
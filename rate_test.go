@@ -0,0 +1,31 @@
+package lifx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	var l limiter
+	t0 := time.Now()
+	// The first burst goes straight through.
+	for i := 0; i < 5; i++ {
+		if wait := l.reserve(t0, 20, 5); wait != 0 {
+			t.Fatalf("message %d of burst waits %v, want 0", i, wait)
+		}
+	}
+	// After that, messages are spaced out at the rate.
+	if wait := l.reserve(t0, 20, 5); wait != 50*time.Millisecond {
+		t.Errorf("message after burst waits %v, want 50ms", wait)
+	}
+	if wait := l.reserve(t0, 20, 5); wait != 100*time.Millisecond {
+		t.Errorf("second message after burst waits %v, want 100ms", wait)
+	}
+	// Tokens refill over time, but no more than the burst.
+	if wait := l.reserve(t0.Add(time.Hour), 20, 5); wait != 0 {
+		t.Errorf("message after an idle hour waits %v, want 0", wait)
+	}
+	if l.tokens != 4 {
+		t.Errorf("after an idle hour, %v tokens remain, want 4", l.tokens)
+	}
+}
@@ -0,0 +1,40 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// Send sends a message of any type to the device, and waits for it to be acknowledged.
+// The payload is the message's raw encoding; see the protocol package.
+// This is for messages that aren't otherwise supported by this package.
+func (d *Device) Send(ctx context.Context, typ protocol.Type, payload []byte) error {
+	if err := checkPayloadLength(payload); err != nil {
+		return err
+	}
+	return d.set(ctx, typ, payload)
+}
+
+// Request sends a message of any type to the device, and returns the raw payload
+// of its response, which must be of type respType.
+// If the device can't handle the message, the error matches ErrUnhandled.
+// This is for messages that aren't otherwise supported by this package.
+//
+// Since the message may change the device's state, the device's cache is invalidated.
+func (d *Device) Request(ctx context.Context, typ, respType protocol.Type, payload []byte) ([]byte, error) {
+	if err := checkPayloadLength(payload); err != nil {
+		return nil, err
+	}
+	d.cacheInvalidate()
+	return d.oneRPC(ctx, typ, respType, payload, true, false)
+}
+
+// checkPayloadLength checks that a payload fits in a single message.
+func checkPayloadLength(payload []byte) error {
+	if len(payload) > protocol.MaxPayloadLength {
+		return fmt.Errorf("payload of %d bytes exceeds the maximum of %d", len(payload), protocol.MaxPayloadLength)
+	}
+	return nil
+}
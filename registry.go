@@ -0,0 +1,117 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RegisteredDevice is a device known to a Registry.
+type RegisteredDevice struct {
+	Device   *Device
+	LastSeen time.Time
+	// Stale reports whether the device has missed several consecutive discoveries.
+	Stale bool
+}
+
+// Registry maintains the set of devices on the network, kept up to date by
+// periodic discovery (see Discover). Devices that stop responding are marked
+// stale but not forgotten.
+// Its methods do no network I/O. It is safe for concurrent use.
+type Registry struct {
+	c *Client
+
+	mu   sync.RWMutex
+	devs map[[6]byte]*registryEntry
+}
+
+type registryEntry struct {
+	rd     RegisteredDevice
+	misses int
+}
+
+// StartRegistry starts discovering devices every interval
+// (or DefaultPollInterval if interval is not positive), until the context is done.
+func (c *Client) StartRegistry(ctx context.Context, interval time.Duration) *Registry {
+	r := &Registry{
+		c:    c,
+		devs: make(map[[6]byte]*registryEntry),
+	}
+	go r.run(ctx, interval)
+	return r
+}
+
+// Device returns the device with the given serial, and whether it is known.
+// The same *Device is returned for as long as the device keeps the same address,
+// so per-device state such as caches and circuit breakers is preserved.
+func (r *Registry) Device(serial [6]byte) (RegisteredDevice, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.devs[serial]
+	if !ok {
+		return RegisteredDevice{}, false
+	}
+	return e.rd, true
+}
+
+// Devices returns all known devices, ordered by serial.
+// Stale devices are included; check RegisteredDevice.Stale.
+func (r *Registry) Devices() []RegisteredDevice {
+	r.mu.RLock()
+	rds := make([]RegisteredDevice, 0, len(r.devs))
+	for _, e := range r.devs {
+		rds = append(rds, e.rd)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(rds, func(i, j int) bool {
+		return bytes.Compare(rds[i].Device.Serial[:], rds[j].Device.Serial[:]) < 0
+	})
+	return rds
+}
+
+func (r *Registry) run(ctx context.Context, interval time.Duration) {
+	poll(ctx, interval, func(dctx context.Context) bool {
+		devs, err := r.c.Discover(dctx)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err == nil {
+			r.update(devs, time.Now())
+		}
+		// Otherwise it's transient, presumably. Try again next time.
+		return true
+	})
+}
+
+func (r *Registry) update(devs []*Device, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[[6]byte]bool)
+	for _, d := range devs {
+		seen[d.Serial] = true
+		e, ok := r.devs[d.Serial]
+		if !ok {
+			e = &registryEntry{}
+			r.devs[d.Serial] = e
+		}
+		if !ok || !e.rd.Device.Addr.IP.Equal(d.Addr.IP) || e.rd.Device.Addr.Port != d.Addr.Port {
+			e.rd.Device = d
+		}
+		e.rd.LastSeen = now
+		e.rd.Stale = false
+		e.misses = 0
+	}
+	for serial, e := range r.devs {
+		if seen[serial] {
+			continue
+		}
+		e.misses++
+		if e.misses >= watchMissLimit {
+			e.rd.Stale = true
+		}
+	}
+}
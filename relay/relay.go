@@ -0,0 +1,277 @@
+/*
+Package relay forwards LIFX traffic between network segments.
+
+LIFX discovery relies on broadcast, which doesn't cross subnets or VLANs.
+A Relay runs on a machine attached to both segments. Clients on one segment
+discover devices by broadcasting as usual; the relay rebroadcasts onto the
+device segment, and relays the responses back as if it were the devices
+itself. Clients then address their requests to the relay, which forwards them
+to the right device based on the target serial in each packet.
+*/
+package relay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// headerLength is the size of a LIFX message header.
+const headerLength = 36
+
+// Packet describes a packet, for filtering.
+type Packet struct {
+	From   *net.UDPAddr
+	Type   uint16  // message type
+	Target [6]byte // zero for tagged (broadcast) messages
+	Tagged bool
+}
+
+func parsePacket(b []byte, from *net.UDPAddr) (Packet, error) {
+	if len(b) < headerLength {
+		return Packet{}, fmt.Errorf("packet too short: %d bytes", len(b))
+	}
+	if size := int(binary.LittleEndian.Uint16(b[0:2])); size != len(b) {
+		return Packet{}, fmt.Errorf("packet has invalid size %d; got %d bytes", size, len(b))
+	}
+	p := Packet{
+		From:   from,
+		Type:   binary.LittleEndian.Uint16(b[32:34]),
+		Tagged: b[3]&(1<<5) != 0,
+	}
+	copy(p.Target[:], b[8:14])
+	return p, nil
+}
+
+const (
+	pktStateService = 3
+	idleTimeout     = 2 * time.Minute
+
+	// localIPsRefresh is how often the machine's own addresses are re-read.
+	localIPsRefresh = 1 * time.Minute
+)
+
+// Relay forwards LIFX traffic between a client-facing socket and a device segment.
+type Relay struct {
+	// Broadcast is the broadcast address of the device segment,
+	// such as 10.0.20.255:56700.
+	Broadcast *net.UDPAddr
+
+	// Filter, if set, is consulted for every packet from a client.
+	// Packets for which it returns false are dropped.
+	// Responses from devices are always relayed.
+	Filter func(Packet) bool
+
+	// Logf, if set, will be used to log unusual events.
+	Logf func(format string, args ...interface{})
+
+	mu         sync.Mutex
+	devices    map[[6]byte]*net.UDPAddr // learned from responses
+	clients    map[string]*client       // keyed by client address
+	localIPs   []net.IP                 // this machine's addresses
+	localIPsAt time.Time                // when localIPs was read
+}
+
+type client struct {
+	addr     *net.UDPAddr
+	upstream *net.UDPConn // socket on the device segment for this client
+	lastUsed time.Time
+}
+
+func (r *Relay) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+// Serve relays packets arriving on conn, which should be bound to port 56700
+// on the client-facing segment, until reading from it fails.
+func (r *Relay) Serve(conn *net.UDPConn) error {
+	r.mu.Lock()
+	r.devices = make(map[[6]byte]*net.UDPAddr)
+	r.clients = make(map[string]*client)
+	r.mu.Unlock()
+	defer r.closeClients()
+
+	var scratch [4 << 10]byte
+	for {
+		n, from, err := conn.ReadFromUDP(scratch[:])
+		if err != nil {
+			return err
+		}
+		b := scratch[:n]
+		p, err := parsePacket(b, from)
+		if err != nil {
+			r.logf("Dropping bad packet from %v: %v", from, err)
+			continue
+		}
+		if r.isOwnPacket(from) {
+			// Our own rebroadcast, received because we're on both segments.
+			continue
+		}
+		if r.Filter != nil && !r.Filter(p) {
+			continue
+		}
+
+		dst := r.Broadcast
+		if !p.Tagged && p.Target != ([6]byte{}) {
+			r.mu.Lock()
+			if addr, ok := r.devices[p.Target]; ok {
+				dst = addr
+			}
+			r.mu.Unlock()
+		}
+
+		cl, err := r.client(conn, from)
+		if err != nil {
+			r.logf("Setting up relay for %v: %v", from, err)
+			continue
+		}
+		if _, err := cl.upstream.WriteToUDP(b, dst); err != nil {
+			r.logf("Forwarding to %v: %v", dst, err)
+		}
+		r.expireClients()
+	}
+}
+
+// isOwnPacket reports whether from is one of our upstream sockets.
+func (r *Relay) isOwnPacket(from *net.UDPAddr) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cl := range r.clients {
+		if cl.upstream.LocalAddr().(*net.UDPAddr).Port != from.Port {
+			continue
+		}
+		if from.IP.IsLoopback() || r.isLocalIP(from.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalIP reports whether ip is one of this machine's addresses.
+// The addresses are re-read every localIPsRefresh, so this is cheap enough
+// to call for each packet. r.mu must be held.
+func (r *Relay) isLocalIP(ip net.IP) bool {
+	if time.Since(r.localIPsAt) > localIPsRefresh {
+		r.localIPs = r.localIPs[:0]
+		if addrs, err := net.InterfaceAddrs(); err != nil {
+			r.logf("Listing local addresses: %v", err)
+		} else {
+			for _, a := range addrs {
+				if n, ok := a.(*net.IPNet); ok {
+					r.localIPs = append(r.localIPs, n.IP)
+				}
+			}
+		}
+		r.localIPsAt = time.Now()
+	}
+	for _, lip := range r.localIPs {
+		if lip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns the relay state for the client at addr, creating it if needed.
+func (r *Relay) client(conn *net.UDPConn, addr *net.UDPAddr) (*client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := addr.String()
+	if cl, ok := r.clients[key]; ok {
+		cl.lastUsed = time.Now()
+		return cl, nil
+	}
+	up, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	cl := &client{addr: addr, upstream: up, lastUsed: time.Now()}
+	r.clients[key] = cl
+	go r.relayResponses(conn, cl)
+	return cl, nil
+}
+
+// relayResponses copies responses from devices back to a client.
+func (r *Relay) relayResponses(conn *net.UDPConn, cl *client) {
+	localPort := conn.LocalAddr().(*net.UDPAddr).Port
+	var scratch [4 << 10]byte
+	for {
+		n, from, err := cl.upstream.ReadFromUDP(scratch[:])
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				r.logf("Reading responses for %v: %v", cl.addr, err)
+			}
+			return
+		}
+		b := scratch[:n]
+		p, err := parsePacket(b, from)
+		if err != nil {
+			continue
+		}
+		if p.Target != ([6]byte{}) {
+			r.mu.Lock()
+			r.devices[p.Target] = from
+			r.mu.Unlock()
+		}
+		if p.Type == pktStateService && len(b) == headerLength+5 {
+			// Clients should talk to us, not directly to the device.
+			binary.LittleEndian.PutUint32(b[headerLength+1:], uint32(localPort))
+		}
+		if _, err := conn.WriteToUDP(b, cl.addr); err != nil {
+			r.logf("Relaying to %v: %v", cl.addr, err)
+		}
+	}
+}
+
+func (r *Relay) expireClients() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, cl := range r.clients {
+		if time.Since(cl.lastUsed) > idleTimeout {
+			cl.upstream.Close()
+			delete(r.clients, key)
+		}
+	}
+}
+
+func (r *Relay) closeClients() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, cl := range r.clients {
+		cl.upstream.Close()
+		delete(r.clients, key)
+	}
+}
+
+// AllowClients returns a filter that only admits packets from the given networks.
+func AllowClients(nets ...*net.IPNet) func(Packet) bool {
+	return func(p Packet) bool {
+		for _, n := range nets {
+			if n.Contains(p.From.IP) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllowSerials returns a filter that only admits broadcasts and packets
+// addressed to the given devices.
+func AllowSerials(serials ...[6]byte) func(Packet) bool {
+	return func(p Packet) bool {
+		if p.Tagged || p.Target == ([6]byte{}) {
+			return true
+		}
+		for _, s := range serials {
+			if s == p.Target {
+				return true
+			}
+		}
+		return false
+	}
+}
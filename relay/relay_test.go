@@ -0,0 +1,141 @@
+package relay
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+	"github.com/dsymonds/lifx/protocol"
+)
+
+var testSerial = [6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBB, 0xCC}
+
+// startRelay starts a relay on loopback whose device segment is the emulated device,
+// and returns the relay's address.
+func startRelay(t *testing.T, r *Relay, ed *lifxtest.Device) *net.UDPAddr {
+	t.Helper()
+	r.Broadcast = ed.Addr()
+	r.Logf = t.Logf
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("net.ListenUDP: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Serve(conn)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		<-done
+	})
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestRelayStateServicePort(t *testing.T) {
+	ed := lifxtest.NewNetwork(t).Add(testSerial, "Lamp", &lifxtest.Light{})
+	raddr := startRelay(t, &Relay{}, ed)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("net.ListenUDP: %v", err)
+	}
+	defer conn.Close()
+	req := protocol.Encode(protocol.Header{Tagged: true, Source: 1234, Type: protocol.GetService}, nil)
+	if _, err := conn.WriteToUDP(req, raddr); err != nil {
+		t.Fatalf("Sending GetService: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Reading StateService: %v", err)
+	}
+	hdr, payload, err := protocol.Decode(buf[:n])
+	if err != nil {
+		t.Fatalf("Decoding response: %v", err)
+	}
+	if hdr.Type != protocol.StateService || len(payload) != 5 {
+		t.Fatalf("Got %v with %d byte payload, want StateService with 5 byte payload", hdr.Type, len(payload))
+	}
+	if got := [6]byte(hdr.Target[:6]); got != testSerial {
+		t.Errorf("StateService from %x, want %x", got, testSerial)
+	}
+	// The device's own port must be replaced by the relay's.
+	if got := int(binary.LittleEndian.Uint32(payload[1:])); got != raddr.Port {
+		t.Errorf("StateService has port %d, want the relay's port %d", got, raddr.Port)
+	}
+}
+
+func TestRelayForwarding(t *testing.T) {
+	ed := lifxtest.NewNetwork(t).Add(testSerial, "Lamp", &lifxtest.Light{})
+	raddr := startRelay(t, &Relay{}, ed)
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Probe reaches the device through the relay, and reports the relay's address.
+	devs, err := client.Probe(ctx, []net.UDPAddr{*raddr})
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("Probe = %v, %v; want one device", devs, err)
+	}
+	dev := devs[0]
+	if dev.Serial != testSerial || dev.Addr.String() != raddr.String() {
+		t.Errorf("Probe found %x at %v, want %x at %v", dev.Serial, &dev.Addr, testSerial, raddr)
+	}
+	if label, err := dev.GetLabel(ctx); err != nil || label != "Lamp" {
+		t.Errorf("GetLabel through relay = %q, %v; want %q, nil", label, err, "Lamp")
+	}
+	if err := dev.SetPower(ctx, 0xFFFF); err != nil {
+		t.Errorf("SetPower through relay: %v", err)
+	}
+	if got := ed.Light.Power(); got != 0xFFFF {
+		t.Errorf("After SetPower through relay, device has power %d, want 65535", got)
+	}
+}
+
+func TestRelayFilter(t *testing.T) {
+	ed := lifxtest.NewNetwork(t).Add(testSerial, "Lamp", &lifxtest.Light{})
+	raddr := startRelay(t, &Relay{Filter: AllowSerials([6]byte{0xd0, 0x73, 0xd5, 1, 2, 3})}, ed)
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	dev := client.NewDevice(*raddr, testSerial)
+	dev.Retry = &lifx.RetryPolicy{Base: 20 * time.Millisecond, Multiplier: 1, Max: 20 * time.Millisecond, MaxAttempts: 3}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := dev.GetLabel(ctx); err == nil {
+		t.Errorf("GetLabel of a device not allowed by the filter succeeded")
+	}
+}
+
+func TestIsLocalIPCached(t *testing.T) {
+	r := &Relay{Logf: t.Logf}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.isLocalIP(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("isLocalIP(127.0.0.1) = false, want true")
+	}
+	if r.isLocalIP(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("isLocalIP(192.0.2.1) = true, want false")
+	}
+	at := r.localIPsAt
+	r.isLocalIP(net.IPv4(127, 0, 0, 1))
+	if !r.localIPsAt.Equal(at) {
+		t.Errorf("isLocalIP re-read the local addresses within localIPsRefresh")
+	}
+}
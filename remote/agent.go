@@ -0,0 +1,157 @@
+package remote
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dsymonds/lifx/internal/websocket"
+)
+
+// Agent is an http.Handler that proxies LIFX traffic between
+// WebSocket clients and the local network.
+//
+// Each WebSocket connection gets its own UDP socket on the LAN,
+// so responses are routed back to the client that caused them.
+//
+// Packets are only forwarded to the standard LIFX port on networks
+// directly attached to the agent's host, or to the broadcast address,
+// so the agent can't be used to relay arbitrary UDP traffic.
+type Agent struct {
+	// Token, if non-empty, must be presented by clients as a bearer token.
+	// Agents reachable from untrusted networks should always set this,
+	// and should be served over TLS.
+	Token string
+
+	// Logf, if set, will be used to log connection events.
+	Logf func(format string, args ...interface{})
+
+	port int // destination port to allow; zero means stdPort. For tests.
+}
+
+const stdPort = 56700
+
+// localNetworks returns the IPv4 networks directly attached to this host.
+func localNetworks() ([]*net.IPNet, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		if ipn, ok := addr.(*net.IPNet); ok && ipn.IP.To4() != nil {
+			nets = append(nets, ipn)
+		}
+	}
+	return nets, nil
+}
+
+// allowed reports whether the agent may forward a packet to addr,
+// given the directly attached networks.
+func (a *Agent) allowed(addr *net.UDPAddr, nets []*net.IPNet) bool {
+	port := a.port
+	if port == 0 {
+		port = stdPort
+	}
+	if addr.Port != port {
+		return false
+	}
+	if addr.IP.Equal(net.IPv4bcast) {
+		return true
+	}
+	for _, ipn := range nets {
+		if ipn.Contains(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
+
+func (a *Agent) authorized(r *http.Request) bool {
+	if a.Token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(a.Token)) == 1
+}
+
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		a.logf("Rejecting unauthorized connection from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ws, err := websocket.Upgrade(w, r)
+	if err != nil {
+		a.logf("Upgrading connection from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer ws.Close()
+
+	nets, err := localNetworks()
+	if err != nil {
+		a.logf("Listing local networks: %v", err)
+		return
+	}
+	udp, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		a.logf("net.ListenUDP: %v", err)
+		return
+	}
+	defer udp.Close()
+
+	a.logf("Client %s connected", r.RemoteAddr)
+	defer a.logf("Client %s disconnected", r.RemoteAddr)
+
+	// LAN -> client.
+	go func() {
+		defer ws.Close() // unblocks the other direction
+		var scratch [4 << 10]byte
+		for {
+			n, raddr, err := udp.ReadFromUDP(scratch[:])
+			if err != nil {
+				return
+			}
+			if n < minPacketLength {
+				continue
+			}
+			frame, err := encodeFrame(raddr, scratch[:n])
+			if err != nil {
+				continue
+			}
+			if err := ws.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Client -> LAN.
+	for {
+		op, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if op != websocket.BinaryMessage {
+			continue
+		}
+		addr, packet, err := decodeFrame(msg)
+		if err != nil {
+			a.logf("Bad frame from %s: %v", r.RemoteAddr, err)
+			continue
+		}
+		if !a.allowed(addr, nets) {
+			a.logf("Refusing to forward packet from %s to %v", r.RemoteAddr, addr)
+			continue
+		}
+		if _, err := udp.WriteToUDP(packet, addr); err != nil {
+			a.logf("Forwarding packet to %v: %v", addr, err)
+		}
+	}
+}
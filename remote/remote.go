@@ -0,0 +1,55 @@
+/*
+Package remote lets LIFX devices be controlled from outside their broadcast domain.
+
+An Agent runs on a machine on the same LAN as the devices and exposes a WebSocket
+endpoint (normally served over TLS). A Transport connects to that endpoint and can
+be passed to lifx.NewClient via lifx.WithTransport; the client then behaves as if
+it were on the LAN itself. No LIFX cloud services are involved.
+
+Each WebSocket binary message carries a single LIFX datagram, prefixed by the
+IPv4 address and port it is destined for (client to agent) or was received from
+(agent to client):
+
+	bytes 0-3: IPv4 address
+	bytes 4-5: UDP port, big endian
+	bytes 6- : LIFX packet
+*/
+package remote
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const addrLength = 4 + 2
+
+// minPacketLength is the size of a LIFX header;
+// anything shorter isn't worth forwarding.
+const minPacketLength = 36
+
+func encodeFrame(addr *net.UDPAddr, packet []byte) ([]byte, error) {
+	ip4 := addr.IP.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("address %v is not IPv4", addr)
+	}
+	if addr.Port <= 0 || addr.Port > 0xFFFF {
+		return nil, fmt.Errorf("address %v has invalid port", addr)
+	}
+	out := make([]byte, 0, addrLength+len(packet))
+	out = append(out, ip4...)
+	out = binary.BigEndian.AppendUint16(out, uint16(addr.Port))
+	out = append(out, packet...)
+	return out, nil
+}
+
+func decodeFrame(b []byte) (*net.UDPAddr, []byte, error) {
+	if len(b) < addrLength+minPacketLength {
+		return nil, nil, fmt.Errorf("frame too short: %d bytes", len(b))
+	}
+	addr := &net.UDPAddr{
+		IP:   net.IPv4(b[0], b[1], b[2], b[3]),
+		Port: int(binary.BigEndian.Uint16(b[4:6])),
+	}
+	return addr, b[addrLength:], nil
+}
@@ -0,0 +1,96 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	// A fake device that echoes every packet back to its sender.
+	dev, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("net.ListenUDP: %v", err)
+	}
+	defer dev.Close()
+	go func() {
+		var buf [1024]byte
+		for {
+			n, raddr, err := dev.ReadFromUDP(buf[:])
+			if err != nil {
+				return
+			}
+			dev.WriteToUDP(buf[:n], raddr)
+		}
+	}()
+
+	const token = "sekrit"
+	devAddr := dev.LocalAddr().(*net.UDPAddr)
+	srv := httptest.NewTLSServer(&Agent{Token: token, port: devAddr.Port})
+	defer srv.Close()
+	wsURL := "wss" + strings.TrimPrefix(srv.URL, "https")
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Wrong token should be rejected.
+	bad := &Transport{URL: wsURL, Token: "wrong", TLSConfig: tlsConfig}
+	if _, err := bad.ListenPacket(ctx); err == nil {
+		t.Errorf("ListenPacket with wrong token succeeded")
+	}
+
+	tr := &Transport{URL: wsURL, Token: token, TLSConfig: tlsConfig}
+	conn, err := tr.ListenPacket(ctx)
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	packet := make([]byte, minPacketLength+3)
+	copy(packet, "hello, LIFX")
+	if _, err := conn.WriteTo(packet, devAddr); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	var buf [1024]byte
+	n, raddr, err := conn.ReadFrom(buf[:])
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if got := string(buf[:n]); got != string(packet) {
+		t.Errorf("ReadFrom returned %q, want %q", got, packet)
+	}
+	if got := raddr.(*net.UDPAddr); !got.IP.Equal(devAddr.IP) || got.Port != devAddr.Port {
+		t.Errorf("ReadFrom returned address %v, want %v", got, devAddr)
+	}
+}
+
+func TestAgentAllowed(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.10/24")
+	nets := []*net.IPNet{lan}
+	a := &Agent{}
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"192.168.1.20:56700", true},
+		{"192.168.1.255:56700", true},
+		{"255.255.255.255:56700", true},
+		{"192.168.1.20:53", false},
+		{"192.168.2.20:56700", false},
+		{"8.8.8.8:56700", false},
+	} {
+		addr, err := net.ResolveUDPAddr("udp4", tc.addr)
+		if err != nil {
+			t.Fatalf("net.ResolveUDPAddr(%q): %v", tc.addr, err)
+		}
+		if got := a.allowed(addr, nets); got != tc.want {
+			t.Errorf("allowed(%v) = %t, want %t", addr, got, tc.want)
+		}
+	}
+}
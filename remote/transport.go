@@ -0,0 +1,90 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/internal/websocket"
+)
+
+// Transport is a lifx.Transport that tunnels traffic through an Agent.
+type Transport struct {
+	// URL is the agent's WebSocket endpoint, e.g. "wss://agent.example.com:8443/lifx".
+	URL string
+
+	// Token is the bearer token to present to the agent.
+	Token string
+
+	// TLSConfig configures wss connections. It may be nil.
+	TLSConfig *tls.Config
+}
+
+var _ lifx.Transport = (*Transport)(nil)
+
+// ListenPacket dials the agent and returns a connection tunnelled over it.
+// Every connection uses a fresh WebSocket session.
+func (t *Transport) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	hdr := make(http.Header)
+	if t.Token != "" {
+		hdr.Set("Authorization", "Bearer "+t.Token)
+	}
+	ws, err := websocket.Dial(ctx, t.URL, hdr, t.TLSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to LIFX agent: %w", err)
+	}
+	return &packetConn{ws: ws}, nil
+}
+
+// packetConn adapts a WebSocket connection to net.PacketConn.
+type packetConn struct {
+	ws *websocket.Conn
+}
+
+func (pc *packetConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		op, msg, err := pc.ws.ReadMessage()
+		if err != nil {
+			return 0, nil, fmt.Errorf("reading from LIFX agent: %w", err)
+		}
+		if op != websocket.BinaryMessage {
+			continue
+		}
+		addr, packet, err := decodeFrame(msg)
+		if err != nil {
+			continue
+		}
+		return copy(p, packet), addr, nil
+	}
+}
+
+func (pc *packetConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("unsupported address type %T", addr)
+	}
+	frame, err := encodeFrame(ua, p)
+	if err != nil {
+		return 0, err
+	}
+	if err := pc.ws.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (pc *packetConn) Close() error        { return pc.ws.Close() }
+func (pc *packetConn) LocalAddr() net.Addr { return pc.ws.LocalAddr() }
+
+func (pc *packetConn) SetDeadline(t time.Time) error {
+	if err := pc.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return pc.ws.SetWriteDeadline(t)
+}
+func (pc *packetConn) SetReadDeadline(t time.Time) error  { return pc.ws.SetReadDeadline(t) }
+func (pc *packetConn) SetWriteDeadline(t time.Time) error { return pc.ws.SetWriteDeadline(t) }
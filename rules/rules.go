@@ -0,0 +1,192 @@
+/*
+Package rules is a small automation engine for LIFX devices.
+
+Rules pair a Condition over device state change events (typically from
+lifx.Client.Watch) with an Action to run when the condition is met.
+For instance, to dim the lounge lights when the TV strip turns on:
+
+	eng := rules.NewEngine()
+	eng.Add(rules.Rule{
+		Name: "TV dims lounge",
+		When: rules.TurnedOn(rules.Label("TV strip")),
+		Do:   rules.SetBrightness(rules.Label("Lounge lamp"), 0.3, 2*time.Second),
+	})
+	eng.Run(ctx, client.Watch(ctx, 2*time.Second))
+*/
+package rules
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// A Condition reports whether an event should trigger a rule.
+type Condition func(lifx.Event) bool
+
+// An Action is run when a rule is triggered.
+// The Env gives access to the state of all devices seen so far.
+type Action func(ctx context.Context, env *Env, ev lifx.Event) error
+
+// Rule is a single automation.
+type Rule struct {
+	Name string
+	When Condition
+	Do   Action
+}
+
+// Engine evaluates rules against a stream of events.
+type Engine struct {
+	// Logf, if set, will be used to log rule activity.
+	Logf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	rules []Rule
+}
+
+// NewEngine returns an Engine with no rules.
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Add adds a rule to the engine. It is safe to call while Run is executing.
+func (e *Engine) Add(r Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = append(e.rules, r)
+}
+
+func (e *Engine) logf(format string, args ...interface{}) {
+	if e.Logf != nil {
+		e.Logf(format, args...)
+	}
+}
+
+// Run consumes events until the channel is closed or the context is done.
+// For each event, the rules are evaluated in the order they were added,
+// and the actions of those that match are run in turn before the next event
+// is considered. Action errors are logged but otherwise ignored.
+func (e *Engine) Run(ctx context.Context, events <-chan lifx.Event) error {
+	env := &Env{states: make(map[[6]byte]deviceState)}
+	for {
+		var ev lifx.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok = <-events:
+		}
+		if !ok {
+			return nil
+		}
+		env.states[ev.State.Serial] = deviceState{dev: ev.Device, state: ev.State}
+
+		e.mu.Lock()
+		rules := e.rules
+		e.mu.Unlock()
+		for _, r := range rules {
+			if !r.When(ev) {
+				continue
+			}
+			e.logf("Rule %q triggered by device %x", r.Name, ev.State.Serial)
+			if err := r.Do(ctx, env, ev); err != nil {
+				e.logf("Rule %q failed: %v", r.Name, err)
+			}
+		}
+	}
+}
+
+// Env is the environment in which actions run.
+type Env struct {
+	states map[[6]byte]deviceState
+}
+
+type deviceState struct {
+	dev   *lifx.Device
+	state lifx.WatchedState
+}
+
+// Devices returns the reachable devices whose most recent state matches.
+func (env *Env) Devices(m Matcher) []*lifx.Device {
+	var devs []*lifx.Device
+	for _, ds := range env.states {
+		if ds.state.Reachable && m(ds.state) {
+			devs = append(devs, ds.dev)
+		}
+	}
+	return devs
+}
+
+// A Matcher selects devices by their state.
+type Matcher func(lifx.WatchedState) bool
+
+// Label matches devices with the given label, ignoring case.
+func Label(label string) Matcher {
+	return func(s lifx.WatchedState) bool { return strings.EqualFold(s.Label, label) }
+}
+
+// Serial matches the device with the given serial.
+func Serial(serial [6]byte) Matcher {
+	return func(s lifx.WatchedState) bool { return s.Serial == serial }
+}
+
+// TurnedOn is a condition satisfied when a matching device turns on.
+// A device that is already on when first seen has not turned on.
+func TurnedOn(m Matcher) Condition {
+	return func(ev lifx.Event) bool {
+		return m(ev.State) && ev.State.Reachable && ev.State.Power > 0 &&
+			ev.Prev != nil && ev.Prev.Power == 0
+	}
+}
+
+// TurnedOff is a condition satisfied when a matching device turns off.
+func TurnedOff(m Matcher) Condition {
+	return func(ev lifx.Event) bool {
+		return m(ev.State) && ev.State.Reachable && ev.State.Power == 0 &&
+			ev.Prev != nil && ev.Prev.Power > 0
+	}
+}
+
+// Unreachable is a condition satisfied when a matching device stops responding.
+func Unreachable(m Matcher) Condition {
+	return func(ev lifx.Event) bool {
+		return m(ev.State) && !ev.State.Reachable && ev.Prev != nil && ev.Prev.Reachable
+	}
+}
+
+// SetBrightness is an action that sets the brightness of the matching devices,
+// as a fraction in [0,1], preserving their hue, saturation and kelvin.
+// Levels outside that range are clamped.
+func SetBrightness(m Matcher, level float64, duration time.Duration) Action {
+	brightness := uint16(math.Round(math.Max(0, math.Min(1, level)) * 0xFFFF))
+	return func(ctx context.Context, env *Env, ev lifx.Event) error {
+		for _, d := range env.Devices(m) {
+			col := env.states[d.Serial].state.Color
+			col.Brightness = brightness
+			if err := d.SetColor(ctx, col, duration); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SetPower is an action that turns the matching devices on or off.
+func SetPower(m Matcher, on bool, duration time.Duration) Action {
+	var level uint16
+	if on {
+		level = 0xFFFF
+	}
+	return func(ctx context.Context, env *Env, ev lifx.Event) error {
+		for _, d := range env.Devices(m) {
+			if err := d.SetLightPower(ctx, level, duration); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+package rules
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+)
+
+func TestEngine(t *testing.T) {
+	tv := &lifx.Device{Serial: [6]byte{1}}
+	state := func(power uint16) lifx.WatchedState {
+		return lifx.WatchedState{Serial: tv.Serial, Label: "TV", Power: power, Reachable: true}
+	}
+	off, on := state(0), state(0xFFFF)
+
+	var ons, offs int
+	eng := NewEngine()
+	eng.Add(Rule{
+		Name: "on",
+		When: TurnedOn(Label("tv")),
+		Do:   func(context.Context, *Env, lifx.Event) error { ons++; return nil },
+	})
+	eng.Add(Rule{
+		Name: "off",
+		When: TurnedOff(Label("tv")),
+		Do:   func(context.Context, *Env, lifx.Event) error { offs++; return nil },
+	})
+
+	events := make(chan lifx.Event, 10)
+	events <- lifx.Event{Device: tv, State: off}            // first sighting, off: nothing
+	events <- lifx.Event{Device: tv, Prev: &off, State: on} // turned on
+	events <- lifx.Event{Device: tv, Prev: &on, State: on}  // e.g. a color change: nothing
+	events <- lifx.Event{Device: tv, Prev: &on, State: off} // turned off
+	close(events)
+
+	if err := eng.Run(context.Background(), events); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if ons != 1 || offs != 1 {
+		t.Errorf("got %d on triggers and %d off triggers, want 1 of each", ons, offs)
+	}
+
+	// A device that is already on at startup hasn't turned on.
+	ons, offs = 0, 0
+	events = make(chan lifx.Event, 10)
+	events <- lifx.Event{Device: tv, State: on}            // first sighting, on: nothing
+	events <- lifx.Event{Device: tv, Prev: &on, State: on} // nothing
+	close(events)
+
+	if err := eng.Run(context.Background(), events); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if ons != 0 || offs != 0 {
+		t.Errorf("device on at startup: got %d on triggers and %d off triggers, want none", ons, offs)
+	}
+}
@@ -0,0 +1,222 @@
+package scene
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Capture records the current state of the devices as a scene,
+// with an entry selecting each device by serial.
+// Multizone devices have their zones recorded exactly.
+//
+// Devices whose state can't be captured are left out;
+// the returned error joins their errors, if any.
+func Capture(ctx context.Context, name string, devs []*lifx.Device) (*Scene, error) {
+	entries := make([]*Entry, len(devs))
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state, err := d.CaptureState(ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+				return
+			}
+			serial := d.Serial
+			e := &Entry{
+				Selector: Selector{Serial: &serial},
+				Power:    boolPtr(state.Power() > 0),
+			}
+			if state.NumZones() > 0 {
+				e.Zones = state.Zones()
+			} else {
+				c := state.Color()
+				e.Color = &c
+			}
+			entries[i] = e
+		}()
+	}
+	wg.Wait()
+
+	s := &Scene{Name: name}
+	for _, e := range entries {
+		if e != nil {
+			s.Entries = append(s.Entries, *e)
+		}
+	}
+	sort.Slice(s.Entries, func(i, j int) bool {
+		return bytes.Compare(s.Entries[i].Selector.Serial[:], s.Entries[j].Selector.Serial[:]) < 0
+	})
+	return s, errors.Join(errs...)
+}
+
+// resolveWait is how long Recall waits for devices to respond to discovery.
+const resolveWait = 2 * time.Second
+
+// MissingError is returned by Recall for devices selected by serial that couldn't be found.
+type MissingError struct {
+	Serials [][6]byte
+}
+
+func (e *MissingError) Error() string {
+	s := make([]string, len(e.Serials))
+	for i, serial := range e.Serials {
+		s[i] = hex.EncodeToString(serial[:])
+	}
+	return "devices not found: " + strings.Join(s, ", ")
+}
+
+// Recall finds the scene's devices using the client, and applies the scene to them.
+// Devices selected by serial are located directly; other selectors require discovery.
+// If transition is non-zero, it overrides the scene's default transition.
+//
+// The scene is applied to the devices that are found, even if some are missing,
+// in which case the returned error includes a *MissingError.
+func (s *Scene) Recall(ctx context.Context, c *lifx.Client, transition time.Duration) error {
+	devs, missing, err := s.resolve(ctx, c)
+	if err != nil {
+		return err
+	}
+	sc := *s
+	if transition != 0 {
+		sc.Transition = transition
+	}
+	err = sc.Apply(ctx, devs)
+	if len(missing) > 0 {
+		err = errors.Join(err, &MissingError{Serials: missing})
+	}
+	return err
+}
+
+// resolve locates the devices the scene may apply to.
+func (s *Scene) resolve(ctx context.Context, c *lifx.Client) (devs []*lifx.Device, missing [][6]byte, err error) {
+	found := make(map[[6]byte]bool)
+	var serials [][6]byte
+	needDiscovery := false
+	for _, e := range s.Entries {
+		if e.Selector.Serial == nil {
+			needDiscovery = true
+		} else if serial := *e.Selector.Serial; !found[serial] {
+			found[serial] = false
+			serials = append(serials, serial)
+		}
+	}
+	if needDiscovery {
+		dctx, cancel := context.WithTimeout(ctx, resolveWait)
+		devs, err = c.Discover(dctx)
+		cancel()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, d := range devs {
+			found[d.Serial] = true
+		}
+	}
+
+	// Look for the rest directly.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, serial := range serials {
+		if found[serial] {
+			continue
+		}
+		serial := serial
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dctx, cancel := context.WithTimeout(ctx, resolveWait)
+			defer cancel()
+			d, err := c.DiscoverSerial(dctx, serial)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				missing = append(missing, serial)
+				return
+			}
+			devs = append(devs, d)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(missing, func(i, j int) bool { return bytes.Compare(missing[i][:], missing[j][:]) < 0 })
+	return devs, missing, nil
+}
+
+// WriteFile writes the scene to a file in the form read by ParseFile.
+func (s *Scene) WriteFile(filename string) error {
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0666)
+}
+
+// Write writes the scene as YAML in the form read by Parse.
+// Colors are written exactly, in the "hsbk:" form.
+func (s *Scene) Write(w io.Writer) error {
+	fs := fileScene{Name: s.Name}
+	if s.Transition != 0 {
+		fs.Transition = s.Transition.String()
+	}
+	for _, e := range s.Entries {
+		fs.Lights = append(fs.Lights, e.file())
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(fs); err != nil {
+		return fmt.Errorf("writing scene: %w", err)
+	}
+	return enc.Close()
+}
+
+func (e *Entry) file() fileEntry {
+	fe := fileEntry{
+		All:   e.Selector.All,
+		Label: e.Selector.Label,
+		Group: e.Selector.Group,
+	}
+	if e.Selector.Serial != nil {
+		fe.Serial = hex.EncodeToString(e.Selector.Serial[:])
+	}
+	if e.Power != nil {
+		fe.Power = "off"
+		if *e.Power {
+			fe.Power = "on"
+		}
+	}
+	if e.Color != nil {
+		fe.Color = formatColor(*e.Color)
+	}
+	if e.Brightness != nil {
+		fe.Brightness = strconv.FormatFloat(float64(*e.Brightness)/0xFFFF*100, 'f', -1, 64) + "%"
+	}
+	for _, c := range e.Gradient {
+		fe.Gradient = append(fe.Gradient, formatColor(c))
+	}
+	for _, c := range e.Zones {
+		fe.Zones = append(fe.Zones, formatColor(c))
+	}
+	if e.Transition != 0 {
+		fe.Transition = e.Transition.String()
+	}
+	return fe
+}
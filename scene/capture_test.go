@@ -0,0 +1,107 @@
+package scene
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+type testLight struct {
+	mu    sync.Mutex
+	power uint16
+	color lifx.Color
+}
+
+func (tl *testLight) Power() uint16 {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.power
+}
+
+func (tl *testLight) SetPower(level uint16, _ time.Duration) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.power = level
+}
+
+func (tl *testLight) Color() lifx.Color {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.color
+}
+
+func (tl *testLight) SetColor(c lifx.Color, _ time.Duration) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.color = c
+}
+
+func TestCaptureRecall(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer conn.Close()
+	orig := lifx.Color{Hue: 0x1234, Saturation: 0xFFFF, Brightness: 0x8000, Kelvin: 3500}
+	light := &testLight{power: 0xFFFF, color: orig}
+	vd := &lifx.VirtualDevice{
+		Serial: [6]byte{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03},
+		Light:  light,
+	}
+	go vd.Serve(conn)
+
+	// Direct broadcasts at the virtual device, so Recall can find it.
+	client, err := lifx.NewClient(lifx.WithBroadcastAddr(conn.LocalAddr().(*net.UDPAddr)))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	dev := client.NewDevice(*conn.LocalAddr().(*net.UDPAddr), vd.Serial)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := Capture(ctx, "Test", []*lifx.Device{dev})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	// Round trip through the file format.
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse of written scene: %v\n%s", err, buf.Bytes())
+	}
+	if !reflect.DeepEqual(parsed, s) {
+		t.Errorf("Parse(Write(s)) = %+v, want %+v", parsed, s)
+	}
+
+	light.SetColor(lifx.Color{Kelvin: 9000}, 0)
+	light.SetPower(0, 0)
+
+	// Add an entry for a device that doesn't exist.
+	absent := [6]byte{0xd0, 0x73, 0xd5, 0xFF, 0xFF, 0xFF}
+	parsed.Entries = append(parsed.Entries, Entry{Selector: Selector{Serial: &absent}, Power: boolPtr(true)})
+
+	err = parsed.Recall(ctx, client, 0)
+	var me *MissingError
+	if !errors.As(err, &me) || !reflect.DeepEqual(me.Serials, [][6]byte{absent}) {
+		t.Errorf("Recall = %v, want a MissingError for %x", err, absent)
+	}
+	if got := light.Color(); got != orig {
+		t.Errorf("after Recall, color = %+v, want %+v", got, orig)
+	}
+	if got := light.Power(); got != 0xFFFF {
+		t.Errorf("after Recall, power = %d, want 65535", got)
+	}
+}
@@ -0,0 +1,69 @@
+package scene
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dsymonds/lifx"
+)
+
+const defaultKelvin = lifx.DefaultKelvin
+
+// namedColors are the color names understood in scene files.
+var namedColors = map[string]lifx.Color{
+	"red":    {Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"orange": {Hue: 0x1555, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"yellow": {Hue: 0x2AAA, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"green":  {Hue: 0x5555, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"cyan":   {Hue: 0x8000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"blue":   {Hue: 0xAAAA, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"purple": {Hue: 0xC000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"pink":   {Hue: 0xE38E, Saturation: 0x6666, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+	"white":  {Hue: 0, Saturation: 0, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+}
+
+// parseColor parses a color in one of the forms understood by lifx.ParseColor,
+// or "hsbk:H,S,B,K" with each component in [0,65535], as written by formatColor.
+// The names in namedColors take precedence over the CSS colors of the same name,
+// for compatibility with older scene files.
+func parseColor(s string) (lifx.Color, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+	if hsbk, ok := strings.CutPrefix(s, "hsbk:"); ok {
+		parts := strings.Split(hsbk, ",")
+		var v [4]uint16
+		for i := range v {
+			if len(parts) != len(v) {
+				break
+			}
+			n, err := strconv.ParseUint(strings.TrimSpace(parts[i]), 10, 16)
+			if err != nil {
+				return lifx.Color{}, fmt.Errorf("bad hsbk color %q", s)
+			}
+			v[i] = uint16(n)
+		}
+		if len(parts) != len(v) {
+			return lifx.Color{}, fmt.Errorf("bad hsbk color %q (want four components)", s)
+		}
+		return lifx.Color{Hue: v[0], Saturation: v[1], Brightness: v[2], Kelvin: v[3]}, nil
+	}
+	return lifx.ParseColor(s)
+}
+
+// formatColor formats a color exactly, in a form understood by parseColor.
+func formatColor(c lifx.Color) string {
+	return fmt.Sprintf("hsbk:%d,%d,%d,%d", c.Hue, c.Saturation, c.Brightness, c.Kelvin)
+}
+
+// gradient spreads the stops evenly across n zones,
+// interpolating each HSBK component linearly (taking the short way around the hue circle).
+func gradient(stops []lifx.Color, n int) []lifx.Color {
+	cs := make([]lifx.ColorStop, len(stops))
+	for i, c := range stops {
+		cs[i].Color = c
+	}
+	return lifx.GradientZones(cs, n)
+}
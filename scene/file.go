@@ -0,0 +1,218 @@
+package scene
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileScene is the on-disk form of a scene. JSON is accepted too,
+// since it is (for our purposes) a subset of YAML.
+//
+// An example:
+//
+//	name: Evening
+//	transition: 2s
+//	lights:
+//	  - group: Lounge
+//	    color: kelvin:2700
+//	    brightness: 40%
+//	  - label: TV strip
+//	    gradient: ["#ff0000", purple, blue]
+//	  - label: Hallway
+//	    power: off
+type fileScene struct {
+	Name       string      `yaml:"name"`
+	Transition string      `yaml:"transition,omitempty"`
+	Lights     []fileEntry `yaml:"lights"`
+}
+
+type fileEntry struct {
+	// Selector fields.
+	All    bool   `yaml:"all,omitempty"`
+	Serial string `yaml:"serial,omitempty"`
+	Label  string `yaml:"label,omitempty"`
+	Group  string `yaml:"group,omitempty"`
+
+	Power      string   `yaml:"power,omitempty"`
+	Color      string   `yaml:"color,omitempty"`
+	Brightness string   `yaml:"brightness,omitempty"`
+	Gradient   []string `yaml:"gradient,omitempty"`
+	Zones      []string `yaml:"zones,omitempty"`
+	Transition string   `yaml:"transition,omitempty"`
+}
+
+// ParseFile reads a scene file. See Parse.
+func ParseFile(filename string) (*Scene, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return s, nil
+}
+
+// Parse reads a scene definition in YAML or JSON form.
+//
+// The top level has a name, an optional default transition, and a list of lights.
+// Each light selects devices by any combination of "serial", "label" and "group",
+// or "all: true", and describes their desired state with any of
+//
+//	power:      on or off
+//	color:      a color name, "#rrggbb", "kelvin:N" or "hsbk:H,S,B,K"
+//	brightness: a percentage such as "40%"
+//	gradient:   a list of colors to spread across a multizone device's zones
+//	zones:      a list of colors for each of a multizone device's zones, as saved by Write
+//	transition: a duration such as "1.5s", overriding the scene's default
+func Parse(r io.Reader) (*Scene, error) {
+	var fs fileScene
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&fs); err != nil {
+		return nil, fmt.Errorf("parsing scene: %w", err)
+	}
+	return fs.compile()
+}
+
+func (fs *fileScene) compile() (*Scene, error) {
+	s := &Scene{Name: fs.Name}
+	if fs.Transition != "" {
+		d, err := parseDuration(fs.Transition)
+		if err != nil {
+			return nil, err
+		}
+		s.Transition = d
+	}
+	for i, fe := range fs.Lights {
+		e, err := fe.compile()
+		if err != nil {
+			return nil, fmt.Errorf("light #%d: %w", i+1, err)
+		}
+		s.Entries = append(s.Entries, e)
+	}
+	return s, nil
+}
+
+func (fe *fileEntry) compile() (Entry, error) {
+	var e Entry
+	e.Selector = Selector{
+		All:   fe.All,
+		Label: fe.Label,
+		Group: fe.Group,
+	}
+	if fe.Serial != "" {
+		serial, err := parseSerial(fe.Serial)
+		if err != nil {
+			return Entry{}, err
+		}
+		e.Selector.Serial = &serial
+	}
+	if e.Selector.isZero() {
+		return Entry{}, fmt.Errorf("no selector (need one of all, serial, label, group)")
+	}
+
+	switch strings.ToLower(fe.Power) {
+	case "":
+	case "on", "true":
+		e.Power = boolPtr(true)
+	case "off", "false":
+		e.Power = boolPtr(false)
+	default:
+		return Entry{}, fmt.Errorf("bad power %q (want on or off)", fe.Power)
+	}
+
+	var colors int
+	for _, set := range []bool{fe.Color != "", len(fe.Gradient) > 0, len(fe.Zones) > 0} {
+		if set {
+			colors++
+		}
+	}
+	if colors > 1 {
+		return Entry{}, fmt.Errorf("only one of color, gradient and zones may be set")
+	}
+	if fe.Color != "" {
+		c, err := parseColor(fe.Color)
+		if err != nil {
+			return Entry{}, err
+		}
+		e.Color = &c
+	}
+	for _, gs := range fe.Gradient {
+		c, err := parseColor(gs)
+		if err != nil {
+			return Entry{}, fmt.Errorf("gradient: %w", err)
+		}
+		e.Gradient = append(e.Gradient, c)
+	}
+	for _, zs := range fe.Zones {
+		c, err := parseColor(zs)
+		if err != nil {
+			return Entry{}, fmt.Errorf("zones: %w", err)
+		}
+		e.Zones = append(e.Zones, c)
+	}
+
+	if fe.Brightness != "" {
+		b, err := parsePercent(fe.Brightness)
+		if err != nil {
+			return Entry{}, fmt.Errorf("brightness: %w", err)
+		}
+		e.Brightness = &b
+	}
+
+	if fe.Transition != "" {
+		d, err := parseDuration(fe.Transition)
+		if err != nil {
+			return Entry{}, err
+		}
+		e.Transition = d
+	}
+	return e, nil
+}
+
+func parseSerial(s string) ([6]byte, error) {
+	var serial [6]byte
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(b) != len(serial) {
+		return serial, fmt.Errorf("bad serial %q (want 12 hex digits)", s)
+	}
+	copy(serial[:], b)
+	return serial, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad transition: %w", err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("bad transition %q: negative", s)
+	}
+	return d, nil
+}
+
+// parsePercent parses a percentage like "40%" into the 16-bit range.
+func parsePercent(s string) (uint16, error) {
+	num, ok := strings.CutSuffix(strings.TrimSpace(s), "%")
+	if !ok {
+		return 0, fmt.Errorf("%q is not a percentage", s)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 || f > 100 {
+		return 0, fmt.Errorf("bad percentage %q", s)
+	}
+	return uint16(math.Round(f / 100 * 0xFFFF)), nil
+}
+
+func boolPtr(b bool) *bool { return &b }
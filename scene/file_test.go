@@ -0,0 +1,101 @@
+package scene
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+const testYAML = `
+name: Evening
+transition: 2s
+lights:
+  - group: Lounge
+    color: kelvin:2700
+    brightness: 40%
+  - label: TV strip
+    gradient: ["#ff0000", blue]
+    transition: 500ms
+  - serial: d073d5010203
+    power: off
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse(strings.NewReader(testYAML))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	bright := uint16(0.4 * 0xFFFF)
+	want := &Scene{
+		Name:       "Evening",
+		Transition: 2 * time.Second,
+		Entries: []Entry{
+			{
+				Selector:   Selector{Group: "Lounge"},
+				Color:      &lifx.Color{Brightness: 0xFFFF, Kelvin: 2700},
+				Brightness: &bright,
+			},
+			{
+				Selector: Selector{Label: "TV strip"},
+				Gradient: []lifx.Color{
+					{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: defaultKelvin},
+					namedColors["blue"],
+				},
+				Transition: 500 * time.Millisecond,
+			},
+			{
+				Selector: Selector{Serial: &[6]byte{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03}},
+				Power:    boolPtr(false),
+			},
+		},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Parse mismatch.\n got %+v\nwant %+v", s, want)
+	}
+
+	// The same thing as JSON should parse identically.
+	const testJSON = `{"name": "Evening", "transition": "2s", "lights": [
+		{"group": "Lounge", "color": "kelvin:2700", "brightness": "40%"},
+		{"label": "TV strip", "gradient": ["#ff0000", "blue"], "transition": "500ms"},
+		{"serial": "d0:73:d5:01:02:03", "power": "off"}
+	]}`
+	s, err = Parse(strings.NewReader(testJSON))
+	if err != nil {
+		t.Fatalf("Parse (JSON): %v", err)
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Parse (JSON) mismatch.\n got %+v\nwant %+v", s, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"lights: [{color: red}]",                             // no selector
+		"lights: [{all: true, color: mauve}]",                // unknown color
+		"lights: [{all: true, color: red, gradient: [red]}]", // both color and gradient
+		"lights: [{all: true, power: maybe}]",                // bad power
+		"lights: [{all: true, brightness: 140%}]",            // bad brightness
+		"lights: [{all: true, colour: red}]",                 // unknown field
+	}
+	for _, in := range tests {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	red := lifx.Color{Hue: 0xF000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	orange := lifx.Color{Hue: 0x1000, Saturation: 0xFFFF, Brightness: 0x7FFF, Kelvin: 3500}
+	zones := gradient([]lifx.Color{red, orange}, 3)
+	// The midpoint should wrap through hue 0, not go the long way round.
+	if got := zones[1].Hue; got != 0 {
+		t.Errorf("midpoint hue = %#x, want 0", got)
+	}
+	if zones[0] != red || zones[2] != orange {
+		t.Errorf("endpoints = %+v, %+v; want %+v, %+v", zones[0], zones[2], red, orange)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Package scene provides lighting presets that can be applied to many LIFX devices at once.
+
+A Scene is a list of entries, each selecting some devices and describing the
+state to put them into. Scenes may be built programmatically, loaded from
+human-editable files with Parse, or captured from devices with Capture and
+saved with Write. Recall applies a scene using a Client to find its devices.
+*/
+package scene
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+)
+
+// Scene is a lighting preset.
+type Scene struct {
+	Name string
+
+	// Transition is the default duration over which changes are made.
+	Transition time.Duration
+
+	Entries []Entry
+}
+
+// Entry describes the desired state of the devices matched by its Selector.
+// Fields left as their zero value are not changed.
+type Entry struct {
+	Selector Selector
+
+	Power *bool // whether the light should be on
+
+	// Color, if set, is the color to set.
+	Color *lifx.Color
+	// Brightness, if set, overrides the brightness of Color,
+	// or if Color is not set, changes only the brightness of the current color.
+	Brightness *uint16
+	// Gradient, if set, is spread across the zones of multizone devices.
+	// Devices without zones get the first color.
+	Gradient []lifx.Color
+	// Zones, if set, are the exact colors of the zones of multizone devices.
+	// Devices without zones get the first color.
+	Zones []lifx.Color
+
+	// Transition, if non-zero, overrides the scene's Transition.
+	Transition time.Duration
+}
+
+// Selector chooses devices. All non-zero fields must match.
+// The zero Selector matches nothing; set All to match every device.
+type Selector struct {
+	All    bool
+	Serial *[6]byte
+	Label  string // case insensitive
+	Group  string // case insensitive
+}
+
+func (s Selector) isZero() bool {
+	return !s.All && s.Serial == nil && s.Label == "" && s.Group == ""
+}
+
+func (s Selector) String() string {
+	var parts []string
+	if s.All {
+		parts = append(parts, "all")
+	}
+	if s.Serial != nil {
+		parts = append(parts, fmt.Sprintf("serial=%x", *s.Serial))
+	}
+	if s.Label != "" {
+		parts = append(parts, fmt.Sprintf("label=%q", s.Label))
+	}
+	if s.Group != "" {
+		parts = append(parts, fmt.Sprintf("group=%q", s.Group))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// deviceInfo is what selectors are matched against.
+type deviceInfo struct {
+	serial       [6]byte
+	label, group string
+}
+
+func (s Selector) matches(di deviceInfo) bool {
+	if s.isZero() {
+		return false
+	}
+	if s.Serial != nil && *s.Serial != di.serial {
+		return false
+	}
+	if s.Label != "" && !strings.EqualFold(s.Label, di.label) {
+		return false
+	}
+	if s.Group != "" && !strings.EqualFold(s.Group, di.group) {
+		return false
+	}
+	return true
+}
+
+// Apply applies the scene to the given devices, which may be obtained from Discover.
+// Devices are processed concurrently. Where several entries match a device,
+// they are applied in order.
+//
+// The returned error joins the errors from each device, if any.
+func (s *Scene) Apply(ctx context.Context, devs []*lifx.Device) error {
+	var needLabel, needGroup bool
+	for _, e := range s.Entries {
+		needLabel = needLabel || e.Selector.Label != ""
+		needGroup = needGroup || e.Selector.Group != ""
+	}
+
+	errs := make([]error, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.applyDevice(ctx, d, needLabel, needGroup); err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *Scene) applyDevice(ctx context.Context, d *lifx.Device, needLabel, needGroup bool) error {
+	di := deviceInfo{serial: d.Serial}
+	if needLabel {
+		label, err := d.GetLabel(ctx)
+		if err != nil {
+			return fmt.Errorf("GetLabel: %w", err)
+		}
+		di.label = label
+	}
+	if needGroup {
+		group, err := d.GetGroup(ctx)
+		if err != nil {
+			return fmt.Errorf("GetGroup: %w", err)
+		}
+		di.group = group.Label
+	}
+
+	for _, e := range s.Entries {
+		if !e.Selector.matches(di) {
+			continue
+		}
+		dur := s.Transition
+		if e.Transition != 0 {
+			dur = e.Transition
+		}
+		if err := e.apply(ctx, d, dur); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Entry) apply(ctx context.Context, d *lifx.Device, dur time.Duration) error {
+	// Turn off first, so a color change isn't visible;
+	// turn on last, so it lands on the new color.
+	if e.Power != nil && !*e.Power {
+		if err := d.SetLightPower(ctx, 0, dur); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
+
+	switch {
+	case len(e.Zones) > 0:
+		if err := e.applyZones(ctx, d, dur); err != nil {
+			return err
+		}
+	case len(e.Gradient) > 0:
+		if err := e.applyGradient(ctx, d, dur); err != nil {
+			return err
+		}
+	case e.Color != nil || e.Brightness != nil:
+		var col lifx.Color
+		if e.Color != nil {
+			col = *e.Color
+		} else {
+			var err error
+			col, err = d.GetColor(ctx)
+			if err != nil {
+				return fmt.Errorf("GetColor: %w", err)
+			}
+		}
+		if e.Brightness != nil {
+			col.Brightness = *e.Brightness
+		}
+		if err := d.SetColor(ctx, col, dur); err != nil {
+			return fmt.Errorf("SetColor: %w", err)
+		}
+	}
+
+	if e.Power != nil && *e.Power {
+		if err := d.SetLightPower(ctx, 0xFFFF, dur); err != nil {
+			return fmt.Errorf("SetLightPower: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *Entry) applyGradient(ctx context.Context, d *lifx.Device, dur time.Duration) error {
+	zones, err := d.GetExtendedColorZones(ctx)
+	if err != nil {
+		// Not a multizone device (or not one we can handle); use the first color.
+		col := e.Gradient[0]
+		if e.Brightness != nil {
+			col.Brightness = *e.Brightness
+		}
+		if err := d.SetColor(ctx, col, dur); err != nil {
+			return fmt.Errorf("SetColor: %w", err)
+		}
+		return nil
+	}
+	zones = gradient(e.Gradient, len(zones))
+	if e.Brightness != nil {
+		for i := range zones {
+			zones[i].Brightness = *e.Brightness
+		}
+	}
+	if err := d.SetExtendedColorZones(ctx, dur, zones); err != nil {
+		return fmt.Errorf("SetExtendedColorZones: %w", err)
+	}
+	return nil
+}
+
+func (e *Entry) applyZones(ctx context.Context, d *lifx.Device, dur time.Duration) error {
+	zones := append([]lifx.Color(nil), e.Zones...)
+	if e.Brightness != nil {
+		for i := range zones {
+			zones[i].Brightness = *e.Brightness
+		}
+	}
+	err := d.SetZones(ctx, dur, zones)
+	if errors.Is(err, lifx.ErrUnhandled) {
+		// Not a multizone device; use the first color.
+		err = d.SetColor(ctx, zones[0], dur)
+		if err != nil {
+			return fmt.Errorf("SetColor: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("SetZones: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package schedule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/scene"
+)
+
+// Days is a set of days of the week.
+type Days uint8
+
+const (
+	Daily    = Days(0x7F)
+	Weekdays = Days(1<<time.Monday | 1<<time.Tuesday | 1<<time.Wednesday | 1<<time.Thursday | 1<<time.Friday)
+	Weekends = Days(1<<time.Saturday | 1<<time.Sunday)
+)
+
+// Has reports whether the set includes the day.
+func (d Days) Has(day time.Weekday) bool { return d&(1<<day) != 0 }
+
+// Target selects the devices a rule applies to.
+type Target struct {
+	All   bool
+	Label string // case insensitive
+	Group string // case insensitive
+}
+
+func (t Target) matches(label, group string) bool {
+	switch {
+	case t.All:
+		return true
+	case t.Label != "":
+		return strings.EqualFold(t.Label, label)
+	case t.Group != "":
+		return strings.EqualFold(t.Group, group)
+	}
+	return false
+}
+
+// Rule is something to do to some devices at a time of day on some days of the week.
+type Rule struct {
+	Text string // the rule as written, for logging
+
+	Days Days
+	At   time.Duration // time of day, as an offset from midnight
+
+	Target Target
+	// Action is what to do to each device. Its Selector is ignored.
+	Action scene.Entry
+}
+
+func (r Rule) String() string {
+	if r.Text != "" {
+		return r.Text
+	}
+	return fmt.Sprintf("rule at %v", r.At)
+}
+
+// Next returns the first time after t at which the rule triggers,
+// in t's location. If the rule has no days, it never triggers,
+// and the zero time is returned.
+func (r Rule) Next(t time.Time) time.Time {
+	if r.Days&Daily == 0 {
+		return time.Time{}
+	}
+	h, m := int(r.At/time.Hour), int(r.At%time.Hour/time.Minute)
+	y, mon, d := t.Date()
+	for i := 0; i <= 7; i++ {
+		next := time.Date(y, mon, d+i, h, m, 0, 0, t.Location())
+		if next.After(t) && r.Days.Has(next.Weekday()) {
+			return next
+		}
+	}
+	panic("unreachable")
+}
+
+// ParseRules reads rules, one per line, in the form accepted by ParseRule.
+// Blank lines and lines starting with "#" are ignored.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading rules: %w", err)
+	}
+	return rules, nil
+}
+
+// ParseRule parses a rule of the form
+//
+//	<days> <HH:MM> <verb> <target> [to <color>...] [over <duration>]
+//
+// for example
+//
+//	weekdays 07:00 fade Bedroom to 60% 3000K over 10m
+//	sat,sun 23:30 off group Downstairs
+//
+// Days are "daily", "weekdays", "weekends", or a comma-separated list such as "mon,wed,fri".
+// The verb is "on" or "off", which set the power, or "set" or "fade", which leave it alone.
+// The target is "all", "group" followed by a group name, or otherwise a device label.
+// Colors are a brightness percentage, a temperature such as "2700K",
+// or anything accepted by lifx.ParseColor. A temperature without a brightness
+// or other color is at full brightness.
+func ParseRule(s string) (Rule, error) {
+	r := Rule{Text: s}
+	f := strings.Fields(s)
+	if len(f) < 4 {
+		return Rule{}, fmt.Errorf("rule %q too short", s)
+	}
+	var err error
+	if r.Days, err = parseDays(f[0]); err != nil {
+		return Rule{}, err
+	}
+	t, err := time.Parse("15:04", f[1])
+	if err != nil {
+		return Rule{}, fmt.Errorf("bad time %q: want HH:MM", f[1])
+	}
+	r.At = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	verb := strings.ToLower(f[2])
+	switch verb {
+	case "on":
+		r.Action.Power = boolPtr(true)
+	case "off":
+		r.Action.Power = boolPtr(false)
+	case "set", "fade":
+	default:
+		return Rule{}, fmt.Errorf("unknown verb %q", f[2])
+	}
+
+	// Split the remainder into target, colors and duration.
+	rest := f[3:]
+	clause := func() []string {
+		i := 0
+		for i < len(rest) && !isKeyword(rest[i]) {
+			i++
+		}
+		words := rest[:i]
+		rest = rest[i:]
+		return words
+	}
+	target := clause()
+	if len(target) == 0 {
+		return Rule{}, fmt.Errorf("missing target")
+	}
+	switch {
+	case len(target) == 1 && strings.EqualFold(target[0], "all"):
+		r.Target.All = true
+	case strings.EqualFold(target[0], "group"):
+		if len(target) == 1 {
+			return Rule{}, fmt.Errorf("missing group name")
+		}
+		r.Target.Group = strings.Join(target[1:], " ")
+	default:
+		r.Target.Label = strings.Join(target, " ")
+	}
+	var sawColor bool
+	for len(rest) > 0 {
+		kw := strings.ToLower(rest[0])
+		rest = rest[1:]
+		words := clause()
+		if len(words) == 0 {
+			return Rule{}, fmt.Errorf("nothing after %q", kw)
+		}
+		switch kw {
+		case "to":
+			if sawColor {
+				return Rule{}, fmt.Errorf("repeated %q", kw)
+			}
+			sawColor = true
+			if verb == "off" {
+				return Rule{}, fmt.Errorf("can't turn off to a color")
+			}
+			if err := parseColors(words, &r.Action); err != nil {
+				return Rule{}, err
+			}
+		case "over":
+			if r.Action.Transition != 0 || len(words) != 1 {
+				return Rule{}, fmt.Errorf("bad duration %q", strings.Join(words, " "))
+			}
+			d, err := time.ParseDuration(words[0])
+			if err != nil || d <= 0 {
+				return Rule{}, fmt.Errorf("bad duration %q", words[0])
+			}
+			r.Action.Transition = d
+		}
+	}
+	if (verb == "set" || verb == "fade") && !sawColor {
+		return Rule{}, fmt.Errorf("%q needs a color", verb)
+	}
+	return r, nil
+}
+
+func isKeyword(w string) bool {
+	w = strings.ToLower(w)
+	return w == "to" || w == "over"
+}
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseDays(s string) (Days, error) {
+	switch strings.ToLower(s) {
+	case "daily":
+		return Daily, nil
+	case "weekdays":
+		return Weekdays, nil
+	case "weekends":
+		return Weekends, nil
+	}
+	var days Days
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(name)
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		day, ok := dayNames[name]
+		if !ok {
+			return 0, fmt.Errorf("bad days %q", s)
+		}
+		days |= 1 << day
+	}
+	return days, nil
+}
+
+func parseColors(words []string, e *scene.Entry) error {
+	var col *lifx.Color
+	var kelvin uint16
+	for _, w := range words {
+		if num, ok := strings.CutSuffix(w, "%"); ok {
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil || f < 0 || f > 100 || e.Brightness != nil {
+				return fmt.Errorf("bad brightness %q", w)
+			}
+			b := uint16(math.Round(f / 100 * 0xFFFF))
+			e.Brightness = &b
+			continue
+		}
+		if num, ok := strings.CutSuffix(strings.ToUpper(w), "K"); ok {
+			if k, err := strconv.ParseUint(num, 10, 16); err == nil {
+				if kelvin != 0 {
+					return fmt.Errorf("repeated temperature %q", w)
+				}
+				kelvin = uint16(k)
+				continue
+			}
+		}
+		c, err := lifx.ParseColor(w)
+		if err != nil {
+			return err
+		}
+		if col != nil {
+			return fmt.Errorf("repeated color %q", w)
+		}
+		col = &c
+	}
+	if kelvin != 0 {
+		if col == nil {
+			col = &lifx.Color{Brightness: 0xFFFF}
+		}
+		col.Kelvin = kelvin
+	}
+	e.Color = col
+	return nil
+}
+
+func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,322 @@
+/*
+Package schedule runs LIFX actions at set times of day.
+
+Rules are written in a compact, cron-like form:
+
+	weekdays 07:00 on Bedroom to 60% 3000K over 10m
+	daily 23:30 off all
+
+A Scheduler triggers each rule at its time against the devices it discovers.
+Devices that were previously seen but are offline when a rule triggers
+(or fail to respond) are caught up when they reappear, as long as that's
+within the Scheduler's CatchUp window; any transition is shortened
+by how late the device is.
+*/
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/scene"
+)
+
+const (
+	// DefaultCatchUp is how long after a rule triggers a device that missed it
+	// may be caught up, by default.
+	DefaultCatchUp = time.Hour
+	// DefaultPoll is how often a Scheduler looks for offline devices
+	// that need catching up, by default.
+	DefaultPoll = time.Minute
+)
+
+// discoverWait is how long a Scheduler waits for devices to respond to discovery.
+const discoverWait = 2 * time.Second
+
+// Scheduler runs rules against the devices found by a Client.
+type Scheduler struct {
+	Client *lifx.Client
+	Rules  []Rule
+
+	// CatchUp is how late a device that missed a rule may still have it applied.
+	// If zero, DefaultCatchUp is used; if negative, devices are never caught up.
+	CatchUp time.Duration
+	// Poll is how often to look for devices that need catching up.
+	// If zero, DefaultPoll is used.
+	Poll time.Duration
+
+	// Logf, if set, will be used to log activity.
+	Logf func(format string, args ...interface{})
+
+	// discover, if set, is used instead of Client.Discover.
+	discover func(ctx context.Context) ([]*lifx.Device, error)
+
+	mu      sync.Mutex
+	known   map[[6]byte]deviceInfo
+	pending map[[6]byte][]firing // rules that devices missed, in trigger order
+}
+
+type deviceInfo struct {
+	label, group string
+}
+
+// firing is a rule triggering at a particular time.
+type firing struct {
+	rule *Rule
+	at   time.Time
+}
+
+func (s *Scheduler) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+func (s *Scheduler) catchUp() time.Duration {
+	if s.CatchUp == 0 {
+		return DefaultCatchUp
+	}
+	return s.CatchUp
+}
+
+// Run triggers rules at their times until ctx is done.
+// Errors applying rules are logged but otherwise ignored.
+func (s *Scheduler) Run(ctx context.Context) error {
+	poll := s.Poll
+	if poll == 0 {
+		poll = DefaultPoll
+	}
+	last := time.Now()
+	for {
+		var next time.Time
+		for i := range s.Rules {
+			if t := s.Rules[i].Next(last); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+		wait := poll
+		if !next.IsZero() {
+			if d := time.Until(next); d < wait {
+				wait = d
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		var due []*Rule
+		for i := range s.Rules {
+			if t := s.Rules[i].Next(last); !t.IsZero() && !t.After(now) {
+				due = append(due, &s.Rules[i])
+			}
+		}
+		if len(due) > 0 {
+			s.trigger(ctx, due, now)
+			last = now
+		} else if s.hasPending() {
+			s.catchUpPending(ctx, now)
+		}
+	}
+}
+
+// Trigger applies a rule immediately, as if it had just triggered.
+func (s *Scheduler) Trigger(ctx context.Context, r *Rule) {
+	s.trigger(ctx, []*Rule{r}, time.Now())
+}
+
+func (s *Scheduler) trigger(ctx context.Context, rules []*Rule, at time.Time) {
+	found, err := s.refresh(ctx)
+	if err != nil {
+		s.logf("Discovering devices: %v", err)
+	}
+	s.mu.Lock()
+	known := make(map[[6]byte]deviceInfo, len(s.known))
+	for serial, di := range s.known {
+		known[serial] = di
+	}
+	s.mu.Unlock()
+
+	for _, r := range rules {
+		s.logf("Triggering %v", r)
+		var devs []*lifx.Device
+		for serial, di := range known {
+			if !r.Target.matches(di.label, di.group) {
+				continue
+			}
+			if d, ok := found[serial]; ok {
+				devs = append(devs, d)
+			} else {
+				s.logf("Device %x offline for %v", serial, r)
+				s.addPending(serial, firing{r, at})
+			}
+		}
+		s.apply(ctx, devs, firing{r, at}, at)
+	}
+}
+
+// apply applies the firing to the devices, remembering failures for catching up.
+func (s *Scheduler) apply(ctx context.Context, devs []*lifx.Device, f firing, now time.Time) {
+	e := f.rule.Action
+	e.Selector = scene.Selector{All: true}
+	if late := now.Sub(f.at); late > 0 {
+		e.Transition -= late
+		if e.Transition < 0 {
+			e.Transition = 0
+		}
+	}
+	sc := &scene.Scene{Entries: []scene.Entry{e}}
+	lifx.Collection(devs).Each(ctx, func(ctx context.Context, d *lifx.Device) error {
+		if err := sc.Apply(ctx, []*lifx.Device{d}); err != nil {
+			s.logf("Applying %v to %x: %v", f.rule, d.Serial, err)
+			s.addPending(d.Serial, f)
+			return nil
+		}
+		s.supersede(d.Serial, f.at)
+		return nil
+	})
+}
+
+// refresh discovers devices, recording their labels and groups,
+// and returns those that responded.
+func (s *Scheduler) refresh(ctx context.Context) (map[[6]byte]*lifx.Device, error) {
+	discover := s.discover
+	if discover == nil {
+		discover = s.Client.Discover
+	}
+	dctx, cancel := context.WithTimeout(ctx, discoverWait)
+	devs, err := discover(dctx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[[6]byte]*lifx.Device)
+	var mu sync.Mutex
+	lifx.Collection(devs).Each(ctx, func(ctx context.Context, d *lifx.Device) error {
+		label, err := d.GetLabel(ctx)
+		if err != nil {
+			return err
+		}
+		group, err := d.GetGroup(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		found[d.Serial] = d
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.known == nil {
+			s.known = make(map[[6]byte]deviceInfo)
+		}
+		s.known[d.Serial] = deviceInfo{label: label, group: group.Label}
+		return nil
+	})
+	return found, nil
+}
+
+func (s *Scheduler) addPending(serial [6]byte, f firing) {
+	if s.catchUp() < 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[[6]byte][]firing)
+	}
+	// Only the latest firing of each rule matters.
+	fs := s.pending[serial][:0]
+	for _, old := range s.pending[serial] {
+		if old.rule != f.rule {
+			fs = append(fs, old)
+		}
+	}
+	s.pending[serial] = append(fs, f)
+}
+
+// supersede forgets pending firings for a device from before at,
+// since a later rule has been applied to it.
+func (s *Scheduler) supersede(serial [6]byte, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fs []firing
+	for _, f := range s.pending[serial] {
+		if !f.at.Before(at) {
+			fs = append(fs, f)
+		}
+	}
+	if len(fs) == 0 {
+		delete(s.pending, serial)
+	} else {
+		s.pending[serial] = fs
+	}
+}
+
+func (s *Scheduler) hasPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending) > 0
+}
+
+// catchUpPending applies missed rules to devices that are back online.
+func (s *Scheduler) catchUpPending(ctx context.Context, now time.Time) {
+	// Take the pending firings that are still in the window;
+	// any that fail again are re-added by apply.
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for serial, fs := range pending {
+		live := fs[:0]
+		for _, f := range fs {
+			if now.Sub(f.at) <= s.catchUp() {
+				live = append(live, f)
+			} else {
+				s.logf("Device %x missed %v; giving up", serial, f.rule)
+			}
+		}
+		if len(live) == 0 {
+			delete(pending, serial)
+		} else {
+			pending[serial] = live
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	found, err := s.refresh(ctx)
+	if err != nil {
+		s.logf("Discovering devices: %v", err)
+	}
+	for serial, fs := range pending {
+		d, ok := found[serial]
+		if !ok {
+			for _, f := range fs {
+				s.addPending(serial, f)
+			}
+			continue
+		}
+		for _, f := range fs {
+			s.logf("Catching up %x on %v", serial, f.rule)
+			s.apply(ctx, []*lifx.Device{d}, f, now)
+		}
+	}
+}
+
+// Pending returns the serials of devices with rules waiting to be caught up.
+func (s *Scheduler) Pending() [][6]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var serials [][6]byte
+	for serial := range s.pending {
+		serials = append(serials, serial)
+	}
+	return serials
+}
@@ -0,0 +1,200 @@
+package schedule
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/scene"
+)
+
+func TestParseRule(t *testing.T) {
+	b60 := uint16(39321)
+	tests := []struct {
+		in   string
+		want Rule
+	}{
+		{"weekdays 07:00 fade Bedroom to 60% 3000K over 10m", Rule{
+			Days:   Weekdays,
+			At:     7 * time.Hour,
+			Target: Target{Label: "Bedroom"},
+			Action: scene.Entry{
+				Color:      &lifx.Color{Brightness: 0xFFFF, Kelvin: 3000},
+				Brightness: &b60,
+				Transition: 10 * time.Minute,
+			},
+		}},
+		{"sat,sunday 23:30 off group Down Stairs", Rule{
+			Days:   Weekends,
+			At:     23*time.Hour + 30*time.Minute,
+			Target: Target{Group: "Down Stairs"},
+			Action: scene.Entry{Power: boolPtr(false)},
+		}},
+		{"daily 18:00 on all to red", Rule{
+			Days:   Daily,
+			At:     18 * time.Hour,
+			Target: Target{All: true},
+			Action: scene.Entry{
+				Power: boolPtr(true),
+				Color: &lifx.Color{Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: lifx.DefaultKelvin},
+			},
+		}},
+	}
+	for _, test := range tests {
+		got, err := ParseRule(test.in)
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", test.in, err)
+			continue
+		}
+		test.want.Text = test.in
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseRule(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"weekdays 07:00 on",
+		"someday 07:00 on Bedroom",
+		"daily 7am on Bedroom",
+		"daily 07:00 dance Bedroom",
+		"daily 07:00 set Bedroom",
+		"daily 07:00 off Bedroom to red",
+		"daily 07:00 on Bedroom to 120%",
+		"daily 07:00 on Bedroom over soon",
+	} {
+		if _, err := ParseRule(bad); err == nil {
+			t.Errorf("ParseRule(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	r := Rule{Days: Weekdays, At: 7 * time.Hour}
+	fri := time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC) // a Friday, after the rule
+	if got, want := r.Next(fri), time.Date(2024, 6, 10, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", fri, got, want)
+	}
+	early := time.Date(2024, 6, 7, 6, 0, 0, 0, time.UTC)
+	if got, want := r.Next(early), time.Date(2024, 6, 7, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", early, got, want)
+	}
+	if got := r.Next(r.Next(early)); got.Equal(r.Next(early)) {
+		t.Errorf("Next returned its argument")
+	}
+	for _, days := range []Days{0, 0x80} {
+		if got := (Rule{Days: days, At: 7 * time.Hour}).Next(fri); !got.IsZero() {
+			t.Errorf("Next with Days %#x = %v, want zero time", uint8(days), got)
+		}
+	}
+}
+
+type testLight struct {
+	mu    sync.Mutex
+	power uint16
+	color lifx.Color
+}
+
+func (tl *testLight) Power() uint16 {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.power
+}
+
+func (tl *testLight) SetPower(level uint16, _ time.Duration) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.power = level
+}
+
+func (tl *testLight) Color() lifx.Color {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.color
+}
+
+func (tl *testLight) SetColor(c lifx.Color, _ time.Duration) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.color = c
+}
+
+func TestCatchUp(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer conn.Close()
+	light := &testLight{}
+	vd := &lifx.VirtualDevice{
+		Serial: [6]byte{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03},
+		Light:  light,
+	}
+	vd.SetLabel("Bedroom")
+	go vd.Serve(conn)
+
+	client, err := lifx.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	dev := client.NewDevice(*conn.LocalAddr().(*net.UDPAddr), vd.Serial)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	online := true
+	s := &Scheduler{
+		discover: func(context.Context) ([]*lifx.Device, error) {
+			if online {
+				return []*lifx.Device{dev}, nil
+			}
+			return nil, nil
+		},
+	}
+	on, err := ParseRule("daily 07:00 on Bedroom")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	s.Trigger(ctx, &on)
+	if light.Power() != 0xFFFF {
+		t.Fatalf("light not turned on by trigger")
+	}
+
+	// The light goes offline and misses a rule.
+	online = false
+	blue, err := ParseRule("daily 08:00 set bedroom to blue over 1h")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	s.Trigger(ctx, &blue)
+	if got := s.Pending(); !reflect.DeepEqual(got, [][6]byte{vd.Serial}) {
+		t.Fatalf("Pending = %x, want [%x]", got, vd.Serial)
+	}
+
+	// Nothing happens while it's still away.
+	s.catchUpPending(ctx, time.Now())
+	if len(s.Pending()) != 1 {
+		t.Fatalf("pending rule dropped while device offline")
+	}
+
+	online = true
+	s.catchUpPending(ctx, time.Now())
+	if got, want := light.Color(), blue.Action.Color; got != *want {
+		t.Errorf("after catching up, color = %+v, want %+v", got, *want)
+	}
+	if got := s.Pending(); len(got) != 0 {
+		t.Errorf("Pending = %x after catching up, want none", got)
+	}
+
+	// A rule missed for too long is dropped.
+	online = false
+	s.Trigger(ctx, &blue)
+	s.catchUpPending(ctx, time.Now().Add(2*DefaultCatchUp))
+	if got := s.Pending(); len(got) != 0 {
+		t.Errorf("Pending = %x after catch-up window, want none", got)
+	}
+}
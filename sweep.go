@@ -0,0 +1,155 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// SweptState is the state of a single device as observed by SweepState.
+type SweptState struct {
+	Device *Device
+
+	// HasPower reports whether a StatePower response was received,
+	// in which case Power is valid.
+	HasPower bool
+	Power    uint16
+
+	// HasColor reports whether a LightState response was received,
+	// in which case Color, LightPower and Label are valid.
+	// Non-light devices will not respond with a LightState.
+	HasColor   bool
+	Color      Color
+	LightPower uint16
+	Label      string
+
+	// Zones holds the zone colors of multi-zone devices.
+	// It is only populated by sweeps that ask for zones,
+	// and only once every zone has been received.
+	Zones []Color
+}
+
+// sweepWait is how long SweepState waits for responses
+// if the context has no deadline.
+const sweepWait = 2 * time.Second
+
+// SweepState broadcasts GetColor and GetPower to all devices on the network
+// and collects the responses. This takes a snapshot of every device's state
+// with two packets, rather than a round trip or two per device.
+//
+// Like Discover, the provided context controls how long to wait for responses,
+// and its expiry is not an error. A few seconds is usually plenty,
+// and is used if the context has no deadline.
+// UDP is unreliable, so devices may be missing from the result or only have
+// partial state; callers needing certainty should query devices directly.
+func (c *Client) SweepState(ctx context.Context) ([]*SweptState, error) {
+	return c.sweep(ctx, false)
+}
+
+// sweep implements SweepState, optionally also requesting zone colors.
+func (c *Client) sweep(ctx context.Context, zones bool) ([]*SweptState, error) {
+	conn, err := c.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, ok := ctx.Deadline(); !ok {
+		conn.SetReadDeadline(time.Now().Add(sweepWait))
+	}
+
+	if err := c.broadcast(conn, pktGetColor, nil); err != nil {
+		return nil, fmt.Errorf("sending GetColor broadcast: %v", err)
+	}
+	if err := c.broadcast(conn, pktGetPower, nil); err != nil {
+		return nil, fmt.Errorf("sending GetPower broadcast: %v", err)
+	}
+	if zones {
+		// Devices without zones will respond with StateUnhandled, which is ignored.
+		if err := c.broadcast(conn, pktGetExtendedColorZones, nil); err != nil {
+			return nil, fmt.Errorf("sending GetExtendedColorZones broadcast: %v", err)
+		}
+	}
+
+	var states []*SweptState
+	bySerial := make(map[[6]byte]*SweptState)
+	zoneParts := make(map[[6]byte]*zoneCollector)
+	for {
+		hdr, payload, raddr, err := readOnePacket(conn)
+		if err != nil {
+			var neterr net.Error
+			if errors.As(err, &neterr) && neterr.Timeout() {
+				// Not a failure.
+				break
+			}
+			var derr *protocol.DecodeError
+			if errors.As(err, &derr) {
+				// A garbled packet; the rest of the sweep may still be fine.
+				continue
+			}
+			return nil, err
+		}
+		if hdr.Source != c.source {
+			// Not a response to us.
+			continue
+		}
+		if c.admit([6]byte(hdr.Target[0:6]), raddr) != nil {
+			continue
+		}
+
+		serial := [6]byte(hdr.Target[0:6])
+		st, ok := bySerial[serial]
+		if !ok {
+			st = &SweptState{
+				// Responses come from the device's service port.
+				Device: c.NewDevice(*raddr, serial),
+			}
+		}
+
+		switch hdr.Type {
+		case pktLightState:
+			ls, err := decodeLightState(payload)
+			if err != nil {
+				continue
+			}
+			st.HasColor = true
+			st.Color, st.LightPower, st.Label = ls.color, ls.power, ls.label
+		case pktStatePower:
+			level, err := decodeLevel(pktStatePower, payload)
+			if err != nil {
+				continue
+			}
+			st.HasPower = true
+			st.Power = level
+		case pktStateExtendedColorZones:
+			// Devices with many zones send several messages.
+			count, index, colors, err := decodeExtendedColorZonesPart(payload)
+			if err != nil {
+				continue
+			}
+			zc := zoneParts[serial]
+			if zc == nil {
+				zc = new(zoneCollector)
+				zoneParts[serial] = zc
+			}
+			if zc.add(count, index, colors) != nil {
+				continue
+			}
+			if zc.complete() {
+				st.Zones = zc.zones
+			}
+		default:
+			// Some different message for someone else?
+			continue
+		}
+
+		if !ok {
+			bySerial[serial] = st
+			states = append(states, st)
+		}
+	}
+	return states, nil
+}
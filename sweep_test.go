@@ -0,0 +1,39 @@
+package lifx_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestSweepZones(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	strip := lifxtest.NewStrip(120)
+	zones := make([]lifx.Color, 120)
+	for i := range zones {
+		zones[i] = lifx.Color{Hue: uint16(i * 500), Kelvin: 3500}
+	}
+	strip.SetZones(0, zones, 0)
+	strip.SetPower(0xFFFF, 0)
+	n.Add(testSerial, "Strip", strip)
+
+	// Without a deadline, the sweep still ends.
+	states, err := n.Client().SweepZonesForTest(context.Background())
+	if err != nil {
+		t.Fatalf("SweepState: %v", err)
+	}
+	if len(states) != 1 {
+		t.Fatalf("SweepState found %d devices, want 1", len(states))
+	}
+	st := states[0]
+	if !st.HasPower || st.Power != 0xFFFF || !st.HasColor || st.Label != "Strip" {
+		t.Errorf("SweepState = %+v, want power 65535 and label %q", st, "Strip")
+	}
+	// The zones arrive in two messages.
+	if !reflect.DeepEqual(st.Zones, zones) {
+		t.Errorf("SweepState zones = %v, want %v", st.Zones, zones)
+	}
+}
@@ -0,0 +1,253 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// GetRelayPower returns the power level of a relay on a LIFX Switch.
+// Relays are indexed from zero.
+func (d *Device) GetRelayPower(ctx context.Context, relay uint8) (uint16, error) {
+	if err := d.requireFeature("relays", hasRelays); err != nil {
+		return 0, err
+	}
+	payload, err := d.query(ctx, pktGetRPower, pktStateRPower, []byte{relay})
+	if err != nil {
+		return 0, err
+	}
+	index, level, err := decodeRelayPower(payload)
+	if err != nil {
+		return 0, err
+	}
+	if index != relay {
+		return 0, fmt.Errorf("StateRPower for relay %d, want %d", index, relay)
+	}
+	return level, nil
+}
+
+func decodeRelayPower(payload []byte) (relay uint8, level uint16, err error) {
+	if err := checkLength(pktStateRPower, payload, 3); err != nil {
+		return 0, 0, err
+	}
+	return payload[0], binary.LittleEndian.Uint16(payload[1:3]), nil
+}
+
+// SetRelayPower sets the power level of a relay on a LIFX Switch.
+// Relays are indexed from zero. Only 0 (off) and 65535 (on) are valid levels.
+func (d *Device) SetRelayPower(ctx context.Context, relay uint8, level uint16) error {
+	if err := d.requireFeature("relays", hasRelays); err != nil {
+		return err
+	}
+	if level != 0 && level != 0xFFFF {
+		return fmt.Errorf("bad power level %d; must be 0 or 65535", level)
+	}
+	payload := []byte{relay}
+	payload = binary.LittleEndian.AppendUint16(payload, level)
+	return d.set(ctx, pktSetRPower, payload)
+}
+
+// ButtonGesture identifies how a button on a LIFX Switch is pressed.
+type ButtonGesture uint16
+
+const (
+	GesturePress      = ButtonGesture(1)
+	GestureHold       = ButtonGesture(2)
+	GesturePressPress = ButtonGesture(3)
+	GesturePressHold  = ButtonGesture(4)
+	GestureHoldHold   = ButtonGesture(5)
+)
+
+// ButtonTargetType identifies what a button action controls.
+type ButtonTargetType uint16
+
+const (
+	TargetRelays       = ButtonTargetType(2) // relays on the switch itself
+	TargetDevice       = ButtonTargetType(3)
+	TargetLocation     = ButtonTargetType(4)
+	TargetGroup        = ButtonTargetType(5)
+	TargetScene        = ButtonTargetType(6)
+	TargetDeviceRelays = ButtonTargetType(7) // relays on another switch
+)
+
+// ButtonAction binds a gesture to a target.
+//
+// The interpretation of Target depends on TargetType:
+// for TargetRelays, use Relays;
+// for TargetDevice, use Serial;
+// for TargetLocation, TargetGroup and TargetScene, Target is the 16-byte ID;
+// for TargetDeviceRelays, use Serial and Relays.
+type ButtonAction struct {
+	Gesture    ButtonGesture
+	TargetType ButtonTargetType
+	Target     [16]byte
+}
+
+// Relays returns the relay indexes targeted by a TargetRelays or TargetDeviceRelays action.
+func (ba ButtonAction) Relays() []uint8 {
+	var b []byte
+	switch ba.TargetType {
+	case TargetRelays:
+		b = ba.Target[:]
+	case TargetDeviceRelays:
+		b = ba.Target[6:]
+	default:
+		return nil
+	}
+	n := int(b[0])
+	if n > len(b)-1 {
+		n = len(b) - 1
+	}
+	return append([]uint8(nil), b[1:1+n]...)
+}
+
+// Serial returns the device targeted by a TargetDevice or TargetDeviceRelays action.
+func (ba ButtonAction) Serial() [6]byte {
+	return [6]byte(ba.Target[0:6])
+}
+
+// Button is the set of actions bound to one button of a LIFX Switch.
+type Button struct {
+	Actions []ButtonAction // at most 5
+}
+
+// Sizes of the button structures in messages.
+// https://lan.developer.lifx.com/docs/field-types#button
+const (
+	buttonActionLength = 2 + 2 + 16
+	maxButtonActions   = 5
+	buttonLength       = 1 + maxButtonActions*buttonActionLength
+	maxButtons         = 8
+)
+
+func decodeButton(b []byte) Button {
+	n := int(b[0])
+	if n > maxButtonActions {
+		n = maxButtonActions
+	}
+	var btn Button
+	for i := 0; i < n; i++ {
+		off := 1 + i*buttonActionLength
+		var ba ButtonAction
+		ba.Gesture = ButtonGesture(binary.LittleEndian.Uint16(b[off : off+2]))
+		ba.TargetType = ButtonTargetType(binary.LittleEndian.Uint16(b[off+2 : off+4]))
+		copy(ba.Target[:], b[off+4:off+buttonActionLength])
+		btn.Actions = append(btn.Actions, ba)
+	}
+	return btn
+}
+
+func (btn Button) encode() ([]byte, error) {
+	if len(btn.Actions) > maxButtonActions {
+		return nil, fmt.Errorf("too many button actions; %d > %d", len(btn.Actions), maxButtonActions)
+	}
+	b := make([]byte, buttonLength)
+	b[0] = uint8(len(btn.Actions))
+	for i, ba := range btn.Actions {
+		off := 1 + i*buttonActionLength
+		binary.LittleEndian.PutUint16(b[off:off+2], uint16(ba.Gesture))
+		binary.LittleEndian.PutUint16(b[off+2:off+4], uint16(ba.TargetType))
+		copy(b[off+4:off+buttonActionLength], ba.Target[:])
+	}
+	return b, nil
+}
+
+// GetButtons returns the actions bound to each button of a LIFX Switch.
+func (d *Device) GetButtons(ctx context.Context) ([]Button, error) {
+	if err := d.requireFeature("buttons", hasButtons); err != nil {
+		return nil, err
+	}
+	payload, err := d.query(ctx, pktGetButton, pktStateButton, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeButtons(payload)
+}
+
+func decodeButtons(payload []byte) ([]Button, error) {
+	if err := checkMinLength(pktStateButton, payload, 3+maxButtons*buttonLength); err != nil {
+		return nil, err
+	}
+	count, index, n := int(payload[0]), int(payload[1]), int(payload[2])
+	// Like StateExtendedColorZones, assume the entire state fits in one message.
+	if index != 0 || n != count || n > maxButtons {
+		return nil, malformed(pktStateButton, payload, "can't handle partial message (count=%d index=%d buttons_count=%d)", count, index, n)
+	}
+	buttons := make([]Button, n)
+	for i := range buttons {
+		off := 3 + i*buttonLength
+		buttons[i] = decodeButton(payload[off : off+buttonLength])
+	}
+	return buttons, nil
+}
+
+// SetButtons sets the actions bound to the buttons of a LIFX Switch,
+// starting with the button at the given index.
+func (d *Device) SetButtons(ctx context.Context, index uint8, buttons []Button) error {
+	if err := d.requireFeature("buttons", hasButtons); err != nil {
+		return err
+	}
+	if len(buttons) > maxButtons {
+		return fmt.Errorf("too many buttons; %d > %d", len(buttons), maxButtons)
+	}
+	payload := make([]byte, 2, 2+maxButtons*buttonLength)
+	payload[0] = index
+	payload[1] = uint8(len(buttons))
+	for _, btn := range buttons {
+		b, err := btn.encode()
+		if err != nil {
+			return err
+		}
+		payload = append(payload, b...)
+	}
+	payload = payload[:cap(payload)] // pad the remaining buttons with zeros
+	return d.set(ctx, pktSetButton, payload)
+}
+
+// ButtonConfig is the haptic and backlight configuration of a LIFX Switch.
+type ButtonConfig struct {
+	HapticDuration time.Duration // rounded to milliseconds
+	BacklightOn    Color         // when the relay is on
+	BacklightOff   Color         // when the relay is off
+}
+
+// GetButtonConfig returns the switch's haptic and backlight configuration.
+func (d *Device) GetButtonConfig(ctx context.Context) (ButtonConfig, error) {
+	if err := d.requireFeature("buttons", hasButtons); err != nil {
+		return ButtonConfig{}, err
+	}
+	payload, err := d.query(ctx, pktGetButtonConfig, pktStateButtonConfig, nil)
+	if err != nil {
+		return ButtonConfig{}, err
+	}
+	return decodeButtonConfig(payload)
+}
+
+func decodeButtonConfig(payload []byte) (ButtonConfig, error) {
+	if err := checkLength(pktStateButtonConfig, payload, 2+2*encodedColorLength); err != nil {
+		return ButtonConfig{}, err
+	}
+	var bc ButtonConfig
+	bc.HapticDuration = time.Duration(binary.LittleEndian.Uint16(payload[0:2])) * time.Millisecond
+	bc.BacklightOn.decode(payload[2 : 2+encodedColorLength])
+	bc.BacklightOff.decode(payload[2+encodedColorLength:])
+	return bc, nil
+}
+
+// SetButtonConfig sets the switch's haptic and backlight configuration.
+func (d *Device) SetButtonConfig(ctx context.Context, bc ButtonConfig) error {
+	if err := d.requireFeature("buttons", hasButtons); err != nil {
+		return err
+	}
+	ms := bc.HapticDuration.Milliseconds()
+	if ms < 0 || ms > math.MaxUint16 {
+		return fmt.Errorf("haptic duration %v out of range", bc.HapticDuration)
+	}
+	payload := make([]byte, 2+2*encodedColorLength)
+	binary.LittleEndian.PutUint16(payload[0:2], uint16(ms))
+	bc.BacklightOn.encode(payload[2:])
+	bc.BacklightOff.encode(payload[2+encodedColorLength:])
+	return d.set(ctx, pktSetButtonConfig, payload)
+}
@@ -0,0 +1,32 @@
+package lifx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestButtonRoundTrip(t *testing.T) {
+	var group [16]byte
+	group[0], group[15] = 0xAB, 0xCD
+	relays := ButtonAction{Gesture: GesturePress, TargetType: TargetRelays}
+	relays.Target[0], relays.Target[1], relays.Target[2] = 2, 0, 3
+	btn := Button{Actions: []ButtonAction{
+		relays,
+		{Gesture: GestureHold, TargetType: TargetGroup, Target: group},
+	}}
+
+	b, err := btn.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(b) != buttonLength {
+		t.Errorf("encoded button is %d bytes, want %d", len(b), buttonLength)
+	}
+	got := decodeButton(b)
+	if !reflect.DeepEqual(got, btn) {
+		t.Errorf("round trip of %+v gave %+v", btn, got)
+	}
+	if r := got.Actions[0].Relays(); !reflect.DeepEqual(r, []uint8{0, 3}) {
+		t.Errorf("Relays = %v, want [0 3]", r)
+	}
+}
@@ -0,0 +1,99 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// syncPings is the number of echo requests used to measure each device's latency.
+const syncPings = 3
+
+// Synchronize runs op concurrently on each device, staggering the starts so that
+// the devices receive their first packet at about the same time. This avoids the
+// visible ripple when starting the same transition across a room full of lights.
+//
+// Each device's latency is measured with Ping first, so this takes a little longer
+// than simply running op on each device concurrently. Devices that don't respond
+// to the pings are started first.
+//
+// The returned error joins the errors from each device, if any.
+func Synchronize(ctx context.Context, devs []*Device, op func(context.Context, *Device) error) error {
+	// Measure one-way latency for each device, estimated as half the best RTT.
+	latency := make([]time.Duration, len(devs))
+	answered := make([]bool, len(devs))
+	var wg sync.WaitGroup
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats, err := d.Ping(ctx, syncPings)
+			if err == nil && stats.Received > 0 {
+				latency[i] = stats.Min / 2
+				answered[i] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var maxLatency time.Duration
+	for _, lat := range latency {
+		if lat > maxLatency {
+			maxLatency = lat
+		}
+	}
+	for i, lat := range latency {
+		if !answered[i] {
+			// Nothing is known about this device, so assume it is as slow as the slowest.
+			latency[i] = maxLatency
+			devs[i].tracef(ctx, "LIFX device %x didn't answer pings; assuming latency %v", devs[i].Serial, maxLatency)
+			continue
+		}
+		devs[i].tracef(ctx, "LIFX device %x estimated one-way latency %v", devs[i].Serial, lat)
+	}
+
+	// Start the slowest devices first, and delay the others by the difference.
+	errs := make([]error, len(devs))
+	for i, d := range devs {
+		i, d := i, d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTimer(maxLatency - latency[i])
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			case <-t.C:
+			}
+			if err := op(ctx, d); err != nil {
+				errs[i] = fmt.Errorf("device %x: %w", d.Serial, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// SyncSetColor sets the same color on all the devices with Synchronize,
+// so their transitions start and finish together.
+func SyncSetColor(ctx context.Context, devs []*Device, color Color, duration time.Duration) error {
+	return Synchronize(ctx, devs, func(ctx context.Context, d *Device) error {
+		return d.SetColor(ctx, color, duration)
+	})
+}
+
+// SyncSetLightPower sets the same power level on all the devices with Synchronize,
+// so their transitions start and finish together.
+func SyncSetLightPower(ctx context.Context, devs []*Device, level uint16, duration time.Duration) error {
+	return Synchronize(ctx, devs, func(ctx context.Context, d *Device) error {
+		return d.SetLightPower(ctx, level, duration)
+	})
+}
@@ -0,0 +1,76 @@
+package lifx_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+// delayConn delays every packet sent to one address.
+type delayConn struct {
+	net.PacketConn
+	slow  string
+	delay time.Duration
+}
+
+func (dc *delayConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if addr.String() == dc.slow {
+		time.Sleep(dc.delay)
+	}
+	return dc.PacketConn.WriteTo(b, addr)
+}
+
+func TestSynchronizeSilentDevice(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	slow := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 1}, "Slow", &lifxtest.Light{})
+	fast := n.Add([6]byte{0xd0, 0x73, 0xd5, 0, 0, 2}, "Fast", &lifxtest.Light{})
+	// A socket that never answers.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer silent.Close()
+
+	tf := lifx.TransportFunc(func(ctx context.Context) (net.PacketConn, error) {
+		conn, err := n.ListenPacket(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &delayConn{PacketConn: conn, slow: slow.Addr().String(), delay: 100 * time.Millisecond}, nil
+	})
+	client, err := lifx.NewClient(lifx.WithTransport(tf))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	silentSerial := [6]byte{0xd0, 0x73, 0xd5, 0, 0, 3}
+	devs := []*lifx.Device{
+		client.NewDevice(*slow.Addr(), slow.Serial),
+		client.NewDevice(*fast.Addr(), fast.Serial),
+		client.NewDevice(*silent.LocalAddr().(*net.UDPAddr), silentSerial),
+	}
+
+	var mu sync.Mutex
+	started := make(map[[6]byte]time.Time)
+	err = lifx.Synchronize(testContext(t), devs, func(ctx context.Context, d *lifx.Device) error {
+		mu.Lock()
+		defer mu.Unlock()
+		started[d.Serial] = time.Now()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Synchronize: %v", err)
+	}
+
+	// The silent device's latency is unknown, so it should be started
+	// along with the slowest device, about 50ms ahead of the fast one.
+	if d := started[silentSerial].Sub(started[slow.Serial]); d > 25*time.Millisecond {
+		t.Errorf("silent device started %v after the slow device; want them started together", d)
+	}
+}
@@ -0,0 +1,176 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxTilePalette is the number of colors a tile effect palette can hold.
+const maxTilePalette = 16
+
+// Palette is an ordered set of colors, as used by themes and firmware effects.
+type Palette []Color
+
+// encodeTile encodes the palette in the tile effect format:
+// a count followed by exactly 16 colors, with unused entries zeroed.
+func (p Palette) encodeTile() ([]byte, error) {
+	if len(p) > maxTilePalette {
+		return nil, fmt.Errorf("too many palette colors; %d > %d", len(p), maxTilePalette)
+	}
+	out := make([]byte, 1+maxTilePalette*encodedColorLength)
+	out[0] = byte(len(p))
+	for i := range p {
+		off := 1 + i*encodedColorLength
+		p[i].encode(out[off : off+encodedColorLength])
+	}
+	return out, nil
+}
+
+// Themes are named palettes approximating those offered in the LIFX app.
+// Any of them is suitable for the Palette of a TileEffectConfig.
+var Themes = map[string]Palette{
+	"cheerful": {
+		hsbk(48, 0.9, 1, 3500), hsbk(30, 0.9, 1, 3500), hsbk(340, 0.7, 1, 3500),
+		hsbk(190, 0.6, 1, 3500), hsbk(100, 0.6, 1, 3500),
+	},
+	"energizing": {
+		hsbk(196, 1, 1, 3500), hsbk(180, 0.8, 1, 3500), hsbk(0, 0, 1, 6500),
+		hsbk(210, 0.6, 1, 3500),
+	},
+	"exciting": {
+		hsbk(0, 1, 1, 3500), hsbk(40, 1, 1, 3500), hsbk(120, 1, 1, 3500),
+		hsbk(240, 1, 1, 3500), hsbk(300, 1, 1, 3500),
+	},
+	"intense": {
+		hsbk(0, 1, 1, 3500), hsbk(15, 1, 0.8, 3500), hsbk(270, 1, 0.8, 3500),
+		hsbk(330, 1, 1, 3500),
+	},
+	"peaceful": {
+		hsbk(200, 0.5, 0.6, 3500), hsbk(170, 0.4, 0.6, 3500), hsbk(250, 0.4, 0.6, 3500),
+		hsbk(120, 0.3, 0.6, 3500),
+	},
+	"relaxing": {
+		hsbk(30, 0.6, 0.5, 2700), hsbk(20, 0.7, 0.4, 2700), hsbk(45, 0.5, 0.5, 2700),
+	},
+	"spooky": {
+		hsbk(25, 1, 1, 3500), hsbk(280, 1, 0.6, 3500), hsbk(100, 1, 0.5, 3500),
+	},
+	"tranquil": {
+		hsbk(180, 0.5, 0.5, 3500), hsbk(210, 0.5, 0.5, 3500), hsbk(240, 0.4, 0.5, 3500),
+		hsbk(270, 0.3, 0.5, 3500),
+	},
+}
+
+// hsbk builds a Color from a hue in degrees and saturation/brightness in [0,1].
+func hsbk(hue, sat, bright float64, kelvin uint16) Color {
+	return Color{
+		Hue:        uint16(hue / 360 * 0x10000),
+		Saturation: uint16(sat * 0xFFFF),
+		Brightness: uint16(bright * 0xFFFF),
+		Kelvin:     kelvin,
+	}
+}
+
+// Apply spreads the palette across the device, as the LIFX app does for themes.
+// Matrix devices get a diagonal blend of the palette on each tile, each tile
+// starting from a different color; multizone devices get the palette blended
+// along their length; other lights get the first color.
+func (p Palette) Apply(ctx context.Context, d *Device, duration time.Duration) error {
+	if len(p) == 0 {
+		return fmt.Errorf("empty palette")
+	}
+	return p.apply(ctx, d, 0, duration)
+}
+
+// ApplyAll applies the palette to several devices concurrently, giving each
+// device a different starting color so that the palette is spread across them.
+// Devices are ordered by serial, so the result is consistent from run to run.
+//
+// The returned error joins the errors from each device, if any.
+func (p Palette) ApplyAll(ctx context.Context, devs []*Device, duration time.Duration) error {
+	if len(p) == 0 {
+		return fmt.Errorf("empty palette")
+	}
+	sorted := append([]*Device(nil), devs...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Serial[:], sorted[j].Serial[:]) < 0 })
+	offsets := make(map[*Device]int)
+	for i, d := range sorted {
+		offsets[d] = i
+	}
+	return Collection(devs).Each(ctx, func(ctx context.Context, d *Device) error {
+		return p.apply(ctx, d, offsets[d], duration)
+	})
+}
+
+// rotate returns the palette rotated to start at the given offset.
+func (p Palette) rotate(offset int) Palette {
+	offset %= len(p)
+	return append(append(Palette(nil), p[offset:]...), p[:offset]...)
+}
+
+// blend spreads the palette evenly across n colors.
+func (p Palette) blend(n int) []Color {
+	stops := make([]ColorStop, len(p))
+	for i, c := range p {
+		stops[i].Color = c
+	}
+	return GradientZones(stops, n)
+}
+
+func (p Palette) apply(ctx context.Context, d *Device, offset int, duration time.Duration) error {
+	chain, err := d.GetDeviceChain(ctx)
+	if err == nil && len(chain.Tiles) > 0 {
+		return p.applyTiles(ctx, d, chain, offset, duration)
+	} else if err != nil && !errors.Is(err, ErrUnhandled) {
+		return fmt.Errorf("GetDeviceChain: %w", err)
+	}
+
+	zones, err := d.GetZones(ctx)
+	if err == nil && len(zones) > 0 {
+		if err := d.SetZones(ctx, duration, p.rotate(offset).blend(len(zones))); err != nil {
+			return fmt.Errorf("SetZones: %w", err)
+		}
+		return nil
+	} else if err != nil && !errors.Is(err, ErrUnhandled) {
+		return fmt.Errorf("GetZones: %w", err)
+	}
+
+	if err := d.SetColor(ctx, p[offset%len(p)], duration); err != nil {
+		return fmt.Errorf("SetColor: %w", err)
+	}
+	return nil
+}
+
+func (p Palette) applyTiles(ctx context.Context, d *Device, chain TileChain, offset int, duration time.Duration) error {
+	for i, t := range chain.Tiles {
+		w, h := int(t.Width), int(t.Height)
+		if w == 0 || h == 0 {
+			continue
+		}
+		diag := p.rotate(offset + i).blend(w + h - 1)
+		colors := make([]Color, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				colors[y*w+x] = diag[x+y]
+			}
+		}
+		// Large tiles need several messages, each of as many whole rows as fit,
+		// or of part of a row for tiles more than 64 pixels wide.
+		rows, cols := max(maxSet64Colors/w, 1), min(w, maxSet64Colors)
+		for y := 0; y < h; y += rows {
+			end := min(y+rows, h)
+			for x := 0; x < w; x += cols {
+				rect := TileRect{TileIndex: uint8(chain.StartIndex + i), X: uint8(x), Y: uint8(y), Width: uint8(cols)}
+				part := colors[y*w+x : (end-1)*w+min(x+cols, w)]
+				if err := d.Set64(ctx, rect, duration, part); err != nil {
+					return fmt.Errorf("Set64 on tile %d: %w", i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
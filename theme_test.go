@@ -0,0 +1,66 @@
+package lifx_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestPaletteApply(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	strip := lifxtest.NewStrip(8)
+	bulbs := []*lifxtest.Light{{}, {}}
+	lights := []lifx.VirtualLight{strip, bulbs[0], bulbs[1]}
+	client := n.Client()
+	var devs []*lifx.Device
+	for i, light := range lights {
+		ed := n.Add([6]byte{0xd0, 0x73, 0xd5, 0xAA, 0xBC, byte(i)}, "", light)
+		devs = append(devs, client.NewDevice(*ed.Addr(), ed.Serial))
+	}
+	ctx := testContext(t)
+
+	p := lifx.Palette{
+		{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500},
+		{Hue: 0x5555, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500},
+		{Hue: 0xAAAA, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500},
+	}
+	if err := p.ApplyAll(ctx, devs, 0); err != nil {
+		t.Fatalf("ApplyAll: %v", err)
+	}
+	if got, want := strip.Zones(), p.BlendForTest(8); !reflect.DeepEqual(got, want) {
+		t.Errorf("multizone device got zones %v, want %v", got, want)
+	}
+	// The other devices get successive colors from the palette.
+	for i, bulb := range bulbs {
+		if got := bulb.Color(); got != p[i+1] {
+			t.Errorf("device %d got color %+v, want %+v", i+1, got, p[i+1])
+		}
+	}
+}
+
+func TestPaletteApplyWideTile(t *testing.T) {
+	// Rows of a tile more than 64 pixels wide don't fit in one Set64.
+	const w, h = 70, 2
+	m := lifxtest.NewMatrix(w, h)
+	_, dev, ctx := newTestDevice(t, m)
+
+	p := lifx.Palette{
+		{Hue: 0, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500},
+		{Hue: 0x8000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500},
+	}
+	if err := p.ApplyAll(ctx, []*lifx.Device{dev}, 0); err != nil {
+		t.Fatalf("ApplyAll: %v", err)
+	}
+	diag := p.BlendForTest(w + h - 1)
+	want := make([]lifx.Color, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			want[y*w+x] = diag[x+y]
+		}
+	}
+	if got := m.Pixels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("%dx%d tile got pixels %v, want %v", w, h, got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// A Transport provides the packet connections used to talk to LIFX devices.
+//
+// Addresses passed to and returned from the connections are always *net.UDPAddr
+// values naming devices (or the broadcast address) on the LAN.
+type Transport interface {
+	// ListenPacket returns a new connection ready for sending and receiving.
+	// The context governs only the setup of the connection;
+	// the caller will set deadlines on the returned connection as needed.
+	ListenPacket(ctx context.Context) (net.PacketConn, error)
+}
+
+// udpTransport is the default Transport, using UDP sockets directly.
+type udpTransport struct {
+	ip net.IP // local address to bind to; nil means any
+}
+
+func (t udpTransport) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: t.ip})
+	if err != nil {
+		return nil, fmt.Errorf("net.ListenUDP: %v", err)
+	}
+	return conn, nil
+}
+
+// TransportFunc adapts a function to a Transport.
+// It is convenient for substituting fake connections in tests:
+//
+//	lifx.WithTransport(lifx.TransportFunc(func(context.Context) (net.PacketConn, error) {
+//		return newFakeConn(), nil
+//	}))
+type TransportFunc func(ctx context.Context) (net.PacketConn, error)
+
+// ListenPacket implements Transport.
+func (f TransportFunc) ListenPacket(ctx context.Context) (net.PacketConn, error) { return f(ctx) }
+
+// Direction is the direction of a packet passed to a packet hook.
+type Direction int
+
+const (
+	PacketSent     Direction = iota // sent by the client
+	PacketReceived                  // received by the client
+)
+
+func (d Direction) String() string {
+	switch d {
+	case PacketSent:
+		return "sent"
+	case PacketReceived:
+		return "received"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// WithPacketHook sets a function to be called for every packet the client sends or receives,
+// including broadcasts and packets that aren't valid LIFX messages.
+// It is intended for wire-level debugging and packet capture; see the protocol package
+// for decoding the packets.
+//
+// The hook may be called concurrently. It must not modify raw, or retain it after returning.
+func WithPacketHook(f func(dir Direction, addr *net.UDPAddr, raw []byte)) Option {
+	return func(c *Client) { c.packetHook = f }
+}
+
+// hookConn is a net.PacketConn that calls a packet hook.
+type hookConn struct {
+	net.PacketConn
+	hook func(dir Direction, addr *net.UDPAddr, raw []byte)
+}
+
+func (hc hookConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := hc.PacketConn.ReadFrom(b)
+	if err == nil {
+		ua, _ := addr.(*net.UDPAddr)
+		hc.hook(PacketReceived, ua, b[:n])
+	}
+	return n, addr, err
+}
+
+func (hc hookConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ua, _ := addr.(*net.UDPAddr)
+	hc.hook(PacketSent, ua, b)
+	return hc.PacketConn.WriteTo(b, addr)
+}
@@ -0,0 +1,133 @@
+package lifx_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+	"github.com/dsymonds/lifx/protocol"
+)
+
+func TestTransportFunc(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	light := &lifxtest.Light{}
+	ed := n.Add(testSerial, "Emulated", light)
+
+	var listens int
+	tf := lifx.TransportFunc(func(ctx context.Context) (net.PacketConn, error) {
+		listens++
+		return n.ListenPacket(ctx)
+	})
+	client, err := lifx.NewClient(lifx.WithTransport(tf))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	dctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	devs, err := client.Discover(dctx)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(devs) != 1 || devs[0].Serial != ed.Serial || devs[0].Addr.String() != ed.Addr().String() {
+		t.Fatalf("Discover found %v, want the one device at %v", devs, ed.Addr())
+	}
+	if listens < 2 {
+		t.Errorf("TransportFunc called %d times, want at least 2 (client and discovery)", listens)
+	}
+
+	ctx := testContext(t)
+	dev := devs[0]
+	if label, err := dev.GetLabel(ctx); err != nil || label != "Emulated" {
+		t.Errorf("GetLabel = %q, %v; want %q, nil", label, err, "Emulated")
+	}
+	want := lifx.Color{Hue: 0x8000, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	if err := dev.SetColor(ctx, want, 0); err != nil {
+		t.Errorf("SetColor: %v", err)
+	}
+	if got := light.Color(); got != want {
+		t.Errorf("after SetColor, light has color %+v, want %+v", got, want)
+	}
+}
+
+func TestPacketHook(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	ed := n.Add(testSerial, "", &lifxtest.Light{})
+
+	var mu sync.Mutex
+	var seen []string
+	hook := func(dir lifx.Direction, addr *net.UDPAddr, raw []byte) {
+		hdr, _, err := protocol.Decode(raw)
+		if err != nil {
+			t.Errorf("hook got undecodable %v packet: %v", dir, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, dir.String()+" "+addr.String()+" "+hdr.Type.String())
+	}
+	client := n.Client(lifx.WithPacketHook(hook))
+
+	dctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	devs, err := client.Discover(dctx)
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("Discover = %v, %v; want one device", devs, err)
+	}
+	if _, err := devs[0].GetPower(testContext(t)); err != nil {
+		t.Fatalf("GetPower: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	addr := ed.Addr().String()
+	want := []string{
+		"sent 255.255.255.255:56700 GetService",
+		"received " + addr + " StateService",
+		"sent " + addr + " GetPower",
+		"received " + addr + " StatePower",
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("hook saw\n%q\nwant\n%q", seen, want)
+	}
+}
+
+func TestPacketHookTargetedDiscovery(t *testing.T) {
+	n := lifxtest.NewNetwork(t)
+	ed := n.Add(testSerial, "", &lifxtest.Light{})
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	hook := func(dir lifx.Direction, addr *net.UDPAddr, raw []byte) {
+		hdr, _, err := protocol.Decode(raw)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seen[dir.String()+" "+hdr.Type.String()]++
+	}
+	client := n.Client(lifx.WithPacketHook(hook))
+
+	ctx := testContext(t)
+	if _, err := client.DiscoverSerial(ctx, ed.Serial); err != nil {
+		t.Fatalf("DiscoverSerial: %v", err)
+	}
+	if _, err := client.Probe(ctx, []net.UDPAddr{*ed.Addr()}); err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, k := range []string{"sent GetService", "received StateService"} {
+		if seen[k] < 2 {
+			t.Errorf("hook saw %q %d times, want at least 2 (one each for DiscoverSerial and Probe)", k, seen[k])
+		}
+	}
+}
@@ -0,0 +1,608 @@
+package lifx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dsymonds/lifx/protocol"
+)
+
+// VirtualLight is implemented by lights that are to be exposed as LIFX devices
+// using a VirtualDevice. Methods may be called concurrently.
+type VirtualLight interface {
+	Power() uint16
+	SetPower(level uint16, duration time.Duration)
+	Color() Color
+	SetColor(c Color, duration time.Duration)
+}
+
+// VirtualZones may additionally be implemented by a VirtualLight
+// that has multiple zones, which are then exposed with the multizone messages.
+// The extended multizone messages are only handled if the reported
+// product and firmware support them.
+// The number of zones must not change.
+type VirtualZones interface {
+	Zones() []Color
+	// SetZones sets the zones starting at index.
+	// The zones set are always within those returned by Zones.
+	SetZones(index int, colors []Color, duration time.Duration)
+}
+
+// VirtualMatrix may additionally be implemented by a VirtualLight
+// that is a single tile of pixels, which is then exposed with the matrix messages.
+// The size of the tile must not change.
+type VirtualMatrix interface {
+	TileSize() (width, height int)
+	// Pixels returns the colors of the tile, row by row.
+	Pixels() []Color
+	// SetPixels sets every pixel of the tile, row by row.
+	SetPixels(colors []Color, duration time.Duration)
+}
+
+// VirtualDevice answers LIFX LAN protocol messages on behalf of a VirtualLight,
+// so that it can be discovered and controlled by the LIFX app and other clients,
+// including this package.
+type VirtualDevice struct {
+	Serial [6]byte
+	Light  VirtualLight
+
+	// Vendor and Product are reported to clients, which use them to determine capabilities.
+	// If Vendor is zero, the device claims to be a LIFX A19 (1, 27),
+	// a LIFX Z (1, 32) if Light implements VirtualZones,
+	// or a LIFX Tile (1, 55) if Light implements VirtualMatrix.
+	Vendor, Product uint32
+	// Firmware is the reported firmware version.
+	// If zero, version 3.90 is reported, which supports extended multizone messages.
+	// An older version may be used to emulate a device that only supports the legacy ones.
+	Firmware HostFirmware
+
+	// Logf, if set, will be used to log unexpected events.
+	Logf func(format string, args ...interface{})
+
+	mu       sync.Mutex
+	label    string
+	group    Membership
+	location Membership
+	staged   []zoneUpdate // zone changes awaiting an apply; see ZoneApplication
+}
+
+// zoneUpdate is a change to consecutive zones of a VirtualZones.
+type zoneUpdate struct {
+	index  int
+	colors []Color
+}
+
+func (vd *VirtualDevice) logf(format string, args ...interface{}) {
+	if vd.Logf != nil {
+		vd.Logf(format, args...)
+	}
+}
+
+// SetLabel sets the label reported by the device.
+// Clients may also change the label.
+func (vd *VirtualDevice) SetLabel(label string) {
+	label = TruncateLabel(label)
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+	vd.label = label
+}
+
+// Label returns the label reported by the device.
+func (vd *VirtualDevice) Label() string {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+	return vd.label
+}
+
+// ListenAndServe listens on the UDP address (":56700" if empty) and calls Serve.
+func (vd *VirtualDevice) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", stdPort)
+	}
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return vd.Serve(conn)
+}
+
+// Serve answers messages arriving on conn until reading from it fails.
+func (vd *VirtualDevice) Serve(conn net.PacketConn) error {
+	port := stdPort
+	if ua, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		port = ua.Port
+	}
+	for {
+		hdr, payload, raddr, err := readOnePacket(conn)
+		if err != nil {
+			var neterr net.Error
+			if errors.As(err, &neterr) {
+				return err
+			}
+			vd.logf("Ignoring bad packet: %v", err)
+			continue
+		}
+		if !hdr.Tagged && [6]byte(hdr.Target[:6]) != vd.Serial {
+			// Addressed to someone else.
+			continue
+		}
+		for _, r := range vd.handle(hdr, payload, port) {
+			var rh protocol.Header
+			rh.Source = hdr.Source
+			copy(rh.Target[:6], vd.Serial[:])
+			rh.Sequence = hdr.Sequence
+			rh.Type = r.typ
+			if _, err := conn.WriteTo(protocol.Encode(rh, r.payload), raddr); err != nil {
+				vd.logf("Sending response to %v: %v", raddr, err)
+			}
+		}
+	}
+}
+
+type reply struct {
+	typ     msgType
+	payload []byte
+}
+
+// handle processes a single message, returning the replies to send.
+func (vd *VirtualDevice) handle(hdr protocol.Header, payload []byte, port int) []reply {
+	typ := hdr.Type
+	states, isSet, err := vd.dispatch(typ, payload, port)
+	if errors.Is(err, ErrUnhandled) {
+		return []reply{{pktStateUnhandled, binary.LittleEndian.AppendUint16(nil, uint16(typ))}}
+	}
+	if err != nil {
+		vd.logf("Bad message type %d: %v", typ, err)
+		return nil
+	}
+
+	var rs []reply
+	if hdr.AckRequired {
+		rs = append(rs, reply{typ: pktAcknowledgement})
+	}
+	// Get messages are always answered; Set messages only on request.
+	if !isSet || hdr.ResRequired {
+		rs = append(rs, states...)
+	}
+	return rs
+}
+
+// dispatch acts on a message, returning the relevant state messages.
+func (vd *VirtualDevice) dispatch(typ msgType, payload []byte, port int) (states []reply, isSet bool, err error) {
+	need := func(n int) error { return checkMinLength(typ, payload, n) }
+	zl, zoned := vd.Light.(VirtualZones)
+	ml, tiled := vd.Light.(VirtualMatrix)
+
+	switch typ {
+	case pktGetService:
+		b := []byte{0x01} // UDP
+		return []reply{{pktStateService, binary.LittleEndian.AppendUint32(b, uint32(port))}}, false, nil
+	case pktGetHostFirmware:
+		return []reply{{pktStateHostFirmware, vd.hostFirmware()}}, false, nil
+	case pktGetVersion:
+		return []reply{{pktStateVersion, vd.version()}}, false, nil
+	case pktEchoRequest:
+		return []reply{{pktEchoResponse, payload}}, false, nil
+
+	case pktSetPower:
+		if err := need(2); err != nil {
+			return nil, true, err
+		}
+		vd.Light.SetPower(binary.LittleEndian.Uint16(payload), 0)
+		isSet = true
+		fallthrough
+	case pktGetPower:
+		return []reply{{pktStatePower, binary.LittleEndian.AppendUint16(nil, vd.Light.Power())}}, isSet, nil
+
+	case pktSetLightPower:
+		if err := need(6); err != nil {
+			return nil, true, err
+		}
+		dur := time.Duration(binary.LittleEndian.Uint32(payload[2:6])) * time.Millisecond
+		vd.Light.SetPower(binary.LittleEndian.Uint16(payload), dur)
+		isSet = true
+		fallthrough
+	case pktGetLightPower:
+		return []reply{{pktStateLightPower, binary.LittleEndian.AppendUint16(nil, vd.Light.Power())}}, isSet, nil
+
+	case pktSetLabel:
+		if err := need(labelLength); err != nil {
+			return nil, true, err
+		}
+		vd.SetLabel(trimLabel(payload[:labelLength]))
+		isSet = true
+		fallthrough
+	case pktGetLabel:
+		// Like real devices, echo whatever label was set, even if it's invalid.
+		// The same goes for the labels in StateGroup, StateLocation and LightState.
+		return []reply{{pktStateLabel, padLabel(vd.Label())}}, isSet, nil
+
+	case pktSetGroup, pktSetLocation:
+		m, err := decodeMembership(typ, payload)
+		if err != nil {
+			return nil, true, err
+		}
+		vd.mu.Lock()
+		if typ == pktSetGroup {
+			vd.group = m
+		} else {
+			vd.location = m
+		}
+		vd.mu.Unlock()
+		if typ == pktSetGroup {
+			return []reply{vd.membershipState(pktStateGroup)}, true, nil
+		}
+		return []reply{vd.membershipState(pktStateLocation)}, true, nil
+	case pktGetGroup:
+		return []reply{vd.membershipState(pktStateGroup)}, false, nil
+	case pktGetLocation:
+		return []reply{vd.membershipState(pktStateLocation)}, false, nil
+
+	case pktSetColor:
+		if err := need(1 + encodedColorLength + 4); err != nil {
+			return nil, true, err
+		}
+		var c Color
+		c.decode(payload[1 : 1+encodedColorLength])
+		dur := time.Duration(binary.LittleEndian.Uint32(payload[1+encodedColorLength:])) * time.Millisecond
+		vd.Light.SetColor(c, dur)
+		isSet = true
+		fallthrough
+	case pktGetColor:
+		return []reply{{pktLightState, vd.lightState()}}, isSet, nil
+
+	case pktSetWaveform, pktSetWaveformOptional:
+		n := 21
+		if typ == pktSetWaveformOptional {
+			n += 4
+		}
+		if err := need(n); err != nil {
+			return nil, true, err
+		}
+		// Only the lasting effect of a waveform is emulated:
+		// a non-transient waveform ends at its color, and a transient one makes no change.
+		if payload[1] == 0 {
+			var c Color
+			c.decode(payload[2 : 2+encodedColorLength])
+			dur := time.Duration(binary.LittleEndian.Uint32(payload[10:14])) * time.Millisecond
+			only := WaveformHue | WaveformSaturation | WaveformBrightness | WaveformKelvin
+			if typ == pktSetWaveformOptional {
+				only = 0
+				for i, wc := range []WaveformComponents{WaveformHue, WaveformSaturation, WaveformBrightness, WaveformKelvin} {
+					if payload[21+i] != 0 {
+						only |= wc
+					}
+				}
+			}
+			switch {
+			case zoned:
+				zones := zl.Zones()
+				for i := range zones {
+					zones[i] = waveformEnd(zones[i], c, only)
+				}
+				zl.SetZones(0, zones, dur)
+			case tiled:
+				vd.mu.Lock()
+				pixels := ml.Pixels()
+				for i := range pixels {
+					pixels[i] = waveformEnd(pixels[i], c, only)
+				}
+				ml.SetPixels(pixels, dur)
+				vd.mu.Unlock()
+			default:
+				vd.Light.SetColor(waveformEnd(vd.Light.Color(), c, only), dur)
+			}
+		}
+		return []reply{{pktLightState, vd.lightState()}}, true, nil
+
+	case pktSetExtendedColorZones:
+		if !zoned || !vd.extendedZones() {
+			return nil, true, ErrUnhandled
+		}
+		if err := need(8); err != nil {
+			return nil, true, err
+		}
+		dur := time.Duration(binary.LittleEndian.Uint32(payload[0:4])) * time.Millisecond
+		apply := ZoneApplication(payload[4])
+		index := int(binary.LittleEndian.Uint16(payload[5:7]))
+		count := int(payload[7])
+		if count > maxExtendedZones {
+			return nil, true, malformed(typ, payload, "colors_count %d > %d", count, maxExtendedZones)
+		}
+		if err := need(8 + count*encodedColorLength); err != nil {
+			return nil, true, err
+		}
+		colors := make([]Color, count)
+		for i := range colors {
+			off := 8 + i*encodedColorLength
+			colors[i].decode(payload[off : off+encodedColorLength])
+		}
+		vd.setZones(zl, index, colors, apply, dur)
+		isSet = true
+		fallthrough
+	case pktGetExtendedColorZones:
+		if !zoned || !vd.extendedZones() {
+			return nil, isSet, ErrUnhandled
+		}
+		return encodeExtendedZones(zl.Zones()), isSet, nil
+
+	case pktSetColorZones:
+		if !zoned {
+			return nil, true, ErrUnhandled
+		}
+		if err := need(2 + encodedColorLength + 4 + 1); err != nil {
+			return nil, true, err
+		}
+		start, end := int(payload[0]), int(payload[1])
+		var c Color
+		c.decode(payload[2 : 2+encodedColorLength])
+		dur := time.Duration(binary.LittleEndian.Uint32(payload[2+encodedColorLength:])) * time.Millisecond
+		apply := ZoneApplication(payload[2+encodedColorLength+4])
+		if end < start {
+			return nil, true, malformed(typ, payload, "end_index %d < start_index %d", end, start)
+		}
+		colors := make([]Color, end-start+1)
+		for i := range colors {
+			colors[i] = c
+		}
+		vd.setZones(zl, start, colors, apply, dur)
+		return legacyZones(zl.Zones(), start, end), true, nil
+	case pktGetColorZones:
+		if !zoned {
+			return nil, false, ErrUnhandled
+		}
+		if err := need(2); err != nil {
+			return nil, false, err
+		}
+		return legacyZones(zl.Zones(), int(payload[0]), int(payload[1])), false, nil
+
+	case pktGetDeviceChain:
+		if !tiled {
+			return nil, false, ErrUnhandled
+		}
+		return []reply{{pktStateDeviceChain, vd.deviceChain(ml)}}, false, nil
+	case pktSet64:
+		if !tiled {
+			return nil, true, ErrUnhandled
+		}
+		if err := need(10 + maxSet64Colors*encodedColorLength); err != nil {
+			return nil, true, err
+		}
+		dur := time.Duration(binary.LittleEndian.Uint32(payload[6:10])) * time.Millisecond
+		// Only tile 0 exists, so writes starting at a later tile are ignored.
+		if payload[0] != 0 {
+			return nil, true, nil
+		}
+		// All 64 colors are applied, as real devices do,
+		// except those that fall outside the tile.
+		w, _ := ml.TileSize()
+		vd.mu.Lock()
+		pixels := ml.Pixels()
+		for i := 0; i < maxSet64Colors; i++ {
+			if x, y, ok := tilePixel(ml, payload[3:6], i); ok {
+				off := 10 + i*encodedColorLength
+				pixels[y*w+x].decode(payload[off : off+encodedColorLength])
+			}
+		}
+		ml.SetPixels(pixels, dur)
+		vd.mu.Unlock()
+		// Set64 has no state response, even if one is requested.
+		return nil, true, nil
+	case pktGet64:
+		if !tiled {
+			return nil, false, ErrUnhandled
+		}
+		if err := need(6); err != nil {
+			return nil, false, err
+		}
+		pixels := ml.Pixels()
+		w, _ := ml.TileSize()
+		b := make([]byte, 5+maxSet64Colors*encodedColorLength)
+		b[0] = payload[0]
+		copy(b[2:5], payload[3:6])
+		if payload[0] == 0 {
+			for i := 0; i < maxSet64Colors; i++ {
+				if x, y, ok := tilePixel(ml, payload[3:6], i); ok {
+					off := 5 + i*encodedColorLength
+					pixels[y*w+x].encode(b[off : off+encodedColorLength])
+				}
+			}
+		}
+		return []reply{{pktState64, b}}, false, nil
+	}
+	return nil, false, ErrUnhandled
+}
+
+// setZones stages or applies a change to the zones, as directed by apply.
+// Zones the light doesn't have are ignored, as real devices do.
+// Staged changes take the duration of the message that applies them.
+func (vd *VirtualDevice) setZones(zl VirtualZones, index int, colors []Color, apply ZoneApplication, dur time.Duration) {
+	n := len(zl.Zones())
+	vd.mu.Lock()
+	if apply != ApplyOnly && index < n {
+		if len(colors) > n-index {
+			colors = colors[:n-index]
+		}
+		vd.staged = append(vd.staged, zoneUpdate{index, colors})
+	}
+	var updates []zoneUpdate
+	if apply != NoApply {
+		updates, vd.staged = vd.staged, nil
+	}
+	vd.mu.Unlock()
+	for _, u := range updates {
+		zl.SetZones(u.index, u.colors, dur)
+	}
+}
+
+// legacyZones returns the replies to GetColorZones for zones start to end (inclusive).
+// Like real devices, a single zone is reported with StateZone,
+// and several with StateMultiZone messages of eight zones each.
+func legacyZones(zones []Color, start, end int) []reply {
+	if end >= len(zones) {
+		end = len(zones) - 1
+	}
+	count := len(zones)
+	if count > 0xFF {
+		count = 0xFF
+	}
+	if start > end {
+		return nil
+	}
+	if start == end {
+		b := make([]byte, 2+encodedColorLength)
+		b[0], b[1] = uint8(count), uint8(start)
+		zones[start].encode(b[2:])
+		return []reply{{pktStateZone, b}}
+	}
+	var rs []reply
+	for index := start; index <= end && index <= 0xFF; index += multiZoneColors {
+		b := make([]byte, 2+multiZoneColors*encodedColorLength)
+		b[0], b[1] = uint8(count), uint8(index)
+		for i := 0; i < multiZoneColors && index+i < len(zones); i++ {
+			off := 2 + i*encodedColorLength
+			zones[index+i].encode(b[off : off+encodedColorLength])
+		}
+		rs = append(rs, reply{pktStateMultiZone, b})
+	}
+	return rs
+}
+
+// extendedZones reports whether the device's reported product and firmware
+// support the extended multizone messages.
+func (vd *VirtualDevice) extendedZones() bool {
+	vendor, product := vd.ids()
+	p, err := DetermineProduct(CurrentProducts(), vendor, product, vd.firmware())
+	if err != nil || p.Features.ExtendedMultizone == nil {
+		// An unknown product might support anything.
+		return true
+	}
+	return *p.Features.ExtendedMultizone
+}
+
+// firmware returns the reported firmware version.
+func (vd *VirtualDevice) firmware() HostFirmware {
+	if vd.Firmware == (HostFirmware{}) {
+		return HostFirmware{Major: 3, Minor: 90}
+	}
+	return vd.Firmware
+}
+
+func (vd *VirtualDevice) hostFirmware() []byte {
+	hf := vd.firmware()
+	b := make([]byte, 20)
+	if !hf.Build.IsZero() {
+		binary.LittleEndian.PutUint64(b[0:8], uint64(hf.Build.UnixNano()))
+	}
+	binary.LittleEndian.PutUint16(b[16:18], hf.Minor)
+	binary.LittleEndian.PutUint16(b[18:20], hf.Major)
+	return b
+}
+
+// ids returns the reported vendor and product IDs.
+func (vd *VirtualDevice) ids() (vendor, product uint32) {
+	if vd.Vendor != 0 {
+		return vd.Vendor, vd.Product
+	}
+	if _, ok := vd.Light.(VirtualZones); ok {
+		return 1, 32
+	} else if _, ok := vd.Light.(VirtualMatrix); ok {
+		return 1, 55
+	}
+	return 1, 27
+}
+
+func (vd *VirtualDevice) version() []byte {
+	vendor, product := vd.ids()
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint32(b[0:4], vendor)
+	binary.LittleEndian.PutUint32(b[4:8], product)
+	return b
+}
+
+// tilePixel returns the position of the i'th pixel of a rectangle
+// given as its x, y and width, and whether that position is on the tile.
+func tilePixel(ml VirtualMatrix, rect []byte, i int) (x, y int, ok bool) {
+	w, h := ml.TileSize()
+	rx, ry, rw := int(rect[0]), int(rect[1]), int(rect[2])
+	if rw == 0 {
+		return 0, 0, false
+	}
+	x, y = rx+i%rw, ry+i/rw
+	return x, y, x < w && y < h
+}
+
+func (vd *VirtualDevice) deviceChain(ml VirtualMatrix) []byte {
+	w, h := ml.TileSize()
+	b := make([]byte, 1+maxChainTiles*tileLength+1)
+	t := b[1 : 1+tileLength]
+	t[16], t[17] = uint8(w), uint8(h)
+	copy(t[19:27], vd.version()[:8])
+	copy(t[31:39], vd.hostFirmware()[0:8])
+	copy(t[47:51], vd.hostFirmware()[16:20])
+	b[len(b)-1] = 1
+	return b
+}
+
+// waveformEnd returns the color that a non-transient waveform to w
+// affecting only the given components leaves in place of c.
+func waveformEnd(c, w Color, only WaveformComponents) Color {
+	if only&WaveformHue != 0 {
+		c.Hue = w.Hue
+	}
+	if only&WaveformSaturation != 0 {
+		c.Saturation = w.Saturation
+	}
+	if only&WaveformBrightness != 0 {
+		c.Brightness = w.Brightness
+	}
+	if only&WaveformKelvin != 0 {
+		c.Kelvin = w.Kelvin
+	}
+	return c
+}
+
+func (vd *VirtualDevice) membershipState(typ msgType) reply {
+	vd.mu.Lock()
+	m := vd.group
+	if typ == pktStateLocation {
+		m = vd.location
+	}
+	vd.mu.Unlock()
+	return reply{typ, m.encodeUnchecked()}
+}
+
+func (vd *VirtualDevice) lightState() []byte {
+	label := padLabel(vd.Label())
+
+	b := make([]byte, encodedColorLength+2+2+labelLength+8)
+	c := vd.Light.Color()
+	c.encode(b[:encodedColorLength])
+	binary.LittleEndian.PutUint16(b[encodedColorLength+2:], vd.Light.Power())
+	copy(b[encodedColorLength+4:], label)
+	return b
+}
+
+// encodeExtendedZones encodes zones as StateExtendedColorZones messages,
+// using as many as needed, like real devices.
+func encodeExtendedZones(zones []Color) []reply {
+	var rs []reply
+	for start := 0; start == 0 || start < len(zones); start += maxExtendedZones {
+		end := min(start+maxExtendedZones, len(zones))
+		b := make([]byte, 2+2+1+maxExtendedZones*encodedColorLength)
+		binary.LittleEndian.PutUint16(b[0:2], uint16(len(zones)))
+		binary.LittleEndian.PutUint16(b[2:4], uint16(start))
+		b[4] = uint8(end - start)
+		for i, c := range zones[start:end] {
+			off := 5 + i*encodedColorLength
+			c.encode(b[off : off+encodedColorLength])
+		}
+		rs = append(rs, reply{pktStateExtendedColorZones, b})
+	}
+	return rs
+}
@@ -0,0 +1,223 @@
+package lifx_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+	"github.com/dsymonds/lifx/protocol"
+)
+
+func TestVirtualDevice(t *testing.T) {
+	vd, dev, ctx := newTestDevice(t, lifxtest.NewStrip(8))
+	vd.SetLabel("Virtual")
+
+	if label, err := dev.GetLabel(ctx); err != nil || label != "Virtual" {
+		t.Errorf("GetLabel = %q, %v; want %q, nil", label, err, "Virtual")
+	}
+	if err := dev.SetLabel(ctx, "Renamed"); err != nil {
+		t.Errorf("SetLabel: %v", err)
+	}
+	if label, err := dev.GetLabel(ctx); err != nil || label != "Renamed" {
+		t.Errorf("after SetLabel, GetLabel = %q, %v; want %q, nil", label, err, "Renamed")
+	}
+
+	var echo [64]byte
+	copy(echo[:], "hello")
+	if _, err := dev.Echo(ctx, echo); err != nil {
+		t.Errorf("Echo: %v", err)
+	}
+	if ps, err := dev.Ping(ctx, 3); err != nil || ps.Received != 3 {
+		t.Errorf("Ping = %v, %v; want 3 received", ps, err)
+	}
+
+	// Raw messages.
+	if payload, err := dev.Request(ctx, protocol.GetLabel, protocol.StateLabel, nil); err != nil || strings.TrimRight(string(payload), "\x00") != "Renamed" {
+		t.Errorf("Request(GetLabel) = %q, %v; want %q, nil", payload, err, "Renamed")
+	}
+	if err := dev.Send(ctx, protocol.SetPower, []byte{0xFF, 0xFF}); err != nil {
+		t.Errorf("Send(SetPower): %v", err)
+	}
+	if _, err := dev.Request(ctx, protocol.GetInfrared, protocol.StateInfrared, nil); !errors.Is(err, lifx.ErrUnhandled) {
+		t.Errorf("Request(GetInfrared) = %v, want ErrUnhandled", err)
+	}
+
+	if err := dev.SetLightPower(ctx, 0xFFFF, time.Second); err != nil {
+		t.Errorf("SetLightPower: %v", err)
+	}
+	if got, err := dev.GetLightPower(ctx); err != nil || got != 0xFFFF {
+		t.Errorf("GetLightPower = %d, %v; want 65535, nil", got, err)
+	}
+	if err := dev.SetPower(ctx, 0); err != nil {
+		t.Errorf("SetPower: %v", err)
+	}
+	if got, err := dev.GetPower(ctx); err != nil || got != 0 {
+		t.Errorf("GetPower = %d, %v; want 0, nil", got, err)
+	}
+	if err := dev.SetPower(ctx, 0xFFFF); err != nil {
+		t.Errorf("SetPower: %v", err)
+	}
+
+	want := lifx.Color{Hue: 100, Saturation: 200, Brightness: 300, Kelvin: 3500}
+	if err := dev.SetColor(ctx, want, time.Second); err != nil {
+		t.Errorf("SetColor: %v", err)
+	}
+	if got, err := dev.GetColor(ctx); err != nil || got != want {
+		t.Errorf("GetColor = %+v, %v; want %+v, nil", got, err, want)
+	}
+	want.Hue = 500
+	if got, err := dev.SetColorVerified(ctx, want, 0); err != nil || got != want {
+		t.Errorf("SetColorVerified = %+v, %v; want %+v, nil", got, err, want)
+	}
+	if got, err := dev.SetLightPowerVerified(ctx, 0xFFFF, 0); err != nil || got != 0xFFFF {
+		t.Errorf("SetLightPowerVerified = %d, %v; want 65535, nil", got, err)
+	}
+
+	zones := make([]lifx.Color, 8)
+	for i := range zones {
+		zones[i] = lifx.Color{Hue: uint16(i), Kelvin: 3500}
+	}
+	if err := dev.SetExtendedColorZones(ctx, 0, zones); err != nil {
+		t.Errorf("SetExtendedColorZones: %v", err)
+	}
+	if got, err := dev.GetExtendedColorZones(ctx); err != nil || !reflect.DeepEqual(got, zones) {
+		t.Errorf("GetExtendedColorZones = %+v, %v; want %+v, nil", got, err, zones)
+	}
+
+	if vendor, product, err := dev.GetVersion(ctx); err != nil || vendor != 1 || product != 32 {
+		t.Errorf("GetVersion = %d, %d, %v; want 1, 32, nil", vendor, product, err)
+	}
+	if _, err := dev.GetWifiInfo(ctx); !errors.Is(err, lifx.ErrUnhandled) {
+		t.Errorf("GetWifiInfo = %v, want ErrUnhandled", err)
+	}
+}
+
+func TestVirtualZoneApplication(t *testing.T) {
+	strip := lifxtest.NewStrip(4)
+	_, dev, ctx := newTestDevice(t, strip)
+
+	// setZones sends a raw SetExtendedColorZones message for zones starting at index.
+	red := lifx.Color{Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	setZones := func(apply lifx.ZoneApplication, index, count int) {
+		t.Helper()
+		payload := []byte{0, 0, 0, 0, byte(apply), byte(index), 0, byte(count)}
+		for i := 0; i < count; i++ {
+			payload = append(payload, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0xAC, 0x0D) // red
+		}
+		if err := dev.Send(ctx, protocol.SetExtendedColorZones, payload); err != nil {
+			t.Fatalf("Send(SetExtendedColorZones): %v", err)
+		}
+	}
+
+	setZones(lifx.NoApply, 0, 2)
+	if got := strip.Zones(); got[0] != (lifx.Color{}) {
+		t.Errorf("after NoApply, zone 0 = %+v, want unchanged", got[0])
+	}
+	setZones(lifx.NoApply, 2, 1)
+	setZones(lifx.ApplyOnly, 3, 1) // its zones are ignored
+	want := []lifx.Color{red, red, red, {}}
+	if got := strip.Zones(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after ApplyOnly, zones = %+v, want %+v", got, want)
+	}
+	setZones(lifx.Apply, 3, 1)
+	if got := strip.Zones()[3]; got != red {
+		t.Errorf("after Apply, zone 3 = %+v, want %+v", got, red)
+	}
+}
+
+func TestRawPayloadTooLong(t *testing.T) {
+	_, dev, ctx := newTestDevice(t, &lifxtest.Light{})
+
+	payload := make([]byte, protocol.MaxPayloadLength+1)
+	if err := dev.Send(ctx, protocol.SetLabel, payload); err == nil {
+		t.Errorf("Send with a %d byte payload succeeded, want error", len(payload))
+	}
+	if _, err := dev.Request(ctx, protocol.GetLabel, protocol.StateLabel, payload); err == nil {
+		t.Errorf("Request with a %d byte payload succeeded, want error", len(payload))
+	}
+}
+
+func TestVirtualInvalidLabel(t *testing.T) {
+	_, dev, ctx := newTestDevice(t, &lifxtest.Light{})
+
+	// Like real devices, an invalid label set by a client is echoed back as it was.
+	raw := make([]byte, 32)
+	copy(raw, "bad \xff label")
+	if err := dev.Send(ctx, protocol.SetLabel, raw); err != nil {
+		t.Fatalf("Send(SetLabel): %v", err)
+	}
+	label, err := dev.Request(ctx, protocol.GetLabel, protocol.StateLabel, nil)
+	if err != nil {
+		t.Fatalf("Request(GetLabel): %v", err)
+	}
+	state, err := dev.Request(ctx, protocol.GetColor, protocol.LightState, nil)
+	if err != nil {
+		t.Fatalf("Request(GetColor): %v", err)
+	}
+	if got := state[12:44]; !reflect.DeepEqual(got, raw) || !reflect.DeepEqual(label, raw) {
+		t.Errorf("StateLabel has %q and LightState has %q, want both %q", label, got, raw)
+	}
+}
+
+// FuzzVirtualDevice checks that a VirtualDevice copes with arbitrary messages.
+func FuzzVirtualDevice(f *testing.F) {
+	const maxZones = 82                    // in a SetExtendedColorZones message
+	const maxZonesPayload = 8 + maxZones*8 // header fields, then 8 bytes per color
+	for _, typ := range []protocol.Type{
+		protocol.SetPower, protocol.SetLightPower, protocol.SetLabel, protocol.SetGroup, protocol.SetColor, protocol.SetExtendedColorZones,
+	} {
+		f.Add(uint16(typ), []byte{})
+		f.Add(uint16(typ), make([]byte, maxZonesPayload))
+	}
+	zones := make([]byte, maxZonesPayload)
+	zones[5], zones[6], zones[7] = 0xFF, 0xFF, maxZones
+	f.Add(uint16(protocol.SetExtendedColorZones), zones)
+
+	f.Fuzz(func(t *testing.T, typ uint16, payload []byte) {
+		vd := &lifx.VirtualDevice{Light: lifxtest.NewStrip(8)}
+		vd.HandleForTest(protocol.Header{Type: protocol.Type(typ), ResRequired: true}, payload)
+	})
+}
+
+func TestVirtualMatrix(t *testing.T) {
+	m := lifxtest.NewMatrix(5, 6)
+	_, dev, ctx := newTestDevice(t, m)
+
+	chain, err := dev.GetDeviceChain(ctx)
+	if err != nil {
+		t.Fatalf("GetDeviceChain: %v", err)
+	}
+	if len(chain.Tiles) != 1 || chain.Tiles[0].Width != 5 || chain.Tiles[0].Height != 6 {
+		t.Errorf("GetDeviceChain = %+v, want one 5x6 tile", chain)
+	}
+
+	// A 2-wide rectangle at (3, 4) covers (3, 4), (4, 4), (3, 5) and (4, 5);
+	// the rest of the 64 colors fall off the tile.
+	c := lifx.Color{Hue: 0x1234, Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+	rect := lifx.TileRect{X: 3, Y: 4, Width: 2}
+	if err := dev.Set64(ctx, rect, 0, []lifx.Color{c, c, c, c}); err != nil {
+		t.Fatalf("Set64: %v", err)
+	}
+	pixels := m.Pixels()
+	for i, p := range pixels {
+		x, y := i%5, i/5
+		want := lifx.Color{}
+		if x >= 3 && y >= 4 {
+			want = c
+		}
+		if p != want {
+			t.Errorf("pixel (%d, %d) = %+v, want %+v", x, y, p, want)
+		}
+	}
+	got, err := dev.Get64(ctx, rect)
+	if err != nil {
+		t.Fatalf("Get64: %v", err)
+	}
+	if want := []lifx.Color{c, c, c, c}; !reflect.DeepEqual(got[:4], want) {
+		t.Errorf("Get64 = %+v, want %+v", got[:4], want)
+	}
+}
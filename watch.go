@@ -0,0 +1,159 @@
+package lifx
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPollInterval is how often Watch, Mirror and StartRegistry
+// look at the network if given an interval that is not positive.
+const DefaultPollInterval = 5 * time.Second
+
+// watchMissLimit is how many consecutive sweeps a device may be absent from
+// before Watch considers it unreachable.
+const watchMissLimit = 3
+
+// WatchedState is the observed state of a device.
+type WatchedState struct {
+	Serial    [6]byte
+	Label     string
+	Power     uint16 // light power for lights, device power otherwise
+	Color     Color  // zero for non-lights
+	Reachable bool
+}
+
+// Event reports a change in a device's observed state.
+type Event struct {
+	Device *Device
+	Prev   *WatchedState // nil if the device was not seen before
+	State  WatchedState
+}
+
+// Watch repeatedly sweeps the network (see SweepState), taking each sweep
+// every interval, and reports changes in observed device state on the returned
+// channel. A device that misses several consecutive sweeps is reported with
+// Reachable set to false. If interval is not positive, DefaultPollInterval is used.
+//
+// The channel is closed once the context is done.
+// Slow receivers delay subsequent sweeps.
+func (c *Client) Watch(ctx context.Context, interval time.Duration) <-chan Event {
+	ch := make(chan Event)
+	go c.watch(ctx, interval, ch)
+	return ch
+}
+
+func (c *Client) watch(ctx context.Context, interval time.Duration, ch chan<- Event) {
+	defer close(ch)
+
+	type known struct {
+		dev    *Device
+		state  WatchedState
+		light  bool // whether a LightState has been seen
+		misses int
+	}
+	devs := make(map[[6]byte]*known)
+
+	send := func(ev Event) bool {
+		select {
+		case ch <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	poll(ctx, interval, func(sctx context.Context) bool {
+		swept, err := c.SweepState(sctx)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			// Transient, presumably. Try again next time.
+			swept = nil
+		}
+
+		seen := make(map[[6]byte]bool)
+		for _, ss := range swept {
+			serial := ss.Device.Serial
+			seen[serial] = true
+			st := WatchedState{
+				Serial:    serial,
+				Label:     ss.Label,
+				Power:     ss.Power,
+				Color:     ss.Color,
+				Reachable: true,
+			}
+			if ss.HasColor {
+				st.Power = ss.LightPower
+			}
+
+			k, ok := devs[serial]
+			if !ok {
+				devs[serial] = &known{dev: ss.Device, state: st, light: ss.HasColor}
+				if !send(Event{Device: ss.Device, State: st}) {
+					return false
+				}
+				continue
+			}
+			k.misses = 0
+			if ss.HasColor {
+				k.light = true
+			} else if k.light {
+				// The LightState response was lost; keep what we knew.
+				st.Label, st.Color = k.state.Label, k.state.Color
+				if !ss.HasPower {
+					st.Power = k.state.Power
+				}
+			}
+			if st != k.state {
+				prev := k.state
+				k.state = st
+				if !send(Event{Device: k.dev, Prev: &prev, State: st}) {
+					return false
+				}
+			}
+		}
+		for serial, k := range devs {
+			if seen[serial] || !k.state.Reachable {
+				continue
+			}
+			k.misses++
+			if k.misses < watchMissLimit {
+				continue
+			}
+			prev := k.state
+			k.state.Reachable = false
+			if !send(Event{Device: k.dev, Prev: &prev, State: k.state}) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// poll calls f every interval, or DefaultPollInterval if interval is not positive,
+// until the context is done or f returns false.
+// Each call gets a context that expires after most of the interval,
+// so that a sweep waits for responses for as long as it can
+// without delaying the next one.
+func poll(ctx context.Context, interval time.Duration, f func(ctx context.Context) bool) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, interval*3/4)
+		more := f(pctx)
+		cancel()
+		if !more {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
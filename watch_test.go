@@ -0,0 +1,24 @@
+package lifx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPollInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		calls := 0
+		poll(context.Background(), interval, func(ctx context.Context) bool {
+			calls++
+			deadline, ok := ctx.Deadline()
+			if want := time.Now().Add(DefaultPollInterval * 3 / 4); !ok || deadline.After(want) || deadline.Before(want.Add(-time.Second)) {
+				t.Errorf("poll with interval %v: call has deadline %v, %t; want about %v", interval, deadline, ok, want)
+			}
+			return false
+		})
+		if calls != 1 {
+			t.Errorf("poll with interval %v made %d calls, want 1", interval, calls)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// WifiInfo describes a device's Wi-Fi connection.
+type WifiInfo struct {
+	// Signal is the raw signal value reported by the device.
+	// Its meaning depends on the firmware; use Strength and Quality to interpret it.
+	Signal float32
+}
+
+// GetWifiInfo returns information about the device's Wi-Fi connection.
+func (d *Device) GetWifiInfo(ctx context.Context) (WifiInfo, error) {
+	payload, err := d.query(ctx, pktGetWifiInfo, pktStateWifiInfo, nil)
+	if err != nil {
+		return WifiInfo{}, err
+	}
+	return decodeWifiInfo(payload)
+}
+
+func decodeWifiInfo(payload []byte) (WifiInfo, error) {
+	if err := checkMinLength(pktStateWifiInfo, payload, 4); err != nil {
+		return WifiInfo{}, err
+	}
+	return WifiInfo{Signal: math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4]))}, nil
+}
+
+// Strength returns the signal strength in dB, and whether it is an RSSI
+// (in dBm, typically negative) rather than a signal-to-noise ratio.
+// Which one is reported depends on the device's firmware.
+//
+// https://lan.developer.lifx.com/docs/information-messages#statewifiinfo---packet-17
+func (wi WifiInfo) Strength() (db int, rssi bool) {
+	db = int(math.Floor(10*math.Log10(float64(wi.Signal)) + 0.5))
+	return db, db < 0 || db == 200
+}
+
+// SignalQuality is a coarse interpretation of a device's Wi-Fi signal.
+type SignalQuality int
+
+const (
+	NoSignal = SignalQuality(iota)
+	VeryBadSignal
+	BadSignal
+	AlrightSignal
+	GoodSignal
+)
+
+func (sq SignalQuality) String() string {
+	switch sq {
+	case NoSignal:
+		return "no signal"
+	case VeryBadSignal:
+		return "very bad"
+	case BadSignal:
+		return "bad"
+	case AlrightSignal:
+		return "alright"
+	case GoodSignal:
+		return "good"
+	}
+	return fmt.Sprintf("SignalQuality(%d)", int(sq))
+}
+
+// Quality interprets the signal strength following the LAN protocol documentation.
+func (wi WifiInfo) Quality() SignalQuality {
+	db, rssi := wi.Strength()
+	if rssi {
+		switch {
+		case db == 200:
+			return NoSignal
+		case db <= -80:
+			return VeryBadSignal
+		case db <= -70:
+			return BadSignal
+		case db <= -60:
+			return AlrightSignal
+		}
+		return GoodSignal
+	}
+	switch {
+	case db <= 3:
+		return NoSignal
+	case db <= 6:
+		return VeryBadSignal
+	case db <= 11:
+		return BadSignal
+	case db <= 16:
+		return AlrightSignal
+	}
+	return GoodSignal
+}
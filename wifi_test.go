@@ -0,0 +1,29 @@
+package lifx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWifiQuality(t *testing.T) {
+	tests := []struct {
+		db   float64 // the signal is reported as a linear ratio
+		want SignalQuality
+	}{
+		{-85, VeryBadSignal},
+		{-72, BadSignal},
+		{-65, AlrightSignal},
+		{-50, GoodSignal},
+		{5, VeryBadSignal},
+		{10, BadSignal},
+		{14, AlrightSignal},
+		{25, GoodSignal},
+	}
+	for _, tc := range tests {
+		wi := WifiInfo{Signal: float32(math.Pow(10, tc.db/10))}
+		if got := wi.Quality(); got != tc.want {
+			db, rssi := wi.Strength()
+			t.Errorf("Quality of %v dB = %v (strength %d, rssi=%t), want %v", tc.db, got, db, rssi, tc.want)
+		}
+	}
+}
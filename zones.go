@@ -0,0 +1,136 @@
+package lifx
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ZoneInfo describes the zones of a multi-zone device, as determined by ProbeZones.
+type ZoneInfo struct {
+	Count    int  // number of zones; zero if the device is not multi-zone
+	Extended bool // whether the device supports the extended multi-zone messages
+}
+
+// ProbeZones determines empirically whether the device has zones, how many,
+// and whether it supports the extended multi-zone messages.
+// This is useful for devices that are newer than the product data
+// (see DetermineProduct), or whose product data is incomplete.
+func (d *Device) ProbeZones(ctx context.Context) (ZoneInfo, error) {
+	payload, err := d.query(ctx, pktGetExtendedColorZones, pktStateExtendedColorZones, nil)
+	if err == nil {
+		if err := checkMinLength(pktStateExtendedColorZones, payload, 2); err != nil {
+			return ZoneInfo{}, err
+		}
+		return ZoneInfo{Count: int(binary.LittleEndian.Uint16(payload[0:2])), Extended: true}, nil
+	}
+	if !errors.Is(err, ErrUnhandled) {
+		return ZoneInfo{}, fmt.Errorf("GetExtendedColorZones: %w", err)
+	}
+
+	// Fall back to the legacy messages.
+	payload, err = d.query(ctx, pktGetColorZones, pktStateZone, []byte{0, 0})
+	if errors.Is(err, ErrUnhandled) {
+		return ZoneInfo{}, nil
+	} else if err != nil {
+		return ZoneInfo{}, fmt.Errorf("GetColorZones: %w", err)
+	}
+	if err := checkMinLength(pktStateZone, payload, 1); err != nil {
+		return ZoneInfo{}, err
+	}
+	return ZoneInfo{Count: int(payload[0])}, nil
+}
+
+// GetZones returns the colors of all the device's zones.
+// It uses the extended multi-zone messages where supported,
+// falling back to the legacy messages otherwise.
+// The returned error matches ErrUnhandled if the device is not multi-zone.
+func (d *Device) GetZones(ctx context.Context) ([]Color, error) {
+	zones, err := d.GetExtendedColorZones(ctx)
+	if !errors.Is(err, ErrUnhandled) {
+		return zones, err
+	}
+	return d.getLegacyZones(ctx)
+}
+
+// getLegacyZones reads zones with GetColorZones, eight at a time.
+func (d *Device) getLegacyZones(ctx context.Context) ([]Color, error) {
+	if err := d.requireFeature("multizone", hasMultizone); err != nil {
+		return nil, err
+	}
+	const perMsg = multiZoneColors
+	var zones []Color
+	for start := 0; start == 0 || start < len(zones); start += perMsg {
+		end := start + perMsg - 1
+		if end > 0xFF {
+			end = 0xFF
+		}
+		payload, err := d.query(ctx, pktGetColorZones, pktStateMultiZone, []byte{uint8(start), uint8(end)})
+		if err != nil {
+			return nil, fmt.Errorf("GetColorZones: %w", err)
+		}
+		count, index, colors, err := decodeMultiZone(payload)
+		if err != nil {
+			return nil, err
+		}
+		if zones == nil {
+			zones = make([]Color, count)
+		}
+		if count != len(zones) || index != start {
+			return nil, fmt.Errorf("inconsistent StateMultiZone: count=%d index=%d, want count=%d index=%d", count, index, len(zones), start)
+		}
+		for i := 0; i < len(colors) && index+i < count; i++ {
+			zones[index+i] = colors[i]
+		}
+	}
+	return zones, nil
+}
+
+// multiZoneColors is the number of colors in a StateMultiZone message.
+const multiZoneColors = 8
+
+// decodeMultiZone decodes a StateMultiZone payload.
+func decodeMultiZone(payload []byte) (count, index int, colors []Color, err error) {
+	if err := checkMinLength(pktStateMultiZone, payload, 2+multiZoneColors*encodedColorLength); err != nil {
+		return 0, 0, nil, err
+	}
+	colors = make([]Color, multiZoneColors)
+	for i := range colors {
+		off := 2 + i*encodedColorLength
+		colors[i].decode(payload[off : off+encodedColorLength])
+	}
+	return int(payload[0]), int(payload[1]), colors, nil
+}
+
+// SetZones sets the colors of all the device's zones.
+// It uses the extended multi-zone messages where supported,
+// falling back to the legacy messages (one per zone) otherwise.
+func (d *Device) SetZones(ctx context.Context, duration time.Duration, zones []Color) error {
+	// Journal the zones once, rather than once per message.
+	je := d.capture(ctx, pktSetExtendedColorZones)
+	ctx = withoutJournal(ctx)
+
+	err := d.SetExtendedColorZones(ctx, duration, zones)
+	if !errors.Is(err, ErrUnhandled) {
+		if err == nil {
+			d.journal(je)
+		}
+		return err
+	}
+	if len(zones) > 0x100 {
+		return fmt.Errorf("too many zones to set; %d > 256", len(zones))
+	}
+	for i, c := range zones {
+		apply := NoApply
+		if i == len(zones)-1 {
+			apply = Apply
+		}
+		if err := d.SetColorZones(ctx, uint8(i), uint8(i), c, duration, apply); err != nil {
+			return fmt.Errorf("SetColorZones: %w", err)
+		}
+	}
+	d.journal(je)
+	return nil
+}
@@ -0,0 +1,66 @@
+package lifx_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dsymonds/lifx"
+	"github.com/dsymonds/lifx/lifxtest"
+)
+
+func TestProbeZones(t *testing.T) {
+	// LIFX Z gained extended multizone support in firmware 2.77.
+	legacyFirmware := lifx.HostFirmware{Major: 2, Minor: 60}
+	for _, tc := range []struct {
+		desc     string
+		light    lifx.VirtualLight
+		firmware lifx.HostFirmware
+		want     lifx.ZoneInfo
+	}{
+		{"extended strip", lifxtest.NewStrip(20), lifx.HostFirmware{}, lifx.ZoneInfo{Count: 20, Extended: true}},
+		{"legacy strip", lifxtest.NewStrip(20), legacyFirmware, lifx.ZoneInfo{Count: 20}},
+		{"bulb", &lifxtest.Light{}, lifx.HostFirmware{}, lifx.ZoneInfo{}},
+	} {
+		n := lifxtest.NewNetwork(t)
+		ed := n.AddVirtual(&lifx.VirtualDevice{Serial: testSerial, Light: tc.light, Firmware: tc.firmware})
+		dev := n.Client().NewDevice(*ed.Addr(), ed.Serial)
+		if got, err := dev.ProbeZones(testContext(t)); err != nil || got != tc.want {
+			t.Errorf("%s: ProbeZones = %+v, %v; want %+v, nil", tc.desc, got, err, tc.want)
+		}
+	}
+}
+
+func TestZonesFallback(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		firmware lifx.HostFirmware
+	}{
+		{"extended", lifx.HostFirmware{}},
+		{"legacy", lifx.HostFirmware{Major: 2, Minor: 60}},
+	} {
+		// 20 zones don't fit in a whole number of legacy messages.
+		strip := lifxtest.NewStrip(20)
+		n := lifxtest.NewNetwork(t)
+		ed := n.AddVirtual(&lifx.VirtualDevice{Serial: testSerial, Light: strip, Firmware: tc.firmware})
+		// The legacy SetZones sends a message per zone; don't wait for the rate limit.
+		dev := n.Client(lifx.WithRateLimit(0, 0)).NewDevice(*ed.Addr(), ed.Serial)
+		ctx := testContext(t)
+
+		want := make([]lifx.Color, 20)
+		for i := range want {
+			want[i] = lifx.Color{Hue: uint16(i * 1000), Saturation: 0xFFFF, Brightness: 0xFFFF, Kelvin: 3500}
+		}
+		if err := dev.SetZones(ctx, 0, want); err != nil {
+			t.Fatalf("%s: SetZones: %v", tc.desc, err)
+		}
+		if got := strip.Zones(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: after SetZones, strip has zones\n%+v\nwant\n%+v", tc.desc, got, want)
+		}
+
+		strip.SetZones(5, []lifx.Color{{Kelvin: 9000}}, 0)
+		want[5] = lifx.Color{Kelvin: 9000}
+		if got, err := dev.GetZones(ctx); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: GetZones = %+v, %v\nwant %+v", tc.desc, got, err, want)
+		}
+	}
+}